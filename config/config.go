@@ -3,25 +3,48 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	MongoURI    string
-	MongoDBName string
-	JWTSecret   string
-	Port        string
+	MongoURI          string
+	MongoDBName       string
+	JWTSecret         string
+	Port              string
+	TaxRulesFile      string
+	DefaultTaxCountry string
+	PointsExpiryDays  int
+	PointValueCents   int
+	GiftClaimDays     int
+	AppURL            string
+	BorrowsPerMonth   int
+	BorrowDays        int
+	OpenLibraryURL    string
+	MetadataFixtures  string
+	UploadDir         string
 }
 
 func LoadConfig() *Config {
 	_ = godotenv.Load()
 
 	config := &Config{
-		MongoURI:    getEnv("MONGO_URI", "mongodb+srv://<username>:<password>@cluster.mongodb.net/?retryWrites=true&w=majority"),
-		MongoDBName: getEnv("MONGO_DB_NAME", "bookstore"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		Port:        getEnv("PORT", ":8080"),
+		MongoURI:          getEnv("MONGO_URI", "mongodb+srv://<username>:<password>@cluster.mongodb.net/?retryWrites=true&w=majority"),
+		MongoDBName:       getEnv("MONGO_DB_NAME", "bookstore"),
+		JWTSecret:         getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		Port:              getEnv("PORT", ":8080"),
+		TaxRulesFile:      getEnv("TAX_RULES_FILE", ""),
+		DefaultTaxCountry: getEnv("TAX_DEFAULT_COUNTRY", ""),
+		PointsExpiryDays:  getEnvInt("POINTS_EXPIRY_DAYS", 365),
+		PointValueCents:   getEnvInt("POINT_VALUE_CENTS", 1),
+		GiftClaimDays:     getEnvInt("GIFT_CLAIM_DAYS", 30),
+		AppURL:            getEnv("APP_URL", "http://localhost:8080"),
+		BorrowsPerMonth:   getEnvInt("PREMIUM_BORROWS_PER_MONTH", 2),
+		BorrowDays:        getEnvInt("PREMIUM_BORROW_DAYS", 14),
+		OpenLibraryURL:    getEnv("OPEN_LIBRARY_URL", "https://openlibrary.org"),
+		MetadataFixtures:  getEnv("METADATA_FIXTURES_FILE", ""),
+		UploadDir:         getEnv("UPLOAD_DIR", "./uploads"),
 	}
 
 	return config
@@ -35,3 +58,17 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Printf("Environment variable %s not set, using default value", key)
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Environment variable %s is not a number, using default value", key)
+		return defaultValue
+	}
+	return n
+}
@@ -1,11 +1,17 @@
 package db
 
 import (
+	"bookstore/models"
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -36,8 +42,9 @@ func Connect(mongoURI, dbName string) (*Database, error) {
 	log.Println("Successfully connected to MongoDB Atlas")
 
 	db := client.Database(dbName)
-	if err := createIndexes(ctx, db); err != nil {
-		log.Printf("Failed to create indexes: %v", err)
+	runMigrations(db)
+	if err := createIndexes(db); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
 	}
 
 	return &Database{
@@ -46,56 +53,853 @@ func Connect(mongoURI, dbName string) (*Database, error) {
 	}, nil
 }
 
-func createIndexes(ctx context.Context, db *mongo.Database) error {
+// Startup migrations and index builds scan whole collections, so each gets
+// far longer than connecting does.
+const (
+	migrationTimeout = 10 * time.Minute
+	indexTimeout     = 5 * time.Minute
+)
+
+// migrations rewrite data left by older versions. They run in order on
+// startup, before the indexes that depend on them are built, and each is
+// recorded in the migrations collection once it succeeds so it is not run
+// again. A failed migration is logged and retried on the next start.
+var migrations = []struct {
+	name string
+	run  func(context.Context, *mongo.Database) error
+}{
+	{"merge-digital-access", mergeDigitalAccess},
+	{"clear-purchase-expiry", clearPurchaseExpiry},
+	{"dedupe-authors", dedupeAuthors},
+	{"link-categories", linkCategories},
+	{"normalize-isbns", normalizeISBNs},
+	{"price-minor-units", priceMinorUnits},
+	{"count-returned-units", countReturnedUnits},
+	{"number-redemptions", numberRedemptions},
+	{"link-promotion-categories", linkPromotionCategories},
+	{"backfill-premium-until", backfillPremiumUntil},
+}
+
+func runMigrations(db *mongo.Database) {
+	migrationsCollection := db.Collection("migrations")
+	for _, m := range migrations {
+		ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+		err := migrationsCollection.FindOne(ctx, bson.M{"_id": m.name}).Err()
+		switch {
+		case err == nil:
+			// already applied
+		case err != mongo.ErrNoDocuments:
+			log.Printf("Failed to check migration %s: %v", m.name, err)
+		default:
+			started := time.Now()
+			if err := m.run(ctx, db); err != nil {
+				log.Printf("Migration %s failed: %v", m.name, err)
+				break
+			}
+			_, err := migrationsCollection.InsertOne(ctx, bson.M{"_id": m.name, "applied_at": time.Now()})
+			if err != nil {
+				log.Printf("Failed to record migration %s: %v", m.name, err)
+			}
+			log.Printf("Migration %s applied in %s", m.name, time.Since(started).Round(time.Millisecond))
+		}
+		cancel()
+	}
+}
+
+// createIndexes creates every index, giving each collection its own timeout
+// and carrying on past a failure, and returns the failures together.
+func createIndexes(db *mongo.Database) error {
+	var errs []error
+	create := func(collection *mongo.Collection, indexes ...mongo.IndexModel) {
+		ctx, cancel := context.WithTimeout(context.Background(), indexTimeout)
+		defer cancel()
+		if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", collection.Name(), err))
+		}
+	}
+
 	usersCollection := db.Collection("users")
 	usersIndexModel := []mongo.IndexModel{
 		{Keys: bson.D{{Key: "username", Value: 1}}},
 		{Keys: bson.D{{Key: "email", Value: 1}}},
 	}
-	_, err := usersCollection.Indexes().CreateMany(ctx, usersIndexModel)
-	if err != nil {
-		return err
-	}
+	create(usersCollection, usersIndexModel...)
 
 	formatsCollection := db.Collection("book_formats")
 	formatsIndexModel := []mongo.IndexModel{
 		{Keys: bson.D{{Key: "book_id", Value: 1}}},
 	}
-	_, err = formatsCollection.Indexes().CreateMany(ctx, formatsIndexModel)
-	if err != nil {
-		return err
-	}
+	create(formatsCollection, formatsIndexModel...)
 
 	ordersCollection := db.Collection("orders")
 	ordersIndexModel := []mongo.IndexModel{
 		{Keys: bson.D{{Key: "user_id", Value: 1}}},
 		{Keys: bson.D{{Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "preorder.status", Value: 1}}, Options: options.Index().SetSparse(true)},
 	}
-	_, err = ordersCollection.Indexes().CreateMany(ctx, ordersIndexModel)
-	if err != nil {
-		return err
-	}
+	create(ordersCollection, ordersIndexModel...)
 
 	itemsCollection := db.Collection("order_items")
 	itemsIndexModel := []mongo.IndexModel{
 		{Keys: bson.D{{Key: "order_id", Value: 1}}},
 	}
-	_, err = itemsCollection.Indexes().CreateMany(ctx, itemsIndexModel)
+	create(itemsCollection, itemsIndexModel...)
+
+	digitalCollection := db.Collection("digital_access")
+	digitalIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "book_id", Value: 1}, {Key: "format_type", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	create(digitalCollection, digitalIndexModel...)
+
+	promotionsCollection := db.Collection("promotions")
+	promotionsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "is_active", Value: 1}, {Key: "starts_at", Value: 1}}},
+	}
+	create(promotionsCollection, promotionsIndexModel...)
+
+	redemptionsCollection := db.Collection("promotion_redemptions")
+	redemptionsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "promotion_id", Value: 1}, {Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+		// a user's redemption slots of a promotion with a per-user limit
+		{
+			Keys:    bson.D{{Key: "promotion_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "slot", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"slot": bson.M{"$exists": true}}),
+		},
+	}
+	create(redemptionsCollection, redemptionsIndexModel...)
+
+	taxRulesCollection := db.Collection("tax_rules")
+	taxRulesIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "country", Value: 1}, {Key: "region", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	create(taxRulesCollection, taxRulesIndexModel...)
+
+	shippingMethodsCollection := db.Collection("shipping_methods")
+	shippingMethodsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	create(shippingMethodsCollection, shippingMethodsIndexModel...)
+
+	shipmentsCollection := db.Collection("shipments")
+	shipmentsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+		{Keys: bson.D{{Key: "tracking_number", Value: 1}}},
+	}
+	create(shipmentsCollection, shipmentsIndexModel...)
+
+	addressesCollection := db.Collection("addresses")
+	create(addressesCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "is_default", Value: -1}},
+	})
+
+	returnsCollection := db.Collection("returns")
+	returnsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "order_item_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+	}
+	create(returnsCollection, returnsIndexModel...)
+
+	refundsCollection := db.Collection("refunds")
+	create(refundsCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: "order_id", Value: 1}},
+	})
+
+	subscriptionsCollection := db.Collection("subscriptions")
+	subscriptionsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "current_period_end", Value: 1}}},
+		// at most one active or past_due subscription per user
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"status": bson.M{"$in": []string{models.SubscriptionStatusActive, models.SubscriptionStatusPastDue}},
+			}),
+		},
+	}
+	create(subscriptionsCollection, subscriptionsIndexModel...)
+
+	subscriptionEventsCollection := db.Collection("subscription_events")
+	create(subscriptionEventsCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "at", Value: -1}},
+	})
+
+	pointsLedgerCollection := db.Collection("points_ledger")
+	pointsLedgerIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}, {Key: "remaining", Value: 1}}},
+	}
+	create(pointsLedgerCollection, pointsLedgerIndexModel...)
+
+	loyaltyTiersCollection := db.Collection("loyalty_tiers")
+	create(loyaltyTiersCollection, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	notificationsCollection := db.Collection("notifications")
+	create(notificationsCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+
+	giftCardsCollection := db.Collection("gift_cards")
+	giftCardsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "purchased_by", Value: 1}, {Key: "created_at", Value: -1}}},
+	}
+	create(giftCardsCollection, giftCardsIndexModel...)
+
+	creditTransactionsCollection := db.Collection("credit_transactions")
+	creditTransactionsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "account", Value: 1}, {Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "gift_card_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	}
+	create(creditTransactionsCollection, creditTransactionsIndexModel...)
+
+	giftsCollection := db.Collection("gifts")
+	giftsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "sender_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "recipient_email", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+	}
+	create(giftsCollection, giftsIndexModel...)
+
+	rentalsCollection := db.Collection("rentals")
+	rentalsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	}
+	create(rentalsCollection, rentalsIndexModel...)
+
+	libraryEntriesCollection := db.Collection("library_entries")
+	libraryEntriesIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "book_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	create(libraryEntriesCollection, libraryEntriesIndexModel...)
+
+	authorsCollection := db.Collection("authors")
+	authorsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+	}
+	create(authorsCollection, authorsIndexModel...)
+
+	categoriesCollection := db.Collection("categories")
+	categoriesIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "parent_id", Value: 1}, {Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "ancestors", Value: 1}}},
+	}
+	create(categoriesCollection, categoriesIndexModel...)
+
+	seriesCollection := db.Collection("series")
+	create(seriesCollection, mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	booksCollection := db.Collection("books")
+	booksIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "authors.author_id", Value: 1}}},
+		{Keys: bson.D{{Key: "category_path", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "series_id", Value: 1}, {Key: "series_position", Value: 1}}},
+		{Keys: bson.D{{Key: "work_id", Value: 1}}},
+		{Keys: bson.D{{Key: "isbn", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "legacy_isbn", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "deleted_at", Value: -1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "release_date", Value: 1}}, Options: options.Index().SetSparse(true)},
+	}
+	create(booksCollection, booksIndexModel...)
+
+	catalogImportsCollection := db.Collection("catalog_imports")
+	create(catalogImportsCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: -1}},
+	})
+
+	bookRevisionsCollection := db.Collection("book_revisions")
+	create(bookRevisionsCollection, mongo.IndexModel{
+		Keys:    bson.D{{Key: "book_id", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	priceHistoryCollection := db.Collection("price_history")
+	create(priceHistoryCollection, mongo.IndexModel{
+		Keys: bson.D{{Key: "book_id", Value: 1}, {Key: "format_type", Value: 1}, {Key: "changed_at", Value: -1}},
+	})
+
+	wishlistCollection := db.Collection("wishlist")
+	create(wishlistCollection, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "book_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "added_at", Value: -1}}},
+	}...)
+
+	// job history is kept for 90 days
+	jobRunsCollection := db.Collection("job_runs")
+	jobRunsIndexModel := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "started_at", Value: -1}}},
+		{Keys: bson.D{{Key: "started_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(90 * 24 * 3600)},
+	}
+	create(jobRunsCollection, jobRunsIndexModel...)
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	log.Println("Database indexes created successfully")
+	return nil
+}
+
+// mergeDigitalAccess folds grants created before there was one per user,
+// book and format (every order added its own) into the oldest of them, so
+// the unique index can be built. It keeps the latest expiry.
+func mergeDigitalAccess(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection("digital_access")
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "access_granted_date", Value: 1}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "user_id", Value: "$user_id"}, {Key: "book_id", Value: "$book_id"}, {Key: "format_type", Value: "$format_type"}}},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "order_ids", Value: bson.D{{Key: "$push", Value: "$order_ids"}}},
+			{Key: "expiry_date", Value: bson.D{{Key: "$max", Value: "$expiry_date"}}},
+		}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "ids.1", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+	})
 	if err != nil {
 		return err
 	}
+	defer cursor.Close(ctx)
 
-	digitalCollection := db.Collection("digital_access")
-	digitalIndexModel := []mongo.IndexModel{
-		{Keys: bson.D{{Key: "user_id", Value: 1}}},
-		{Keys: bson.D{{Key: "format_id", Value: 1}}},
+	merged := 0
+	for cursor.Next(ctx) {
+		var group struct {
+			IDs        []primitive.ObjectID   `bson:"ids"`
+			OrderIDs   [][]primitive.ObjectID `bson:"order_ids"`
+			ExpiryDate *time.Time             `bson:"expiry_date"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return err
+		}
+		set := bson.M{}
+		if group.ExpiryDate != nil {
+			set["expiry_date"] = *group.ExpiryDate
+		}
+		var orderIDs []primitive.ObjectID
+		for _, ids := range group.OrderIDs {
+			orderIDs = append(orderIDs, ids...)
+		}
+		if len(orderIDs) > 0 {
+			set["order_ids"] = orderIDs
+		}
+		if len(set) > 0 {
+			if _, err := collection.UpdateOne(ctx, bson.M{"_id": group.IDs[0]}, bson.M{"$set": set}); err != nil {
+				return err
+			}
+		}
+		if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}}); err != nil {
+			return err
+		}
+		merged += len(group.IDs) - 1
+	}
+	if merged > 0 {
+		log.Printf("Merged %d duplicate digital access grants", merged)
 	}
-	_, err = digitalCollection.Indexes().CreateMany(ctx, digitalIndexModel)
+	return cursor.Err()
+}
+
+// clearPurchaseExpiry drops the one year expiry purchases used to get.
+// Only rentals expire now.
+func clearPurchaseExpiry(ctx context.Context, db *mongo.Database) error {
+	result, err := db.Collection("digital_access").UpdateMany(ctx,
+		bson.M{"format_type": bson.M{"$ne": "rental"}, "expiry_date": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"expiry_date": ""}},
+	)
 	if err != nil {
 		return err
 	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Cleared the expiry of %d purchased digital access grants", result.ModifiedCount)
+	}
+	return nil
+}
 
-	log.Println("Database indexes created successfully")
+// dedupeAuthors gives books saved with only a free-text author their author
+// credits. Spellings that normalize to the same key become one author,
+// named after the spelling most books use.
+func dedupeAuthors(ctx context.Context, db *mongo.Database) error {
+	books := db.Collection("books")
+	cursor, err := books.Find(ctx,
+		bson.M{"authors.0": bson.M{"$exists": false}, "author": bson.M{"$nin": bson.A{"", nil}}},
+		options.Find().SetProjection(bson.M{"_id": 1, "author": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	var pending []models.Book
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	spellings := map[string]map[string]int{}
+	for _, book := range pending {
+		for _, name := range models.SplitAuthorNames(book.Author) {
+			key := models.AuthorKey(name)
+			if key == "" {
+				continue
+			}
+			if spellings[key] == nil {
+				spellings[key] = map[string]int{}
+			}
+			spellings[key][name]++
+		}
+	}
+
+	authors := db.Collection("authors")
+	byKey := map[string]models.Author{}
+	for key, counts := range spellings {
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if counts[names[i]] != counts[names[j]] {
+				return counts[names[i]] > counts[names[j]]
+			}
+			return names[i] < names[j]
+		})
+
+		now := time.Now()
+		var author models.Author
+		err := authors.FindOneAndUpdate(ctx,
+			bson.M{"key": key},
+			bson.M{"$setOnInsert": bson.M{"name": names[0], "key": key, "created_at": now, "updated_at": now}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&author)
+		if err != nil {
+			return err
+		}
+		byKey[key] = author
+	}
+
+	updated := 0
+	for _, book := range pending {
+		credits := []models.BookAuthor{}
+		seen := map[string]bool{}
+		for _, name := range models.SplitAuthorNames(book.Author) {
+			key := models.AuthorKey(name)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			author := byKey[key]
+			credits = append(credits, models.BookAuthor{AuthorID: author.ID, Name: author.Name, Role: models.AuthorRoleAuthor})
+		}
+		if len(credits) == 0 {
+			continue
+		}
+		_, err := books.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{"$set": bson.M{
+			"authors": credits,
+			"author":  models.AuthorLine(credits),
+		}})
+		if err != nil {
+			return err
+		}
+		updated++
+	}
+	log.Printf("Linked %d books to %d authors", updated, len(byKey))
+	return nil
+}
+
+// linkCategories turns the free-text categories of books saved before the
+// category tree into root categories, one per name ignoring case and
+// spacing, and files the books under them.
+func linkCategories(ctx context.Context, db *mongo.Database) error {
+	books := db.Collection("books")
+	names, err := books.Distinct(ctx, "category", bson.M{
+		"category_id": bson.M{"$exists": false},
+		"category":    bson.M{"$nin": bson.A{"", nil}},
+	})
+	if err != nil {
+		return err
+	}
+
+	categories := db.Collection("categories")
+	linked := int64(0)
+	for _, value := range names {
+		name, ok := value.(string)
+		key := models.NameKey(name)
+		if !ok || key == "" {
+			continue
+		}
+
+		now := time.Now()
+		var category models.Category
+		err := categories.FindOneAndUpdate(ctx,
+			bson.M{"parent_id": nil, "key": key},
+			bson.M{"$setOnInsert": bson.M{
+				"name":       strings.Join(strings.Fields(name), " "),
+				"ancestors":  bson.A{},
+				"created_at": now,
+				"updated_at": now,
+			}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&category)
+		if err != nil {
+			return err
+		}
+
+		result, err := books.UpdateMany(ctx,
+			bson.M{"category_id": bson.M{"$exists": false}, "category": name},
+			bson.M{"$set": bson.M{
+				"category":      category.Name,
+				"category_id":   category.ID,
+				"category_path": category.Path(),
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		linked += result.ModifiedCount
+	}
+	if linked > 0 {
+		log.Printf("Filed %d books under categories", linked)
+	}
+	return nil
+}
+
+// normalizeISBNs rewrites stored ISBNs as ISBN-13 without hyphens so the
+// unique index can be built. Empty ISBNs are removed. An ISBN that fails its
+// check digit, or that an older book already has, is moved to legacy_isbn
+// and logged; GET /admin/books/isbn-issues lists them until they are fixed.
+func normalizeISBNs(ctx context.Context, db *mongo.Database) error {
+	books := db.Collection("books")
+	cursor, err := books.Find(ctx,
+		bson.M{"isbn": bson.M{"$exists": true}},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+			SetProjection(bson.M{"isbn": 1, "title": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	seen := map[string]primitive.ObjectID{}
+	normalized, setAside := 0, 0
+	for cursor.Next(ctx) {
+		var book struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			ISBN  interface{}        `bson:"isbn"`
+			Title string             `bson:"title"`
+		}
+		if err := cursor.Decode(&book); err != nil {
+			return err
+		}
+		raw, _ := book.ISBN.(string)
+		if strings.TrimSpace(raw) == "" {
+			if _, err := books.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{"$unset": bson.M{"isbn": ""}}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		isbn, ok := models.ISBN13(raw)
+		if ok {
+			if other, taken := seen[isbn]; taken {
+				log.Printf("Book %s (%q) has ISBN %s, which belongs to book %s; moved to legacy_isbn", book.ID.Hex(), book.Title, raw, other.Hex())
+				ok = false
+			}
+		} else {
+			log.Printf("Book %s (%q) has invalid ISBN %q; moved to legacy_isbn", book.ID.Hex(), book.Title, raw)
+		}
+		if !ok {
+			_, err := books.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{
+				"$set":   bson.M{"legacy_isbn": raw},
+				"$unset": bson.M{"isbn": ""},
+			})
+			if err != nil {
+				return err
+			}
+			setAside++
+			continue
+		}
+
+		seen[isbn] = book.ID
+		if isbn != raw {
+			if _, err := books.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{"$set": bson.M{"isbn": isbn}}); err != nil {
+				return err
+			}
+			normalized++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if normalized > 0 || setAside > 0 {
+		log.Printf("Normalized %d ISBNs to ISBN-13; set aside %d invalid or duplicate ISBNs", normalized, setAside)
+	}
+	return nil
+}
+
+// priceMinorUnits rewrites prices and order totals stored as decimals in
+// cents. Only values still stored as doubles are converted, so running it
+// twice does no harm. Price changes in revisions recorded before the switch
+// keep showing decimals; their snapshots are converted so rollbacks work.
+func priceMinorUnits(ctx context.Context, db *mongo.Database) error {
+	cents := func(value string) bson.M {
+		return bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{value, 100}}, 0}}}
+	}
+	centsIfDouble := func(value string) bson.M {
+		return bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{bson.M{"$type": value}, "double"}}, cents(value), value}}
+	}
+	formats := func(path string) bson.M {
+		return bson.M{"$map": bson.M{
+			"input": "$" + path,
+			"as":    "f",
+			"in": bson.M{"$mergeObjects": bson.A{"$$f", bson.M{
+				"price": centsIfDouble("$$f.price"),
+				"rental_prices": bson.M{"$cond": bson.A{
+					bson.M{"$isArray": "$$f.rental_prices"},
+					bson.M{"$map": bson.M{
+						"input": "$$f.rental_prices",
+						"as":    "r",
+						"in":    bson.M{"$mergeObjects": bson.A{"$$r", bson.M{"price": centsIfDouble("$$r.price")}}},
+					}},
+					"$$REMOVE",
+				}},
+			}}},
+		}}
+	}
+
+	fields := []struct{ collection, field string }{
+		{"orders", "total_amount"},
+		{"order_items", "price"},
+		{"price_history", "price"},
+		{"daily_stats", "revenue"},
+	}
+	for _, f := range fields {
+		result, err := db.Collection(f.collection).UpdateMany(ctx,
+			bson.M{f.field: bson.M{"$type": "double"}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{f.field: cents("$" + f.field)}}}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			log.Printf("Converted %s.%s of %d documents to cents", f.collection, f.field, result.ModifiedCount)
+		}
+	}
+
+	for _, c := range []struct{ collection, path string }{
+		{"books", "formats"},
+		{"book_revisions", "snapshot.formats"},
+	} {
+		result, err := db.Collection(c.collection).UpdateMany(ctx,
+			bson.M{"$or": bson.A{
+				bson.M{c.path + ".price": bson.M{"$type": "double"}},
+				bson.M{c.path + ".rental_prices.price": bson.M{"$type": "double"}},
+			}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{c.path: formats(c.path)}}}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			log.Printf("Converted format prices of %d %s to cents", result.ModifiedCount, c.collection)
+		}
+	}
+	return nil
+}
+
+// countReturnedUnits sets returned_quantity on order items from the returns
+// still holding units of them, so new returns are checked against it.
+func countReturnedUnits(ctx context.Context, db *mongo.Database) error {
+	cursor, err := db.Collection("returns").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$in": bson.A{
+			models.ReturnStatusRequested,
+			models.ReturnStatusApproved,
+			models.ReturnStatusReceived,
+			models.ReturnStatusRefunded,
+		}}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$order_item_id", "quantity": bson.M{"$sum": "$quantity"}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var counts []struct {
+		ItemID   primitive.ObjectID `bson:"_id"`
+		Quantity int                `bson:"quantity"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return err
+	}
+	for _, count := range counts {
+		_, err := db.Collection("order_items").UpdateOne(ctx,
+			bson.M{"_id": count.ItemID},
+			bson.M{"$set": bson.M{"returned_quantity": count.Quantity}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if len(counts) > 0 {
+		log.Printf("Counted returned units of %d order items", len(counts))
+	}
+	return nil
+}
+
+// numberRedemptions gives existing redemptions of promotions with a
+// per-user limit their slot numbers, oldest first, so they count against
+// the limit.
+func numberRedemptions(ctx context.Context, db *mongo.Database) error {
+	cursor, err := db.Collection("promotions").Find(ctx,
+		bson.M{"per_user_limit": bson.M{"$gt": 0}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	var limited []models.Promotion
+	if err := cursor.All(ctx, &limited); err != nil {
+		return err
+	}
+	if len(limited) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, len(limited))
+	for i, p := range limited {
+		ids[i] = p.ID
+	}
+
+	redemptions := db.Collection("promotion_redemptions")
+	cursor, err = redemptions.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"promotion_id": bson.M{"$in": ids}, "slot": bson.M{"$exists": false}}}},
+		{{Key: "$sort", Value: bson.M{"created_at": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"promotion_id": "$promotion_id", "user_id": "$user_id"},
+			"ids": bson.M{"$push": "$_id"},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	var groups []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return err
+	}
+	numbered := 0
+	for _, g := range groups {
+		for i, id := range g.IDs {
+			if _, err := redemptions.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"slot": i + 1}}); err != nil {
+				return err
+			}
+			numbered++
+		}
+	}
+	if numbered > 0 {
+		log.Printf("Numbered %d redemptions of promotions with a per-user limit", numbered)
+	}
+	return nil
+}
+
+// linkPromotionCategories resolves the category names of promotion scopes
+// saved before categories became a tree, so the promotions cover their
+// subcategories. A name used in more than one place in the tree is left
+// matching by name only.
+func linkPromotionCategories(ctx context.Context, db *mongo.Database) error {
+	promotions := db.Collection("promotions")
+	cursor, err := promotions.Find(ctx, bson.M{
+		"scope.categories.0":   bson.M{"$exists": true},
+		"scope.category_ids.0": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+	var pending []models.Promotion
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+
+	categories := db.Collection("categories")
+	linked := 0
+	for _, p := range pending {
+		var ids []primitive.ObjectID
+		for _, name := range p.Scope.Categories {
+			cursor, err := categories.Find(ctx, bson.M{"key": models.NameKey(name)}, options.Find().SetLimit(2))
+			if err != nil {
+				return err
+			}
+			var found []models.Category
+			if err := cursor.All(ctx, &found); err != nil {
+				return err
+			}
+			if len(found) == 1 {
+				ids = append(ids, found[0].ID)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if _, err := promotions.UpdateOne(ctx, bson.M{"_id": p.ID}, bson.M{"$set": bson.M{"scope.category_ids": ids}}); err != nil {
+			return err
+		}
+		linked++
+	}
+	if linked > 0 {
+		log.Printf("Linked the scope categories of %d promotions", linked)
+	}
+	return nil
+}
+
+// backfillPremiumUntil gives an end date to premium members stored without
+// one, which no longer counts as premium. Members with a current
+// subscription get its period end, or the end of the grace period when it
+// is past due. Members with no subscription, who were made premium by hand,
+// keep premium for another 30 days, the length of the old purchase.
+func backfillPremiumUntil(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	cursor, err := users.Find(ctx, bson.M{"is_premium": true, "premium_until": nil}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var pending []models.User
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+
+	subscriptions := db.Collection("subscriptions")
+	fallback := time.Now().AddDate(0, 0, 30)
+	for _, u := range pending {
+		until := fallback
+		var sub models.Subscription
+		err := subscriptions.FindOne(ctx, bson.M{
+			"user_id": u.ID,
+			"status":  bson.M{"$in": []string{models.SubscriptionStatusActive, models.SubscriptionStatusPastDue}},
+		}).Decode(&sub)
+		switch {
+		case err == nil && sub.GraceUntil != nil:
+			until = *sub.GraceUntil
+		case err == nil:
+			until = sub.CurrentPeriodEnd
+		case err != mongo.ErrNoDocuments:
+			return err
+		}
+		if _, err := users.UpdateOne(ctx, bson.M{"_id": u.ID, "premium_until": nil}, bson.M{"$set": bson.M{"premium_until": until}}); err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("Backfilled the premium end date of %d users", len(pending))
+	}
 	return nil
 }
 
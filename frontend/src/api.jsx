@@ -2,6 +2,10 @@ import axios from 'axios';
 
 const API_BASE_URL = 'http://localhost:8080/api' || '/api';
 
+// Prices and totals come from the API in cents.
+export const fromCents = (cents) => (cents || 0) / 100;
+export const toCents = (amount) => Math.round((parseFloat(amount) || 0) * 100);
+
 const apiClient = axios.create({
   baseURL: API_BASE_URL,
   headers: {
@@ -55,12 +59,21 @@ export const orderAPI = {
 export const digitalAPI = {
   getPersonalLibrary: () =>
     apiClient.get('/library'),
-  getDigitalBookAccess: (formatId) =>
-    apiClient.get(`/library/${formatId}`),
+  getLibraryBook: (bookId) =>
+    apiClient.get(`/library/${bookId}`),
   listAvailableDigitalBooks: () =>
     apiClient.get('/digital-books'),
 };
 
+export const wishlistAPI = {
+  getWishlist: () =>
+    apiClient.get('/users/me/wishlist'),
+  addToWishlist: (bookId) =>
+    apiClient.post('/users/me/wishlist', { book_id: bookId }),
+  removeFromWishlist: (bookId) =>
+    apiClient.delete(`/users/me/wishlist/${bookId}`),
+};
+
 export const adminAPI = {
   getStats: () =>
     apiClient.get('/admin/stats'),
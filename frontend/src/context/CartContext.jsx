@@ -1,4 +1,5 @@
 import React, { createContext, useState, useEffect } from 'react'
+import { fromCents } from '../api.jsx'
 
 export const CartContext = createContext()
 
@@ -29,7 +30,7 @@ export const CartProvider = ({ children }) => {
             return [...prevCart, {
                 bookId: id,
                 formatType: format.type,
-                price: format.price,
+                price: fromCents(format.price),
                 quantity: 1,
                 bookTitle: book.title || book.Title,
                 type: format.type,
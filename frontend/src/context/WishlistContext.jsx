@@ -1,39 +1,98 @@
 import React, { createContext, useState, useEffect } from 'react'
+import { wishlistAPI } from '../api.jsx'
+import { useAuth } from './AuthContext'
 
 export const WishlistContext = createContext()
 
+// Guests keep their wishlist in localStorage; it moves to the account on login.
 const STORAGE_KEY = 'bookstore_wishlist'
 
+const readLocal = () => {
+    try {
+        const raw = localStorage.getItem(STORAGE_KEY)
+        if (!raw) return []
+        const parsed = JSON.parse(raw)
+        return Array.isArray(parsed) ? parsed : []
+    } catch {
+        return []
+    }
+}
+
+const writeLocal = (ids) => localStorage.setItem(STORAGE_KEY, JSON.stringify(ids))
+
+const bookIdOf = (bookId) => typeof bookId === 'string' ? bookId : (bookId?.id || bookId?._id)
+
 export const WishlistProvider = ({ children }) => {
-    const [ids, setIds] = useState(() => {
-        try {
-            const raw = localStorage.getItem(STORAGE_KEY)
-            if (!raw) return []
-            const parsed = JSON.parse(raw)
-            return Array.isArray(parsed) ? parsed : []
-        } catch {
-            return []
-        }
-    })
+    const { user, loading } = useAuth()
+    const userId = user?.id
+    const [ids, setIds] = useState(readLocal)
 
     useEffect(() => {
-        localStorage.setItem(STORAGE_KEY, JSON.stringify(ids))
-    }, [ids])
+        if (loading) return
+        if (!userId) {
+            setIds(readLocal())
+            return
+        }
+
+        let cancelled = false
+        const sync = async () => {
+            const local = readLocal()
+            for (const id of local) {
+                try {
+                    await wishlistAPI.addToWishlist(id)
+                } catch (error) {
+                    // Books that were deleted or do not fit are dropped.
+                    console.error('Failed to move wishlist book', id, error)
+                }
+            }
+            if (local.length > 0) localStorage.removeItem(STORAGE_KEY)
 
-    const add = (bookId) => {
-        const id = typeof bookId === 'string' ? bookId : (bookId?.id || bookId?._id)
+            try {
+                const response = await wishlistAPI.getWishlist()
+                if (!cancelled) setIds((response.data || []).map(b => b.id))
+            } catch (error) {
+                console.error('Failed to load wishlist', error)
+            }
+        }
+        sync()
+        return () => { cancelled = true }
+    }, [userId, loading])
+
+    const add = async (bookId) => {
+        const id = bookIdOf(bookId)
         if (!id) return
+        if (ids.includes(id)) return
         setIds(prev => prev.includes(id) ? prev : [...prev, id])
+        if (!userId) {
+            writeLocal([...ids, id])
+            return
+        }
+        try {
+            await wishlistAPI.addToWishlist(id)
+        } catch (error) {
+            setIds(prev => prev.filter(x => x !== id))
+            alert(error.response?.data?.error || 'Failed to add to wishlist')
+        }
     }
 
-    const remove = (bookId) => {
-        const id = typeof bookId === 'string' ? bookId : (bookId?.id || bookId?._id)
+    const remove = async (bookId) => {
+        const id = bookIdOf(bookId)
         if (!id) return
         setIds(prev => prev.filter(x => x !== id))
+        if (!userId) {
+            writeLocal(ids.filter(x => x !== id))
+            return
+        }
+        try {
+            await wishlistAPI.removeFromWishlist(id)
+        } catch (error) {
+            setIds(prev => prev.includes(id) ? prev : [...prev, id])
+            alert(error.response?.data?.error || 'Failed to remove from wishlist')
+        }
     }
 
     const has = (bookId) => {
-        const id = typeof bookId === 'string' ? bookId : (bookId?.id || bookId?._id)
+        const id = bookIdOf(bookId)
         return id ? ids.includes(id) : false
     }
 
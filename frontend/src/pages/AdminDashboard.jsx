@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react'
 import { useNavigate } from 'react-router-dom'
-import { adminAPI, bookAPI } from '../api.jsx'
+import { adminAPI, bookAPI, fromCents, toCents } from '../api.jsx'
 import { useAuth } from '../context/AuthContext'
 import { LineChart, Line, XAxis, YAxis, CartesianGrid, Tooltip, Legend, ResponsiveContainer, BarChart, Bar } from 'recharts'
 
@@ -37,7 +37,7 @@ export default function AdminDashboard() {
     const fetchWeeklyStats = async () => {
         try {
             const res = await adminAPI.getWeeklySales()
-            setWeeklyStats(res.data || [])
+            setWeeklyStats((res.data || []).map(d => ({ ...d, revenue: fromCents(d.revenue), tax: fromCents(d.tax) })))
         } catch {
             setWeeklyStats([])
         }
@@ -179,7 +179,7 @@ export default function AdminDashboard() {
             published_year: book.published_year || '',
             isbn: book.isbn || '',
             category: book.category || '',
-            formats: (book.formats && book.formats.length) ? book.formats.map(f => ({ type: f.type, price: f.price || 0, stock_quantity: f.stock_quantity || 0, access_url: f.access_url || '' })) : defaultFormats.map(f => ({ ...f })),
+            formats: (book.formats && book.formats.length) ? book.formats.map(f => ({ type: f.type, price: fromCents(f.price), stock_quantity: f.stock_quantity || 0, access_url: f.access_url || '' })) : defaultFormats.map(f => ({ ...f })),
         })
         setShowBookForm(true)
     }
@@ -196,7 +196,7 @@ export default function AdminDashboard() {
             category: bookForm.category || undefined,
             formats: bookForm.formats.filter(f => f.type).map(f => ({
                 type: f.type,
-                price: parseFloat(f.price) || 0,
+                price: toCents(f.price),
                 stock_quantity: parseInt(f.stock_quantity, 10) || 0,
                 access_url: f.access_url || undefined,
             })),
@@ -260,7 +260,7 @@ export default function AdminDashboard() {
                             <div className="card stat-card"><p>Total Books</p><h2>{stats.total_books}</h2></div>
                             <div className="card stat-card"><p>Total Orders</p><h2>{stats.total_orders}</h2></div>
                             <div className="card stat-card"><p>Premium Users</p><h2>{stats.premium_users}</h2></div>
-                            <div className="card stat-card"><p>Total Revenue</p><h2>${(stats.total_revenue || 0).toFixed(2)}</h2></div>
+                            <div className="card stat-card"><p>Total Revenue</p><h2>${fromCents(stats.total_revenue).toFixed(2)}</h2></div>
                             <div className="card stat-card"><p>Admins</p><h2>{stats.admins}</h2></div>
                             <div className="card stat-card"><p>Moderators</p><h2>{stats.moderators}</h2></div>
                             <div className="card stat-card"><p>Pending Orders</p><h2>{stats.pending_orders}</h2></div>
@@ -442,7 +442,7 @@ export default function AdminDashboard() {
                                         <tr key={orderId(order)}>
                                             <td>{(orderId(order)).toString().slice(0, 8)}...</td>
                                             <td>{(order.user_id || order.userId || '').toString().slice(0, 8)}...</td>
-                                            <td>${(order.total_amount || 0).toFixed(2)}</td>
+                                            <td>${fromCents(order.total_amount).toFixed(2)}</td>
                                             <td>
                                                 <select value={order.status} onChange={e => handleUpdateOrderStatus(orderId(order), e.target.value)} style={{ padding: '0.5rem' }}>
                                                     <option value="Pending">Pending</option>
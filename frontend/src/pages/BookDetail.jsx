@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react'
 import { useParams, useNavigate } from 'react-router-dom'
-import { bookAPI } from '../api.jsx'
+import { bookAPI, fromCents } from '../api.jsx'
 import { useCart } from '../context/CartContext'
 import { useWishlist } from '../context/WishlistContext'
 
@@ -90,7 +90,7 @@ export default function BookDetail() {
                                     <div key={format.type} className="format-block">
                                         <div className="format-header">
                                             <span className="format-type">{format.type}</span>
-                                            <span className="format-price">${format.price.toFixed(2)}</span>
+                                            <span className="format-price">${fromCents(format.price).toFixed(2)}</span>
                                         </div>
                                         <p className="format-stock">Stock: {format.stock_quantity}</p>
                                         {format.stock_quantity > 0 ? (
@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react'
 import { Link } from 'react-router-dom'
-import { bookAPI } from '../api.jsx'
+import { bookAPI, fromCents } from '../api.jsx'
 import { useCart } from '../context/CartContext'
 import { useWishlist } from '../context/WishlistContext'
 
@@ -110,7 +110,7 @@ export default function Books() {
                                     <div className="book-formats">
                                         {book.formats.map((f) => (
                                             <div key={f.type} className="book-format-row">
-                                                <span>{f.type} ${f.price.toFixed(2)}</span>
+                                                <span>{f.type} ${fromCents(f.price).toFixed(2)}</span>
                                                 {f.stock_quantity > 0 && (
                                                     <button
                                                         className="btn btn-success btn-small"
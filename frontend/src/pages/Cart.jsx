@@ -14,7 +14,17 @@ export default function Cart() {
     const [loading, setLoading] = useState(false)
     const [error, setError] = useState('')
     const [success, setSuccess] = useState('')
-    const [deliveryAddress, setDeliveryAddress] = useState('')
+    const [address, setAddress] = useState({ full_name: '', line1: '', line2: '', city: '', region: '', postal_code: '', country: '' })
+
+    const addressFields = [
+        { name: 'full_name', placeholder: 'Full name' },
+        { name: 'line1', placeholder: 'Street address' },
+        { name: 'line2', placeholder: 'Apartment, suite (optional)' },
+        { name: 'city', placeholder: 'City' },
+        { name: 'region', placeholder: 'State / region' },
+        { name: 'postal_code', placeholder: 'Postal code' },
+        { name: 'country', placeholder: 'Country code (e.g. US)' },
+    ]
 
     const hasPhysicalFormat = cart.some(item => item.formatType === 'physical' || item.formatType === 'both')
 
@@ -27,7 +37,7 @@ export default function Cart() {
             setError('Cart is empty')
             return
         }
-        if (hasPhysicalFormat && !deliveryAddress.trim()) {
+        if (hasPhysicalFormat && !(address.full_name.trim() && address.line1.trim() && address.city.trim() && address.country.trim())) {
             setError('Please enter a delivery address for physical books')
             return
         }
@@ -42,7 +52,7 @@ export default function Cart() {
             // Include delivery address if physical books in cart
             const orderData = { items }
             if (hasPhysicalFormat) {
-                orderData.delivery_address = deliveryAddress
+                orderData.shipping_address = address
             }
             await orderAPI.createOrder(orderData)
             setSuccess('Order placed successfully!')
@@ -154,22 +164,24 @@ export default function Cart() {
                                     <p style={{ margin: '0 0 0.5rem 0', fontSize: '0.9rem', fontWeight: 'bold', color: '#856404' }}>
                                         📦 Delivery Address Required
                                     </p>
-                                    <textarea
-                                        placeholder="Enter your delivery address (Street, City, Postal Code, etc.)"
-                                        value={deliveryAddress}
-                                        onChange={(e) => setDeliveryAddress(e.target.value)}
-                                        style={{
-                                            width: '100%',
-                                            padding: '0.75rem',
-                                            borderRadius: '4px',
-                                            border: '1px solid #ced4da',
-                                            fontSize: '0.85rem',
-                                            fontFamily: 'inherit',
-                                            boxSizing: 'border-box',
-                                            minHeight: '80px',
-                                            resize: 'vertical'
-                                        }}
-                                    />
+                                    {addressFields.map((field) => (
+                                        <input
+                                            key={field.name}
+                                            placeholder={field.placeholder}
+                                            value={address[field.name]}
+                                            onChange={(e) => setAddress({ ...address, [field.name]: e.target.value })}
+                                            style={{
+                                                width: '100%',
+                                                padding: '0.5rem 0.75rem',
+                                                marginBottom: '0.5rem',
+                                                borderRadius: '4px',
+                                                border: '1px solid #ced4da',
+                                                fontSize: '0.85rem',
+                                                fontFamily: 'inherit',
+                                                boxSizing: 'border-box'
+                                            }}
+                                        />
+                                    ))}
                                     <small style={{ display: 'block', color: '#666', marginTop: '0.25rem' }}>
                                         This address will be used for physical book delivery
                                     </small>
@@ -36,7 +36,7 @@ export default function Library() {
     return (
         <div className="page">
             <div className="container">
-                <h1 className="page-title">My Digital Library</h1>
+                <h1 className="page-title">My Library</h1>
 
                 {error && <div className="alert alert-danger">{error}</div>}
 
@@ -47,23 +47,33 @@ export default function Library() {
                 ) : (
                     <div className="grid grid-2">
                         {library.books.map((book) => (
-                            <div key={book.id} className="card">
-                                <h3 className="card-title">{book.book_title}</h3>
-                                <p className="card-subtitle">{book.book_author}</p>
+                            <div key={book.book_id} className="card">
+                                <h3 className="card-title">{book.title}</h3>
+                                <p className="card-subtitle">{book.author}</p>
 
                                 <div style={{ margin: '1rem 0', padding: '1rem', backgroundColor: '#f0f0f0', borderRadius: '4px' }}>
                                     <p style={{ fontSize: '0.9rem', marginBottom: '0.5rem' }}>
-                                        <strong>Format:</strong> {book.format}
+                                        <strong>Formats:</strong> {book.formats.map((f) => f.type).join(', ')}
                                     </p>
-                                    <p style={{ fontSize: '0.9rem' }}>
-                                        <strong>Accessed:</strong> {new Date(book.accessed_date).toLocaleDateString()}
+                                    <p style={{ fontSize: '0.9rem', marginBottom: '0.5rem' }}>
+                                        <strong>Added:</strong> {new Date(book.acquired_at).toLocaleDateString()}
                                     </p>
+                                    {book.progress && (
+                                        <p style={{ fontSize: '0.9rem', marginBottom: '0.5rem' }}>
+                                            <strong>Progress:</strong> {Math.round(book.progress.percent)}%
+                                        </p>
+                                    )}
+                                    {book.shelves.length > 0 && (
+                                        <p style={{ fontSize: '0.9rem' }}>
+                                            <strong>Shelves:</strong> {book.shelves.join(', ')}
+                                        </p>
+                                    )}
                                 </div>
 
                                 <div className="card-footer">
-                                    {book.access_url ? (
+                                    {book.formats.some((f) => f.access_url) ? (
                                         <a
-                                            href={book.access_url}
+                                            href={book.formats.find((f) => f.access_url).access_url}
                                             target="_blank"
                                             rel="noopener noreferrer"
                                             className="btn btn-primary btn-small"
@@ -71,7 +81,7 @@ export default function Library() {
                                             Access Now
                                         </a>
                                     ) : (
-                                        <button className="btn btn-secondary btn-small" disabled>Not available</button>
+                                        <button className="btn btn-secondary btn-small" disabled>Physical copy</button>
                                     )}
                                 </div>
                             </div>
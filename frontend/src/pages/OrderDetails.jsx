@@ -1,6 +1,6 @@
 import React, { useEffect, useState } from 'react';
 import { useParams, useNavigate } from 'react-router-dom';
-import { orderAPI } from '../api';
+import { orderAPI, fromCents } from '../api';
 
 export default function OrderDetails() {
     const { orderId } = useParams();
@@ -155,7 +155,7 @@ export default function OrderDetails() {
                                                     Qty: {item.quantity}
                                                 </p>
                                                 <p style={{ margin: 0, fontWeight: 'bold', color: '#2c3e50', fontSize: '1.1rem' }}>
-                                                    ${(item.price * item.quantity).toFixed(2)}
+                                                    ${fromCents(item.price * item.quantity).toFixed(2)}
                                                 </p>
                                             </div>
                                         </div>
@@ -215,7 +215,7 @@ export default function OrderDetails() {
                                 <div style={{ display: 'flex', justifyContent: 'space-between', marginBottom: '0.5rem' }}>
                                     <span style={{ color: '#7f8c8d' }}>Subtotal:</span>
                                     <span style={{ fontWeight: 'bold', color: '#2c3e50' }}>
-                                        ${order.total_amount ? order.total_amount.toFixed(2) : '0.00'}
+                                        ${fromCents(order.total_amount).toFixed(2)}
                                     </span>
                                 </div>
                             </div>
@@ -223,7 +223,7 @@ export default function OrderDetails() {
                             <div style={{ display: 'flex', justifyContent: 'space-between', fontSize: '1.2rem', fontWeight: 'bold' }}>
                                 <span style={{ color: '#2c3e50' }}>Total:</span>
                                 <span style={{ color: '#e74c3c' }}>
-                                    ${order.total_amount ? order.total_amount.toFixed(2) : '0.00'}
+                                    ${fromCents(order.total_amount).toFixed(2)}
                                 </span>
                             </div>
 
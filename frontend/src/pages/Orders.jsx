@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react'
 import { useNavigate } from 'react-router-dom'
-import { orderAPI } from '../api.jsx'
+import { orderAPI, fromCents } from '../api.jsx'
 
 export default function Orders() {
     const navigate = useNavigate()
@@ -157,7 +157,7 @@ export default function Orders() {
                                                     <span style={{ color: '#999', fontSize: '0.9rem' }}>—</span>
                                                 )}
                                             </td>
-                                            <td>${order.total_amount?.toFixed(2) || '0.00'}</td>
+                                            <td>${fromCents(order.total_amount).toFixed(2)}</td>
                                             <td>{order.items?.length || 0} item(s)</td>
                                             <td style={{ display: 'flex', gap: '0.5rem', flexWrap: 'wrap' }}>
                                                 <button
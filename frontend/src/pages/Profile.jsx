@@ -97,9 +97,8 @@ export default function Profile() {
         setProcessing(true)
         setMessage('')
         try {
-            // Call cancel premium API (we need to create this endpoint)
             await userAPI.cancelPremium()
-            setMessage('✓ Your premium membership has been cancelled.')
+            setMessage('✓ Your premium membership has been cancelled. Benefits remain until the end of the current period.')
             setTimeout(() => window.location.reload(), 2000)
         } catch (err) {
             setMessage(err.response?.data?.error || 'Failed to cancel premium')
@@ -233,8 +232,9 @@ export default function Profile() {
                                             display: 'inline-block',
                                             padding: '0.3rem 0.8rem',
                                             borderRadius: '20px',
-                                            backgroundColor: user.loyalty_level === 'Platinum' ? '#E5E4E2' : user.loyalty_level === 'Gold' ? '#FFD700' : user.loyalty_level === 'Silver' ? '#C0C0C0' : '#A0826D',
-                                            color: user.loyalty_level === 'Gold' ? '#333' : 'white',
+                                            backgroundColor: user.loyalty_color || '#A0826D',
+                                            color: 'white',
+                                            textShadow: '0 0 2px rgba(0, 0, 0, 0.6)',
                                             fontSize: '0.9rem',
                                             fontWeight: 'bold'
                                         }}
@@ -252,6 +252,10 @@ export default function Profile() {
                                 </div>
                             )}
 
+                            {user.loyalty_tier?.free_shipping && (
+                                <p style={{ marginBottom: '1.5rem', color: '#2c3e50', fontSize: '0.9rem' }}>🚚 Free shipping on every order</p>
+                            )}
+
                             {user.is_premium && (
                                 <div>
                                     <div style={{ padding: '1.2rem', backgroundColor: '#d5f4e6', borderRadius: '8px', marginBottom: '1.5rem', borderLeft: '4px solid #2ecc71', border: '2px solid #2ecc71' }}>
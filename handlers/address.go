@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AddressHandler struct {
+	addressesCollection *mongo.Collection
+}
+
+func NewAddressHandler(addressesCollection *mongo.Collection) *AddressHandler {
+	return &AddressHandler{
+		addressesCollection: addressesCollection,
+	}
+}
+
+func (h *AddressHandler) GetAddresses(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "is_default", Value: -1}, {Key: "created_at", Value: -1}})
+	cursor, err := h.addressesCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch addresses"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var addresses []models.SavedAddress
+	if err = cursor.All(ctx, &addresses); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode addresses"})
+		return
+	}
+
+	if addresses == nil {
+		addresses = []models.SavedAddress{}
+	}
+
+	c.JSON(http.StatusOK, addresses)
+}
+
+func (h *AddressHandler) CreateAddress(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.SavedAddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Address.Normalize()
+	if err := req.Address.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the first address a customer saves becomes the default
+	count, err := h.addressesCollection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	address := models.SavedAddress{
+		UserID:    userID,
+		Label:     strings.TrimSpace(req.Label),
+		Address:   req.Address,
+		IsDefault: req.IsDefault || count == 0,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	result, err := h.addressesCollection.InsertOne(ctx, address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+	address.ID = result.InsertedID.(primitive.ObjectID)
+
+	if address.IsDefault {
+		if err := h.setDefault(ctx, userID, address.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, address)
+}
+
+func (h *AddressHandler) UpdateAddress(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	addressID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	var req models.SavedAddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Address.Normalize()
+	if err := req.Address.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// orders keep their own snapshot, so editing here never changes past orders
+	result, err := h.addressesCollection.UpdateOne(ctx, bson.M{"_id": addressID, "user_id": userID}, bson.M{"$set": bson.M{
+		"label":      strings.TrimSpace(req.Label),
+		"address":    req.Address,
+		"updated_at": time.Now(),
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+
+	if req.IsDefault {
+		if err := h.setDefault(ctx, userID, addressID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address updated successfully"})
+}
+
+func (h *AddressHandler) SetDefaultAddress(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	addressID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := h.addressesCollection.CountDocuments(ctx, bson.M{"_id": addressID, "user_id": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+
+	if err := h.setDefault(ctx, userID, addressID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Default address updated"})
+}
+
+func (h *AddressHandler) DeleteAddress(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	addressID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var deleted models.SavedAddress
+	err = h.addressesCollection.FindOneAndDelete(ctx, bson.M{"_id": addressID, "user_id": userID}).Decode(&deleted)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		}
+		return
+	}
+
+	// promote the most recently added address when the default goes away
+	if deleted.IsDefault {
+		var next models.SavedAddress
+		opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+		if err := h.addressesCollection.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&next); err == nil {
+			_ = h.setDefault(ctx, userID, next.ID)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted successfully"})
+}
+
+func (h *AddressHandler) setDefault(ctx context.Context, userID, addressID primitive.ObjectID) error {
+	_, err := h.addressesCollection.UpdateMany(ctx, bson.M{"user_id": userID, "_id": bson.M{"$ne": addressID}}, bson.M{
+		"$set": bson.M{"is_default": false},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.addressesCollection.UpdateOne(ctx, bson.M{"_id": addressID}, bson.M{
+		"$set": bson.M{"is_default": true},
+	})
+	return err
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"bookstore/models"
+	"bookstore/services"
 	"context"
 	"net/http"
 	"time"
@@ -13,9 +15,10 @@ import (
 
 // WeeklySalesDayStat описывает статистику за день
 type WeeklySalesDayStat struct {
-	Date        string  `json:"date"`
-	OrdersCount int     `json:"orders_count"`
-	Revenue     float64 `json:"revenue"`
+	Date        string       `json:"date"`
+	OrdersCount int          `json:"orders_count"`
+	Revenue     models.Money `json:"revenue"`
+	Tax         models.Money `json:"tax"`
 }
 
 // GetWeeklySales возвращает статистику продаж за последние 7 дней по дням
@@ -37,6 +40,7 @@ func (h *AdminHandler) GetWeeklySales(c *gin.Context) {
 			{Key: "_id", Value: bson.D{{Key: "$dateToString", Value: bson.D{{Key: "format", Value: "%Y-%m-%d"}, {Key: "date", Value: "$created_at"}}}}},
 			{Key: "orders_count", Value: bson.D{{Key: "$sum", Value: 1}}},
 			{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$total_amount"}}},
+			{Key: "tax", Value: bson.D{{Key: "$sum", Value: "$pricing.tax"}}},
 		}}},
 		bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
 	}
@@ -52,15 +56,17 @@ func (h *AdminHandler) GetWeeklySales(c *gin.Context) {
 	statsMap := make(map[string]WeeklySalesDayStat)
 	for cursor.Next(ctx) {
 		var row struct {
-			ID          string  `bson:"_id"`
-			OrdersCount int     `bson:"orders_count"`
-			Revenue     float64 `bson:"revenue"`
+			ID          string       `bson:"_id"`
+			OrdersCount int          `bson:"orders_count"`
+			Revenue     models.Money `bson:"revenue"`
+			Tax         models.Money `bson:"tax"`
 		}
 		if err := cursor.Decode(&row); err == nil {
 			statsMap[row.ID] = WeeklySalesDayStat{
 				Date:        row.ID,
 				OrdersCount: row.OrdersCount,
 				Revenue:     row.Revenue,
+				Tax:         row.Tax,
 			}
 		}
 	}
@@ -88,13 +94,15 @@ type AdminHandler struct {
 	usersCollection  *mongo.Collection
 	booksCollection  *mongo.Collection
 	ordersCollection *mongo.Collection
+	loyaltyService   *services.LoyaltyService
 }
 
-func NewAdminHandler(usersCol, booksCol, ordersCol *mongo.Collection) *AdminHandler {
+func NewAdminHandler(usersCol, booksCol, ordersCol *mongo.Collection, loyaltyService *services.LoyaltyService) *AdminHandler {
 	return &AdminHandler{
 		usersCollection:  usersCol,
 		booksCollection:  booksCol,
 		ordersCollection: ordersCol,
+		loyaltyService:   loyaltyService,
 	}
 }
 
@@ -103,7 +111,7 @@ func (h *AdminHandler) GetStats(c *gin.Context) {
 	defer cancel()
 
 	totalUsers, _ := h.usersCollection.CountDocuments(ctx, bson.M{})
-	totalBooks, _ := h.booksCollection.CountDocuments(ctx, bson.M{})
+	totalBooks, _ := h.booksCollection.CountDocuments(ctx, bson.M{"deleted_at": nil})
 	totalOrders, _ := h.ordersCollection.CountDocuments(ctx, bson.M{})
 	premiumUsers, _ := h.usersCollection.CountDocuments(ctx, bson.M{"is_premium": true})
 	admins, _ := h.usersCollection.CountDocuments(ctx, bson.M{"role": "Admin"})
@@ -113,13 +121,17 @@ func (h *AdminHandler) GetStats(c *gin.Context) {
 	cancelledOrders, _ := h.ordersCollection.CountDocuments(ctx, bson.M{"status": "Cancelled"})
 
 	var revenueResult struct {
-		Total float64 `bson:"total"`
+		Total    models.Money `bson:"total"`
+		Tax      models.Money `bson:"tax"`
+		Refunded models.Money `bson:"refunded"`
 	}
 	pipeline := mongo.Pipeline{
 		bson.D{{Key: "$match", Value: bson.M{"status": "Completed"}}},
 		bson.D{{Key: "$group", Value: bson.D{
 			{Key: "_id", Value: nil},
 			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$total_amount"}}},
+			{Key: "tax", Value: bson.D{{Key: "$sum", Value: "$pricing.tax"}}},
+			{Key: "refunded", Value: bson.D{{Key: "$sum", Value: "$refunded_amount"}}},
 		}}},
 	}
 	cursor, _ := h.ordersCollection.Aggregate(ctx, pipeline)
@@ -133,7 +145,9 @@ func (h *AdminHandler) GetStats(c *gin.Context) {
 		"total_books":      totalBooks,
 		"total_orders":     totalOrders,
 		"premium_users":    premiumUsers,
-		"total_revenue":    revenueResult.Total,
+		"total_revenue":    revenueResult.Total - revenueResult.Refunded,
+		"total_tax":        revenueResult.Tax,
+		"total_refunded":   revenueResult.Refunded,
 		"admins":           admins,
 		"moderators":       moderators,
 		"pending_orders":   pendingOrders,
@@ -184,36 +198,6 @@ func (h *AdminHandler) DeactivateUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "User deactivated"})
 }
 
-func (h *AdminHandler) UpgradeToPremium(c *gin.Context) {
-	userID := c.Param("id")
-	objID, _ := primitive.ObjectIDFromHex(userID)
-
-	var req struct {
-		Days int `json:"days" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	premiumUntil := time.Now().AddDate(0, 0, req.Days)
-	_, err := h.usersCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
-		"$set": bson.M{
-			"is_premium":    true,
-			"premium_until": premiumUntil,
-		},
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "User upgraded to premium", "premium_until": premiumUntil})
-}
-
 func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
 	userID := c.Param("id")
 	objID, _ := primitive.ObjectIDFromHex(userID)
@@ -271,14 +255,20 @@ func (h *AdminHandler) UpdateOrderStatus(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := h.ordersCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
+	var order models.Order
+	err := h.ordersCollection.FindOneAndUpdate(ctx, bson.M{"_id": objID}, bson.M{
 		"$set": bson.M{"status": req.Status},
-	})
-	if err != nil {
+	}).Decode(&order)
+	if err != nil && err != mongo.ErrNoDocuments {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// cancelled orders stop counting towards the loyalty tier
+	if err == nil && order.Status != req.Status {
+		_, _ = h.loyaltyService.Recalculate(ctx, order.UserID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Order status updated"})
 }
 
@@ -287,8 +277,7 @@ func (h *AdminHandler) UpdateDeliveryStatus(c *gin.Context) {
 	objID, _ := primitive.ObjectIDFromHex(orderID)
 
 	var req struct {
-		DeliveryStatus  string `json:"delivery_status" binding:"required,oneof=pending accepted in_transit delivered"`
-		DeliveryAddress string `json:"delivery_address"`
+		DeliveryStatus string `json:"delivery_status" binding:"required,oneof=pending accepted in_transit delivered"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -300,8 +289,7 @@ func (h *AdminHandler) UpdateDeliveryStatus(c *gin.Context) {
 
 	_, err := h.ordersCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
 		"$set": bson.M{
-			"delivery_status":  req.DeliveryStatus,
-			"delivery_address": req.DeliveryAddress,
+			"delivery_status": req.DeliveryStatus,
 		},
 	})
 	if err != nil {
@@ -3,6 +3,7 @@ package handlers
 import (
 	"bookstore/middleware"
 	"bookstore/models"
+	"bookstore/services"
 	"context"
 	"net/http"
 	"strings"
@@ -17,12 +18,14 @@ import (
 
 type AuthHandler struct {
 	usersCollection *mongo.Collection
+	loyaltyService  *services.LoyaltyService
 	jwtSecret       string
 }
 
-func NewAuthHandler(usersCollection *mongo.Collection, jwtSecret string) *AuthHandler {
+func NewAuthHandler(usersCollection *mongo.Collection, loyaltyService *services.LoyaltyService, jwtSecret string) *AuthHandler {
 	return &AuthHandler{
 		usersCollection: usersCollection,
+		loyaltyService:  loyaltyService,
 		jwtSecret:       jwtSecret,
 	}
 }
@@ -61,15 +64,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	newUser := models.User{
-		Username:     req.Username,
-		Email:        req.Email,
-		Password:     string(hashedPassword),
-		Role:         "Customer",
-		IsPremium:    false,
-		PremiumUntil: time.Now(),
-		IsActive:     true,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		Username:  req.Username,
+		Email:     req.Email,
+		Password:  string(hashedPassword),
+		Role:      "Customer",
+		IsPremium: false,
+		IsActive:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
 	}
 
 	result, err := h.usersCollection.InsertOne(ctx, newUser)
@@ -111,7 +113,11 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	loyaltyLevel, _, _ := middleware.GetLoyaltyLevel(user.LoyaltyPoints)
+	tier, err := h.loyaltyService.TierFor(ctx, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, middleware.Claims{
 		UserID:    user.ID,
@@ -138,9 +144,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		Token:         tokenString,
 		IsPremium:     user.IsPremium,
 		PremiumUntil:  user.PremiumUntil,
-		LoyaltyLevel:  loyaltyLevel,
 		LoyaltyPoints: user.LoyaltyPoints,
 	}
+	if tier != nil {
+		response.LoyaltyLevel = tier.Name
+		response.LoyaltyColor = tier.Color
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -166,20 +175,32 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	// compute loyalty level from points
-	loyaltyLevel, loyaltyDiscount, _ := middleware.GetLoyaltyLevel(user.LoyaltyPoints)
+	tier, err := h.loyaltyService.TierFor(ctx, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":               user.ID,
-		"username":         user.Username,
-		"email":            user.Email,
-		"role":             user.Role,
-		"is_premium":       user.IsPremium,
-		"premium_until":    user.PremiumUntil,
-		"loyalty_points":   user.LoyaltyPoints,
-		"loyalty_level":    loyaltyLevel,
-		"loyalty_discount": loyaltyDiscount,
-	})
+	profile := gin.H{
+		"id":             user.ID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"role":           user.Role,
+		"is_premium":     user.IsPremium,
+		"premium_until":  user.PremiumUntil,
+		"loyalty_points": user.LoyaltyPoints,
+		"loyalty_spend":  user.LoyaltySpend,
+		"profile_image":  user.ProfileImage,
+		"avatar":         user.Avatar,
+	}
+	if tier != nil {
+		profile["loyalty_level"] = tier.Name
+		profile["loyalty_discount"] = tier.Discount
+		profile["loyalty_color"] = tier.Color
+		profile["loyalty_tier"] = tier
+	}
+
+	c.JSON(http.StatusOK, profile)
 }
 
 func (h *AuthHandler) UpdateProfile(c *gin.Context) {
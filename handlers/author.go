@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuthorHandler struct {
+	authorService *services.AuthorService
+}
+
+func NewAuthorHandler(authorService *services.AuthorService) *AuthorHandler {
+	return &AuthorHandler{
+		authorService: authorService,
+	}
+}
+
+func (h *AuthorHandler) GetAuthors(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	authors, err := h.authorService.List(ctx, c.Query("search"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch authors"})
+		return
+	}
+	if authors == nil {
+		authors = []models.Author{}
+	}
+
+	c.JSON(http.StatusOK, authors)
+}
+
+// GetAuthorByID is the author page: the author and every book they are
+// credited on.
+func (h *AuthorHandler) GetAuthorByID(c *gin.Context) {
+	authorID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid author ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	author, err := h.authorService.Get(ctx, authorID)
+	if err != nil {
+		respondAuthorError(c, err)
+		return
+	}
+	books, err := h.authorService.Books(ctx, authorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		return
+	}
+	if books == nil {
+		books = []models.Book{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"author": author, "books": books})
+}
+
+func (h *AuthorHandler) CreateAuthor(c *gin.Context) {
+	var req models.AuthorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	author, err := h.authorService.Create(ctx, req)
+	if err != nil {
+		respondAuthorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, author)
+}
+
+// UpdateAuthor edits an author; a changed name is copied onto their books.
+func (h *AuthorHandler) UpdateAuthor(c *gin.Context) {
+	authorID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid author ID"})
+		return
+	}
+
+	var req models.AuthorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	author, err := h.authorService.Update(ctx, authorID, req)
+	if err != nil {
+		respondAuthorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, author)
+}
+
+func (h *AuthorHandler) DeleteAuthor(c *gin.Context) {
+	authorID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid author ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.authorService.Delete(ctx, authorID); err != nil {
+		respondAuthorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Author deleted successfully"})
+}
+
+// MergeAuthor folds a duplicate author into another one.
+func (h *AuthorHandler) MergeAuthor(c *gin.Context) {
+	authorID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid author ID"})
+		return
+	}
+
+	var req models.MergeAuthorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	intoID, err := primitive.ObjectIDFromHex(req.Into)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid author ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changed, err := h.authorService.Merge(ctx, authorID, intoID)
+	if err != nil {
+		respondAuthorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Authors merged", "books_updated": changed})
+}
+
+func respondAuthorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAuthorNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAuthorExists), errors.Is(err, services.ErrAuthorHasBooks):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidAuthor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update author"})
+	}
+}
@@ -1,12 +1,17 @@
 package handlers
 
 import (
+	"bookstore/middleware"
 	"bookstore/models"
+	"bookstore/services"
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,12 +21,22 @@ import (
 type BookHandler struct {
 	booksCollection  *mongo.Collection
 	ordersCollection *mongo.Collection
+	authorService    *services.AuthorService
+	categoryService  *services.CategoryService
+	seriesService    *services.SeriesService
+	archiveService   *services.BookArchiveService
+	revisionService  *services.RevisionService
 }
 
-func NewBookHandler(booksCollection, ordersCollection *mongo.Collection) *BookHandler {
+func NewBookHandler(booksCollection, ordersCollection *mongo.Collection, authorService *services.AuthorService, categoryService *services.CategoryService, seriesService *services.SeriesService, archiveService *services.BookArchiveService, revisionService *services.RevisionService) *BookHandler {
 	return &BookHandler{
 		booksCollection:  booksCollection,
 		ordersCollection: ordersCollection,
+		authorService:    authorService,
+		categoryService:  categoryService,
+		seriesService:    seriesService,
+		archiveService:   archiveService,
+		revisionService:  revisionService,
 	}
 }
 
@@ -32,39 +47,90 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateRentalFormats(req.Formats); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	authors, err := h.authorService.Resolve(ctx, req.Authors, req.Author)
+	if err != nil {
+		respondAuthorError(c, err)
+		return
+	}
+	category, ok := h.bookCategory(ctx, c, req.CategoryID, req.Category)
+	if !ok {
+		return
+	}
+	isbn := ""
+	if req.ISBN != "" {
+		if isbn, ok = h.bookISBN(ctx, c, req.ISBN, primitive.NilObjectID); !ok {
+			return
+		}
+	}
+	var seriesID, workID *primitive.ObjectID
+	if req.SeriesID != "" {
+		series, err := h.seriesService.Resolve(ctx, req.SeriesID)
+		if err != nil {
+			respondSeriesError(c, err)
+			return
+		}
+		seriesID = &series.ID
+	}
+	if req.EditionOf != "" {
+		id, err := h.seriesService.WorkOf(ctx, req.EditionOf)
+		if err != nil {
+			respondSeriesError(c, err)
+			return
+		}
+		workID = &id
+	}
+
 	formats := make([]models.BookFormat, len(req.Formats))
 	for i, f := range req.Formats {
-		formats[i] = models.BookFormat{
-			Type:          f.Type,
-			Price:         f.Price,
-			StockQuantity: f.StockQuantity,
-		}
+		formats[i] = f.BookFormat()
 	}
 
 	book := models.Book{
-		Title:         req.Title,
-		Author:        req.Author,
-		Description:   req.Description,
-		ImageURL:      req.ImageURL,
-		PublishedYear: req.PublishedYear,
-		ISBN:          req.ISBN,
-		Category:      req.Category,
-		Formats:       formats,
-		Rating:        0,
-		TotalRatings:  0,
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+		Title:          req.Title,
+		Author:         models.AuthorLine(authors),
+		Authors:        authors,
+		Description:    req.Description,
+		ImageURL:       req.ImageURL,
+		PublishedYear:  req.PublishedYear,
+		ISBN:           isbn,
+		Tags:           models.NormalizeTags(req.Tags),
+		SeriesID:       seriesID,
+		SeriesPosition: req.SeriesPosition,
+		WorkID:         workID,
+		Language:       req.Language,
+		TranslatedFrom: req.TranslatedFrom,
+		ReleaseDate:    req.ReleaseDate,
+		Formats:        formats,
+		Rating:         0,
+		TotalRatings:   0,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+
+	if category != nil {
+		book.Category = category.Name
+		book.CategoryID = &category.ID
+		book.CategoryPath = category.Path()
 	}
 
 	bookResult, err := h.booksCollection.InsertOne(ctx, book)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A book with this ISBN already exists"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
 		return
 	}
+	h.revisionService.Record(ctx, bookResult.InsertedID.(primitive.ObjectID), nil, models.RevisionCreate, editorID(c))
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Book created successfully",
@@ -78,17 +144,59 @@ func (h *BookHandler) GetBooks(c *gin.Context) {
 
 	query := c.Query("search")
 
-	filter := bson.M{}
+	filter := bson.M{"deleted_at": nil}
 	if query != "" {
-		filter = bson.M{
-			"$or": []bson.M{
-				{"title": bson.M{"$regex": query, "$options": "i"}},
-				{"author": bson.M{"$regex": query, "$options": "i"}},
-			},
+		filter["$or"] = []bson.M{
+			{"title": bson.M{"$regex": query, "$options": "i"}},
+			{"author": bson.M{"$regex": query, "$options": "i"}},
+		}
+	}
+	if authorID := c.Query("author_id"); authorID != "" {
+		id, err := primitive.ObjectIDFromHex(authorID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid author ID"})
+			return
+		}
+		filter["authors.author_id"] = id
+	}
+	if ref := c.Query("category"); ref != "" {
+		category, err := h.categoryService.Lookup(ctx, ref)
+		if err != nil {
+			respondCategoryError(c, err)
+			return
+		}
+		// the category and everything below it
+		filter["category_path"] = category.ID
+	}
+	if tag := c.Query("tag"); tag != "" {
+		filter["tags"] = models.NormalizeTag(tag)
+	}
+	opts := options.Find().SetLimit(100)
+	if seriesID := c.Query("series_id"); seriesID != "" {
+		id, err := primitive.ObjectIDFromHex(seriesID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid series ID"})
+			return
+		}
+		filter["series_id"] = id
+		opts.SetSort(bson.D{{Key: "series_position", Value: 1}, {Key: "published_year", Value: 1}})
+	}
+	if language := c.Query("language"); language != "" {
+		filter["language"] = language
+	}
+	// books with a format that can only be pre-ordered, soonest first
+	if upcoming, _ := strconv.ParseBool(c.Query("upcoming")); upcoming {
+		now := time.Now()
+		filter["$and"] = []bson.M{{"$or": []bson.M{
+			{"release_date": bson.M{"$gt": now}},
+			{"formats.release_date": bson.M{"$gt": now}},
+		}}}
+		if c.Query("series_id") == "" {
+			opts.SetSort(bson.D{{Key: "release_date", Value: 1}})
 		}
 	}
 
-	cursor, err := h.booksCollection.Find(ctx, filter, options.Find().SetLimit(100))
+	cursor, err := h.booksCollection.Find(ctx, filter, opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
 		return
@@ -108,6 +216,8 @@ func (h *BookHandler) GetBooks(c *gin.Context) {
 	c.JSON(http.StatusOK, books)
 }
 
+// GetBookByID also finds deleted books, with deleted_at set, so orders and
+// libraries can still show them.
 func (h *BookHandler) GetBookByID(c *gin.Context) {
 	bookID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
@@ -129,7 +239,86 @@ func (h *BookHandler) GetBookByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, book)
+	detail, err := h.bookDetail(ctx, book)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// GetBookByISBN looks a book up by ISBN-10 or ISBN-13, with or without
+// hyphens.
+func (h *BookHandler) GetBookByISBN(c *gin.Context) {
+	isbn, ok := models.ISBN13(c.Param("isbn"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var book models.Book
+	err := h.booksCollection.FindOne(ctx, bson.M{"isbn": isbn}).Decode(&book)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	detail, err := h.bookDetail(ctx, book)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// GetISBNIssues lists books whose ISBN was set aside on startup because it
+// was invalid or shared with an older book. Setting a valid ISBN on the
+// book clears it from the list.
+func (h *BookHandler) GetISBNIssues(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := h.booksCollection.Find(ctx,
+		bson.M{"legacy_isbn": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{Key: "title", Value: 1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var books []models.Book
+	if err := cursor.All(ctx, &books); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode books"})
+		return
+	}
+
+	issues := []models.ISBNIssue{}
+	for _, book := range books {
+		reason := "invalid"
+		if _, ok := models.ISBN13(book.LegacyISBN); ok {
+			reason = "duplicate"
+		}
+		issues = append(issues, models.ISBNIssue{
+			BookID:     book.ID,
+			Title:      book.Title,
+			Author:     book.Author,
+			LegacyISBN: book.LegacyISBN,
+			Reason:     reason,
+		})
+	}
+
+	c.JSON(http.StatusOK, issues)
 }
 
 func (h *BookHandler) UpdateBook(c *gin.Context) {
@@ -144,73 +333,296 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateRentalFormats(req.Formats); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
 	if req.Title != "" {
 		set["title"] = req.Title
 	}
-	if req.Author != "" {
-		set["author"] = req.Author
+	if len(req.Authors) > 0 || req.Author != "" {
+		authors, err := h.authorService.Resolve(ctx, req.Authors, req.Author)
+		if err != nil {
+			respondAuthorError(c, err)
+			return
+		}
+		set["authors"] = authors
+		set["author"] = models.AuthorLine(authors)
 	}
 	if req.Description != "" {
 		set["description"] = req.Description
 	}
 	if req.ImageURL != "" {
 		set["image_url"] = req.ImageURL
+		// a cover hosted elsewhere replaces an uploaded one
+		unset["cover"] = ""
 	}
 	if req.PublishedYear > 0 {
 		set["published_year"] = req.PublishedYear
 	}
 	if req.ISBN != "" {
-		set["isbn"] = req.ISBN
+		isbn, ok := h.bookISBN(ctx, c, req.ISBN, bookID)
+		if !ok {
+			return
+		}
+		set["isbn"] = isbn
+		unset["legacy_isbn"] = ""
+	}
+	if req.CategoryID != "" || req.Category != "" {
+		category, ok := h.bookCategory(ctx, c, req.CategoryID, req.Category)
+		if !ok {
+			return
+		}
+		set["category"] = category.Name
+		set["category_id"] = category.ID
+		set["category_path"] = category.Path()
+	}
+	if req.Tags != nil {
+		set["tags"] = models.NormalizeTags(req.Tags)
+	}
+	if req.SeriesID != "" {
+		series, err := h.seriesService.Resolve(ctx, req.SeriesID)
+		if err != nil {
+			respondSeriesError(c, err)
+			return
+		}
+		set["series_id"] = series.ID
 	}
-	if req.Category != "" {
-		set["category"] = req.Category
+	if req.SeriesPosition > 0 {
+		set["series_position"] = req.SeriesPosition
+	}
+	if req.EditionOf != "" {
+		if req.EditionOf == bookID.Hex() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A book cannot be an edition of itself"})
+			return
+		}
+		workID, err := h.seriesService.WorkOf(ctx, req.EditionOf)
+		if err != nil {
+			respondSeriesError(c, err)
+			return
+		}
+		set["work_id"] = workID
+	}
+	if req.Language != "" {
+		set["language"] = req.Language
+	}
+	if req.TranslatedFrom != "" {
+		set["translated_from"] = req.TranslatedFrom
+	}
+	if req.ReleaseDate != nil {
+		set["release_date"] = req.ReleaseDate
 	}
 	if len(req.Formats) > 0 {
 		formats := make([]models.BookFormat, len(req.Formats))
 		for i, f := range req.Formats {
-			formats[i] = models.BookFormat{Type: f.Type, Price: f.Price, StockQuantity: f.StockQuantity}
+			formats[i] = f.BookFormat()
 		}
 		set["formats"] = formats
 	}
-	result, err := h.booksCollection.UpdateOne(ctx, bson.M{"_id": bookID}, bson.M{"$set": set})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	var before models.Book
+	err = h.booksCollection.FindOneAndUpdate(ctx, bson.M{"_id": bookID}, update).Decode(&before)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A book with this ISBN already exists"})
 		return
 	}
-
-	if result.MatchedCount == 0 {
+	if err == mongo.ErrNoDocuments {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
+		return
+	}
+	h.revisionService.Record(ctx, bookID, &before, models.RevisionUpdate, editorID(c))
 
 	c.JSON(http.StatusOK, gin.H{"message": "Book updated successfully"})
 }
 
+// DeleteBook takes a book out of the catalog; it can be restored. With
+// ?permanent=true a book that is already deleted is removed for good,
+// which is refused with 409 while orders or libraries still point at it.
 func (h *BookHandler) DeleteBook(c *gin.Context) {
 	bookID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
 		return
 	}
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+	permanent, _ := strconv.ParseBool(c.DefaultQuery("permanent", "false"))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result, err := h.booksCollection.DeleteOne(ctx, bson.M{"_id": bookID})
+	if !permanent {
+		if err := h.archiveService.Delete(ctx, bookID, userID); err != nil {
+			respondArchiveError(c, err, nil)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Book deleted successfully"})
+		return
+	}
+
+	refs, err := h.archiveService.Purge(ctx, bookID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
+		respondArchiveError(c, err, refs)
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	c.JSON(http.StatusOK, gin.H{"message": "Book permanently deleted"})
+}
+
+func (h *BookHandler) RestoreBook(c *gin.Context) {
+	bookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Book deleted successfully"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.archiveService.Restore(ctx, bookID); err != nil {
+		respondArchiveError(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Book restored successfully"})
+}
+
+func (h *BookHandler) GetDeletedBooks(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	books, err := h.archiveService.Deleted(ctx, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		return
+	}
+	if books == nil {
+		books = []models.Book{}
+	}
+
+	c.JSON(http.StatusOK, books)
+}
+
+func respondArchiveError(c *gin.Context, err error, refs map[string]int64) {
+	switch {
+	case errors.Is(err, services.ErrBookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	case errors.Is(err, services.ErrBookNotDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBookReferenced):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "references": refs})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
+	}
+}
+
+// bookDetail adds the series links, other editions and lowest recent
+// prices to a book.
+func (h *BookHandler) bookDetail(ctx context.Context, book models.Book) (*models.BookDetail, error) {
+	detail, err := h.seriesService.Detail(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+	detail.LowestPrices, err = h.revisionService.LowestPrices(ctx, book, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// editorID is the user making a change, or nil when the request carries
+// none.
+func editorID(c *gin.Context) *primitive.ObjectID {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		return nil
+	}
+	return &userID
+}
+
+// bookCategory finds the category a book request names, by ID or by name.
+// It returns nil when the request names none.
+func (h *BookHandler) bookCategory(ctx context.Context, c *gin.Context, categoryID, name string) (*models.Category, bool) {
+	ref := categoryID
+	if ref == "" {
+		ref = name
+	}
+	if ref == "" {
+		return nil, true
+	}
+	category, err := h.categoryService.Lookup(ctx, ref)
+	if errors.Is(err, services.ErrCategoryNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown category"})
+		return nil, false
+	}
+	if err != nil {
+		respondCategoryError(c, err)
+		return nil, false
+	}
+	return category, true
+}
+
+// bookISBN validates an ISBN from a book request and returns it as an
+// ISBN-13, rejecting one that a book other than except already has.
+func (h *BookHandler) bookISBN(ctx context.Context, c *gin.Context, isbn string, except primitive.ObjectID) (string, bool) {
+	isbn13, ok := models.ISBN13(isbn)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN: expected an ISBN-10 or ISBN-13 with a valid check digit"})
+		return "", false
+	}
+	var other models.Book
+	err := h.booksCollection.FindOne(ctx, bson.M{"isbn": isbn13, "_id": bson.M{"$ne": except}}).Decode(&other)
+	if err == mongo.ErrNoDocuments {
+		return isbn13, true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return "", false
+	}
+	if other.DeletedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A deleted book has this ISBN; restore it instead", "book_id": other.ID})
+		return "", false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "A book with this ISBN already exists", "book_id": other.ID})
+	return "", false
+}
+
+// validateRentalFormats checks the rental prices of rental formats, which
+// binding does not reach because formats are not validated one by one.
+func validateRentalFormats(formats []models.BookFormatInput) error {
+	for _, f := range formats {
+		if f.Type != "rental" {
+			continue
+		}
+		if len(f.RentalPrices) == 0 {
+			return errors.New("rental formats need at least one rental price")
+		}
+		for _, p := range f.RentalPrices {
+			if err := binding.Validator.ValidateStruct(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
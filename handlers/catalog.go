@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxCatalogUploadBytes = 50 << 20
+	// files with up to this many rows are imported before the response;
+	// larger ones are imported in the background
+	syncImportRows = 200
+	importTimeout  = 30 * time.Minute
+)
+
+var catalogContentTypes = map[string]string{
+	models.CatalogFormatCSV:   "text/csv",
+	models.CatalogFormatJSONL: "application/x-ndjson",
+	models.CatalogFormatONIX:  "application/xml",
+}
+
+var catalogExtensions = map[string]string{
+	models.CatalogFormatCSV:   "csv",
+	models.CatalogFormatJSONL: "jsonl",
+	models.CatalogFormatONIX:  "xml",
+}
+
+type CatalogHandler struct {
+	catalogService *services.CatalogService
+}
+
+func NewCatalogHandler(catalogService *services.CatalogService) *CatalogHandler {
+	return &CatalogHandler{
+		catalogService: catalogService,
+	}
+}
+
+// ImportCatalog takes a multipart upload with the catalog in "file". The
+// format comes from "format" or the file extension; "dry_run=true" only
+// validates. Small files are imported before responding with 200, larger
+// ones in the background with a 202 whose import can be polled.
+func (h *CatalogHandler) ImportCatalog(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCatalogUploadBytes)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A catalog file of at most 50 MB is required in the file field"})
+		return
+	}
+	format := c.PostForm("format")
+	if format == "" {
+		format = services.CatalogFormatFromFileName(header.Filename)
+	}
+	if _, ok := catalogContentTypes[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrUnknownCatalogFormat.Error()})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	rows, rowErrors, err := services.ReadCatalog(format, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	total := len(rows) + len(rowErrors)
+	valid := []models.CatalogRow{}
+	for _, row := range rows {
+		if err := validateCatalogRow(row.Book); err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row.Row, ISBN: row.Book.ISBN, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, row)
+	}
+	sort.Slice(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	imp, err := h.catalogService.NewImport(ctx, userID, header.Filename, format, dryRun, total, rowErrors)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start import"})
+		return
+	}
+
+	if len(valid) > syncImportRows {
+		// Respond before starting the run, which changes imp as it goes.
+		c.JSON(http.StatusAccepted, imp)
+		go func() {
+			runCtx, cancel := context.WithTimeout(context.Background(), importTimeout)
+			defer cancel()
+			h.catalogService.Run(runCtx, imp, valid)
+			log.Printf("Catalog import %s finished: %d created, %d updated, %d failed", imp.ID.Hex(), imp.Created, imp.Updated, imp.Failed)
+		}()
+		return
+	}
+
+	runCtx, runCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer runCancel()
+	h.catalogService.Run(runCtx, imp, valid)
+
+	c.JSON(http.StatusOK, imp)
+}
+
+func (h *CatalogHandler) GetImports(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	imports, err := h.catalogService.Imports(ctx, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch imports"})
+		return
+	}
+	if imports == nil {
+		imports = []models.CatalogImport{}
+	}
+
+	c.JSON(http.StatusOK, imports)
+}
+
+// GetImport returns an import with its row errors; poll it to follow a
+// background import.
+func (h *CatalogHandler) GetImport(c *gin.Context) {
+	importID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	imp, err := h.catalogService.Import(ctx, importID)
+	if errors.Is(err, services.ErrImportNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import"})
+		return
+	}
+
+	c.JSON(http.StatusOK, imp)
+}
+
+// ExportCatalog downloads the whole catalog as ?format=csv, jsonl or onix.
+func (h *CatalogHandler) ExportCatalog(c *gin.Context) {
+	format := c.DefaultQuery("format", models.CatalogFormatCSV)
+	contentType, ok := catalogContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrUnknownCatalogFormat.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	fileName := fmt.Sprintf("catalog-%s.%s", time.Now().Format("20060102"), catalogExtensions[format])
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Status(http.StatusOK)
+	if err := h.catalogService.Export(ctx, format, c.Writer); err != nil {
+		// the status has been sent; the client sees a truncated file
+		log.Printf("Catalog export failed: %v", err)
+	}
+}
+
+// validateCatalogRow applies the checks of a book create request to an
+// imported row.
+func validateCatalogRow(book models.CreateBookRequest) error {
+	if models.NormalizeISBN(book.ISBN) == "" {
+		return errors.New("isbn is required")
+	}
+	if _, ok := models.ISBN13(book.ISBN); !ok {
+		return errors.New("isbn is not a valid ISBN-10 or ISBN-13")
+	}
+	if err := binding.Validator.ValidateStruct(book); err != nil {
+		return err
+	}
+	if len(book.Formats) == 0 {
+		return errors.New("at least one format with a price is required")
+	}
+	for _, f := range book.Formats {
+		switch f.Type {
+		case "physical", "digital", "both", "rental":
+		default:
+			return fmt.Errorf("unknown format %q", f.Type)
+		}
+		if f.Price < 0 || f.StockQuantity < 0 || f.WeightGrams < 0 {
+			return fmt.Errorf("%s format: price, stock and weight cannot be negative", f.Type)
+		}
+	}
+	return validateRentalFormats(book.Formats)
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"bookstore/middleware"
 	"bookstore/models"
 	"context"
 	"net/http"
@@ -28,114 +27,11 @@ func NewDigitalAccessHandler(
 	}
 }
 
-func (h *DigitalAccessHandler) GetPersonalLibrary(c *gin.Context) {
-	userID, err := middleware.GetUserIDFromContext(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cursor, err := h.digitalAccessCollection.Find(ctx, bson.M{"user_id": userID})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch library"})
-		return
-	}
-	defer cursor.Close(ctx)
-
-	var libraryItems []models.PersonalLibraryItem
-
-	for cursor.Next(ctx) {
-		var access models.DigitalAccess
-		if err := cursor.Decode(&access); err != nil {
-			continue
-		}
-
-		if access.ExpiryDate != nil && access.ExpiryDate.Before(time.Now()) {
-			continue
-		}
-
-		var book models.Book
-		err := h.booksCollection.FindOne(ctx, bson.M{"_id": access.BookID}).Decode(&book)
-		if err != nil {
-			continue
-		}
-
-		libraryItem := models.PersonalLibraryItem{
-			ID:           access.ID,
-			BookID:       book.ID,
-			BookTitle:    book.Title,
-			BookAuthor:   book.Author,
-			Format:       access.FormatType,
-			AccessURL:    access.AccessURL,
-			AccessedDate: access.AccessGrantedDate,
-		}
-
-		libraryItems = append(libraryItems, libraryItem)
-	}
-
-	if libraryItems == nil {
-		libraryItems = []models.PersonalLibraryItem{}
-	}
-
-	response := models.PersonalLibraryResponse{
-		UserID: userID,
-		Books:  libraryItems,
-	}
-
-	c.JSON(http.StatusOK, response)
-}
-
-func (h *DigitalAccessHandler) GetDigitalBookAccess(c *gin.Context) {
-	userID, err := middleware.GetUserIDFromContext(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
-		return
-	}
-
-	formatID := c.Param("format_id")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var access models.DigitalAccess
-	err = h.digitalAccessCollection.FindOne(
-		ctx,
-		bson.M{
-			"user_id":   userID,
-			"format_id": formatID,
-		},
-	).Decode(&access)
-
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Access not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		}
-		return
-	}
-
-	if access.ExpiryDate != nil && access.ExpiryDate.Before(time.Now()) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access has expired"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"id":          access.ID,
-		"access_url":  access.AccessURL,
-		"access_date": access.AccessGrantedDate,
-		"expiry_date": access.ExpiryDate,
-	})
-}
-
 func (h *DigitalAccessHandler) ListAvailableDigitalBooks(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := h.booksCollection.Find(ctx, bson.M{})
+	cursor, err := h.booksCollection.Find(ctx, bson.M{"deleted_at": nil})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch digital books"})
 		return
@@ -151,8 +47,8 @@ func (h *DigitalAccessHandler) ListAvailableDigitalBooks(c *gin.Context) {
 		}
 
 		for _, format := range book.Formats {
-			if (format.Type == "digital" || format.Type == "both") && format.StockQuantity > 0 {
-				results = append(results, gin.H{
+			if (format.Type == "digital" || format.Type == "both" || format.Type == "rental") && format.StockQuantity > 0 {
+				result := gin.H{
 					"book_id":        book.ID,
 					"title":          book.Title,
 					"author":         book.Author,
@@ -160,7 +56,11 @@ func (h *DigitalAccessHandler) ListAvailableDigitalBooks(c *gin.Context) {
 					"type":           format.Type,
 					"price":          format.Price,
 					"stock_quantity": format.StockQuantity,
-				})
+				}
+				if format.Type == "rental" {
+					result["rental_prices"] = format.RentalPrices
+				}
+				results = append(results, result)
 			}
 		}
 	}
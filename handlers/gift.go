@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type GiftHandler struct {
+	giftService     *services.GiftService
+	usersCollection *mongo.Collection
+}
+
+func NewGiftHandler(giftService *services.GiftService, usersCollection *mongo.Collection) *GiftHandler {
+	return &GiftHandler{
+		giftService:     giftService,
+		usersCollection: usersCollection,
+	}
+}
+
+func (h *GiftHandler) GetSentGifts(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	gifts, err := h.giftService.Sent(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gifts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gifts)
+}
+
+// GetReceivedGifts lists claimed gifts and the pending ones sent to the
+// user's email address. Pending gifts still need the token from the email.
+func (h *GiftHandler) GetReceivedGifts(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := h.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	gifts, err := h.giftService.Received(ctx, userID, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gifts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gifts)
+}
+
+func (h *GiftHandler) ClaimGift(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.ClaimGiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	gift, err := h.giftService.Claim(ctx, userID, req.Token)
+	if err != nil {
+		respondGiftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gift added to your library", "gift": gift})
+}
+
+func (h *GiftHandler) ResendGift(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	giftID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.giftService.Resend(ctx, userID, giftID); err != nil {
+		respondGiftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gift email sent again"})
+}
+
+func respondGiftError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrGiftNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift not found"})
+	case errors.Is(err, services.ErrGiftClaimed), errors.Is(err, services.ErrGiftNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGiftExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOwnGift):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process gift"})
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GiftCardHandler struct {
+	creditService *services.CreditService
+}
+
+func NewGiftCardHandler(creditService *services.CreditService) *GiftCardHandler {
+	return &GiftCardHandler{
+		creditService: creditService,
+	}
+}
+
+// PurchaseGiftCard buys a gift card. The code is returned only to the buyer,
+// who passes it on to the recipient.
+func (h *GiftCardHandler) PurchaseGiftCard(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.PurchaseGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	card, err := h.creditService.PurchaseGiftCard(ctx, userID, req)
+	if errors.Is(err, services.ErrGiftCardPayment) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Failed to purchase gift card"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create gift card"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, card)
+}
+
+func (h *GiftCardHandler) GetPurchasedGiftCards(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cards, err := h.creditService.GiftCards(ctx, bson.M{"purchased_by": userID}, 100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift cards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cards)
+}
+
+// CheckGiftCard shows the balance behind a code without using it.
+func (h *GiftCardHandler) CheckGiftCard(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	card, err := h.creditService.GiftCardByCode(ctx, c.Param("code"))
+	if err != nil {
+		respondGiftCardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    services.MaskGiftCardCode(card.Code),
+		"balance": card.Balance,
+		"status":  card.Status,
+	})
+}
+
+func (h *GiftCardHandler) GetGiftCards(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cards, err := h.creditService.GiftCards(ctx, filter, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift cards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cards)
+}
+
+func (h *GiftCardHandler) GetGiftCardByID(c *gin.Context) {
+	cardID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift card ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	card, err := h.creditService.GiftCard(ctx, cardID)
+	if err != nil {
+		respondGiftCardError(c, err)
+		return
+	}
+
+	transactions, err := h.creditService.Transactions(ctx, bson.M{"gift_card_id": cardID}, 500)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift card transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"gift_card": card, "transactions": transactions})
+}
+
+func (h *GiftCardHandler) IssueGiftCard(c *gin.Context) {
+	adminID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.IssueGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	card, err := h.creditService.IssueGiftCard(ctx, req.Amount, strings.TrimSpace(req.Note), adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, card)
+}
+
+func (h *GiftCardHandler) DisableGiftCard(c *gin.Context) {
+	h.setStatus(c, models.GiftCardDisabled, "Gift card disabled")
+}
+
+func (h *GiftCardHandler) EnableGiftCard(c *gin.Context) {
+	h.setStatus(c, models.GiftCardActive, "Gift card enabled")
+}
+
+func (h *GiftCardHandler) setStatus(c *gin.Context, status, message string) {
+	cardID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gift card ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.creditService.SetGiftCardStatus(ctx, cardID, status); err != nil {
+		respondGiftCardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func respondGiftCardError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrGiftCardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+	case errors.Is(err, services.ErrGiftCardEmpty), errors.Is(err, services.ErrInsufficientCredit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bookstore/jobs"
+	"bookstore/middleware"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	runner *jobs.Runner
+}
+
+func NewJobHandler(runner *jobs.Runner) *JobHandler {
+	return &JobHandler{
+		runner: runner,
+	}
+}
+
+func (h *JobHandler) GetJobs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	infos, err := h.runner.Jobs(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, infos)
+}
+
+func (h *JobHandler) GetJobRuns(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runs, err := h.runner.Runs(ctx, c.Query("job"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// TriggerJob starts a job now. The job runs in the background; poll
+// /admin/jobs/runs for its outcome.
+func (h *JobHandler) TriggerJob(c *gin.Context) {
+	adminID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	run, err := h.runner.Trigger(ctx, c.Param("name"), adminID)
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrUnknownJob):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		case errors.Is(err, jobs.ErrJobLocked):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start job"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
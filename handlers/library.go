@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LibraryHandler struct {
+	libraryService *services.LibraryService
+}
+
+func NewLibraryHandler(libraryService *services.LibraryService) *LibraryHandler {
+	return &LibraryHandler{
+		libraryService: libraryService,
+	}
+}
+
+// GetPersonalLibrary lists the books the user owns, one per book with all
+// owned formats, and how many books are on each shelf. ?shelf= narrows the
+// list to one shelf.
+func (h *LibraryHandler) GetPersonalLibrary(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	books, err := h.libraryService.Library(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch library"})
+		return
+	}
+
+	shelves := map[string]int{}
+	for _, shelf := range models.ReadingShelves {
+		shelves[shelf] = 0
+	}
+	filter := strings.TrimSpace(c.Query("shelf"))
+	listed := []models.LibraryBook{}
+	for _, book := range books {
+		onShelf := filter == ""
+		for _, shelf := range book.Shelves {
+			shelves[shelf]++
+			if strings.EqualFold(shelf, filter) {
+				onShelf = true
+			}
+		}
+		if onShelf {
+			listed = append(listed, book)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.PersonalLibraryResponse{
+		UserID:  userID,
+		Books:   listed,
+		Shelves: shelves,
+	})
+}
+
+func (h *LibraryHandler) GetLibraryBook(c *gin.Context) {
+	userID, bookID, ok := libraryParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	book, err := h.libraryService.Book(ctx, userID, bookID)
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, book)
+}
+
+func (h *LibraryHandler) UpdateShelves(c *gin.Context) {
+	userID, bookID, ok := libraryParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateShelvesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	entry, err := h.libraryService.SetShelves(ctx, userID, bookID, req.Shelves)
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// UpdateReadingProgress saves the position reached in an e-book. A 409
+// carries the later position already saved from another device.
+func (h *LibraryHandler) UpdateReadingProgress(c *gin.Context) {
+	userID, bookID, ok := libraryParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReadingProgressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	entry, err := h.libraryService.UpdateProgress(ctx, userID, bookID, req)
+	if errors.Is(err, services.ErrStaleProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "progress": entry.Progress})
+		return
+	}
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+func (h *LibraryHandler) AddBookmark(c *gin.Context) {
+	userID, bookID, ok := libraryParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.BookmarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bookmark, err := h.libraryService.AddBookmark(ctx, userID, bookID, req)
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, bookmark)
+}
+
+func (h *LibraryHandler) DeleteBookmark(c *gin.Context) {
+	userID, bookID, ok := libraryParams(c)
+	if !ok {
+		return
+	}
+
+	bookmarkID, err := primitive.ObjectIDFromHex(c.Param("bookmark_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bookmark ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.libraryService.DeleteBookmark(ctx, userID, bookID, bookmarkID); err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark deleted"})
+}
+
+// DownloadBook hands out the access URL of an e-book. Rentals are checked
+// for expiry here, at the moment of download. ?format= picks a format.
+func (h *LibraryHandler) DownloadBook(c *gin.Context) {
+	userID, bookID, ok := libraryParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	access, err := h.libraryService.Download(ctx, userID, bookID, c.Query("format"))
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":     access.BookID,
+		"format_type": access.FormatType,
+		"access_url":  access.AccessURL,
+		"expiry_date": access.ExpiryDate,
+	})
+}
+
+func (h *LibraryHandler) GetRentals(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rentals, err := h.libraryService.Rentals(ctx, userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rentals"})
+		return
+	}
+	if rentals == nil {
+		rentals = []models.Rental{}
+	}
+	left, err := h.libraryService.BorrowsLeft(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rentals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"borrows_left": left, "rentals": rentals})
+}
+
+// BorrowBook lends a rentable book to a premium member at no cost.
+func (h *LibraryHandler) BorrowBook(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.BorrowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bookID, err := primitive.ObjectIDFromHex(req.BookID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rental, err := h.libraryService.Borrow(ctx, userID, bookID)
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, rental)
+}
+
+func libraryParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	bookID, err := primitive.ObjectIDFromHex(c.Param("book_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, bookID, true
+}
+
+func respondLibraryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotInLibrary), errors.Is(err, services.ErrBookmarkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotEbook), errors.Is(err, services.ErrInvalidShelves):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTooManyBookmarks), errors.Is(err, services.ErrAlreadyInLibrary), errors.Is(err, services.ErrBorrowLimit):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotRentable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotPremium):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAccessExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update library"})
+	}
+}
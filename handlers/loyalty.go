@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type LoyaltyHandler struct {
+	tiersCollection *mongo.Collection
+	loyaltyService  *services.LoyaltyService
+}
+
+func NewLoyaltyHandler(tiersCollection *mongo.Collection, loyaltyService *services.LoyaltyService) *LoyaltyHandler {
+	return &LoyaltyHandler{
+		tiersCollection: tiersCollection,
+		loyaltyService:  loyaltyService,
+	}
+}
+
+func (h *LoyaltyHandler) GetTiers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tiers, err := h.loyaltyService.Tiers(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loyalty tiers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tiers)
+}
+
+// CreateTier adds a tier. While no tier is stored the built-in ones apply,
+// so the first tier created replaces all of them.
+func (h *LoyaltyHandler) CreateTier(c *gin.Context) {
+	var req models.LoyaltyTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tier := loyaltyTierFromRequest(req)
+	tier.CreatedAt = time.Now()
+	tier.UpdatedAt = time.Now()
+
+	result, err := h.tiersCollection.InsertOne(ctx, tier)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Loyalty tier name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loyalty tier"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Loyalty tier created successfully",
+		"id":      result.InsertedID,
+	})
+}
+
+func (h *LoyaltyHandler) UpdateTier(c *gin.Context) {
+	tierID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loyalty tier ID"})
+		return
+	}
+
+	var req models.LoyaltyTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tier := loyaltyTierFromRequest(req)
+	result, err := h.tiersCollection.UpdateOne(ctx, bson.M{"_id": tierID}, bson.M{"$set": bson.M{
+		"name":          tier.Name,
+		"min_spend":     tier.MinSpend,
+		"discount":      tier.Discount,
+		"color":         tier.Color,
+		"free_shipping": tier.FreeShipping,
+		"perks":         tier.Perks,
+		"updated_at":    time.Now(),
+	}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Loyalty tier name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loyalty tier"})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loyalty tier not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Loyalty tier updated successfully"})
+}
+
+func (h *LoyaltyHandler) DeleteTier(c *gin.Context) {
+	tierID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loyalty tier ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.tiersCollection.DeleteOne(ctx, bson.M{"_id": tierID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete loyalty tier"})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loyalty tier not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Loyalty tier deleted successfully"})
+}
+
+func loyaltyTierFromRequest(req models.LoyaltyTierRequest) models.LoyaltyTier {
+	var perks []string
+	for _, perk := range req.Perks {
+		if perk = strings.TrimSpace(perk); perk != "" {
+			perks = append(perks, perk)
+		}
+	}
+	return models.LoyaltyTier{
+		Name:         strings.TrimSpace(req.Name),
+		MinSpend:     req.MinSpend,
+		Discount:     req.Discount,
+		Color:        req.Color,
+		FreeShipping: req.FreeShipping,
+		Perks:        perks,
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetadataHandler struct {
+	metadataService *services.MetadataService
+}
+
+func NewMetadataHandler(metadataService *services.MetadataService) *MetadataHandler {
+	return &MetadataHandler{
+		metadataService: metadataService,
+	}
+}
+
+// LookupBook pre-fills a book create request from the metadata source, so a
+// moderator only has to check it and add formats before POST /admin/books.
+func (h *MetadataHandler) LookupBook(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	book, err := h.metadataService.Lookup(ctx, c.Query("isbn"))
+	switch {
+	case errors.Is(err, services.ErrInvalidISBN):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN: expected an ISBN-10 or ISBN-13 with a valid check digit"})
+		return
+	case errors.Is(err, services.ErrMetadataNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrMetadataUnavailable):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up book"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"source": h.metadataService.Source(), "book": book})
+}
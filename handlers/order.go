@@ -3,7 +3,11 @@ package handlers
 import (
 	"bookstore/middleware"
 	"bookstore/models"
+	"bookstore/services"
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -11,29 +15,57 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type OrderHandler struct {
-	ordersCollection        *mongo.Collection
-	orderItemsCollection    *mongo.Collection
-	booksCollection         *mongo.Collection
-	digitalAccessCollection *mongo.Collection
-	usersCollection         *mongo.Collection
+	ordersCollection     *mongo.Collection
+	orderItemsCollection *mongo.Collection
+	booksCollection      *mongo.Collection
+	usersCollection      *mongo.Collection
+	shipmentsCollection  *mongo.Collection
+	addressesCollection  *mongo.Collection
+	promotionService     *services.PromotionService
+	pricingService       *services.PricingService
+	pointsService        *services.PointsService
+	loyaltyService       *services.LoyaltyService
+	creditService        *services.CreditService
+	giftService          *services.GiftService
+	libraryService       *services.LibraryService
+	preorderService      *services.PreorderService
 }
 
 func NewOrderHandler(
 	ordersCollection,
 	orderItemsCollection,
 	booksCollection,
-	digitalAccessCollection *mongo.Collection,
 	usersCollection *mongo.Collection,
+	shipmentsCollection *mongo.Collection,
+	addressesCollection *mongo.Collection,
+	promotionService *services.PromotionService,
+	pricingService *services.PricingService,
+	pointsService *services.PointsService,
+	loyaltyService *services.LoyaltyService,
+	creditService *services.CreditService,
+	giftService *services.GiftService,
+	libraryService *services.LibraryService,
+	preorderService *services.PreorderService,
 ) *OrderHandler {
 	return &OrderHandler{
-		ordersCollection:        ordersCollection,
-		orderItemsCollection:    orderItemsCollection,
-		booksCollection:         booksCollection,
-		digitalAccessCollection: digitalAccessCollection,
-		usersCollection:         usersCollection, // will be set separately
+		ordersCollection:     ordersCollection,
+		orderItemsCollection: orderItemsCollection,
+		booksCollection:      booksCollection,
+		usersCollection:      usersCollection, // will be set separately
+		shipmentsCollection:  shipmentsCollection,
+		addressesCollection:  addressesCollection,
+		promotionService:     promotionService,
+		pricingService:       pricingService,
+		pointsService:        pointsService,
+		loyaltyService:       loyaltyService,
+		creditService:        creditService,
+		giftService:          giftService,
+		libraryService:       libraryService,
+		preorderService:      preorderService,
 	}
 }
 
@@ -53,102 +85,123 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var totalAmount float64
-	var orderItems []models.OrderItem
-	var digitalFormats []models.OrderItem
-
-	for _, item := range req.Items {
-		bookID, err := primitive.ObjectIDFromHex(item.BookID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
-			return
-		}
-
-		var book models.Book
-		err = h.booksCollection.FindOne(ctx, bson.M{"_id": bookID}).Decode(&book)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Book not found"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-			}
-			return
-		}
-
-		var format models.BookFormat
-		found := false
-		for _, f := range book.Formats {
-			if f.Type == item.FormatType {
-				format = f
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Format not available for this book"})
-			return
-		}
-
-		if format.StockQuantity < item.Quantity {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock for format: " + format.Type})
-			return
-		}
+	if err := h.resolveShippingAddress(ctx, userID, &req); err != nil {
+		respondPricingError(c, err)
+		return
+	}
 
-		itemTotal := format.Price * float64(item.Quantity)
-		totalAmount += itemTotal
+	quote, promotions, err := h.pricingService.Quote(ctx, quoteInput(userID, req))
+	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
 
+	var orderItems []models.OrderItem
+	var digitalFormats []models.OrderItem
+	var gifts []models.Gift
+	// quote lines follow the request items one to one
+	for i, line := range quote.Lines {
 		orderItem := models.OrderItem{
-			BookID:     bookID,
-			FormatType: item.FormatType,
-			Quantity:   item.Quantity,
-			Price:      format.Price,
+			ID:         primitive.NewObjectID(),
+			BookID:     line.BookID,
+			FormatType: line.FormatType,
+			Quantity:   line.Quantity,
+			Price:      line.UnitPrice,
+			RentalDays: line.RentalDays,
 			CreatedAt:  time.Now(),
 		}
-		orderItems = append(orderItems, orderItem)
 
-		if item.FormatType == "digital" || item.FormatType == "both" {
+		if email := req.Items[i].GiftRecipientEmail; email != "" {
+			giftID := primitive.NewObjectID()
+			orderItem.GiftID = &giftID
+			gifts = append(gifts, models.Gift{
+				ID:             giftID,
+				OrderItemID:    orderItem.ID,
+				SenderID:       userID,
+				RecipientEmail: email,
+				Message:        req.Items[i].GiftMessage,
+				BookID:         line.BookID,
+				BookTitle:      line.Title,
+				FormatType:     line.FormatType,
+			})
+		} else if line.FormatType == "digital" || line.FormatType == "both" {
 			digitalFormats = append(digitalFormats, orderItem)
 		}
+		orderItems = append(orderItems, orderItem)
 	}
 
-	// apply premium discount if user has premium
-	discount := 0.0
-	if v, exists := c.Get("is_premium"); exists {
-		if isPremium, ok := v.(bool); ok && isPremium {
-			discount = 0.10 // 10% discount for premium users
-		}
-	}
-	if h.usersCollection != nil {
-		var user models.User
-		err := h.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
-		if err == nil {
-			_, loyaltyDiscount, _ := middleware.GetLoyaltyLevel(user.LoyaltyPoints)
-			// stack discounts: first premium, then loyalty
-			discount = discount + (loyaltyDiscount * (1 - discount))
-		}
-	}
-
-	discountedTotal := totalAmount * (1 - discount)
-
 	order := models.Order{
+		ID:              primitive.NewObjectID(),
 		UserID:          userID,
 		Status:          "Pending",
-		TotalAmount:     discountedTotal,
+		TotalAmount:     quote.GrandTotal,
 		ItemCount:       len(orderItems),
-		DeliveryAddress: req.DeliveryAddress,
+		ShippingAddress: req.ShippingAddress,
+		ShippingMethod:  quote.ShippingMethod,
+		Promotions:      promotions,
+		Pricing:         quote,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 	}
+	orderID := order.ID
+	// digital-only orders skip shipping entirely
+	if quote.ShippingMethod != "" {
+		order.DeliveryStatus = models.ShipmentStatusPending
+		if order.ShippingAddress != nil {
+			order.DeliveryAddress = order.ShippingAddress.String()
+		}
+	} else {
+		order.DeliveryAddress = ""
+		order.ShippingAddress = nil
+	}
+
+	if err := h.promotionService.Redeem(ctx, userID, orderID, promotions); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.pointsService.Redeem(ctx, userID, quote.PointsRedeemed, orderID); err != nil {
+		h.promotionService.Release(ctx, orderID, promotions)
+		if errors.Is(err, services.ErrInsufficientPoints) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem loyalty points"})
+		}
+		return
+	}
+
+	if err := h.creditService.Capture(ctx, userID, orderID, quote.Payments); err != nil {
+		h.promotionService.Release(ctx, orderID, promotions)
+		_ = h.pointsService.ReverseOrder(ctx, userID, orderID, "Order could not be placed")
+		if errors.Is(err, services.ErrInsufficientCredit) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to charge gift cards or store credit"})
+		}
+		return
+	}
+
+	// a pre-order only holds the payment; it is taken on release
+	if quote.IsPreorder() {
+		order.Preorder, err = h.preorderService.Authorize(ctx, userID, orderID, quote)
+		if err != nil {
+			h.undoCheckout(ctx, userID, orderID, promotions, quote, nil)
+			if errors.Is(err, services.ErrPaymentDeclined) {
+				c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorise payment"})
+			}
+			return
+		}
+	}
 
-	orderResult, err := h.ordersCollection.InsertOne(ctx, order)
+	_, err = h.ordersCollection.InsertOne(ctx, order)
 	if err != nil {
+		h.undoCheckout(ctx, userID, orderID, promotions, quote, order.Preorder)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
 
-	orderID := orderResult.InsertedID.(primitive.ObjectID)
-
 	for i := range orderItems {
 		orderItems[i].OrderID = orderID
 	}
@@ -160,50 +213,56 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 
 	_, err = h.orderItemsCollection.InsertMany(ctx, itemDocs)
 	if err != nil {
+		h.undoCheckout(ctx, userID, orderID, promotions, quote, order.Preorder)
+		// some items may have been written before the failure
+		if _, err := h.orderItemsCollection.DeleteMany(ctx, bson.M{"order_id": orderID}); err != nil {
+			log.Printf("Failed to remove items of unplaced order %s: %v", orderID.Hex(), err)
+		}
+		if _, err := h.ordersCollection.DeleteOne(ctx, bson.M{"_id": orderID}); err != nil {
+			log.Printf("Failed to remove unplaced order %s: %v", orderID.Hex(), err)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order items"})
 		return
 	}
 
+	// gifts go to the recipient's library once claimed, not the buyer's
+	for _, gift := range gifts {
+		gift.OrderID = orderID
+		if _, err := h.giftService.Send(ctx, gift); err != nil {
+			log.Printf("Failed to send gift %s of order %s: %v", gift.ID.Hex(), orderID.Hex(), err)
+		}
+	}
+
 	// Award loyalty points (1 point per $1 spent, before discount)
-	if h.usersCollection != nil {
-		pointsEarned := int(totalAmount)
-		_, _ = h.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
-			"$inc": bson.M{"loyalty_points": pointsEarned},
+	pointsEarned := int(quote.Subtotal / 100)
+	_ = h.pointsService.Earn(ctx, userID, pointsEarned, &orderID, "Order "+orderID.Hex())
+	_, _ = h.loyaltyService.Recalculate(ctx, userID)
+
+	if order.Preorder != nil {
+		// granted and taken from stock by the pre-order release job
+		c.JSON(http.StatusCreated, gin.H{
+			"message":      "Pre-order placed successfully",
+			"order_id":     orderID,
+			"total_amount": order.TotalAmount,
+			"amount_due":   quote.AmountDue,
+			"pricing":      quote,
+			"preorder":     order.Preorder,
 		})
+		return
 	}
 
+	// buying a format already owned adds to the existing library entry
 	for _, digitalItem := range digitalFormats {
-		accessURL := "https://library.bookstore.com/access/" + orderID.Hex()
-
-		digitalAccess := models.DigitalAccess{
-			UserID:            userID,
-			BookID:            digitalItem.BookID,
-			FormatType:        digitalItem.FormatType,
-			AccessGrantedDate: time.Now(),
-			ExpiryDate:        &[]time.Time{time.Now().AddDate(1, 0, 0)}[0],
-			AccessURL:         accessURL,
-			CreatedAt:         time.Now(),
-		}
-
-		_, err := h.digitalAccessCollection.InsertOne(ctx, digitalAccess)
-		if err != nil {
-			continue
-		}
+		_ = h.libraryService.Grant(ctx, userID, digitalItem.BookID, digitalItem.FormatType, orderID)
 	}
-
-	// Create library entries for physical formats so library shows purchased physical books
 	for _, item := range orderItems {
-		if item.FormatType == "physical" {
-			digitalAccess := models.DigitalAccess{
-				UserID:            userID,
-				BookID:            item.BookID,
-				FormatType:        "physical",
-				AccessGrantedDate: time.Now(),
-				AccessURL:         "",
-				CreatedAt:         time.Now(),
+		switch item.FormatType {
+		case "physical":
+			_ = h.libraryService.Grant(ctx, userID, item.BookID, item.FormatType, orderID)
+		case "rental":
+			if _, err := h.libraryService.Rent(ctx, userID, item.BookID, item.RentalDays, &orderID, item.Price); err != nil {
+				log.Printf("Failed to start rental of book %s for order %s: %v", item.BookID.Hex(), orderID.Hex(), err)
 			}
-
-			_, _ = h.digitalAccessCollection.InsertOne(ctx, digitalAccess)
 		}
 	}
 
@@ -218,10 +277,113 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"message":      "Order created successfully",
 		"order_id":     orderID,
-		"total_amount": totalAmount,
+		"total_amount": order.TotalAmount,
+		"amount_due":   quote.AmountDue,
+		"pricing":      quote,
 	})
 }
 
+// undoCheckout gives back what CreateOrder took before the order could not
+// be placed: promotion redemptions, redeemed points, gift card and store
+// credit payments and the pre-order payment authorisation.
+func (h *OrderHandler) undoCheckout(ctx context.Context, userID, orderID primitive.ObjectID, promotions []models.AppliedPromotion, quote *models.PriceQuote, preorder *models.Preorder) {
+	h.promotionService.Release(ctx, orderID, promotions)
+	if err := h.pointsService.ReverseOrder(ctx, userID, orderID, "Order could not be placed"); err != nil {
+		log.Printf("Failed to reverse points of unplaced order %s: %v", orderID.Hex(), err)
+	}
+	h.creditService.Reverse(ctx, userID, orderID, quote.Payments, "Order could not be placed")
+	if err := h.preorderService.Void(ctx, preorder); err != nil {
+		log.Printf("Failed to void payment of unplaced order %s: %v", orderID.Hex(), err)
+	}
+}
+
+// QuoteOrder prices a basket without placing an order, for the cart page.
+func (h *OrderHandler) QuoteOrder(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.resolveShippingAddress(ctx, userID, &req); err != nil {
+		respondPricingError(c, err)
+		return
+	}
+
+	quote, _, err := h.pricingService.Quote(ctx, quoteInput(userID, req))
+	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
+
+func quoteInput(userID primitive.ObjectID, req models.CreateOrderRequest) services.QuoteInput {
+	return services.QuoteInput{
+		UserID:         userID,
+		Items:          req.Items,
+		CouponCodes:    req.CouponCodes,
+		RedeemPoints:   req.RedeemPoints,
+		GiftCardCodes:  req.GiftCardCodes,
+		UseStoreCredit: req.UseStoreCredit,
+		Address:        req.ShippingAddress,
+		ShippingMethod: req.ShippingMethod,
+	}
+}
+
+// resolveShippingAddress fills req.ShippingAddress from the address book
+// when the client picked a saved address or sent none at all. The result is
+// a copy, so the order keeps its snapshot if the saved entry changes later.
+func (h *OrderHandler) resolveShippingAddress(ctx context.Context, userID primitive.ObjectID, req *models.CreateOrderRequest) error {
+	if req.AddressID != "" {
+		addressID, err := primitive.ObjectIDFromHex(req.AddressID)
+		if err != nil {
+			return fmt.Errorf("%w: invalid address ID", services.ErrInvalidBasket)
+		}
+		var saved models.SavedAddress
+		err = h.addressesCollection.FindOne(ctx, bson.M{"_id": addressID, "user_id": userID}).Decode(&saved)
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("%w: address not found", services.ErrInvalidBasket)
+		}
+		if err != nil {
+			return err
+		}
+		req.ShippingAddress = &saved.Address
+	} else if req.ShippingAddress == nil {
+		var saved models.SavedAddress
+		err := h.addressesCollection.FindOne(ctx, bson.M{"user_id": userID, "is_default": true}).Decode(&saved)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if err == nil {
+			req.ShippingAddress = &saved.Address
+		}
+	}
+
+	if req.ShippingAddress != nil {
+		req.ShippingAddress.Normalize()
+	}
+	return nil
+}
+
+func respondPricingError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidBasket) || errors.Is(err, services.ErrInvalidCoupon) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price order"})
+}
+
 func (h *OrderHandler) GetUserOrders(c *gin.Context) {
 	userID, err := middleware.GetUserIDFromContext(c)
 	if err != nil {
@@ -271,6 +433,12 @@ func (h *OrderHandler) GetUserOrders(c *gin.Context) {
 			Items:           items,
 			DeliveryStatus:  order.DeliveryStatus,
 			DeliveryAddress: order.DeliveryAddress,
+			ShippingAddress: order.ShippingAddress,
+			ShippingMethod:  order.ShippingMethod,
+			Promotions:      order.Promotions,
+			Pricing:         order.Pricing,
+			RefundedAmount:  order.RefundedAmount,
+			Preorder:        order.Preorder,
 			CreatedAt:       order.CreatedAt,
 			UpdatedAt:       order.UpdatedAt,
 		})
@@ -326,6 +494,12 @@ func (h *OrderHandler) GetAllOrders(c *gin.Context) {
 			Items:           items,
 			DeliveryStatus:  order.DeliveryStatus,
 			DeliveryAddress: order.DeliveryAddress,
+			ShippingAddress: order.ShippingAddress,
+			ShippingMethod:  order.ShippingMethod,
+			Promotions:      order.Promotions,
+			Pricing:         order.Pricing,
+			RefundedAmount:  order.RefundedAmount,
+			Preorder:        order.Preorder,
 			CreatedAt:       order.CreatedAt,
 			UpdatedAt:       order.UpdatedAt,
 		})
@@ -434,6 +608,16 @@ func (h *OrderHandler) GetOrderByID(c *gin.Context) {
 		items = []models.OrderItemResponse{}
 	}
 
+	var shipments []models.Shipment
+	shipmentCursor, err := h.shipmentsCollection.Find(ctx, bson.M{"order_id": orderID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err == nil {
+		err = shipmentCursor.All(ctx, &shipments)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipments"})
+		return
+	}
+
 	response := models.OrderResponse{
 		ID:              order.ID,
 		UserID:          order.UserID,
@@ -442,6 +626,13 @@ func (h *OrderHandler) GetOrderByID(c *gin.Context) {
 		Items:           items,
 		DeliveryStatus:  order.DeliveryStatus,
 		DeliveryAddress: order.DeliveryAddress,
+		ShippingAddress: order.ShippingAddress,
+		ShippingMethod:  order.ShippingMethod,
+		Shipments:       shipments,
+		Promotions:      order.Promotions,
+		Pricing:         order.Pricing,
+		RefundedAmount:  order.RefundedAmount,
+		Preorder:        order.Preorder,
 		CreatedAt:       order.CreatedAt,
 		UpdatedAt:       order.UpdatedAt,
 	}
@@ -486,24 +677,58 @@ func (h *OrderHandler) CancelOrder(c *gin.Context) {
 		return
 	}
 
-	result, err := h.ordersCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": orderID},
-		bson.M{"$set": bson.M{
-			"status":     "Cancelled",
-			"updated_at": time.Now(),
-		}},
-	)
+	// the status filter makes sure a double submit gives nothing back twice,
+	// and that a pre-order being released is not cancelled under it
+	filter := bson.M{"_id": orderID, "status": order.Status}
+	set := bson.M{
+		"status":     "Cancelled",
+		"updated_at": time.Now(),
+	}
+	if order.Preorder != nil {
+		filter["preorder.status"] = order.Preorder.Status
+		if order.Preorder.Status == models.PreorderAwaitingRelease {
+			set["preorder.status"] = models.PreorderCancelled
+		}
+	}
+	var cancelled models.Order
+	err = h.ordersCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&cancelled)
+
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order status changed, please try again"})
+		return
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	if order.Preorder != nil && order.Preorder.Status == models.PreorderAwaitingRelease {
+		if err := h.preorderService.Void(ctx, order.Preorder); err != nil {
+			log.Printf("Failed to void payment of pre-order %s: %v", orderID.Hex(), err)
+		}
+	}
+	// a released pre-order was paid on release; keep it unless that
+	// payment can be given back
+	if err := h.preorderService.Refund(ctx, order.Preorder); err != nil {
+		log.Printf("Failed to refund payment of pre-order %s: %v", orderID.Hex(), err)
+		_, _ = h.ordersCollection.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{"$set": bson.M{"status": order.Status}})
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to refund the pre-order payment, please try again"})
 		return
 	}
+	h.promotionService.Release(ctx, orderID, order.Promotions)
+	_ = h.pointsService.ReverseOrder(ctx, userID, orderID, "Order cancelled")
+	if order.Pricing != nil {
+		// refunds already made, such as for expired gifts, are not paid twice;
+		// no gift refund can start once the order is cancelled
+		payments := services.LessRefunded(order.Pricing.Payments, cancelled.RefundedAmount)
+		h.creditService.Reverse(ctx, userID, orderID, payments, "Order cancelled")
+	}
+	_ = h.giftService.CancelOrder(ctx, orderID)
+	_ = h.libraryService.RevokeOrder(ctx, userID, orderID)
+	_, _ = h.loyaltyService.Recalculate(ctx, userID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully"})
 }
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PromotionHandler struct {
+	promotionsCollection  *mongo.Collection
+	redemptionsCollection *mongo.Collection
+	categoryService       *services.CategoryService
+}
+
+func NewPromotionHandler(promotionsCollection, redemptionsCollection *mongo.Collection, categoryService *services.CategoryService) *PromotionHandler {
+	return &PromotionHandler{
+		promotionsCollection:  promotionsCollection,
+		redemptionsCollection: redemptionsCollection,
+		categoryService:       categoryService,
+	}
+}
+
+func (h *PromotionHandler) CreatePromotion(c *gin.Context) {
+	var req models.PromotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	promotion := promotionFromRequest(req)
+	if msg := validatePromotion(promotion); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	promotion.CreatedAt = time.Now()
+	promotion.UpdatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if !h.resolveScope(ctx, c, &promotion.Scope) {
+		return
+	}
+
+	result, err := h.promotionsCollection.InsertOne(ctx, promotion)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promotion"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Promotion created successfully",
+		"id":      result.InsertedID,
+	})
+}
+
+func (h *PromotionHandler) GetPromotions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if c.Query("active") == "true" {
+		filter["is_active"] = true
+	}
+
+	cursor, err := h.promotionsCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promotions"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var promotions []models.Promotion
+	if err = cursor.All(ctx, &promotions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode promotions"})
+		return
+	}
+
+	if promotions == nil {
+		promotions = []models.Promotion{}
+	}
+
+	c.JSON(http.StatusOK, promotions)
+}
+
+func (h *PromotionHandler) GetPromotionByID(c *gin.Context) {
+	promotionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var promotion models.Promotion
+	err = h.promotionsCollection.FindOne(ctx, bson.M{"_id": promotionID}).Decode(&promotion)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, promotion)
+}
+
+func (h *PromotionHandler) UpdatePromotion(c *gin.Context) {
+	promotionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	var req models.PromotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	promotion := promotionFromRequest(req)
+	if msg := validatePromotion(promotion); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if !h.resolveScope(ctx, c, &promotion.Scope) {
+		return
+	}
+
+	set := bson.M{
+		"name":              promotion.Name,
+		"description":       promotion.Description,
+		"type":              promotion.Type,
+		"percent":           promotion.Percent,
+		"amount":            promotion.Amount,
+		"buy_quantity":      promotion.BuyQuantity,
+		"get_quantity":      promotion.GetQuantity,
+		"scope":             promotion.Scope,
+		"min_basket_amount": promotion.MinBasketAmount,
+		"min_basket_items":  promotion.MinBasketItems,
+		"starts_at":         promotion.StartsAt,
+		"ends_at":           promotion.EndsAt,
+		"usage_limit":       promotion.UsageLimit,
+		"per_user_limit":    promotion.PerUserLimit,
+		"stackable":         promotion.Stackable,
+		"priority":          promotion.Priority,
+		"is_active":         promotion.IsActive,
+		"updated_at":        time.Now(),
+	}
+	update := bson.M{"$set": set}
+	if promotion.Code != "" {
+		set["code"] = promotion.Code
+	} else {
+		update["$unset"] = bson.M{"code": ""}
+	}
+
+	result, err := h.promotionsCollection.UpdateOne(ctx, bson.M{"_id": promotionID}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update promotion"})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promotion updated successfully"})
+}
+
+func (h *PromotionHandler) DeletePromotion(c *gin.Context) {
+	promotionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// promotions that were already redeemed are kept for the order history
+	used, err := h.redemptionsCollection.CountDocuments(ctx, bson.M{"promotion_id": promotionID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if used > 0 {
+		result, err := h.promotionsCollection.UpdateOne(ctx, bson.M{"_id": promotionID}, bson.M{
+			"$set": bson.M{"is_active": false, "updated_at": time.Now()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate promotion"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Promotion has redemptions and was deactivated instead of deleted"})
+		return
+	}
+
+	result, err := h.promotionsCollection.DeleteOne(ctx, bson.M{"_id": promotionID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete promotion"})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promotion deleted successfully"})
+}
+
+// resolveScope looks up the categories of a scope, which may be given by
+// name or ID. It writes the error response and reports whether they all
+// exist.
+func (h *PromotionHandler) resolveScope(ctx context.Context, c *gin.Context, scope *models.PromotionScope) bool {
+	scope.CategoryIDs = nil
+	for _, ref := range scope.Categories {
+		category, err := h.categoryService.Lookup(ctx, ref)
+		if errors.Is(err, services.ErrCategoryNotFound) || errors.Is(err, services.ErrInvalidCategory) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error() + ": " + ref})
+			return false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up category"})
+			return false
+		}
+		scope.CategoryIDs = append(scope.CategoryIDs, category.ID)
+	}
+	return true
+}
+
+func promotionFromRequest(req models.PromotionRequest) models.Promotion {
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+	startsAt := req.StartsAt
+	if startsAt.IsZero() {
+		startsAt = time.Now()
+	}
+	return models.Promotion{
+		Name:            req.Name,
+		Description:     req.Description,
+		Code:            services.NormalizeCouponCode(req.Code),
+		Type:            req.Type,
+		Percent:         req.Percent,
+		Amount:          req.Amount,
+		BuyQuantity:     req.BuyQuantity,
+		GetQuantity:     req.GetQuantity,
+		Scope:           req.Scope,
+		MinBasketAmount: req.MinBasketAmount,
+		MinBasketItems:  req.MinBasketItems,
+		StartsAt:        startsAt,
+		EndsAt:          req.EndsAt,
+		UsageLimit:      req.UsageLimit,
+		PerUserLimit:    req.PerUserLimit,
+		Stackable:       req.Stackable,
+		Priority:        req.Priority,
+		IsActive:        isActive,
+	}
+}
+
+func validatePromotion(p models.Promotion) string {
+	switch p.Type {
+	case models.PromotionTypePercentage:
+		if p.Percent <= 0 || p.Percent > 100 {
+			return "Percentage promotions need a percent between 0 and 100"
+		}
+	case models.PromotionTypeFixed:
+		if p.Amount <= 0 {
+			return "Fixed promotions need a positive amount in minor units"
+		}
+	case models.PromotionTypeBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return "Buy X get Y promotions need buy_quantity and get_quantity"
+		}
+	}
+	if p.EndsAt != nil && !p.EndsAt.After(p.StartsAt) {
+		return "ends_at must be after starts_at"
+	}
+	return ""
+}
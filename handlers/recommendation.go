@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RecommendationHandler struct {
+	recommendationService *services.RecommendationService
+}
+
+func NewRecommendationHandler(recommendationService *services.RecommendationService) *RecommendationHandler {
+	return &RecommendationHandler{
+		recommendationService: recommendationService,
+	}
+}
+
+// GetRelated lists books related to a book: bought by the same customers,
+// by the same author or in the same category.
+func (h *RecommendationHandler) GetRelated(c *gin.Context) {
+	bookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	books, err := h.recommendationService.Related(ctx, bookID, recommendationLimit(c))
+	if err != nil {
+		if errors.Is(err, services.ErrBookNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related books"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, books)
+}
+
+// GetRecommendations lists books picked for the user from their library
+// and wishlist, or the best sellers until there is enough to go on.
+func (h *RecommendationHandler) GetRecommendations(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	books, err := h.recommendationService.ForUser(ctx, userID, recommendationLimit(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, books)
+}
+
+func recommendationLimit(c *gin.Context) int {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit <= 0 || limit > services.MaxRecommendations {
+		limit = 10
+	}
+	return limit
+}
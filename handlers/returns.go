@@ -0,0 +1,595 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReturnHandler struct {
+	returnsCollection    *mongo.Collection
+	refundsCollection    *mongo.Collection
+	ordersCollection     *mongo.Collection
+	orderItemsCollection *mongo.Collection
+	booksCollection      *mongo.Collection
+	pointsService        *services.PointsService
+	loyaltyService       *services.LoyaltyService
+	creditService        *services.CreditService
+	libraryService       *services.LibraryService
+}
+
+func NewReturnHandler(
+	returnsCollection,
+	refundsCollection,
+	ordersCollection,
+	orderItemsCollection,
+	booksCollection *mongo.Collection,
+	pointsService *services.PointsService,
+	loyaltyService *services.LoyaltyService,
+	creditService *services.CreditService,
+	libraryService *services.LibraryService,
+) *ReturnHandler {
+	return &ReturnHandler{
+		returnsCollection:    returnsCollection,
+		refundsCollection:    refundsCollection,
+		ordersCollection:     ordersCollection,
+		orderItemsCollection: orderItemsCollection,
+		booksCollection:      booksCollection,
+		pointsService:        pointsService,
+		loyaltyService:       loyaltyService,
+		creditService:        creditService,
+		libraryService:       libraryService,
+	}
+}
+
+func (h *ReturnHandler) CreateReturn(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req models.CreateReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(req.OrderItemID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order item ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order models.Order
+	err = h.ordersCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if order.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot return items of other user's order"})
+		return
+	}
+
+	if order.Status != "Completed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only completed orders can be returned; cancel the order instead"})
+		return
+	}
+
+	var item models.OrderItem
+	err = h.orderItemsCollection.FindOne(ctx, bson.M{"_id": itemID, "order_id": orderID}).Decode(&item)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order item not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	if item.FormatType == "rental" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rentals cannot be returned"})
+		return
+	}
+	if item.GiftID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gifts cannot be returned; unclaimed gifts are refunded when they expire"})
+		return
+	}
+
+	// reserve the units on the item first, so concurrent requests cannot
+	// return more than was bought
+	reserved, err := h.orderItemsCollection.UpdateOne(ctx, bson.M{
+		"_id": itemID,
+		"$expr": bson.M{"$lte": bson.A{
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$returned_quantity", 0}}, req.Quantity}},
+			"$quantity",
+		}},
+	}, bson.M{"$inc": bson.M{"returned_quantity": req.Quantity}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if reserved.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity exceeds the units left to return for this item"})
+		return
+	}
+
+	now := time.Now()
+	ret := models.ReturnRequest{
+		OrderID:     orderID,
+		OrderItemID: itemID,
+		UserID:      userID,
+		BookID:      item.BookID,
+		FormatType:  item.FormatType,
+		Quantity:    req.Quantity,
+		Reason:      req.Reason,
+		Comment:     strings.TrimSpace(req.Comment),
+		Status:      models.ReturnStatusRequested,
+		Events:      []models.ReturnEvent{{Status: models.ReturnStatusRequested, By: &userID, At: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	result, err := h.returnsCollection.InsertOne(ctx, ret)
+	if err != nil {
+		h.unreserve(ctx, ret)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create return request"})
+		return
+	}
+	ret.ID = result.InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusCreated, ret)
+}
+
+func (h *ReturnHandler) GetUserReturns(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	h.listReturns(c, bson.M{"user_id": userID}, -1)
+}
+
+func (h *ReturnHandler) GetReturnByID(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ret, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	if role := middleware.GetRoleFromContext(c); ret.UserID != userID && role != "Admin" && role != "Moderator" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot view other user's return"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// CancelReturn lets the customer withdraw a request that has not been reviewed yet.
+func (h *ReturnHandler) CancelReturn(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ret, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	if ret.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot cancel other user's return"})
+		return
+	}
+
+	if h.transition(c, ret, []string{models.ReturnStatusRequested}, models.ReturnStatusCancelled, "", nil) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.unreserve(ctx, ret)
+	}
+}
+
+// GetReturnQueue lists returns for staff, oldest first. Without a status
+// filter it shows every return that still needs action.
+func (h *ReturnHandler) GetReturnQueue(c *gin.Context) {
+	filter := bson.M{"status": bson.M{"$in": []string{
+		models.ReturnStatusRequested,
+		models.ReturnStatusApproved,
+		models.ReturnStatusReceived,
+	}}}
+	if status := c.Query("status"); status != "" {
+		filter = bson.M{"status": status}
+	}
+
+	h.listReturns(c, filter, 1)
+}
+
+func (h *ReturnHandler) ApproveReturn(c *gin.Context) {
+	var req models.ReviewReturnRequest
+	// the body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ret, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	h.transition(c, ret, []string{models.ReturnStatusRequested}, models.ReturnStatusApproved, req.Note, nil)
+}
+
+func (h *ReturnHandler) RejectReturn(c *gin.Context) {
+	var req models.ReviewReturnRequest
+	// the body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ret, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	if h.transition(c, ret, []string{models.ReturnStatusRequested, models.ReturnStatusApproved}, models.ReturnStatusRejected, req.Note, nil) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.unreserve(ctx, ret)
+	}
+}
+
+// ReceiveReturn records that the returned copies arrived at the warehouse
+// and optionally puts them back into stock.
+func (h *ReturnHandler) ReceiveReturn(c *gin.Context) {
+	var req models.ReceiveReturnRequest
+	// the body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ret, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	if ret.FormatType == "digital" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Digital items are not shipped back; refund the return directly"})
+		return
+	}
+
+	if !h.transition(c, ret, []string{models.ReturnStatusApproved}, models.ReturnStatusReceived, req.Note, bson.M{"restocked": req.Restock}) {
+		return
+	}
+
+	if req.Restock {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = h.booksCollection.UpdateOne(ctx, bson.M{"_id": ret.BookID, "formats.type": ret.FormatType}, bson.M{
+			"$inc": bson.M{"formats.$.stock_quantity": ret.Quantity},
+		})
+	}
+}
+
+// RefundReturn pays back a return. Without an amount the item's share of
+// the order total is refunded, including its part of discounts and tax;
+// a smaller amount makes a partial refund. Loyalty points earned on the
+// returned units are taken back in proportion to the amount, and library
+// access is revoked once every unit of the item has been refunded.
+func (h *ReturnHandler) RefundReturn(c *gin.Context) {
+	adminID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.RefundReturnRequest
+	// the body is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ret, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	ready := models.ReturnStatusReceived
+	if ret.FormatType == "digital" {
+		ready = models.ReturnStatusApproved
+	}
+	if ret.Status != ready {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Return must be " + ready + " before it can be refunded"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// claim the return first so a double submit cannot refund it twice
+	claim, err := h.returnsCollection.UpdateOne(ctx, bson.M{"_id": ret.ID, "status": ready}, bson.M{
+		"$set": bson.M{"status": models.ReturnStatusRefunded, "updated_at": time.Now()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update return"})
+		return
+	}
+	if claim.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Return is already being refunded"})
+		return
+	}
+	release := func() {
+		_, _ = h.returnsCollection.UpdateOne(ctx, bson.M{"_id": ret.ID}, bson.M{"$set": bson.M{"status": ready}})
+	}
+
+	var order models.Order
+	if err := h.ordersCollection.FindOne(ctx, bson.M{"_id": ret.OrderID}).Decode(&order); err != nil {
+		release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order"})
+		return
+	}
+	var item models.OrderItem
+	if err := h.orderItemsCollection.FindOne(ctx, bson.M{"_id": ret.OrderItemID}).Decode(&item); err != nil {
+		release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order item"})
+		return
+	}
+
+	gross := item.Price * models.Money(ret.Quantity)
+	share := services.RefundShare(order, gross)
+	amount := req.Amount
+	if amount == 0 {
+		amount = share
+	}
+	if amount > share && !req.Override {
+		release()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund exceeds the returned item's share of the order (" + share.String() + "); set override to refund more"})
+		return
+	}
+	if amount <= 0 {
+		release()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to refund for this return"})
+		return
+	}
+
+	// the filter caps the running total at what the customer paid, so two
+	// concurrent refunds cannot pay out more than the order was worth
+	grandTotal := order.TotalAmount
+	if order.Pricing != nil {
+		grandTotal = order.Pricing.GrandTotal
+	}
+	result, err := h.ordersCollection.UpdateOne(ctx, bson.M{
+		"_id": order.ID,
+		"$expr": bson.M{"$lte": bson.A{
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$refunded_amount", 0}}, int64(amount)}},
+			int64(grandTotal),
+		}},
+	}, bson.M{
+		"$inc": bson.M{"refunded_amount": amount},
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record refund"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		release()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund exceeds the amount left to refund on this order (" + (grandTotal - order.RefundedAmount).String() + ")"})
+		return
+	}
+
+	refund := models.Refund{
+		OrderID:   order.ID,
+		UserID:    ret.UserID,
+		ReturnID:  &ret.ID,
+		Amount:    amount,
+		Method:    models.RefundToOriginal,
+		Note:      strings.TrimSpace(req.Note),
+		IssuedBy:  adminID,
+		CreatedAt: time.Now(),
+	}
+	if req.ToStoreCredit {
+		refund.Method = models.RefundToStoreCredit
+	}
+	inserted, err := h.refundsCollection.InsertOne(ctx, refund)
+	if err != nil {
+		_, _ = h.ordersCollection.UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{"$inc": bson.M{"refunded_amount": -amount}})
+		release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record refund"})
+		return
+	}
+	if req.ToStoreCredit {
+		if err := h.creditService.CreditWallet(ctx, ret.UserID, amount, models.CreditRefund, &order.ID, "Refund for returned item", &adminID); err != nil {
+			// undo the refund so the return can be refunded again
+			_, _ = h.refundsCollection.DeleteOne(ctx, bson.M{"_id": inserted.InsertedID})
+			_, _ = h.ordersCollection.UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{"$inc": bson.M{"refunded_amount": -amount}})
+			release()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add store credit"})
+			return
+		}
+	}
+
+	// points were awarded at 1 per $1 of the undiscounted subtotal; a
+	// partial refund takes back its part of them
+	points := int(gross / 100)
+	if amount < share {
+		points = int(int64(points) * int64(amount) / int64(share))
+	}
+	_ = h.pointsService.Deduct(ctx, ret.UserID, points, &order.ID, "Returned item refunded")
+	_, _ = h.loyaltyService.Recalculate(ctx, ret.UserID)
+
+	// the copy stays in the library while some units are still kept
+	refunded, err := h.returnedQuantity(ctx, ret.OrderItemID, models.ReturnStatusRefunded)
+	if err == nil && refunded >= item.Quantity {
+		_ = h.libraryService.Revoke(ctx, ret.UserID, ret.BookID, ret.FormatType, ret.OrderID)
+	}
+
+	_, err = h.returnsCollection.UpdateOne(ctx, bson.M{"_id": ret.ID}, bson.M{
+		"$set": bson.M{
+			"refund_amount":   amount,
+			"points_reversed": points,
+		},
+		"$push": bson.M{"events": models.ReturnEvent{Status: models.ReturnStatusRefunded, Note: refund.Note, By: &adminID, At: time.Now()}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Refund issued but the return could not be updated"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Refund issued",
+		"amount":  amount,
+		"method":  refund.Method,
+	})
+}
+
+// returnedQuantity counts the units of an order item in returns with one
+// of statuses.
+func (h *ReturnHandler) returnedQuantity(ctx context.Context, orderItemID primitive.ObjectID, statuses ...string) (int, error) {
+	cursor, err := h.returnsCollection.Find(ctx, bson.M{
+		"order_item_id": orderItemID,
+		"status":        bson.M{"$in": statuses},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var returns []models.ReturnRequest
+	if err := cursor.All(ctx, &returns); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, r := range returns {
+		total += r.Quantity
+	}
+	return total, nil
+}
+
+// unreserve gives the units of a return that did not go ahead back to its
+// order item.
+func (h *ReturnHandler) unreserve(ctx context.Context, ret models.ReturnRequest) {
+	_, err := h.orderItemsCollection.UpdateOne(ctx, bson.M{"_id": ret.OrderItemID}, bson.M{
+		"$inc": bson.M{"returned_quantity": -ret.Quantity},
+	})
+	if err != nil {
+		log.Printf("Failed to release returned units of order item %s: %v", ret.OrderItemID.Hex(), err)
+	}
+}
+
+func (h *ReturnHandler) listReturns(c *gin.Context, filter bson.M, order int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: order}})
+	cursor, err := h.returnsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var returns []models.ReturnRequest
+	if err = cursor.All(ctx, &returns); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode returns"})
+		return
+	}
+
+	if returns == nil {
+		returns = []models.ReturnRequest{}
+	}
+
+	c.JSON(http.StatusOK, returns)
+}
+
+func (h *ReturnHandler) loadReturn(c *gin.Context) (models.ReturnRequest, bool) {
+	var ret models.ReturnRequest
+	returnID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return ret, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = h.returnsCollection.FindOne(ctx, bson.M{"_id": returnID}).Decode(&ret)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return ret, false
+	}
+	return ret, true
+}
+
+// transition moves a return to status if it is still in one of from, so
+// concurrent reviews cannot both succeed. It writes the response and
+// reports whether the update happened.
+func (h *ReturnHandler) transition(c *gin.Context, ret models.ReturnRequest, from []string, status, note string, set bson.M) bool {
+	actorID, _ := middleware.GetUserIDFromContext(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	fields := bson.M{"status": status, "updated_at": now}
+	for k, v := range set {
+		fields[k] = v
+	}
+	event := models.ReturnEvent{Status: status, Note: strings.TrimSpace(note), By: &actorID, At: now}
+
+	result, err := h.returnsCollection.UpdateOne(ctx, bson.M{"_id": ret.ID, "status": bson.M{"$in": from}}, bson.M{
+		"$set":  fields,
+		"$push": bson.M{"events": event},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update return"})
+		return false
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot move a " + ret.Status + " return to " + status})
+		return false
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Return " + status})
+	return true
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RevisionHandler struct {
+	revisionService *services.RevisionService
+}
+
+func NewRevisionHandler(revisionService *services.RevisionService) *RevisionHandler {
+	return &RevisionHandler{
+		revisionService: revisionService,
+	}
+}
+
+// GetHistory lists a book's revisions with the fields each one changed,
+// newest first.
+func (h *RevisionHandler) GetHistory(c *gin.Context) {
+	bookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return
+	}
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	revisions, err := h.revisionService.History(ctx, bookID, limit)
+	if err != nil {
+		respondRevisionError(c, err)
+		return
+	}
+	if revisions == nil {
+		revisions = []models.BookRevision{}
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetRevision returns one revision with the full snapshot of the book.
+func (h *RevisionHandler) GetRevision(c *gin.Context) {
+	bookID, version, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	revision, err := h.revisionService.Revision(ctx, bookID, version)
+	if err != nil {
+		respondRevisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// Rollback restores a book to a revision. The rollback is itself recorded
+// as a new revision, so it can be undone the same way.
+func (h *RevisionHandler) Rollback(c *gin.Context) {
+	bookID, version, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	revision, err := h.revisionService.Rollback(ctx, bookID, version, userID)
+	if err != nil {
+		respondRevisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Book rolled back successfully", "revision": revision})
+}
+
+// GetPriceHistory lists the prices a book's formats were set to, newest
+// first, optionally for one ?format.
+func (h *RevisionHandler) GetPriceHistory(c *gin.Context) {
+	bookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return
+	}
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	points, err := h.revisionService.PriceHistory(ctx, bookID, c.Query("format"), limit)
+	if err != nil {
+		respondRevisionError(c, err)
+		return
+	}
+	if points == nil {
+		points = []models.PricePoint{}
+	}
+
+	c.JSON(http.StatusOK, points)
+}
+
+func revisionParams(c *gin.Context) (primitive.ObjectID, int, bool) {
+	bookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return primitive.NilObjectID, 0, false
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return primitive.NilObjectID, 0, false
+	}
+	return bookID, version, true
+}
+
+func respondRevisionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrBookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	case errors.Is(err, services.ErrRevisionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+	case errors.Is(err, services.ErrRollbackConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ShippingHandler struct {
+	methodsCollection    *mongo.Collection
+	shipmentsCollection  *mongo.Collection
+	ordersCollection     *mongo.Collection
+	orderItemsCollection *mongo.Collection
+	shippingService      *services.ShippingService
+}
+
+func NewShippingHandler(
+	methodsCollection,
+	shipmentsCollection,
+	ordersCollection,
+	orderItemsCollection *mongo.Collection,
+	shippingService *services.ShippingService,
+) *ShippingHandler {
+	return &ShippingHandler{
+		methodsCollection:    methodsCollection,
+		shipmentsCollection:  shipmentsCollection,
+		ordersCollection:     ordersCollection,
+		orderItemsCollection: orderItemsCollection,
+		shippingService:      shippingService,
+	}
+}
+
+func (h *ShippingHandler) GetShippingMethods(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	methods, err := h.shippingService.Methods(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping methods"})
+		return
+	}
+
+	c.JSON(http.StatusOK, methods)
+}
+
+func (h *ShippingHandler) CreateShippingMethod(c *gin.Context) {
+	var req models.ShippingMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	method := shippingMethodFromRequest(req)
+	method.CreatedAt = time.Now()
+	method.UpdatedAt = time.Now()
+
+	result, err := h.methodsCollection.InsertOne(ctx, method)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Shipping method code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipping method"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Shipping method created successfully",
+		"id":      result.InsertedID,
+	})
+}
+
+func (h *ShippingHandler) UpdateShippingMethod(c *gin.Context) {
+	methodID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping method ID"})
+		return
+	}
+
+	var req models.ShippingMethodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	method := shippingMethodFromRequest(req)
+	result, err := h.methodsCollection.UpdateOne(ctx, bson.M{"_id": methodID}, bson.M{"$set": bson.M{
+		"code":               method.Code,
+		"name":               method.Name,
+		"rate_type":          method.RateType,
+		"base_fee":           method.BaseFee,
+		"per_item_fee":       method.PerItemFee,
+		"per_kg_fee":         method.PerKgFee,
+		"free_over":          method.FreeOver,
+		"countries":          method.Countries,
+		"requires_address":   method.RequiresAddress,
+		"estimated_days_min": method.EstimatedDaysMin,
+		"estimated_days_max": method.EstimatedDaysMax,
+		"is_active":          method.IsActive,
+		"updated_at":         time.Now(),
+	}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Shipping method code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipping method"})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping method not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping method updated successfully"})
+}
+
+func (h *ShippingHandler) DeleteShippingMethod(c *gin.Context) {
+	methodID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping method ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.methodsCollection.DeleteOne(ctx, bson.M{"_id": methodID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shipping method"})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping method not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping method deleted successfully"})
+}
+
+// CreateShipment ships some or all of the remaining physical items of an
+// order. Without items in the request every unshipped unit is included.
+func (h *ShippingHandler) CreateShipment(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req models.CreateShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order models.Order
+	err = h.ordersCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	if order.ShippingMethod == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order has no physical items to ship"})
+		return
+	}
+	if order.Status == "Cancelled" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot ship a cancelled order"})
+		return
+	}
+	if order.Preorder != nil && order.Preorder.Status != models.PreorderReleased {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot ship a pre-order before its release"})
+		return
+	}
+
+	remaining, items, err := h.unshippedQuantities(ctx, orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var shipmentItems []models.ShipmentItem
+	if len(req.Items) == 0 {
+		for _, item := range items {
+			if remaining[item.ID] > 0 {
+				shipmentItems = append(shipmentItems, models.ShipmentItem{OrderItemID: item.ID, BookID: item.BookID, Quantity: remaining[item.ID]})
+			}
+		}
+	} else {
+		byID := make(map[primitive.ObjectID]models.OrderItem)
+		for _, item := range items {
+			byID[item.ID] = item
+		}
+		for _, reqItem := range req.Items {
+			itemID, err := primitive.ObjectIDFromHex(reqItem.OrderItemID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order item ID"})
+				return
+			}
+			item, ok := byID[itemID]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Order item " + reqItem.OrderItemID + " is not a physical item of this order"})
+				return
+			}
+			if reqItem.Quantity > remaining[itemID] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity exceeds unshipped units for order item " + reqItem.OrderItemID})
+				return
+			}
+			remaining[itemID] -= reqItem.Quantity
+			shipmentItems = append(shipmentItems, models.ShipmentItem{OrderItemID: itemID, BookID: item.BookID, Quantity: reqItem.Quantity})
+		}
+	}
+	if len(shipmentItems) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "All items of this order have already been shipped"})
+		return
+	}
+
+	now := time.Now()
+	shipment := models.Shipment{
+		OrderID:        orderID,
+		UserID:         order.UserID,
+		Method:         order.ShippingMethod,
+		Carrier:        strings.TrimSpace(req.Carrier),
+		TrackingNumber: strings.TrimSpace(req.TrackingNumber),
+		Status:         models.ShipmentStatusPending,
+		Items:          shipmentItems,
+		Events:         []models.ShipmentEvent{{Status: models.ShipmentStatusPending, At: now}},
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	result, err := h.shipmentsCollection.InsertOne(ctx, shipment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipment"})
+		return
+	}
+	h.syncDeliveryStatus(ctx, orderID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Shipment created successfully",
+		"id":      result.InsertedID,
+	})
+}
+
+func (h *ShippingHandler) UpdateShipment(c *gin.Context) {
+	shipmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	var req models.UpdateShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var shipment models.Shipment
+	err = h.shipmentsCollection.FindOne(ctx, bson.M{"_id": shipmentID}).Decode(&shipment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	now := time.Now()
+	set := bson.M{"updated_at": now}
+	update := bson.M{"$set": set}
+	if req.Carrier != "" {
+		set["carrier"] = strings.TrimSpace(req.Carrier)
+	}
+	if req.TrackingNumber != "" {
+		set["tracking_number"] = strings.TrimSpace(req.TrackingNumber)
+	}
+	if (req.Status != "" && req.Status != shipment.Status) || req.Note != "" {
+		status := shipment.Status
+		if req.Status != "" {
+			status = req.Status
+		}
+		set["status"] = status
+		switch status {
+		case models.ShipmentStatusShipped, models.ShipmentStatusInTransit:
+			if shipment.ShippedAt == nil {
+				set["shipped_at"] = now
+			}
+		case models.ShipmentStatusDelivered:
+			set["delivered_at"] = now
+			if shipment.ShippedAt == nil {
+				set["shipped_at"] = now
+			}
+		}
+		update["$push"] = bson.M{"events": models.ShipmentEvent{Status: status, Note: req.Note, At: now}}
+	}
+
+	_, err = h.shipmentsCollection.UpdateOne(ctx, bson.M{"_id": shipmentID}, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipment"})
+		return
+	}
+	h.syncDeliveryStatus(ctx, shipment.OrderID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipment updated successfully"})
+}
+
+// unshippedQuantities returns the physical order items and, per item, how
+// many units are not yet part of a shipment.
+func (h *ShippingHandler) unshippedQuantities(ctx context.Context, orderID primitive.ObjectID) (map[primitive.ObjectID]int, []models.OrderItem, error) {
+	cursor, err := h.orderItemsCollection.Find(ctx, bson.M{"order_id": orderID})
+	if err != nil {
+		return nil, nil, err
+	}
+	var allItems []models.OrderItem
+	if err := cursor.All(ctx, &allItems); err != nil {
+		return nil, nil, err
+	}
+
+	remaining := make(map[primitive.ObjectID]int)
+	var items []models.OrderItem
+	for _, item := range allItems {
+		if services.GoodsCategory(item.FormatType) == services.GoodsPhysical {
+			items = append(items, item)
+			remaining[item.ID] = item.Quantity
+		}
+	}
+
+	shipments, err := h.orderShipments(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, s := range shipments {
+		if s.Status == models.ShipmentStatusReturned {
+			continue
+		}
+		for _, si := range s.Items {
+			remaining[si.OrderItemID] -= si.Quantity
+		}
+	}
+	return remaining, items, nil
+}
+
+func (h *ShippingHandler) orderShipments(ctx context.Context, orderID primitive.ObjectID) ([]models.Shipment, error) {
+	cursor, err := h.shipmentsCollection.Find(ctx, bson.M{"order_id": orderID})
+	if err != nil {
+		return nil, err
+	}
+	var shipments []models.Shipment
+	err = cursor.All(ctx, &shipments)
+	return shipments, err
+}
+
+// syncDeliveryStatus derives the order level delivery_status from its
+// shipments: delivered once every physical unit is delivered, in_transit
+// while anything is on its way and accepted while parcels are being prepared.
+func (h *ShippingHandler) syncDeliveryStatus(ctx context.Context, orderID primitive.ObjectID) {
+	remaining, _, err := h.unshippedQuantities(ctx, orderID)
+	if err != nil {
+		return
+	}
+	shipments, err := h.orderShipments(ctx, orderID)
+	if err != nil {
+		return
+	}
+
+	allShipped := true
+	for _, qty := range remaining {
+		if qty > 0 {
+			allShipped = false
+		}
+	}
+
+	status := models.ShipmentStatusPending
+	allDelivered := allShipped && len(shipments) > 0
+	for _, s := range shipments {
+		switch s.Status {
+		case models.ShipmentStatusShipped, models.ShipmentStatusInTransit, models.ShipmentStatusDelivered:
+			status = "in_transit"
+		case models.ShipmentStatusPending, models.ShipmentStatusPacked:
+			if status == models.ShipmentStatusPending {
+				status = "accepted"
+			}
+		}
+		if s.Status != models.ShipmentStatusDelivered && s.Status != models.ShipmentStatusReturned {
+			allDelivered = false
+		}
+	}
+	if allDelivered {
+		status = models.ShipmentStatusDelivered
+	}
+
+	_, _ = h.ordersCollection.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{"$set": bson.M{
+		"delivery_status": status,
+		"updated_at":      time.Now(),
+	}})
+}
+
+func shippingMethodFromRequest(req models.ShippingMethodRequest) models.ShippingMethod {
+	countries := make([]string, len(req.Countries))
+	for i, country := range req.Countries {
+		countries[i] = strings.ToUpper(country)
+	}
+	return models.ShippingMethod{
+		Code:             strings.ToLower(strings.TrimSpace(req.Code)),
+		Name:             req.Name,
+		RateType:         req.RateType,
+		BaseFee:          req.BaseFee,
+		PerItemFee:       req.PerItemFee,
+		PerKgFee:         req.PerKgFee,
+		FreeOver:         req.FreeOver,
+		Countries:        countries,
+		RequiresAddress:  req.RequiresAddress,
+		EstimatedDaysMin: req.EstimatedDaysMin,
+		EstimatedDaysMax: req.EstimatedDaysMax,
+		IsActive:         req.IsActive == nil || *req.IsActive,
+	}
+}
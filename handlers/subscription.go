@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SubscriptionHandler struct {
+	subscriptionService *services.SubscriptionService
+}
+
+func NewSubscriptionHandler(subscriptionService *services.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+	}
+}
+
+func (h *SubscriptionHandler) GetPlans(c *gin.Context) {
+	c.JSON(http.StatusOK, h.subscriptionService.Plans())
+}
+
+// GetSubscription returns the current subscription, if any, together with
+// the user's full subscription history.
+func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	h.respondSubscription(c, userID)
+}
+
+func (h *SubscriptionHandler) Subscribe(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.subscribe(c, userID, strings.ToLower(req.Plan), req.AutoRenew == nil || *req.AutoRenew)
+}
+
+// PurchasePremium is the original one-click upgrade; it starts an
+// auto-renewing monthly subscription.
+func (h *SubscriptionHandler) PurchasePremium(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	h.subscribe(c, userID, "monthly", true)
+}
+
+func (h *SubscriptionHandler) subscribe(c *gin.Context, userID primitive.ObjectID, plan string, autoRenew bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, err := h.subscriptionService.Subscribe(ctx, userID, plan, autoRenew)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Premium membership active",
+		"subscription":  sub,
+		"premium_until": sub.CurrentPeriodEnd,
+	})
+}
+
+// CancelSubscription turns off renewal; premium stays until the period ends.
+func (h *SubscriptionHandler) CancelSubscription(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, err := h.subscriptionService.Cancel(ctx, userID)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Premium membership cancelled; benefits remain until the end of the current period",
+		"subscription":  sub,
+		"premium_until": sub.CurrentPeriodEnd,
+	})
+}
+
+func (h *SubscriptionHandler) ResumeSubscription(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, err := h.subscriptionService.Resume(ctx, userID)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Premium membership will renew automatically",
+		"subscription": sub,
+	})
+}
+
+// GrantPremium lets an admin give a user free premium days, extending any
+// running subscription.
+func (h *SubscriptionHandler) GrantPremium(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Days int    `json:"days" binding:"required,gt=0"`
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, err := h.subscriptionService.Grant(ctx, userID, req.Days, strings.TrimSpace(req.Note))
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User upgraded to premium", "premium_until": sub.CurrentPeriodEnd})
+}
+
+func (h *SubscriptionHandler) GetUserSubscription(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	h.respondSubscription(c, userID)
+}
+
+func (h *SubscriptionHandler) respondSubscription(c *gin.Context, userID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, err := h.subscriptionService.Current(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscription"})
+		return
+	}
+	history, err := h.subscriptionService.History(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscription history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subscription": sub,
+		"history":      history,
+	})
+}
+
+func respondSubscriptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownPlan):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadySubscribed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNoSubscription):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSubscriptionPayment):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription"})
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TaxHandler struct {
+	taxRulesCollection *mongo.Collection
+	taxService         *services.TaxService
+}
+
+func NewTaxHandler(taxRulesCollection *mongo.Collection, taxService *services.TaxService) *TaxHandler {
+	return &TaxHandler{
+		taxRulesCollection: taxRulesCollection,
+		taxService:         taxService,
+	}
+}
+
+func (h *TaxHandler) GetTaxRules(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "country", Value: 1}, {Key: "region", Value: 1}})
+	cursor, err := h.taxRulesCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tax rules"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var rules []models.TaxRule
+	if err = cursor.All(ctx, &rules); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode tax rules"})
+		return
+	}
+
+	if rules == nil {
+		rules = []models.TaxRule{}
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *TaxHandler) CreateTaxRule(c *gin.Context) {
+	var req models.TaxRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rule := models.TaxRule{
+		Country:      strings.ToUpper(req.Country),
+		Region:       strings.ToUpper(strings.TrimSpace(req.Region)),
+		Name:         req.Name,
+		PhysicalRate: req.PhysicalRate,
+		DigitalRate:  req.DigitalRate,
+		IsActive:     req.IsActive == nil || *req.IsActive,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	result, err := h.taxRulesCollection.InsertOne(ctx, rule)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tax rule for this country and region already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tax rule"})
+		return
+	}
+	h.taxService.Invalidate()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Tax rule created successfully",
+		"id":      result.InsertedID,
+	})
+}
+
+func (h *TaxHandler) UpdateTaxRule(c *gin.Context) {
+	ruleID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rule ID"})
+		return
+	}
+
+	var req models.TaxRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.taxRulesCollection.UpdateOne(ctx, bson.M{"_id": ruleID}, bson.M{"$set": bson.M{
+		"country":       strings.ToUpper(req.Country),
+		"region":        strings.ToUpper(strings.TrimSpace(req.Region)),
+		"name":          req.Name,
+		"physical_rate": req.PhysicalRate,
+		"digital_rate":  req.DigitalRate,
+		"is_active":     req.IsActive == nil || *req.IsActive,
+		"updated_at":    time.Now(),
+	}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tax rule for this country and region already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tax rule"})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax rule not found"})
+		return
+	}
+	h.taxService.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tax rule updated successfully"})
+}
+
+func (h *TaxHandler) DeleteTaxRule(c *gin.Context) {
+	ruleID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rule ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := h.taxRulesCollection.DeleteOne(ctx, bson.M{"_id": ruleID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tax rule"})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax rule not found"})
+		return
+	}
+	h.taxService.Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tax rule deleted successfully"})
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type WalletHandler struct {
+	creditService *services.CreditService
+}
+
+func NewWalletHandler(creditService *services.CreditService) *WalletHandler {
+	return &WalletHandler{
+		creditService: creditService,
+	}
+}
+
+func (h *WalletHandler) GetWallet(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	h.respondWallet(c, userID)
+}
+
+func (h *WalletHandler) GetUserWallet(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	h.respondWallet(c, userID)
+}
+
+// RedeemGiftCard moves a gift card's balance into the user's store credit.
+func (h *WalletHandler) RedeemGiftCard(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var req models.RedeemGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	amount, err := h.creditService.RedeemToWallet(ctx, userID, req.Code)
+	if err != nil {
+		respondGiftCardError(c, err)
+		return
+	}
+
+	balance, _ := h.creditService.WalletBalance(ctx, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Gift card redeemed", "amount": amount, "balance": balance})
+}
+
+func (h *WalletHandler) AdjustWallet(c *gin.Context) {
+	adminID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.WalletAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := h.creditService.WalletBalance(ctx, userID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		}
+		return
+	}
+
+	if err := h.creditService.AdjustWallet(ctx, userID, req.Amount, reason, adminID); err != nil {
+		respondGiftCardError(c, err)
+		return
+	}
+
+	balance, _ := h.creditService.WalletBalance(ctx, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Store credit adjusted", "balance": balance})
+}
+
+func (h *WalletHandler) respondWallet(c *gin.Context, userID primitive.ObjectID) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	balance, err := h.creditService.WalletBalance(ctx, userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store credit"})
+		}
+		return
+	}
+
+	transactions, err := h.creditService.Transactions(ctx, bson.M{"account": models.CreditAccountWallet, "user_id": userID}, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch store credit history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balance": balance, "transactions": transactions})
+}
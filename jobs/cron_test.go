@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// 2024-01-01 is a Monday
+	from := time.Date(2024, time.January, 1, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr    string
+		next    time.Time
+		wantErr bool
+	}{
+		{expr: "* * * * *", next: time.Date(2024, 1, 1, 10, 18, 0, 0, time.UTC)},
+		{expr: "@hourly", next: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{expr: "@daily", next: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "@weekly", next: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", next: time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{expr: "0-30/10 9-17 * * *", next: time.Date(2024, 1, 1, 10, 20, 0, 0, time.UTC)},
+		{expr: "5/20 * * * *", next: time.Date(2024, 1, 1, 10, 25, 0, 0, time.UTC)},
+		{expr: "0 3,22 * * *", next: time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)},
+		{expr: "30 2 15 * *", next: time.Date(2024, 1, 15, 2, 30, 0, 0, time.UTC)},
+		{expr: "0 0 1 3 *", next: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 12 * * 5", next: time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{expr: "0 12 * * 7", next: time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC)},
+		// with both day fields restricted either one matches
+		{expr: "0 0 20 * 3", next: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{expr: "  0 0 * * *  ", next: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", next: time.Time{}},
+		{expr: "", wantErr: true},
+		{expr: "* * * *", wantErr: true},
+		{expr: "* * * * * *", wantErr: true},
+		{expr: "@monthly", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "10-5 * * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "a * * * *", wantErr: true},
+		{expr: "1-b * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseSchedule(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSchedule(%q) error = nil, want an error", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) error = %v", tt.expr, err)
+			}
+			if got := s.Next(from); !got.Equal(tt.next) {
+				t.Errorf("ParseSchedule(%q).Next(%v) = %v, want %v", tt.expr, from, got, tt.next)
+			}
+		})
+	}
+}
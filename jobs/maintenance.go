@@ -0,0 +1,214 @@
+package jobs
+
+import (
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SubscriptionExpiry renews due subscriptions and expires lapsed memberships.
+func SubscriptionExpiry(subscriptionService *services.SubscriptionService) Job {
+	return Job{
+		Name:        "subscription-expiry",
+		Description: "Renew due premium subscriptions and expire lapsed memberships",
+		Schedule:    "*/15 * * * *",
+		Run: func(ctx context.Context) (string, error) {
+			n, err := subscriptionService.ProcessDue(ctx, time.Now())
+			return fmt.Sprintf("%d memberships updated", n), err
+		},
+	}
+}
+
+// PointsExpiry expires loyalty points that were earned longer ago than the
+// configured expiry period and have not been spent.
+func PointsExpiry(pointsService *services.PointsService) Job {
+	return Job{
+		Name:        "points-expiry",
+		Description: "Expire unspent loyalty points past their expiry date",
+		Schedule:    "15 2 * * *",
+		Run: func(ctx context.Context) (string, error) {
+			n, err := pointsService.Expire(ctx, time.Now())
+			return fmt.Sprintf("%d points expired", n), err
+		},
+	}
+}
+
+// LoyaltyTiers recalculates every user's loyalty tier, so spend that has
+// left the rolling window lowers the tier.
+func LoyaltyTiers(loyaltyService *services.LoyaltyService) Job {
+	return Job{
+		Name:        "loyalty-tiers",
+		Description: "Recalculate loyalty tiers over the rolling spend window",
+		Schedule:    "45 1 * * *",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := loyaltyService.RecalculateAll(ctx, time.Now())
+			return fmt.Sprintf("%d tier changes", n), err
+		},
+	}
+}
+
+// GiftExpiry expires unclaimed gifts and refunds them to their senders.
+func GiftExpiry(giftService *services.GiftService) Job {
+	return Job{
+		Name:        "gift-expiry",
+		Description: "Expire unclaimed gifts and refund the senders",
+		Schedule:    "0 * * * *",
+		Run: func(ctx context.Context) (string, error) {
+			n, err := giftService.Expire(ctx, time.Now())
+			return fmt.Sprintf("%d gifts expired", n), err
+		},
+	}
+}
+
+// MetadataEnrichment fills in missing descriptions and covers of books from
+// the metadata source.
+func MetadataEnrichment(metadataService *services.MetadataService) Job {
+	return Job{
+		Name:        "metadata-enrichment",
+		Description: "Fill in missing book descriptions and covers from the metadata source",
+		Schedule:    "20 4 * * *",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := metadataService.Enrich(ctx, time.Now())
+			return fmt.Sprintf("%d books enriched", n), err
+		},
+	}
+}
+
+// PreorderRelease fulfils pre-orders whose books have been released.
+func PreorderRelease(preorderService *services.PreorderService) Job {
+	return Job{
+		Name:        "preorder-release",
+		Description: "Take payment for released pre-orders, fulfil them and notify the customers",
+		Schedule:    "5 * * * *",
+		Timeout:     15 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := preorderService.Release(ctx, time.Now())
+			return fmt.Sprintf("%d pre-orders released", n), err
+		},
+	}
+}
+
+// CatalogImports fails catalog imports whose run was cut off, so they do not
+// stay queued or processing forever.
+func CatalogImports(catalogService *services.CatalogService) Job {
+	return Job{
+		Name:        "catalog-imports",
+		Description: "Mark catalog imports interrupted by a restart as failed",
+		Schedule:    "*/10 * * * *",
+		Run: func(ctx context.Context) (string, error) {
+			n, err := catalogService.FailInterrupted(ctx, time.Now())
+			return fmt.Sprintf("%d interrupted imports failed", n), err
+		},
+	}
+}
+
+// Recommendations rebuilds the cached related books and personal
+// recommendations from the latest orders, libraries and wishlists.
+func Recommendations(recommendationService *services.RecommendationService) Job {
+	return Job{
+		Name:        "recommendations",
+		Description: "Recompute related books and personal recommendations",
+		Schedule:    "40 3 * * *",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			books, users, err := recommendationService.Compute(ctx, time.Now())
+			return fmt.Sprintf("%d books and %d users computed", books, users), err
+		},
+	}
+}
+
+// DigitalAccessCleanup removes rentals whose expiry date has passed. The
+// library already hides them; this keeps the collection small.
+func DigitalAccessCleanup(digitalAccessCollection *mongo.Collection) Job {
+	return Job{
+		Name:        "digital-access-cleanup",
+		Description: "Delete expired rental grants",
+		Schedule:    "30 3 * * *",
+		Run: func(ctx context.Context) (string, error) {
+			result, err := digitalAccessCollection.DeleteMany(ctx, bson.M{
+				"expiry_date": bson.M{"$lte": time.Now()},
+			})
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d expired grants removed", result.DeletedCount), nil
+		},
+	}
+}
+
+// DailyStats rolls up yesterday's and today's orders into daily_stats.
+// Yesterday is redone so late status changes (completions, refunds) are
+// picked up.
+func DailyStats(ordersCollection, usersCollection, statsCollection *mongo.Collection) Job {
+	return Job{
+		Name:        "daily-stats",
+		Description: "Roll up orders, revenue, tax, refunds and sign-ups per day",
+		Schedule:    "5 * * * *",
+		Run: func(ctx context.Context) (string, error) {
+			today := time.Now().Truncate(24 * time.Hour)
+			for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+				if err := rollupDay(ctx, ordersCollection, usersCollection, statsCollection, day); err != nil {
+					return "", err
+				}
+			}
+			return "rolled up " + today.AddDate(0, 0, -1).Format("2006-01-02") + " and " + today.Format("2006-01-02"), nil
+		},
+	}
+}
+
+func rollupDay(ctx context.Context, ordersCollection, usersCollection, statsCollection *mongo.Collection, day time.Time) error {
+	createdOn := bson.M{"created_at": bson.M{"$gte": day, "$lt": day.AddDate(0, 0, 1)}}
+
+	stats := models.DailyStats{Date: day.Format("2006-01-02"), UpdatedAt: time.Now()}
+
+	var err error
+	if stats.Orders, err = ordersCollection.CountDocuments(ctx, createdOn); err != nil {
+		return err
+	}
+	if stats.NewUsers, err = usersCollection.CountDocuments(ctx, createdOn); err != nil {
+		return err
+	}
+
+	var totals struct {
+		Count    int64        `bson:"count"`
+		Revenue  models.Money `bson:"revenue"`
+		Tax      models.Money `bson:"tax"`
+		Refunded models.Money `bson:"refunded"`
+	}
+	cursor, err := ordersCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"status": "Completed", "created_at": createdOn["created_at"]}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$total_amount"}}},
+			{Key: "tax", Value: bson.D{{Key: "$sum", Value: "$pricing.tax"}}},
+			{Key: "refunded", Value: bson.D{{Key: "$sum", Value: "$refunded_amount"}}},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&totals); err != nil {
+			cursor.Close(ctx)
+			return err
+		}
+	}
+	cursor.Close(ctx)
+
+	stats.CompletedOrders = totals.Count
+	stats.Revenue = totals.Revenue - totals.Refunded
+	stats.Tax = totals.Tax
+	stats.Refunded = totals.Refunded
+
+	_, err = statsCollection.ReplaceOne(ctx, bson.M{"_id": stats.Date}, stats, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,286 @@
+package jobs
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	ErrJobLocked  = errors.New("job is already running")
+)
+
+const defaultJobTimeout = 10 * time.Minute
+
+// Job is a unit of background work. Run returns a short summary of what it
+// did, which is kept in the run history.
+type Job struct {
+	Name        string
+	Description string
+	Schedule    string
+	Timeout     time.Duration
+	Run         func(ctx context.Context) (string, error)
+}
+
+type JobInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Schedule    string         `json:"schedule"`
+	NextRun     time.Time      `json:"next_run"`
+	LastRun     *models.JobRun `json:"last_run,omitempty"`
+}
+
+type registeredJob struct {
+	Job
+	schedule Schedule
+}
+
+// Runner runs registered jobs on their schedules. Every run takes a lock
+// document in job_locks first, so with several replicas each scheduled run
+// happens on only one of them.
+type Runner struct {
+	locksCollection *mongo.Collection
+	runsCollection  *mongo.Collection
+	instance        string
+
+	mu   sync.RWMutex
+	jobs map[string]*registeredJob
+}
+
+func NewRunner(locksCollection, runsCollection *mongo.Collection) *Runner {
+	host, _ := os.Hostname()
+	return &Runner{
+		locksCollection: locksCollection,
+		runsCollection:  runsCollection,
+		instance:        fmt.Sprintf("%s-%d-%s", host, os.Getpid(), primitive.NewObjectID().Hex()[18:]),
+		jobs:            make(map[string]*registeredJob),
+	}
+}
+
+func (r *Runner) Register(job Job) error {
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if job.Timeout == 0 {
+		job.Timeout = defaultJobTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.jobs[job.Name]; exists {
+		return fmt.Errorf("job %s is registered twice", job.Name)
+	}
+	r.jobs[job.Name] = &registeredJob{Job: job, schedule: schedule}
+	return nil
+}
+
+// Start checks the schedules at the top of every minute until ctx is done.
+func (r *Runner) Start(ctx context.Context) {
+	go func() {
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(next.Sub(now)):
+			}
+
+			r.mu.RLock()
+			for _, job := range r.jobs {
+				if job.schedule.Matches(next) {
+					go r.execute(ctx, job, next)
+				}
+			}
+			r.mu.RUnlock()
+		}
+	}()
+	log.Printf("Job runner started as %s with %d jobs", r.instance, len(r.jobs))
+}
+
+// Trigger starts a job immediately and returns its run record without
+// waiting for it to finish.
+func (r *Runner) Trigger(ctx context.Context, name string, triggeredBy primitive.ObjectID) (*models.JobRun, error) {
+	r.mu.RLock()
+	job, ok := r.jobs[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+
+	if !r.acquire(ctx, job) {
+		return nil, ErrJobLocked
+	}
+	run, err := r.startRun(ctx, job, models.JobTriggerManual, &triggeredBy)
+	if err != nil {
+		r.release(job.Name, time.Time{})
+		return nil, err
+	}
+	go r.finish(context.Background(), job, run, time.Time{})
+	return run, nil
+}
+
+func (r *Runner) Jobs(ctx context.Context) ([]JobInfo, error) {
+	r.mu.RLock()
+	var infos []JobInfo
+	for _, job := range r.jobs {
+		infos = append(infos, JobInfo{
+			Name:        job.Name,
+			Description: job.Description,
+			Schedule:    job.Schedule,
+			NextRun:     job.schedule.Next(time.Now()),
+		})
+	}
+	r.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	for i := range infos {
+		var last models.JobRun
+		opts := options.FindOne().SetSort(bson.D{{Key: "started_at", Value: -1}})
+		err := r.runsCollection.FindOne(ctx, bson.M{"job": infos[i].Name}, opts).Decode(&last)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos[i].LastRun = &last
+	}
+	if infos == nil {
+		infos = []JobInfo{}
+	}
+	return infos, nil
+}
+
+// Runs returns the most recent runs, optionally for a single job.
+func (r *Runner) Runs(ctx context.Context, name string, limit int64) ([]models.JobRun, error) {
+	filter := bson.M{}
+	if name != "" {
+		filter["job"] = name
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(limit)
+	cursor, err := r.runsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var runs []models.JobRun
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	if runs == nil {
+		runs = []models.JobRun{}
+	}
+	return runs, nil
+}
+
+// execute runs job for the scheduled minute slot. The lock is held at least
+// until the slot is over so a replica whose clock is a little behind does
+// not run the same slot again.
+func (r *Runner) execute(ctx context.Context, job *registeredJob, slot time.Time) {
+	if !r.acquire(ctx, job) {
+		return
+	}
+	holdUntil := slot.Add(time.Minute)
+	run, err := r.startRun(ctx, job, models.JobTriggerSchedule, nil)
+	if err != nil {
+		log.Printf("Job %s: failed to record run: %v", job.Name, err)
+		r.release(job.Name, holdUntil)
+		return
+	}
+	r.finish(ctx, job, run, holdUntil)
+}
+
+func (r *Runner) startRun(ctx context.Context, job *registeredJob, trigger string, triggeredBy *primitive.ObjectID) (*models.JobRun, error) {
+	run := &models.JobRun{
+		Job:         job.Name,
+		Trigger:     trigger,
+		TriggeredBy: triggeredBy,
+		Instance:    r.instance,
+		Status:      models.JobRunRunning,
+		StartedAt:   time.Now(),
+	}
+	result, err := r.runsCollection.InsertOne(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	run.ID = result.InsertedID.(primitive.ObjectID)
+	return run, nil
+}
+
+func (r *Runner) finish(ctx context.Context, job *registeredJob, run *models.JobRun, holdUntil time.Time) {
+	defer r.release(job.Name, holdUntil)
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	summary, err := func() (summary string, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		return job.Run(runCtx)
+	}()
+	cancel()
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Result = summary
+	run.Status = models.JobRunSucceeded
+	if err != nil {
+		run.Status = models.JobRunFailed
+		run.Error = err.Error()
+		log.Printf("Job %s failed: %v", job.Name, err)
+	}
+
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer saveCancel()
+	_, _ = r.runsCollection.UpdateOne(saveCtx, bson.M{"_id": run.ID}, bson.M{"$set": bson.M{
+		"status":      run.Status,
+		"result":      run.Result,
+		"error":       run.Error,
+		"finished_at": finished,
+	}})
+}
+
+// acquire takes the lock for job until its timeout runs out. A lock left
+// behind by a crashed instance expires on its own.
+func (r *Runner) acquire(ctx context.Context, job *registeredJob) bool {
+	now := time.Now()
+	_, err := r.locksCollection.UpdateOne(ctx,
+		bson.M{"_id": job.Name, "locked_until": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"instance": r.instance, "locked_until": now.Add(job.Timeout)}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		// the upsert collides with the existing, still valid lock
+		if !mongo.IsDuplicateKeyError(err) {
+			log.Printf("Job %s: failed to acquire lock: %v", job.Name, err)
+		}
+		return false
+	}
+	return true
+}
+
+func (r *Runner) release(name string, holdUntil time.Time) {
+	if now := time.Now(); holdUntil.Before(now) {
+		holdUntil = now
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = r.locksCollection.UpdateOne(ctx,
+		bson.M{"_id": name, "instance": r.instance},
+		bson.M{"$set": bson.M{"locked_until": holdUntil}},
+	)
+}
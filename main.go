@@ -3,7 +3,9 @@ package main
 import (
 	"bookstore/config"
 	"bookstore/db"
+	"bookstore/jobs"
 	"bookstore/routes"
+	"context"
 	"log"
 
 	"github.com/gin-gonic/gin"
@@ -26,7 +28,12 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok", "message": "Bookstore API is running"})
 	})
 
-	routes.SetupRoutes(router, database.DB, cfg.JWTSecret)
+	jobRunner := jobs.NewRunner(database.DB.Collection("job_locks"), database.DB.Collection("job_runs"))
+	routes.SetupRoutes(router, database.DB, cfg, jobRunner)
+
+	ctx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobRunner.Start(ctx)
 
 	router.Static("/assets", "./frontend/dist/assets")
 	// Для SPA: отдаём index.html для /admin и всех вложенных путей
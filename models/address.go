@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var postalCodePatterns = map[string]*regexp.Regexp{
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"KZ": regexp.MustCompile(`^\d{6}$`),
+	"RU": regexp.MustCompile(`^\d{6}$`),
+}
+
+// countries whose addresses are not deliverable without a region code
+var regionRequired = map[string]bool{"US": true, "CA": true}
+
+// Address is a structured postal address. Country is an ISO 3166-1 alpha-2
+// code and Region a state/province code where the country uses them.
+type Address struct {
+	FullName   string `bson:"full_name" json:"full_name" binding:"required"`
+	Line1      string `bson:"line1" json:"line1" binding:"required"`
+	Line2      string `bson:"line2,omitempty" json:"line2,omitempty"`
+	City       string `bson:"city" json:"city" binding:"required"`
+	Region     string `bson:"region,omitempty" json:"region,omitempty"`
+	PostalCode string `bson:"postal_code" json:"postal_code"`
+	Country    string `bson:"country" json:"country" binding:"required,iso3166_1_alpha2"`
+	Phone      string `bson:"phone,omitempty" json:"phone,omitempty"`
+}
+
+func (a *Address) Normalize() {
+	a.FullName = strings.TrimSpace(a.FullName)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.ToUpper(strings.TrimSpace(a.Region))
+	a.PostalCode = strings.ToUpper(strings.TrimSpace(a.PostalCode))
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	a.Phone = strings.TrimSpace(a.Phone)
+}
+
+// Validate checks the parts the binding tags cannot: postal code format and
+// region presence for the countries we know the rules of. Call Normalize first.
+func (a Address) Validate() error {
+	if regionRequired[a.Country] && a.Region == "" {
+		return fmt.Errorf("region is required for %s addresses", a.Country)
+	}
+	if pattern, ok := postalCodePatterns[a.Country]; ok {
+		if !pattern.MatchString(a.PostalCode) {
+			return fmt.Errorf("invalid postal code %q for %s", a.PostalCode, a.Country)
+		}
+	}
+	return nil
+}
+
+// String formats the address on one line, as stored in the legacy
+// delivery_address field.
+func (a Address) String() string {
+	parts := []string{a.FullName, a.Line1, a.Line2, a.City, strings.TrimSpace(a.Region + " " + a.PostalCode), a.Country}
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, ", ")
+}
+
+// SavedAddress is an entry in a customer's address book.
+type SavedAddress struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Label     string             `bson:"label" json:"label"`
+	Address   Address            `bson:"address" json:"address"`
+	IsDefault bool               `bson:"is_default" json:"is_default"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type SavedAddressRequest struct {
+	Label     string  `json:"label"`
+	Address   Address `json:"address" binding:"required"`
+	IsDefault bool    `json:"is_default"`
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuthorRoleAuthor      = "author"
+	AuthorRoleTranslator  = "translator"
+	AuthorRoleIllustrator = "illustrator"
+)
+
+// Author is a person credited on books. Key is the normalized name and is
+// unique, so "J.K. Rowling" and "J. K. Rowling" are the same author.
+type Author struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Key       string             `bson:"key" json:"-"`
+	Bio       string             `bson:"bio,omitempty" json:"bio,omitempty"`
+	PhotoURL  string             `bson:"photo_url,omitempty" json:"photo_url,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// BookAuthor credits an author on a book. The name is copied from the
+// author so books can be listed without a lookup.
+type BookAuthor struct {
+	AuthorID primitive.ObjectID `bson:"author_id" json:"author_id"`
+	Name     string             `bson:"name" json:"name"`
+	Role     string             `bson:"role" json:"role"`
+}
+
+// BookAuthorInput credits an existing author by ID or any author by name;
+// unknown names become new authors.
+type BookAuthorInput struct {
+	AuthorID string `json:"author_id"`
+	Name     string `json:"name" binding:"required_without=AuthorID,max=200"`
+	Role     string `json:"role" binding:"omitempty,oneof=author translator illustrator"`
+}
+
+type AuthorRequest struct {
+	Name     string `json:"name" binding:"required,max=200"`
+	Bio      string `json:"bio" binding:"max=5000"`
+	PhotoURL string `json:"photo_url" binding:"omitempty,url"`
+}
+
+type MergeAuthorRequest struct {
+	Into string `json:"into" binding:"required"`
+}
+
+// AuthorKey normalizes an author name for matching: letters and digits
+// only, lower case.
+func AuthorKey(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// SplitAuthorNames splits a free-text author string such as
+// "Terry Pratchett & Neil Gaiman" into names.
+func SplitAuthorNames(author string) []string {
+	var names []string
+	for _, part := range strings.FieldsFunc(strings.ReplaceAll(author, " and ", "&"), func(r rune) bool { return r == '&' || r == ';' }) {
+		if name := strings.Join(strings.Fields(part), " "); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// AuthorLine is the display form of a book's credits: the names of its
+// authors, or of everyone credited when nobody has the author role.
+func AuthorLine(authors []BookAuthor) string {
+	var names []string
+	for _, a := range authors {
+		if a.Role == AuthorRoleAuthor {
+			names = append(names, a.Name)
+		}
+	}
+	if len(names) == 0 {
+		for _, a := range authors {
+			names = append(names, a.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -1,50 +1,160 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// RentalPrice is the price of renting an e-book for Days days.
+type RentalPrice struct {
+	Days  int   `bson:"days" json:"days" binding:"required,oneof=7 14 30"`
+	Price Money `bson:"price" json:"price" binding:"required,gt=0"`
+}
+
+// BookFormat is a way of buying a book. The "rental" format is a
+// time-limited e-book priced per period in RentalPrices; Price is unused
+// for it. ReleaseDate overrides the book's release date for this format.
 type BookFormat struct {
-	Type          string  `bson:"type" json:"type"`
-	Price         float64 `bson:"price" json:"price"`
-	StockQuantity int     `bson:"stock_quantity" json:"stock_quantity"`
-	AccessURL     string  `bson:"access_url,omitempty" json:"access_url,omitempty"`
+	Type          string        `bson:"type" json:"type"`
+	Price         Money         `bson:"price" json:"price"`
+	StockQuantity int           `bson:"stock_quantity" json:"stock_quantity"`
+	AccessURL     string        `bson:"access_url,omitempty" json:"access_url,omitempty"`
+	WeightGrams   int           `bson:"weight_grams,omitempty" json:"weight_grams,omitempty"`
+	RentalPrices  []RentalPrice `bson:"rental_prices,omitempty" json:"rental_prices,omitempty"`
+	ReleaseDate   *time.Time    `bson:"release_date,omitempty" json:"release_date,omitempty"`
+}
+
+// RentalPriceFor returns the price of renting for the given number of days.
+func (f BookFormat) RentalPriceFor(days int) (Money, bool) {
+	for _, p := range f.RentalPrices {
+		if p.Days == days {
+			return p.Price, true
+		}
+	}
+	return 0, false
 }
 
+// Book is a catalog entry.
 type Book struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Title         string             `bson:"title" json:"title"`
-	Author        string             `bson:"author" json:"author"`
-	Description   string             `bson:"description" json:"description"`
-	ImageURL      string             `bson:"image_url" json:"image_url"`
-	PublishedYear int                `bson:"published_year" json:"published_year"`
-	ISBN          string             `bson:"isbn" json:"isbn"`
-	Category      string             `bson:"category" json:"category"`
-	Rating        float64            `bson:"rating" json:"rating"`
-	TotalRatings  int                `bson:"total_ratings" json:"total_ratings"`
-	Formats       []BookFormat       `bson:"formats" json:"formats"`
-	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+	ID    primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Title string             `bson:"title" json:"title"`
+	// Author is the display line built from Authors (see AuthorLine), kept
+	// for searching and for clients that show a single string.
+	Author        string       `bson:"author" json:"author"`
+	Authors       []BookAuthor `bson:"authors,omitempty" json:"authors"`
+	Description   string       `bson:"description" json:"description"`
+	ImageURL      string       `bson:"image_url" json:"image_url"`
+	PublishedYear int          `bson:"published_year" json:"published_year"`
+	// ISBN is always a valid ISBN-13 and unique. A stored ISBN that was
+	// invalid or taken by another book is kept in LegacyISBN until it is
+	// corrected.
+	ISBN       string `bson:"isbn,omitempty" json:"isbn"`
+	LegacyISBN string `bson:"legacy_isbn,omitempty" json:"-"`
+	// Category is the name of the category CategoryID points to, and
+	// CategoryPath holds that category and its ancestors.
+	Category       string               `bson:"category" json:"category"`
+	CategoryID     *primitive.ObjectID  `bson:"category_id,omitempty" json:"category_id,omitempty"`
+	CategoryPath   []primitive.ObjectID `bson:"category_path,omitempty" json:"-"`
+	Tags           []string             `bson:"tags,omitempty" json:"tags"`
+	SeriesID       *primitive.ObjectID  `bson:"series_id,omitempty" json:"series_id,omitempty"`
+	SeriesPosition float64              `bson:"series_position,omitempty" json:"series_position,omitempty"`
+	// WorkID is shared by the books of the same work.
+	WorkID   *primitive.ObjectID `bson:"work_id,omitempty" json:"work_id,omitempty"`
+	Language string              `bson:"language,omitempty" json:"language,omitempty"`
+	// TranslatedFrom is the language a translation was made from.
+	TranslatedFrom string `bson:"translated_from,omitempty" json:"translated_from,omitempty"`
+	// MetadataCheckedAt is when the enrichment job last looked the book up.
+	MetadataCheckedAt *time.Time `bson:"metadata_checked_at,omitempty" json:"-"`
+	// Cover is an uploaded cover image, whose URL is then also the ImageURL.
+	Cover *StoredImage `bson:"cover,omitempty" json:"cover,omitempty"`
+	// ReleaseDate is when an upcoming book goes on sale; until then its
+	// formats can only be pre-ordered.
+	ReleaseDate *time.Time `bson:"release_date,omitempty" json:"release_date,omitempty"`
+	// DeletedAt is set on a deleted book: it is left out of the catalog but
+	// still found by ID for the orders and libraries that point at it.
+	DeletedAt    *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedBy    *primitive.ObjectID `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
+	Rating       float64             `bson:"rating" json:"rating"`
+	TotalRatings int                 `bson:"total_ratings" json:"total_ratings"`
+	Formats      []BookFormat        `bson:"formats" json:"formats"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// ReleaseDateOf is when a format of the book goes on sale: its own release
+// date, or else the book's. It is nil for books without one.
+func (b Book) ReleaseDateOf(f BookFormat) *time.Time {
+	if f.ReleaseDate != nil {
+		return f.ReleaseDate
+	}
+	return b.ReleaseDate
 }
 
+// Released reports whether a format of the book is on sale at now.
+func (b Book) Released(f BookFormat, now time.Time) bool {
+	date := b.ReleaseDateOf(f)
+	return date == nil || !date.After(now)
+}
+
+// AuthorNames lists everyone credited on the book. Books saved before
+// authors were tracked fall back to the display line.
+func (b Book) AuthorNames() []string {
+	if len(b.Authors) == 0 {
+		return SplitAuthorNames(b.Author)
+	}
+	names := make([]string, len(b.Authors))
+	for i, a := range b.Authors {
+		names[i] = a.Name
+	}
+	return names
+}
+
+// CreateBookRequest credits authors through Authors, or through Author,
+// which may name several people separated by "&", "and" or ";". The
+// category is given by CategoryID or by the name in Category. EditionOf
+// names another book of the same work, which this book joins.
 type CreateBookRequest struct {
-	Title         string            `json:"title" binding:"required"`
-	Author        string            `json:"author" binding:"required"`
-	Description   string            `json:"description"`
-	ImageURL      string            `json:"image_url"`
-	PublishedYear int               `json:"published_year"`
-	ISBN          string            `json:"isbn"`
-	Category      string            `json:"category"`
-	Formats       []BookFormatInput `json:"formats" binding:"required"`
+	Title          string            `json:"title" binding:"required"`
+	Author         string            `json:"author" binding:"required_without=Authors"`
+	Authors        []BookAuthorInput `json:"authors" binding:"dive"`
+	Description    string            `json:"description"`
+	ImageURL       string            `json:"image_url"`
+	PublishedYear  int               `json:"published_year"`
+	ISBN           string            `json:"isbn"`
+	Category       string            `json:"category"`
+	CategoryID     string            `json:"category_id"`
+	Tags           []string          `json:"tags" binding:"omitempty,max=20,dive,max=50"`
+	SeriesID       string            `json:"series_id"`
+	SeriesPosition float64           `json:"series_position" binding:"gte=0"`
+	EditionOf      string            `json:"edition_of"`
+	Language       string            `json:"language" binding:"omitempty,bcp47_language_tag"`
+	TranslatedFrom string            `json:"translated_from" binding:"omitempty,bcp47_language_tag"`
+	ReleaseDate    *time.Time        `json:"release_date"`
+	Formats        []BookFormatInput `json:"formats" binding:"required"`
 }
 
 type BookFormatInput struct {
-	Type          string  `json:"type" binding:"required,oneof=physical digital both"`
-	Price         float64 `json:"price" binding:"required,gt=0"`
-	StockQuantity int     `json:"stock_quantity" binding:"required,gte=0"`
-	AccessURL     string  `json:"access_url"`
+	Type          string        `json:"type" binding:"required,oneof=physical digital both rental"`
+	Price         Money         `json:"price" binding:"required_unless=Type rental,gte=0"`
+	StockQuantity int           `json:"stock_quantity" binding:"required,gte=0"`
+	AccessURL     string        `json:"access_url"`
+	WeightGrams   int           `json:"weight_grams" binding:"gte=0"`
+	RentalPrices  []RentalPrice `json:"rental_prices" binding:"required_if=Type rental,dive"`
+	ReleaseDate   *time.Time    `json:"release_date"`
+}
+
+// BookFormat converts the input into the stored format.
+func (f BookFormatInput) BookFormat() BookFormat {
+	return BookFormat{
+		Type:          f.Type,
+		Price:         f.Price,
+		StockQuantity: f.StockQuantity,
+		WeightGrams:   f.WeightGrams,
+		RentalPrices:  f.RentalPrices,
+		ReleaseDate:   f.ReleaseDate,
+	}
 }
 
 type BookWithFormats struct {
@@ -58,12 +168,110 @@ type BookWithFormats struct {
 }
 
 type UpdateBookRequest struct {
-	Title         string            `json:"title"`
-	Author        string            `json:"author"`
-	Description   string            `json:"description"`
-	ImageURL      string            `json:"image_url"`
-	PublishedYear int               `json:"published_year"`
-	ISBN          string            `json:"isbn"`
-	Category      string            `json:"category"`
-	Formats       []BookFormatInput `json:"formats"`
+	Title          string            `json:"title"`
+	Author         string            `json:"author"`
+	Authors        []BookAuthorInput `json:"authors" binding:"dive"`
+	Description    string            `json:"description"`
+	ImageURL       string            `json:"image_url"`
+	PublishedYear  int               `json:"published_year"`
+	ISBN           string            `json:"isbn"`
+	Category       string            `json:"category"`
+	CategoryID     string            `json:"category_id"`
+	Tags           []string          `json:"tags" binding:"omitempty,max=20,dive,max=50"`
+	SeriesID       string            `json:"series_id"`
+	SeriesPosition float64           `json:"series_position" binding:"gte=0"`
+	EditionOf      string            `json:"edition_of"`
+	Language       string            `json:"language" binding:"omitempty,bcp47_language_tag"`
+	TranslatedFrom string            `json:"translated_from" binding:"omitempty,bcp47_language_tag"`
+	ReleaseDate    *time.Time        `json:"release_date"`
+	Formats        []BookFormatInput `json:"formats"`
+}
+
+// NormalizeTags lower-cases tags, collapses their spacing and drops empty
+// and repeated ones.
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// NormalizeISBN strips hyphens and spaces from an ISBN so differently
+// written ISBNs of one book compare equal.
+func NormalizeISBN(isbn string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(isbn) {
+		if (r >= '0' && r <= '9') || r == 'X' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ISBN13 checks the check digit of an ISBN-10 or ISBN-13, written with or
+// without hyphens, and returns it as an ISBN-13.
+func ISBN13(isbn string) (string, bool) {
+	digits := NormalizeISBN(isbn)
+	switch len(digits) {
+	case 10:
+		sum := 0
+		for i, r := range digits {
+			d := int(r - '0')
+			if r == 'X' {
+				if i != 9 {
+					return "", false
+				}
+				d = 10
+			}
+			sum += (10 - i) * d
+		}
+		if sum%11 != 0 {
+			return "", false
+		}
+		isbn13 := "978" + digits[:9]
+		return isbn13 + string(rune('0'+isbn13CheckDigit(isbn13))), true
+	case 13:
+		if strings.ContainsRune(digits, 'X') || !(strings.HasPrefix(digits, "978") || strings.HasPrefix(digits, "979")) {
+			return "", false
+		}
+		if isbn13CheckDigit(digits[:12]) != int(digits[12]-'0') {
+			return "", false
+		}
+		return digits, true
+	}
+	return "", false
+}
+
+// isbn13CheckDigit computes the last digit of an ISBN-13 from the first 12.
+func isbn13CheckDigit(digits string) int {
+	sum := 0
+	for i, r := range digits[:12] {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(r-'0')
+	}
+	return (10 - sum%10) % 10
+}
+
+// ISBNIssue is a book whose stored ISBN was set aside by the startup
+// migration because it was invalid or belonged to another book as well.
+type ISBNIssue struct {
+	BookID     primitive.ObjectID `json:"book_id"`
+	Title      string             `json:"title"`
+	Author     string             `json:"author"`
+	LegacyISBN string             `json:"legacy_isbn"`
+	Reason     string             `json:"reason"`
 }
@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"978-0-306-40615-7", "9780306406157"},
+		{" 0 306 40615 2 ", "0306406152"},
+		{"080442957x", "080442957X"},
+		{"ISBN 0-306-40615-2", "0306406152"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeISBN(tt.in); got != tt.want {
+			t.Errorf("NormalizeISBN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestISBN13(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		ok   bool
+	}{
+		{"isbn-13", "9780306406157", "9780306406157", true},
+		{"isbn-13 with hyphens", "978-0-306-40615-7", "9780306406157", true},
+		{"979 prefix", "979-10-90636-07-1", "9791090636071", true},
+		{"isbn-10", "0-306-40615-2", "9780306406157", true},
+		{"isbn-10 with X check digit", "0-8044-2957-X", "9780804429573", true},
+		{"isbn-13 bad check digit", "9780306406158", "", false},
+		{"isbn-10 bad check digit", "0306406153", "", false},
+		{"X before the last digit", "03064061X2", "", false},
+		{"isbn-13 with X", "978030640615X", "", false},
+		{"unknown prefix", "9770306406155", "", false},
+		{"too short", "030640615", "", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ISBN13(tt.in)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("ISBN13(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Catalog file formats for bulk import and export.
+const (
+	CatalogFormatCSV   = "csv"
+	CatalogFormatJSONL = "jsonl"
+	CatalogFormatONIX  = "onix"
+)
+
+const (
+	ImportStatusQueued     = "queued"
+	ImportStatusProcessing = "processing"
+	ImportStatusCompleted  = "completed"
+	ImportStatusFailed     = "failed"
+)
+
+// CatalogImport is one uploaded catalog file. Rows are matched to existing
+// books by ISBN and update them; other rows create books. A dry run checks
+// every row and reports what would happen without writing anything.
+type CatalogImport struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FileName   string             `bson:"file_name" json:"file_name"`
+	Format     string             `bson:"format" json:"format"`
+	DryRun     bool               `bson:"dry_run" json:"dry_run"`
+	Status     string             `bson:"status" json:"status"`
+	TotalRows  int                `bson:"total_rows" json:"total_rows"`
+	Processed  int                `bson:"processed" json:"processed"`
+	Created    int                `bson:"created" json:"created"`
+	Updated    int                `bson:"updated" json:"updated"`
+	Failed     int                `bson:"failed" json:"failed"`
+	Errors     []ImportRowError   `bson:"errors" json:"errors"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedBy  primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	FinishedAt *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// ImportRowError reports a row that could not be imported. Row is the line
+// number in CSV and JSON Lines files and the product number in ONIX.
+type ImportRowError struct {
+	Row   int    `bson:"row" json:"row"`
+	ISBN  string `bson:"isbn,omitempty" json:"isbn,omitempty"`
+	Error string `bson:"error" json:"error"`
+}
+
+// CatalogRow is a book read from a catalog file. The series is named rather
+// than given by ID so files can move between stores.
+type CatalogRow struct {
+	Row    int
+	Book   CreateBookRequest
+	Series string
+}
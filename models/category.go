@@ -0,0 +1,52 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Category is a node of the category tree. Ancestors lists the categories
+// above it, root first, so a subtree is everything whose ancestors contain
+// its root. Key is the normalized name and is unique among siblings.
+type Category struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name      string               `bson:"name" json:"name"`
+	Key       string               `bson:"key" json:"-"`
+	ParentID  *primitive.ObjectID  `bson:"parent_id" json:"parent_id"`
+	Ancestors []primitive.ObjectID `bson:"ancestors" json:"ancestors"`
+	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// Path is the category and its ancestors, which is what a book in the
+// category stores to be found by a filter on any of them.
+func (c Category) Path() []primitive.ObjectID {
+	return append(append([]primitive.ObjectID{}, c.Ancestors...), c.ID)
+}
+
+// CategoryNode is a category in the tree listing. BookCount includes the
+// books of every subcategory.
+type CategoryNode struct {
+	Category
+	BookCount int64           `json:"book_count"`
+	Children  []*CategoryNode `json:"children"`
+}
+
+type CategoryRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	ParentID string `json:"parent_id"`
+}
+
+// TagCount is a tag and the number of books carrying it.
+type TagCount struct {
+	Tag   string `bson:"_id" json:"tag"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+// NameKey normalizes a category or series name for matching: lower case
+// with single spaces.
+func NameKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	GiftCardActive   = "active"
+	GiftCardDisabled = "disabled"
+)
+
+const (
+	CreditAccountWallet   = "wallet"
+	CreditAccountGiftCard = "gift_card"
+)
+
+const (
+	CreditIssued          = "issued"           // gift card created
+	CreditRedeemed        = "redeemed"         // gift card moved into a wallet
+	CreditPayment         = "payment"          // spent on an order
+	CreditPaymentReversed = "payment_reversed" // order cancelled or not placed
+	CreditRefund          = "refund"           // refund paid out as store credit
+	CreditAdjusted        = "adjusted"         // manual correction by an admin
+)
+
+// GiftCard is a prepaid balance behind a redeemable code. The code can pay
+// for orders directly or be redeemed into the owner's store credit wallet.
+type GiftCard struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Code           string              `bson:"code" json:"code"`
+	InitialAmount  Money               `bson:"initial_amount" json:"initial_amount"`
+	Balance        Money               `bson:"balance" json:"balance"`
+	Status         string              `bson:"status" json:"status"`
+	PurchasedBy    *primitive.ObjectID `bson:"purchased_by,omitempty" json:"purchased_by,omitempty"`
+	IssuedBy       *primitive.ObjectID `bson:"issued_by,omitempty" json:"issued_by,omitempty"`
+	RecipientEmail string              `bson:"recipient_email,omitempty" json:"recipient_email,omitempty"`
+	Message        string              `bson:"message,omitempty" json:"message,omitempty"`
+	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// CreditTransaction records one change to a wallet or gift card balance.
+// Transactions are only ever inserted; Amount is negative for debits and
+// Balance is the account balance after the change.
+type CreditTransaction struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Account    string              `bson:"account" json:"account"`
+	UserID     *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	GiftCardID *primitive.ObjectID `bson:"gift_card_id,omitempty" json:"gift_card_id,omitempty"`
+	Type       string              `bson:"type" json:"type"`
+	Amount     Money               `bson:"amount" json:"amount"`
+	Balance    Money               `bson:"balance" json:"balance"`
+	OrderID    *primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Note       string              `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedBy  *primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+}
+
+type PurchaseGiftCardRequest struct {
+	Amount         Money  `json:"amount" binding:"required,gte=500,lte=50000"`
+	RecipientEmail string `json:"recipient_email" binding:"omitempty,email"`
+	Message        string `json:"message" binding:"max=500"`
+}
+
+type IssueGiftCardRequest struct {
+	Amount Money  `json:"amount" binding:"required,gt=0"`
+	Note   string `json:"note"`
+}
+
+type RedeemGiftCardRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type WalletAdjustmentRequest struct {
+	Amount Money  `json:"amount" binding:"required,ne=0"`
+	Reason string `json:"reason" binding:"required"`
+}
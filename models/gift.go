@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	GiftPending       = "pending"
+	GiftClaimed       = "claimed"
+	GiftRefundPending = "refund_pending"
+	GiftExpired       = "expired"
+	GiftCancelled     = "cancelled"
+)
+
+// Gift is a digital book bought for someone else. The recipient gets an
+// email with the claim token; claiming adds the book to their library.
+// Gifts not claimed by ExpiresAt wait in refund_pending until they have
+// been refunded to the sender, then become expired.
+type Gift struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrderID        primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	OrderItemID    primitive.ObjectID  `bson:"order_item_id" json:"order_item_id"`
+	SenderID       primitive.ObjectID  `bson:"sender_id" json:"sender_id"`
+	RecipientEmail string              `bson:"recipient_email" json:"recipient_email"`
+	Message        string              `bson:"message,omitempty" json:"message,omitempty"`
+	BookID         primitive.ObjectID  `bson:"book_id" json:"book_id"`
+	BookTitle      string              `bson:"book_title" json:"book_title"`
+	FormatType     string              `bson:"format_type" json:"format_type"`
+	Token          string              `bson:"token" json:"-"`
+	Status         string              `bson:"status" json:"status"`
+	ClaimedBy      *primitive.ObjectID `bson:"claimed_by,omitempty" json:"claimed_by,omitempty"`
+	ClaimedAt      *time.Time          `bson:"claimed_at,omitempty" json:"claimed_at,omitempty"`
+	ExpiresAt      time.Time           `bson:"expires_at" json:"expires_at"`
+	RefundAmount   Money               `bson:"refund_amount,omitempty" json:"refund_amount,omitempty"`
+	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+type ClaimGiftRequest struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// StoredImage is an uploaded image kept in the blob store: the original
+// and thumbnails named by size ("small", "medium", "large"). Keys are the
+// blob store keys of all its files, so it can be removed as a whole.
+type StoredImage struct {
+	URL        string            `bson:"url" json:"url"`
+	Thumbnails map[string]string `bson:"thumbnails" json:"thumbnails"`
+	Width      int               `bson:"width" json:"width"`
+	Height     int               `bson:"height" json:"height"`
+	Keys       []string          `bson:"keys" json:"-"`
+	UploadedAt time.Time         `bson:"uploaded_at" json:"uploaded_at"`
+}
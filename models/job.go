@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// JobRun is one execution of a background job.
+type JobRun struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Job         string              `bson:"job" json:"job"`
+	Trigger     string              `bson:"trigger" json:"trigger"`
+	TriggeredBy *primitive.ObjectID `bson:"triggered_by,omitempty" json:"triggered_by,omitempty"`
+	Instance    string              `bson:"instance" json:"instance"`
+	Status      string              `bson:"status" json:"status"`
+	Result      string              `bson:"result,omitempty" json:"result,omitempty"`
+	Error       string              `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt   time.Time           `bson:"started_at" json:"started_at"`
+	FinishedAt  *time.Time          `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// JobLock is held by the instance running a job so other replicas skip it.
+type JobLock struct {
+	Job         string    `bson:"_id" json:"job"`
+	Instance    string    `bson:"instance" json:"instance"`
+	LockedUntil time.Time `bson:"locked_until" json:"locked_until"`
+}
+
+// DailyStats is the per-day sales rollup written by the stats job.
+type DailyStats struct {
+	Date            string    `bson:"_id" json:"date"`
+	Orders          int64     `bson:"orders" json:"orders"`
+	CompletedOrders int64     `bson:"completed_orders" json:"completed_orders"`
+	Revenue         Money     `bson:"revenue" json:"revenue"`
+	Tax             Money     `bson:"tax" json:"tax"`
+	Refunded        Money     `bson:"refunded" json:"refunded"`
+	NewUsers        int64     `bson:"new_users" json:"new_users"`
+	UpdatedAt       time.Time `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The reading shelves. A book is on at most one of them; any other shelf
+// name is a custom shelf and a book may be on as many of those as it likes.
+const (
+	ShelfToRead   = "to-read"
+	ShelfReading  = "reading"
+	ShelfFinished = "finished"
+)
+
+var ReadingShelves = []string{ShelfToRead, ShelfReading, ShelfFinished}
+
+// LibraryEntry holds what a user did with a book in their library: the
+// shelves it is on, the reading position and bookmarks. Ownership lives in
+// digital_access; the entry is kept when access ends so it is still there
+// if the book is bought again.
+type LibraryEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	BookID    primitive.ObjectID `bson:"book_id" json:"book_id"`
+	Shelves   []string           `bson:"shelves" json:"shelves"`
+	Progress  *ReadingProgress   `bson:"progress,omitempty" json:"progress,omitempty"`
+	Bookmarks []Bookmark         `bson:"bookmarks" json:"bookmarks"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// ReadingProgress is the last position reached in an e-book. Location is
+// opaque to the server (a CFI, page or offset chosen by the reader app).
+type ReadingProgress struct {
+	Percent   float64   `bson:"percent" json:"percent"`
+	Location  string    `bson:"location,omitempty" json:"location,omitempty"`
+	Device    string    `bson:"device,omitempty" json:"device,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type Bookmark struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Location  string             `bson:"location" json:"location"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// LibraryFormat is one owned format of a library book.
+type LibraryFormat struct {
+	Type       string     `bson:"type" json:"type"`
+	AccessURL  string     `bson:"access_url,omitempty" json:"access_url,omitempty"`
+	AcquiredAt time.Time  `bson:"acquired_at" json:"acquired_at"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// LibraryBook is a book in the personal library with every owned format
+// merged and the user's entry for it.
+type LibraryBook struct {
+	BookID     primitive.ObjectID `bson:"book_id" json:"book_id"`
+	Title      string             `bson:"title" json:"title"`
+	Author     string             `bson:"author" json:"author"`
+	ImageURL   string             `bson:"image_url" json:"image_url"`
+	Formats    []LibraryFormat    `bson:"formats" json:"formats"`
+	AcquiredAt time.Time          `bson:"acquired_at" json:"acquired_at"`
+	Shelves    []string           `bson:"shelves" json:"shelves"`
+	Progress   *ReadingProgress   `bson:"progress,omitempty" json:"progress,omitempty"`
+	Bookmarks  []Bookmark         `bson:"bookmarks" json:"bookmarks"`
+}
+
+// IsEbook reports whether one of the owned formats can be read in the app.
+func (b LibraryBook) IsEbook() bool {
+	for _, f := range b.Formats {
+		if f.Type != "physical" {
+			return true
+		}
+	}
+	return false
+}
+
+type PersonalLibraryResponse struct {
+	UserID  primitive.ObjectID `json:"user_id"`
+	Books   []LibraryBook      `json:"books"`
+	Shelves map[string]int     `json:"shelves"`
+}
+
+type UpdateShelvesRequest struct {
+	Shelves []string `json:"shelves" binding:"max=20,dive,min=1,max=40"`
+}
+
+// ReadingProgressRequest carries the position from a reader app. UpdatedAt
+// is when the reader got there; a position older than the stored one is
+// rejected so devices syncing late do not move the reader backwards.
+type ReadingProgressRequest struct {
+	Percent   float64    `json:"percent" binding:"min=0,max=100"`
+	Location  string     `json:"location" binding:"max=500"`
+	Device    string     `json:"device" binding:"max=100"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type BookmarkRequest struct {
+	Location string `json:"location" binding:"required,max=500"`
+	Note     string `json:"note" binding:"max=500"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoyaltyTier is reached by spending at least MinSpend over the last 12
+// months. Discount is a rate (0.05 for 5%) taken off the basket after the
+// premium discount.
+type LoyaltyTier struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	MinSpend     Money              `bson:"min_spend" json:"min_spend"`
+	Discount     float64            `bson:"discount" json:"discount"`
+	Color        string             `bson:"color" json:"color"`
+	FreeShipping bool               `bson:"free_shipping" json:"free_shipping"`
+	Perks        []string           `bson:"perks,omitempty" json:"perks,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type LoyaltyTierRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	MinSpend     Money    `json:"min_spend" binding:"gte=0"`
+	Discount     float64  `json:"discount" binding:"gte=0,lte=1"`
+	Color        string   `json:"color" binding:"omitempty,hexcolor"`
+	FreeShipping bool     `json:"free_shipping"`
+	Perks        []string `json:"perks"`
+}
@@ -0,0 +1,33 @@
+package models
+
+// BookMetadata is what a bibliographic source knows about an edition.
+// Fields the source does not have are left empty.
+type BookMetadata struct {
+	ISBN          string   `json:"isbn"`
+	Title         string   `json:"title"`
+	Authors       []string `json:"authors"`
+	Description   string   `json:"description"`
+	CoverURL      string   `json:"cover_url"`
+	PublishedYear int      `json:"published_year"`
+	Language      string   `json:"language"`
+}
+
+// CreateRequest pre-fills a book create request from the metadata. Formats
+// are left for the moderator to add.
+func (m BookMetadata) CreateRequest() CreateBookRequest {
+	authors := []BookAuthorInput{}
+	for _, name := range m.Authors {
+		authors = append(authors, BookAuthorInput{Name: name})
+	}
+	return CreateBookRequest{
+		Title:         m.Title,
+		Authors:       authors,
+		Description:   m.Description,
+		ImageURL:      m.CoverURL,
+		PublishedYear: m.PublishedYear,
+		ISBN:          m.ISBN,
+		Language:      m.Language,
+		Tags:          []string{},
+		Formats:       []BookFormatInput{},
+	}
+}
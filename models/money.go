@@ -0,0 +1,33 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Money is an amount in minor currency units (cents). Prices, totals and
+// everything derived from them are computed and stored as Money to avoid
+// floating point drift.
+type Money int64
+
+func MoneyFromFloat(v float64) Money {
+	return Money(math.Round(v * 100))
+}
+
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// Percent returns rate (0.1 for 10%) of m, rounded to the nearest minor unit.
+func (m Money) Percent(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
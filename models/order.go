@@ -9,32 +9,85 @@ import (
 type Order struct {
 	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID          primitive.ObjectID `bson:"user_id" json:"user_id"`
-	TotalAmount     float64            `bson:"total_amount" json:"total_amount"`
+	TotalAmount     Money              `bson:"total_amount" json:"total_amount"`
 	Status          string             `bson:"status" json:"status"`
 	ItemCount       int                `bson:"item_count" json:"item_count"`
 	DeliveryStatus  string             `bson:"delivery_status,omitempty" json:"delivery_status,omitempty"`
 	DeliveryAddress string             `bson:"delivery_address,omitempty" json:"delivery_address,omitempty"`
+	ShippingAddress *Address           `bson:"shipping_address,omitempty" json:"shipping_address,omitempty"`
+	ShippingMethod  string             `bson:"shipping_method,omitempty" json:"shipping_method,omitempty"`
+	Promotions      []AppliedPromotion `bson:"promotions,omitempty" json:"promotions,omitempty"`
+	Pricing         *PriceQuote        `bson:"pricing,omitempty" json:"pricing,omitempty"`
+	RefundedAmount  Money              `bson:"refunded_amount,omitempty" json:"refunded_amount,omitempty"`
+	Preorder        *Preorder          `bson:"preorder,omitempty" json:"preorder,omitempty"`
 	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+const (
+	PreorderAwaitingRelease = "awaiting_release"
+	PreorderReleased        = "released"
+	PreorderCancelled       = "cancelled"
+)
+
+// Preorder is the state of an order for books that are not released yet.
+// The amount due is authorised with the payment gateway when the order is
+// placed and captured once every book in it is out; until then nothing is
+// granted and no stock is taken. ReleaseDate is the expected release at the
+// time of ordering. CaptureError is the last failed capture, which is
+// retried on the next run.
+type Preorder struct {
+	Status          string    `bson:"status" json:"status"`
+	ReleaseDate     time.Time `bson:"release_date" json:"release_date"`
+	Amount          Money     `bson:"amount" json:"amount"`
+	AuthorizationID string    `bson:"authorization_id,omitempty" json:"-"`
+	CaptureError    string    `bson:"capture_error,omitempty" json:"capture_error,omitempty"`
+	// WaitingForStock is set when the books are out but there were not
+	// enough copies left to fill the order on release.
+	WaitingForStock bool       `bson:"waiting_for_stock,omitempty" json:"waiting_for_stock,omitempty"`
+	ReleasedAt      *time.Time `bson:"released_at,omitempty" json:"released_at,omitempty"`
+}
+
 type OrderItem struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	OrderID    primitive.ObjectID `bson:"order_id" json:"order_id"`
-	BookID     primitive.ObjectID `bson:"book_id" json:"book_id"`
-	FormatType string             `bson:"format_type" json:"format_type"`
-	Quantity   int                `bson:"quantity" json:"quantity"`
-	Price      float64            `bson:"price" json:"price"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrderID    primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	BookID     primitive.ObjectID  `bson:"book_id" json:"book_id"`
+	FormatType string              `bson:"format_type" json:"format_type"`
+	Quantity   int                 `bson:"quantity" json:"quantity"`
+	Price      Money               `bson:"price" json:"price"`
+	RentalDays int                 `bson:"rental_days,omitempty" json:"rental_days,omitempty"`
+	GiftID     *primitive.ObjectID `bson:"gift_id,omitempty" json:"gift_id,omitempty"`
+	// ReturnedQuantity is the units held by returns that are not cancelled
+	// or rejected.
+	ReturnedQuantity int       `bson:"returned_quantity,omitempty" json:"returned_quantity,omitempty"`
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+}
+
+type CreateOrderItem struct {
+	BookID     string `json:"book_id" binding:"required"`
+	FormatType string `json:"format_type" binding:"required,oneof=physical digital both rental"`
+	Quantity   int    `json:"quantity" binding:"required,gt=0"`
+	// RentalDays picks the rental period of a rental item.
+	RentalDays int `json:"rental_days" binding:"required_if=FormatType rental,omitempty,oneof=7 14 30"`
+	// GiftRecipientEmail sends a digital item to someone else instead of
+	// adding it to the buyer's library.
+	GiftRecipientEmail string `json:"gift_recipient_email" binding:"omitempty,email"`
+	GiftMessage        string `json:"gift_message" binding:"max=500"`
 }
 
+// CreateOrderRequest is also the body of POST /orders/quote.
 type CreateOrderRequest struct {
-	Items []struct {
-		BookID     string `json:"book_id" binding:"required"`
-		FormatType string `json:"format_type" binding:"required,oneof=physical digital both"`
-		Quantity   int    `json:"quantity" binding:"required,gt=0"`
-	} `json:"items" binding:"required"`
-	DeliveryAddress string `json:"delivery_address"`
+	Items []CreateOrderItem `json:"items" binding:"required,dive"`
+	// AddressID picks an entry from the address book; ShippingAddress is a
+	// one-off address. Without either the default saved address is used.
+	AddressID       string   `json:"address_id"`
+	ShippingAddress *Address `json:"shipping_address"`
+	ShippingMethod  string   `json:"shipping_method"`
+	CouponCodes     []string `json:"coupon_codes"`
+	RedeemPoints    int      `json:"redeem_points" binding:"gte=0"`
+	// GiftCardCodes and UseStoreCredit pay part or all of the grand total.
+	GiftCardCodes  []string `json:"gift_card_codes"`
+	UseStoreCredit bool     `json:"use_store_credit"`
 }
 
 type OrderItemInput struct {
@@ -46,10 +99,17 @@ type OrderResponse struct {
 	ID              primitive.ObjectID  `json:"id"`
 	UserID          primitive.ObjectID  `json:"user_id"`
 	Status          string              `json:"status"`
-	TotalAmount     float64             `json:"total_amount"`
+	TotalAmount     Money               `json:"total_amount"`
 	Items           []OrderItemResponse `json:"items"`
 	DeliveryStatus  string              `json:"delivery_status,omitempty"`
 	DeliveryAddress string              `json:"delivery_address,omitempty"`
+	ShippingAddress *Address            `json:"shipping_address,omitempty"`
+	ShippingMethod  string              `json:"shipping_method,omitempty"`
+	Shipments       []Shipment          `json:"shipments,omitempty"`
+	Promotions      []AppliedPromotion  `json:"promotions,omitempty"`
+	Pricing         *PriceQuote         `json:"pricing,omitempty"`
+	RefundedAmount  Money               `json:"refunded_amount,omitempty"`
+	Preorder        *Preorder           `json:"preorder,omitempty"`
 	CreatedAt       time.Time           `json:"created_at"`
 	UpdatedAt       time.Time           `json:"updated_at"`
 }
@@ -59,7 +119,7 @@ type OrderItemResponse struct {
 	BookID     primitive.ObjectID `json:"book_id"`
 	FormatType string             `json:"format_type"`
 	Quantity   int                `json:"quantity"`
-	Price      float64            `json:"price"`
+	Price      Money              `json:"price"`
 	CreatedAt  time.Time          `json:"created_at"`
 }
 
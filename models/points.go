@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PointsEarned   = "earned"
+	PointsRedeemed = "redeemed"
+	PointsExpired  = "expired"
+	PointsAdjusted = "adjusted"
+)
+
+// PointsEntry is one line of a user's loyalty points ledger. Points is
+// signed and Balance is the user's balance after the entry. Entries that add
+// points also form a lot: Remaining counts the points of the lot that have
+// not been spent or expired yet, and spending always uses the oldest lot
+// first. A redemption records the lots it spent in Lots, and entries an
+// order cancellation has undone are marked Reversed.
+type PointsEntry struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Type      string              `bson:"type" json:"type"`
+	Points    int                 `bson:"points" json:"points"`
+	Balance   int                 `bson:"balance" json:"balance"`
+	Remaining int                 `bson:"remaining,omitempty" json:"-"`
+	ExpiresAt *time.Time          `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Lots      []PointsLotUse      `bson:"lots" json:"-"`
+	Reversed  bool                `bson:"reversed,omitempty" json:"-"`
+	OrderID   *primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Reason    string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedBy *primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// PointsLotUse is the part of a lot spent by a redemption.
+type PointsLotUse struct {
+	LotID  primitive.ObjectID `bson:"lot_id"`
+	Points int                `bson:"points"`
+}
+
+type PointsAdjustmentRequest struct {
+	Points int    `json:"points" binding:"required,ne=0"`
+	Reason string `json:"reason" binding:"required"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DiscountSourcePromotion = "promotion"
+	DiscountSourcePremium   = "premium"
+	DiscountSourceLoyalty   = "loyalty"
+	DiscountSourcePoints    = "points"
+)
+
+type PriceLine struct {
+	BookID      primitive.ObjectID `bson:"book_id" json:"book_id"`
+	Title       string             `bson:"title" json:"title"`
+	FormatType  string             `bson:"format_type" json:"format_type"`
+	Quantity    int                `bson:"quantity" json:"quantity"`
+	UnitPrice   Money              `bson:"unit_price" json:"unit_price"`
+	Total       Money              `bson:"total" json:"total"`
+	WeightGrams int                `bson:"weight_grams,omitempty" json:"weight_grams,omitempty"` // per unit
+	RentalDays  int                `bson:"rental_days,omitempty" json:"rental_days,omitempty"`
+	// ReleaseDate is set on pre-order lines, for books not yet released.
+	ReleaseDate *time.Time `bson:"release_date,omitempty" json:"release_date,omitempty"`
+}
+
+// PriceAdjustment is a single discount source in a quote.
+type PriceAdjustment struct {
+	Source      string              `bson:"source" json:"source"`
+	Label       string              `bson:"label" json:"label"`
+	PromotionID *primitive.ObjectID `bson:"promotion_id,omitempty" json:"promotion_id,omitempty"`
+	Amount      Money               `bson:"amount" json:"amount"`
+}
+
+const (
+	PaymentGiftCard    = "gift_card"
+	PaymentStoreCredit = "store_credit"
+)
+
+// PaymentLine is part of the grand total paid from a gift card or the
+// store credit wallet.
+type PaymentLine struct {
+	Method     string              `bson:"method" json:"method"`
+	Label      string              `bson:"label" json:"label"`
+	GiftCardID *primitive.ObjectID `bson:"gift_card_id,omitempty" json:"gift_card_id,omitempty"`
+	Amount     Money               `bson:"amount" json:"amount"`
+}
+
+// PriceQuote is the itemized price of a basket. All amounts are in minor
+// units; GrandTotal = Subtotal - DiscountTotal + Tax + Shipping. Payments
+// from gift cards and store credit do not change the grand total, only
+// AmountDue.
+type PriceQuote struct {
+	Currency       string            `bson:"currency" json:"currency"`
+	Lines          []PriceLine       `bson:"lines" json:"lines"`
+	Subtotal       Money             `bson:"subtotal" json:"subtotal"`
+	Discounts      []PriceAdjustment `bson:"discounts" json:"discounts"`
+	DiscountTotal  Money             `bson:"discount_total" json:"discount_total"`
+	PointsRedeemed int               `bson:"points_redeemed,omitempty" json:"points_redeemed,omitempty"`
+	TaxLines       []TaxLine         `bson:"tax_lines" json:"tax_lines"`
+	Tax            Money             `bson:"tax" json:"tax"`
+	ShippingMethod string            `bson:"shipping_method,omitempty" json:"shipping_method,omitempty"`
+	Shipping       Money             `bson:"shipping" json:"shipping"`
+	GrandTotal     Money             `bson:"grand_total" json:"grand_total"`
+	Payments       []PaymentLine     `bson:"payments,omitempty" json:"payments,omitempty"`
+	AmountDue      Money             `bson:"amount_due" json:"amount_due"`
+}
+
+// IsPreorder reports whether the quote is for books not yet released.
+// Quotes never mix pre-orders with books that are out.
+func (q PriceQuote) IsPreorder() bool {
+	return len(q.Lines) > 0 && q.Lines[0].ReleaseDate != nil
+}
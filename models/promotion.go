@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PromotionTypePercentage = "percentage"
+	PromotionTypeFixed      = "fixed"
+	PromotionTypeBuyXGetY   = "buy_x_get_y"
+)
+
+// PromotionScope limits a promotion to matching books. An empty scope
+// applies to the whole basket. Categories are given by name or ID and
+// resolved into CategoryIDs, so books anywhere below them match too.
+type PromotionScope struct {
+	Categories  []string             `bson:"categories,omitempty" json:"categories,omitempty"`
+	CategoryIDs []primitive.ObjectID `bson:"category_ids,omitempty" json:"category_ids,omitempty"`
+	Authors     []string             `bson:"authors,omitempty" json:"authors,omitempty"`
+	BookIDs     []primitive.ObjectID `bson:"book_ids,omitempty" json:"book_ids,omitempty"`
+}
+
+// Promotion is either a coupon (has a Code) or an automatic sale (no Code).
+type Promotion struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name            string             `bson:"name" json:"name"`
+	Description     string             `bson:"description" json:"description"`
+	Code            string             `bson:"code,omitempty" json:"code,omitempty"`
+	Type            string             `bson:"type" json:"type"`
+	Percent         float64            `bson:"percent,omitempty" json:"percent,omitempty"` // percentage promotions
+	Amount          Money              `bson:"amount,omitempty" json:"amount,omitempty"`   // fixed promotions
+	BuyQuantity     int                `bson:"buy_quantity,omitempty" json:"buy_quantity,omitempty"`
+	GetQuantity     int                `bson:"get_quantity,omitempty" json:"get_quantity,omitempty"`
+	Scope           PromotionScope     `bson:"scope" json:"scope"`
+	MinBasketAmount Money              `bson:"min_basket_amount" json:"min_basket_amount"`
+	MinBasketItems  int                `bson:"min_basket_items" json:"min_basket_items"`
+	StartsAt        time.Time          `bson:"starts_at" json:"starts_at"`
+	EndsAt          *time.Time         `bson:"ends_at,omitempty" json:"ends_at,omitempty"`
+	UsageLimit      int                `bson:"usage_limit" json:"usage_limit"`       // 0 means unlimited
+	PerUserLimit    int                `bson:"per_user_limit" json:"per_user_limit"` // 0 means unlimited
+	UsageCount      int                `bson:"usage_count" json:"usage_count"`
+	Stackable       bool               `bson:"stackable" json:"stackable"`
+	Priority        int                `bson:"priority" json:"priority"`
+	IsActive        bool               `bson:"is_active" json:"is_active"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// AppliedPromotion records how much a promotion contributed to an order.
+type AppliedPromotion struct {
+	PromotionID primitive.ObjectID `bson:"promotion_id" json:"promotion_id"`
+	Code        string             `bson:"code,omitempty" json:"code,omitempty"`
+	Name        string             `bson:"name" json:"name"`
+	Type        string             `bson:"type" json:"type"`
+	Amount      Money              `bson:"amount" json:"amount"`
+}
+
+type PromotionRedemption struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PromotionID primitive.ObjectID `bson:"promotion_id" json:"promotion_id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	OrderID     primitive.ObjectID `bson:"order_id" json:"order_id"`
+	Amount      Money              `bson:"amount" json:"amount"`
+	// Slot numbers the redemptions of a promotion with a per-user limit,
+	// from 1 up to the limit, for each user.
+	Slot      int       `bson:"slot,omitempty" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+type PromotionRequest struct {
+	Name            string         `json:"name" binding:"required"`
+	Description     string         `json:"description"`
+	Code            string         `json:"code"`
+	Type            string         `json:"type" binding:"required,oneof=percentage fixed buy_x_get_y"`
+	Percent         float64        `json:"percent" binding:"gte=0,lte=100"`
+	Amount          Money          `json:"amount" binding:"gte=0"`
+	BuyQuantity     int            `json:"buy_quantity" binding:"gte=0"`
+	GetQuantity     int            `json:"get_quantity" binding:"gte=0"`
+	Scope           PromotionScope `json:"scope"`
+	MinBasketAmount Money          `json:"min_basket_amount" binding:"gte=0"`
+	MinBasketItems  int            `json:"min_basket_items" binding:"gte=0"`
+	StartsAt        time.Time      `json:"starts_at"`
+	EndsAt          *time.Time     `json:"ends_at"`
+	UsageLimit      int            `json:"usage_limit" binding:"gte=0"`
+	PerUserLimit    int            `json:"per_user_limit" binding:"gte=0"`
+	Stackable       bool           `json:"stackable"`
+	Priority        int            `json:"priority"`
+	IsActive        *bool          `json:"is_active"`
+}
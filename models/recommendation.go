@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Why a book was recommended.
+const (
+	ReasonBoughtTogether = "bought_together"
+	ReasonSameAuthor     = "same_author"
+	ReasonSameCategory   = "same_category"
+	ReasonLibrary        = "library"
+	ReasonWishlist       = "wishlist"
+	ReasonPopular        = "popular"
+)
+
+// ScoredBook is a precomputed recommendation. BecauseOf lists the books in
+// a user's library or wishlist that led to it.
+type ScoredBook struct {
+	BookID    primitive.ObjectID   `bson:"book_id" json:"book_id"`
+	Score     float64              `bson:"score" json:"score"`
+	Reasons   []string             `bson:"reasons" json:"reasons"`
+	BecauseOf []primitive.ObjectID `bson:"because_of,omitempty" json:"because_of,omitempty"`
+}
+
+// RelatedBooks caches the books related to a book, best first.
+type RelatedBooks struct {
+	BookID     primitive.ObjectID `bson:"_id" json:"book_id"`
+	Books      []ScoredBook       `bson:"books" json:"books"`
+	ComputedAt time.Time          `bson:"computed_at" json:"computed_at"`
+}
+
+// UserRecommendations caches a user's personal recommendations, best first.
+type UserRecommendations struct {
+	UserID     primitive.ObjectID `bson:"_id" json:"user_id"`
+	Books      []ScoredBook       `bson:"books" json:"books"`
+	ComputedAt time.Time          `bson:"computed_at" json:"computed_at"`
+}
+
+// Recommendation is a recommended book as returned by the API.
+type Recommendation struct {
+	BookLink
+	Score     float64              `json:"score"`
+	Reasons   []string             `json:"reasons"`
+	BecauseOf []primitive.ObjectID `json:"because_of,omitempty"`
+}
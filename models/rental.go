@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rental records one paid rental or premium loan of an e-book. Renting a
+// book that is still out extends it, so ExpiresAt counts on from the
+// previous expiry rather than from CreatedAt.
+type Rental struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	BookID    primitive.ObjectID  `bson:"book_id" json:"book_id"`
+	OrderID   *primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Days      int                 `bson:"days" json:"days"`
+	Price     Money               `bson:"price" json:"price"`
+	Borrowed  bool                `bson:"borrowed" json:"borrowed"`
+	Extension bool                `bson:"extension" json:"extension"`
+	ExpiresAt time.Time           `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
+
+type BorrowRequest struct {
+	BookID string `json:"book_id" binding:"required"`
+}
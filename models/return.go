@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A return moves requested -> approved -> received -> refunded. Digital
+// items have nothing to send back, so they go straight from approved to
+// refunded. Staff may reject a request and customers may cancel it while it
+// is still waiting for review.
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+	ReturnStatusRefunded  = "refunded"
+	ReturnStatusCancelled = "cancelled"
+)
+
+type ReturnEvent struct {
+	Status string              `bson:"status" json:"status"`
+	Note   string              `bson:"note,omitempty" json:"note,omitempty"`
+	By     *primitive.ObjectID `bson:"by,omitempty" json:"by,omitempty"`
+	At     time.Time           `bson:"at" json:"at"`
+}
+
+// ReturnRequest covers a quantity of a single order item.
+type ReturnRequest struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrderID        primitive.ObjectID `bson:"order_id" json:"order_id"`
+	OrderItemID    primitive.ObjectID `bson:"order_item_id" json:"order_item_id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	BookID         primitive.ObjectID `bson:"book_id" json:"book_id"`
+	FormatType     string             `bson:"format_type" json:"format_type"`
+	Quantity       int                `bson:"quantity" json:"quantity"`
+	Reason         string             `bson:"reason" json:"reason"`
+	Comment        string             `bson:"comment,omitempty" json:"comment,omitempty"`
+	Status         string             `bson:"status" json:"status"`
+	Restocked      bool               `bson:"restocked" json:"restocked"`
+	RefundAmount   Money              `bson:"refund_amount" json:"refund_amount"`
+	PointsReversed int                `bson:"points_reversed" json:"points_reversed"`
+	Events         []ReturnEvent      `bson:"events" json:"events"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Refund is a ledger entry for money paid back on an order. Refunds issued
+// through a return carry its ID. Method is RefundToStoreCredit when the
+// money went to the customer's wallet.
+type Refund struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrderID   primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	UserID    primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	ReturnID  *primitive.ObjectID `bson:"return_id,omitempty" json:"return_id,omitempty"`
+	Amount    Money               `bson:"amount" json:"amount"`
+	Method    string              `bson:"method,omitempty" json:"method,omitempty"`
+	Note      string              `bson:"note,omitempty" json:"note,omitempty"`
+	IssuedBy  primitive.ObjectID  `bson:"issued_by" json:"issued_by"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
+
+const (
+	RefundToOriginal    = "original"
+	RefundToStoreCredit = "store_credit"
+)
+
+type CreateReturnRequest struct {
+	OrderItemID string `json:"order_item_id" binding:"required"`
+	Quantity    int    `json:"quantity" binding:"required,gt=0"`
+	Reason      string `json:"reason" binding:"required,oneof=damaged defective wrong_item not_as_described no_longer_needed other"`
+	Comment     string `json:"comment"`
+}
+
+type ReviewReturnRequest struct {
+	Note string `json:"note"`
+}
+
+type ReceiveReturnRequest struct {
+	// Restock puts the units back on sale; leave it off for damaged copies.
+	Restock bool   `json:"restock"`
+	Note    string `json:"note"`
+}
+
+type RefundReturnRequest struct {
+	// Amount in minor units; zero refunds the item's share of the order.
+	// It cannot exceed that share unless Override is set.
+	Amount   Money  `json:"amount" binding:"gte=0"`
+	Override bool   `json:"override"`
+	Note     string `json:"note"`
+	// ToStoreCredit pays the refund into the customer's wallet instead of
+	// the original payment method.
+	ToStoreCredit bool `json:"to_store_credit"`
+}
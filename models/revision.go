@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// RevisionBaseline is the state of a book from before revisions were
+	// kept, saved ahead of its first recorded change.
+	RevisionBaseline = "baseline"
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionImport   = "import"
+	RevisionRollback = "rollback"
+)
+
+// BookRevision is a numbered snapshot of a book taken after a change, with
+// the fields that changed. RolledBackTo is the version a rollback restored.
+// Revision lists leave the snapshot out.
+type BookRevision struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	BookID       primitive.ObjectID  `bson:"book_id" json:"book_id"`
+	Version      int                 `bson:"version" json:"version"`
+	Action       string              `bson:"action" json:"action"`
+	RolledBackTo int                 `bson:"rolled_back_to,omitempty" json:"rolled_back_to,omitempty"`
+	Changes      []FieldChange       `bson:"changes" json:"changes"`
+	Snapshot     *Book               `bson:"snapshot,omitempty" json:"snapshot,omitempty"`
+	EditedBy     *primitive.ObjectID `bson:"edited_by,omitempty" json:"edited_by,omitempty"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// FieldChange is one changed field of a book, named as in the API, with its
+// JSON value before and after. From is left out for new books.
+type FieldChange struct {
+	Field string          `bson:"field" json:"field"`
+	From  json.RawMessage `bson:"from,omitempty" json:"from,omitempty"`
+	To    json.RawMessage `bson:"to,omitempty" json:"to,omitempty"`
+}
+
+// PricePoint records the price a format was set to. Rental formats, priced
+// per period, are not tracked.
+type PricePoint struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	BookID     primitive.ObjectID `bson:"book_id" json:"book_id"`
+	FormatType string             `bson:"format_type" json:"format_type"`
+	Price      Money              `bson:"price" json:"price"`
+	ChangedAt  time.Time          `bson:"changed_at" json:"changed_at"`
+}
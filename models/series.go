@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Series is an ordered run of books; each book gives its place in the
+// series with SeriesPosition.
+type Series struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Key         string             `bson:"key" json:"-"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Work groups the books that are the same text: editions, formats from
+// different publishers and translations.
+type Work struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Title            string             `bson:"title" json:"title"`
+	OriginalLanguage string             `bson:"original_language,omitempty" json:"original_language,omitempty"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type SeriesRequest struct {
+	Name        string `json:"name" binding:"required,max=200"`
+	Description string `json:"description" binding:"max=5000"`
+}
+
+// BookLink is the short form of a book used to link to it from another
+// book's page.
+type BookLink struct {
+	ID             primitive.ObjectID `bson:"_id" json:"id"`
+	Title          string             `bson:"title" json:"title"`
+	Author         string             `bson:"author" json:"author"`
+	ImageURL       string             `bson:"image_url" json:"image_url"`
+	PublishedYear  int                `bson:"published_year" json:"published_year"`
+	Language       string             `bson:"language,omitempty" json:"language,omitempty"`
+	SeriesPosition float64            `bson:"series_position,omitempty" json:"series_position,omitempty"`
+}
+
+// BookDetail is a book with links to its series neighbours and its other
+// editions.
+type BookDetail struct {
+	Book
+	Series           *Series    `json:"series,omitempty"`
+	PreviousInSeries *BookLink  `json:"previous_in_series,omitempty"`
+	NextInSeries     *BookLink  `json:"next_in_series,omitempty"`
+	OtherEditions    []BookLink `json:"other_editions"`
+	// LowestPrices is the lowest price of each format over the last 30 days.
+	LowestPrices map[string]Money `json:"lowest_price_30d,omitempty"`
+}
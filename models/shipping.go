@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ShippingRatePerItem = "per_item"
+	ShippingRateWeight  = "weight"
+)
+
+const (
+	ShipmentStatusPending   = "pending"
+	ShipmentStatusPacked    = "packed"
+	ShipmentStatusShipped   = "shipped"
+	ShipmentStatusInTransit = "in_transit"
+	ShipmentStatusDelivered = "delivered"
+	ShipmentStatusReturned  = "returned"
+)
+
+// ShippingMethod prices delivery either per item or by weight. FreeOver
+// waives the fee once the discounted basket reaches that amount.
+type ShippingMethod struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code             string             `bson:"code" json:"code"`
+	Name             string             `bson:"name" json:"name"`
+	RateType         string             `bson:"rate_type" json:"rate_type"`
+	BaseFee          Money              `bson:"base_fee" json:"base_fee"`
+	PerItemFee       Money              `bson:"per_item_fee" json:"per_item_fee"`
+	PerKgFee         Money              `bson:"per_kg_fee" json:"per_kg_fee"`
+	FreeOver         Money              `bson:"free_over" json:"free_over"`
+	Countries        []string           `bson:"countries,omitempty" json:"countries,omitempty"` // empty means everywhere
+	RequiresAddress  bool               `bson:"requires_address" json:"requires_address"`
+	EstimatedDaysMin int                `bson:"estimated_days_min" json:"estimated_days_min"`
+	EstimatedDaysMax int                `bson:"estimated_days_max" json:"estimated_days_max"`
+	IsActive         bool               `bson:"is_active" json:"is_active"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type ShippingMethodRequest struct {
+	Code             string   `json:"code" binding:"required"`
+	Name             string   `json:"name" binding:"required"`
+	RateType         string   `json:"rate_type" binding:"required,oneof=per_item weight"`
+	BaseFee          Money    `json:"base_fee" binding:"gte=0"`
+	PerItemFee       Money    `json:"per_item_fee" binding:"gte=0"`
+	PerKgFee         Money    `json:"per_kg_fee" binding:"gte=0"`
+	FreeOver         Money    `json:"free_over" binding:"gte=0"`
+	Countries        []string `json:"countries" binding:"dive,iso3166_1_alpha2"`
+	RequiresAddress  bool     `json:"requires_address"`
+	EstimatedDaysMin int      `json:"estimated_days_min" binding:"gte=0"`
+	EstimatedDaysMax int      `json:"estimated_days_max" binding:"gte=0"`
+	IsActive         *bool    `json:"is_active"`
+}
+
+type ShipmentItem struct {
+	OrderItemID primitive.ObjectID `bson:"order_item_id" json:"order_item_id"`
+	BookID      primitive.ObjectID `bson:"book_id" json:"book_id"`
+	Quantity    int                `bson:"quantity" json:"quantity"`
+}
+
+type ShipmentEvent struct {
+	Status string    `bson:"status" json:"status"`
+	Note   string    `bson:"note,omitempty" json:"note,omitempty"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// Shipment is one parcel of an order; an order may be split across several.
+type Shipment struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrderID        primitive.ObjectID `bson:"order_id" json:"order_id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Method         string             `bson:"method" json:"method"`
+	Carrier        string             `bson:"carrier,omitempty" json:"carrier,omitempty"`
+	TrackingNumber string             `bson:"tracking_number,omitempty" json:"tracking_number,omitempty"`
+	Status         string             `bson:"status" json:"status"`
+	Items          []ShipmentItem     `bson:"items" json:"items"`
+	Events         []ShipmentEvent    `bson:"events" json:"events"`
+	ShippedAt      *time.Time         `bson:"shipped_at,omitempty" json:"shipped_at,omitempty"`
+	DeliveredAt    *time.Time         `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type CreateShipmentRequest struct {
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+	Items          []struct {
+		OrderItemID string `json:"order_item_id" binding:"required"`
+		Quantity    int    `json:"quantity" binding:"required,gt=0"`
+	} `json:"items" binding:"dive"`
+}
+
+type UpdateShipmentRequest struct {
+	Status         string `json:"status" binding:"omitempty,oneof=pending packed shipped in_transit delivered returned"`
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+	Note           string `json:"note"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPastDue   = "past_due"
+	SubscriptionStatusCancelled = "cancelled"
+	SubscriptionStatusExpired   = "expired"
+)
+
+const (
+	SubscriptionEventStarted         = "started"
+	SubscriptionEventRenewed         = "renewed"
+	SubscriptionEventRenewalFailed   = "renewal_failed"
+	SubscriptionEventGraceStarted    = "grace_started"
+	SubscriptionEventCancelScheduled = "cancel_scheduled"
+	SubscriptionEventResumed         = "resumed"
+	SubscriptionEventExtended        = "extended"
+	SubscriptionEventEnded           = "ended"
+	SubscriptionEventExpired         = "expired"
+)
+
+type SubscriptionPlan struct {
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	Months    int    `json:"months"`
+	Price     Money  `json:"price"`
+	GraceDays int    `json:"grace_days"`
+}
+
+// Subscription is one premium membership. A user has at most one active or
+// past_due subscription; ended ones are kept as history.
+type Subscription struct {
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID             primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Plan               string             `bson:"plan" json:"plan"`
+	Price              Money              `bson:"price" json:"price"`
+	Status             string             `bson:"status" json:"status"`
+	AutoRenew          bool               `bson:"auto_renew" json:"auto_renew"`
+	CancelAtPeriodEnd  bool               `bson:"cancel_at_period_end" json:"cancel_at_period_end"`
+	CurrentPeriodStart time.Time          `bson:"current_period_start" json:"current_period_start"`
+	CurrentPeriodEnd   time.Time          `bson:"current_period_end" json:"current_period_end"`
+	GraceUntil         *time.Time         `bson:"grace_until,omitempty" json:"grace_until,omitempty"`
+	CancelledAt        *time.Time         `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+	EndedAt            *time.Time         `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+	CreatedAt          time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt          time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type SubscriptionEvent struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SubscriptionID primitive.ObjectID `bson:"subscription_id" json:"subscription_id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Type           string             `bson:"type" json:"type"`
+	Plan           string             `bson:"plan" json:"plan"`
+	Amount         Money              `bson:"amount" json:"amount"`
+	PeriodEnd      time.Time          `bson:"period_end" json:"period_end"`
+	Note           string             `bson:"note,omitempty" json:"note,omitempty"`
+	At             time.Time          `bson:"at" json:"at"`
+}
+
+type SubscribeRequest struct {
+	Plan      string `json:"plan" binding:"required"`
+	AutoRenew *bool  `json:"auto_renew"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TaxRule holds the rates for a country, or for a single region of it when
+// Region is set. Rates are fractions, e.g. 0.2 for 20%.
+type TaxRule struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Country      string             `bson:"country" json:"country"`
+	Region       string             `bson:"region,omitempty" json:"region,omitempty"`
+	Name         string             `bson:"name" json:"name"`
+	PhysicalRate float64            `bson:"physical_rate" json:"physical_rate"`
+	DigitalRate  float64            `bson:"digital_rate" json:"digital_rate"`
+	IsActive     bool               `bson:"is_active" json:"is_active"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type TaxRuleRequest struct {
+	Country      string  `json:"country" binding:"required,iso3166_1_alpha2"`
+	Region       string  `json:"region"`
+	Name         string  `json:"name" binding:"required"`
+	PhysicalRate float64 `json:"physical_rate" binding:"gte=0,lt=1"`
+	DigitalRate  float64 `json:"digital_rate" binding:"gte=0,lt=1"`
+	IsActive     *bool   `json:"is_active"`
+}
+
+// TaxLine is the tax charged for one class of goods in a quote.
+type TaxLine struct {
+	Name          string  `bson:"name" json:"name"`
+	GoodsCategory string  `bson:"goods_category" json:"goods_category"` // physical or digital
+	Rate          float64 `bson:"rate" json:"rate"`
+	Taxable       Money   `bson:"taxable" json:"taxable"`
+	Amount        Money   `bson:"amount" json:"amount"`
+}
@@ -13,14 +13,26 @@ type User struct {
 	Password      string             `bson:"password" json:"-"`
 	Role          string             `bson:"role" json:"role"`
 	IsPremium     bool               `bson:"is_premium" json:"is_premium"`
-	PremiumUntil  time.Time          `bson:"premium_until" json:"premium_until,omitempty"`
+	PremiumUntil  *time.Time         `bson:"premium_until,omitempty" json:"premium_until,omitempty"`
 	LoyaltyPoints int                `bson:"loyalty_points" json:"loyalty_points"`
+	LoyaltyTier   string             `bson:"loyalty_tier,omitempty" json:"loyalty_tier,omitempty"`
+	LoyaltySpend  Money              `bson:"loyalty_spend" json:"loyalty_spend"`
+	StoreCredit   Money              `bson:"store_credit" json:"store_credit"`
+	BorrowMonth   string             `bson:"borrow_month,omitempty" json:"-"`
+	BorrowCount   int                `bson:"borrow_count,omitempty" json:"-"`
 	IsActive      bool               `bson:"is_active" json:"is_active"`
 	ProfileImage  string             `bson:"profile_image" json:"profile_image"`
+	Avatar        *StoredImage       `bson:"avatar,omitempty" json:"avatar,omitempty"`
 	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+// HasPremium reports whether the user's premium membership is active. A
+// membership without an end date does not count.
+func (u User) HasPremium(now time.Time) bool {
+	return u.IsPremium && u.PremiumUntil != nil && u.PremiumUntil.After(now)
+}
+
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
@@ -39,7 +51,8 @@ type LoginResponse struct {
 	Role          string             `json:"role"`
 	Token         string             `json:"token"`
 	IsPremium     bool               `json:"is_premium"`
-	PremiumUntil  time.Time          `json:"premium_until,omitempty"`
+	PremiumUntil  *time.Time         `json:"premium_until,omitempty"`
 	LoyaltyLevel  string             `json:"loyalty_level,omitempty"`
+	LoyaltyColor  string             `json:"loyalty_color,omitempty"`
 	LoyaltyPoints int                `json:"loyalty_points,omitempty"`
 }
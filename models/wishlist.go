@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WishlistItem is a book a user would like to have.
+type WishlistItem struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID  primitive.ObjectID `bson:"user_id" json:"user_id"`
+	BookID  primitive.ObjectID `bson:"book_id" json:"book_id"`
+	AddedAt time.Time          `bson:"added_at" json:"added_at"`
+}
+
+type AddToWishlistRequest struct {
+	BookID string `json:"book_id" binding:"required"`
+}
+
+// WishlistBook is a wishlist entry with the book it points to.
+type WishlistBook struct {
+	BookLink
+	AddedAt time.Time `json:"added_at"`
+}
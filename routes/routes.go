@@ -1,8 +1,15 @@
 package routes
 
 import (
+	"bookstore/config"
 	"bookstore/handlers"
+	"bookstore/jobs"
 	"bookstore/middleware"
+	"bookstore/models"
+	"bookstore/services"
+	"context"
+	"log"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 
@@ -12,20 +19,141 @@ import (
 func SetupRoutes(
 	router *gin.Engine,
 	db *mongo.Database,
-	jwtSecret string,
+	cfg *config.Config,
+	jobRunner *jobs.Runner,
 ) {
+	jwtSecret := cfg.JWTSecret
+
 	usersCollection := db.Collection("users")
 	booksCollection := db.Collection("books")
 	ordersCollection := db.Collection("orders")
 	orderItemsCollection := db.Collection("order_items")
 	digitalAccessCollection := db.Collection("digital_access")
+	promotionsCollection := db.Collection("promotions")
+	promotionRedemptionsCollection := db.Collection("promotion_redemptions")
+	taxRulesCollection := db.Collection("tax_rules")
+	shippingMethodsCollection := db.Collection("shipping_methods")
+	shipmentsCollection := db.Collection("shipments")
+	addressesCollection := db.Collection("addresses")
+	returnsCollection := db.Collection("returns")
+	refundsCollection := db.Collection("refunds")
+	subscriptionsCollection := db.Collection("subscriptions")
+	subscriptionEventsCollection := db.Collection("subscription_events")
+	dailyStatsCollection := db.Collection("daily_stats")
+	pointsLedgerCollection := db.Collection("points_ledger")
+	loyaltyTiersCollection := db.Collection("loyalty_tiers")
+	notificationsCollection := db.Collection("notifications")
+	giftCardsCollection := db.Collection("gift_cards")
+	creditTransactionsCollection := db.Collection("credit_transactions")
+	giftsCollection := db.Collection("gifts")
+	libraryEntriesCollection := db.Collection("library_entries")
+	rentalsCollection := db.Collection("rentals")
+	authorsCollection := db.Collection("authors")
+	categoriesCollection := db.Collection("categories")
+	seriesCollection := db.Collection("series")
+	worksCollection := db.Collection("works")
+	catalogImportsCollection := db.Collection("catalog_imports")
+	bookRevisionsCollection := db.Collection("book_revisions")
+	priceHistoryCollection := db.Collection("price_history")
+	wishlistCollection := db.Collection("wishlist")
+	relatedBooksCollection := db.Collection("related_books")
+	recommendationsCollection := db.Collection("recommendations")
+
+	fallbackTaxRules, err := services.LoadTaxRulesFile(cfg.TaxRulesFile)
+	if err != nil {
+		log.Printf("Failed to load tax rules from %s: %v", cfg.TaxRulesFile, err)
+	}
+
+	promotionService := services.NewPromotionService(promotionsCollection, promotionRedemptionsCollection)
+	taxService := services.NewTaxService(taxRulesCollection, fallbackTaxRules, cfg.DefaultTaxCountry)
+	shippingService := services.NewShippingService(shippingMethodsCollection)
+	subscriptionService := services.NewSubscriptionService(subscriptionsCollection, subscriptionEventsCollection, usersCollection, services.NoopBiller{})
+	pointsService := services.NewPointsService(pointsLedgerCollection, usersCollection, cfg.PointsExpiryDays, models.Money(cfg.PointValueCents))
+	notificationService := services.NewNotificationService(notificationsCollection)
+	loyaltyService := services.NewLoyaltyService(loyaltyTiersCollection, ordersCollection, usersCollection, notificationService)
+	creditService := services.NewCreditService(giftCardsCollection, creditTransactionsCollection, usersCollection, services.NoopBiller{})
+	libraryService := services.NewLibraryService(digitalAccessCollection, libraryEntriesCollection, booksCollection, rentalsCollection, usersCollection, cfg.BorrowsPerMonth, cfg.BorrowDays)
+	giftService := services.NewGiftService(giftsCollection, ordersCollection, orderItemsCollection, refundsCollection, usersCollection, creditService, libraryService, services.LogMailer{}, cfg.GiftClaimDays, cfg.AppURL)
+	authorService := services.NewAuthorService(authorsCollection, booksCollection)
+	categoryService := services.NewCategoryService(categoriesCollection, booksCollection)
+	seriesService := services.NewSeriesService(seriesCollection, worksCollection, booksCollection)
+	revisionService := services.NewRevisionService(bookRevisionsCollection, priceHistoryCollection, booksCollection, categoryService)
+	catalogService := services.NewCatalogService(booksCollection, catalogImportsCollection, authorService, categoryService, seriesService, revisionService)
+	var metadataProvider services.MetadataProvider = services.NewOpenLibraryProvider(cfg.OpenLibraryURL)
+	if cfg.MetadataFixtures != "" {
+		fixtures, err := services.LoadMetadataFixtures(cfg.MetadataFixtures)
+		if err != nil {
+			log.Printf("Failed to load metadata fixtures from %s: %v", cfg.MetadataFixtures, err)
+		} else {
+			metadataProvider = fixtures
+		}
+	}
+	metadataService := services.NewMetadataService(booksCollection, metadataProvider)
+	blobStore, err := services.NewLocalBlobStore(cfg.UploadDir)
+	if err != nil {
+		log.Fatalf("Failed to open upload directory %s: %v", cfg.UploadDir, err)
+	}
+	imageService := services.NewImageService(blobStore, booksCollection, usersCollection)
+	bookArchiveService := services.NewBookArchiveService(booksCollection, orderItemsCollection, digitalAccessCollection, libraryEntriesCollection, rentalsCollection, giftsCollection, returnsCollection, wishlistCollection, promotionsCollection, bookRevisionsCollection, priceHistoryCollection, relatedBooksCollection, recommendationsCollection, imageService)
+	preorderService := services.NewPreorderService(ordersCollection, orderItemsCollection, booksCollection, services.NoopPaymentGateway{}, libraryService, notificationService)
+	wishlistService := services.NewWishlistService(wishlistCollection, booksCollection)
+	recommendationService := services.NewRecommendationService(orderItemsCollection, booksCollection, digitalAccessCollection, wishlistCollection, relatedBooksCollection, recommendationsCollection)
+	pricingService := services.NewPricingService(booksCollection, usersCollection, promotionService, taxService, shippingService, pointsService, loyaltyService, creditService)
+
+	// Imports cut off by the last shutdown will not resume.
+	startupCtx, cancelStartup := context.WithTimeout(context.Background(), 10*time.Second)
+	if n, err := catalogService.FailInterrupted(startupCtx, time.Now()); err != nil {
+		log.Printf("Failed to fail interrupted catalog imports: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted catalog imports as failed", n)
+	}
+	cancelStartup()
+
+	for _, job := range []jobs.Job{
+		jobs.SubscriptionExpiry(subscriptionService),
+		jobs.DigitalAccessCleanup(digitalAccessCollection),
+		jobs.DailyStats(ordersCollection, usersCollection, dailyStatsCollection),
+		jobs.PointsExpiry(pointsService),
+		jobs.LoyaltyTiers(loyaltyService),
+		jobs.GiftExpiry(giftService),
+		jobs.MetadataEnrichment(metadataService),
+		jobs.PreorderRelease(preorderService),
+		jobs.CatalogImports(catalogService),
+		jobs.Recommendations(recommendationService),
+	} {
+		if err := jobRunner.Register(job); err != nil {
+			log.Fatalf("Failed to register job: %v", err)
+		}
+	}
 
-	authHandler := handlers.NewAuthHandler(usersCollection, jwtSecret)
-	userHandler := handlers.NewUserHandler(usersCollection)
-	bookHandler := handlers.NewBookHandler(booksCollection, ordersCollection)
-	orderHandler := handlers.NewOrderHandler(ordersCollection, orderItemsCollection, booksCollection, digitalAccessCollection, usersCollection)
+	authHandler := handlers.NewAuthHandler(usersCollection, loyaltyService, jwtSecret)
+	bookHandler := handlers.NewBookHandler(booksCollection, ordersCollection, authorService, categoryService, seriesService, bookArchiveService, revisionService)
+	authorHandler := handlers.NewAuthorHandler(authorService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService)
+	seriesHandler := handlers.NewSeriesHandler(seriesService)
+	catalogHandler := handlers.NewCatalogHandler(catalogService)
+	metadataHandler := handlers.NewMetadataHandler(metadataService)
+	imageHandler := handlers.NewImageHandler(imageService)
+	revisionHandler := handlers.NewRevisionHandler(revisionService)
+	orderHandler := handlers.NewOrderHandler(ordersCollection, orderItemsCollection, booksCollection, usersCollection, shipmentsCollection, addressesCollection, promotionService, pricingService, pointsService, loyaltyService, creditService, giftService, libraryService, preorderService)
 	digitalAccessHandler := handlers.NewDigitalAccessHandler(digitalAccessCollection, booksCollection, booksCollection)
-	adminHandler := handlers.NewAdminHandler(usersCollection, booksCollection, ordersCollection)
+	adminHandler := handlers.NewAdminHandler(usersCollection, booksCollection, ordersCollection, loyaltyService)
+	promotionHandler := handlers.NewPromotionHandler(promotionsCollection, promotionRedemptionsCollection, categoryService)
+	taxHandler := handlers.NewTaxHandler(taxRulesCollection, taxService)
+	shippingHandler := handlers.NewShippingHandler(shippingMethodsCollection, shipmentsCollection, ordersCollection, orderItemsCollection, shippingService)
+	addressHandler := handlers.NewAddressHandler(addressesCollection)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
+	jobHandler := handlers.NewJobHandler(jobRunner)
+	returnHandler := handlers.NewReturnHandler(returnsCollection, refundsCollection, ordersCollection, orderItemsCollection, booksCollection, pointsService, loyaltyService, creditService, libraryService)
+	pointsHandler := handlers.NewPointsHandler(pointsService)
+	loyaltyHandler := handlers.NewLoyaltyHandler(loyaltyTiersCollection, loyaltyService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	giftCardHandler := handlers.NewGiftCardHandler(creditService)
+	walletHandler := handlers.NewWalletHandler(creditService)
+	giftHandler := handlers.NewGiftHandler(giftService, usersCollection)
+	wishlistHandler := handlers.NewWishlistHandler(wishlistService)
+	recommendationHandler := handlers.NewRecommendationHandler(recommendationService)
+	libraryHandler := handlers.NewLibraryHandler(libraryService)
 
 	api := router.Group("/api")
 	public := api.Group("")
@@ -40,9 +168,31 @@ func SetupRoutes(
 		{
 			books.GET("", bookHandler.GetBooks)
 			books.GET("/:id", bookHandler.GetBookByID)
+			books.GET("/isbn/:isbn", bookHandler.GetBookByISBN)
+			books.GET("/:id/related", recommendationHandler.GetRelated)
+		}
+
+		authors := public.Group("/authors")
+		{
+			authors.GET("", authorHandler.GetAuthors)
+			authors.GET("/:id", authorHandler.GetAuthorByID)
 		}
 
+		series := public.Group("/series")
+		{
+			series.GET("", seriesHandler.GetSeries)
+			series.GET("/:id", seriesHandler.GetSeriesByID)
+		}
+
+		public.GET("/images/*key", imageHandler.ServeImage)
+
+		public.GET("/categories", categoryHandler.GetCategories)
+		public.GET("/tags", categoryHandler.GetTags)
+
 		public.GET("/digital-books", digitalAccessHandler.ListAvailableDigitalBooks)
+		public.GET("/shipping-methods", shippingHandler.GetShippingMethods)
+		public.GET("/subscriptions/plans", subscriptionHandler.GetPlans)
+		public.GET("/loyalty-tiers", loyaltyHandler.GetTiers)
 	}
 
 	protected := api.Group("")
@@ -52,24 +202,98 @@ func SetupRoutes(
 		{
 			auth.GET("/profile", authHandler.GetProfile)
 			auth.PUT("/profile", authHandler.UpdateProfile)
+			auth.POST("/profile/avatar", imageHandler.UploadAvatar)
+			auth.DELETE("/profile/avatar", imageHandler.DeleteAvatar)
 		}
 
-		// user endpoints
-		protected.PUT("/users/premium", userHandler.PurchasePremium)
-		protected.DELETE("/users/premium", userHandler.CancelPremium)
+		// premium membership
+		protected.PUT("/users/premium", subscriptionHandler.PurchasePremium)
+		protected.DELETE("/users/premium", subscriptionHandler.CancelSubscription)
+
+		subscription := protected.Group("/users/me/subscription")
+		{
+			subscription.GET("", subscriptionHandler.GetSubscription)
+			subscription.POST("", subscriptionHandler.Subscribe)
+			subscription.DELETE("", subscriptionHandler.CancelSubscription)
+			subscription.PUT("/resume", subscriptionHandler.ResumeSubscription)
+		}
+
+		protected.GET("/users/me/points/history", pointsHandler.GetPointsHistory)
+
+		wallet := protected.Group("/users/me/wallet")
+		{
+			wallet.GET("", walletHandler.GetWallet)
+			wallet.POST("/redeem", walletHandler.RedeemGiftCard)
+		}
+
+		giftCards := protected.Group("/gift-cards")
+		{
+			giftCards.POST("", giftCardHandler.PurchaseGiftCard)
+			giftCards.GET("", giftCardHandler.GetPurchasedGiftCards)
+			giftCards.GET("/:code", giftCardHandler.CheckGiftCard)
+		}
+
+		gifts := protected.Group("/gifts")
+		{
+			gifts.GET("/sent", giftHandler.GetSentGifts)
+			gifts.GET("/received", giftHandler.GetReceivedGifts)
+			gifts.POST("/claim", giftHandler.ClaimGift)
+			gifts.POST("/:id/resend", giftHandler.ResendGift)
+		}
+
+		notifications := protected.Group("/users/me/notifications")
+		{
+			notifications.GET("", notificationHandler.GetNotifications)
+			notifications.PUT("/read", notificationHandler.MarkAllNotificationsRead)
+			notifications.PUT("/:id/read", notificationHandler.MarkNotificationRead)
+		}
+
+		addresses := protected.Group("/users/me/addresses")
+		{
+			addresses.GET("", addressHandler.GetAddresses)
+			addresses.POST("", addressHandler.CreateAddress)
+			addresses.PUT("/:id", addressHandler.UpdateAddress)
+			addresses.PUT("/:id/default", addressHandler.SetDefaultAddress)
+			addresses.DELETE("/:id", addressHandler.DeleteAddress)
+		}
+
+		wishlist := protected.Group("/users/me/wishlist")
+		{
+			wishlist.GET("", wishlistHandler.GetWishlist)
+			wishlist.POST("", wishlistHandler.AddToWishlist)
+			wishlist.DELETE("/:book_id", wishlistHandler.RemoveFromWishlist)
+		}
+
+		protected.GET("/recommendations", recommendationHandler.GetRecommendations)
 
 		orders := protected.Group("/orders")
 		{
 			orders.POST("", orderHandler.CreateOrder)
+			orders.POST("/quote", orderHandler.QuoteOrder)
 			orders.GET("", orderHandler.GetUserOrders)
 			orders.GET("/:id", orderHandler.GetOrderByID)
 			orders.DELETE("/:id", orderHandler.CancelOrder)
+			orders.POST("/:id/returns", returnHandler.CreateReturn)
+		}
+
+		returns := protected.Group("/returns")
+		{
+			returns.GET("", returnHandler.GetUserReturns)
+			returns.GET("/:id", returnHandler.GetReturnByID)
+			returns.DELETE("/:id", returnHandler.CancelReturn)
 		}
 
 		library := protected.Group("/library")
 		{
-			library.GET("", digitalAccessHandler.GetPersonalLibrary)
-			library.GET("/:format_id", digitalAccessHandler.GetDigitalBookAccess)
+			library.GET("", libraryHandler.GetPersonalLibrary)
+			library.GET("/rentals", libraryHandler.GetRentals)
+			library.POST("/borrow", libraryHandler.BorrowBook)
+			library.GET("/:book_id", libraryHandler.GetLibraryBook)
+			library.GET("/:book_id/download", libraryHandler.DownloadBook)
+			library.PUT("/:book_id/shelves", libraryHandler.UpdateShelves)
+			library.PUT("/:book_id/progress", libraryHandler.UpdateReadingProgress)
+			library.POST("/:book_id/bookmarks", libraryHandler.AddBookmark)
+			library.DELETE("/:book_id/bookmarks/:bookmark_id", libraryHandler.DeleteBookmark)
 		}
 	}
 
@@ -82,19 +306,135 @@ func SetupRoutes(
 		// moderator and admin can view users, but only admin can modify
 		admin.GET("/users", middleware.ModeratorOrAdminMiddleware(), adminHandler.GetAllUsers)
 		admin.PUT("/users/:id/deactivate", middleware.AdminMiddleware(), adminHandler.DeactivateUser)
-		admin.PUT("/users/:id/premium", middleware.AdminMiddleware(), adminHandler.UpgradeToPremium)
+		admin.PUT("/users/:id/premium", middleware.AdminMiddleware(), subscriptionHandler.GrantPremium)
+		admin.GET("/users/:id/subscription", middleware.AdminMiddleware(), subscriptionHandler.GetUserSubscription)
+		admin.POST("/users/:id/points", middleware.AdminMiddleware(), pointsHandler.AdjustPoints)
+		admin.GET("/users/:id/points/history", middleware.AdminMiddleware(), pointsHandler.GetUserPointsHistory)
+		admin.POST("/users/:id/wallet", middleware.AdminMiddleware(), walletHandler.AdjustWallet)
+		admin.GET("/users/:id/wallet", middleware.AdminMiddleware(), walletHandler.GetUserWallet)
 		admin.PUT("/users/:id/role", middleware.AdminMiddleware(), adminHandler.UpdateUserRole)
 		admin.GET("/orders", middleware.AdminMiddleware(), adminHandler.GetAllOrders)
 		admin.PUT("/orders/:id", middleware.AdminMiddleware(), adminHandler.UpdateOrderStatus)
 		admin.PUT("/orders/:id/delivery", middleware.AdminMiddleware(), adminHandler.UpdateDeliveryStatus)
+		admin.POST("/orders/:id/shipments", middleware.AdminMiddleware(), shippingHandler.CreateShipment)
+		admin.PUT("/shipments/:id", middleware.AdminMiddleware(), shippingHandler.UpdateShipment)
+
+		// returns are reviewed by staff, refunds are issued by admins only
+		returns := admin.Group("/returns")
+		returns.Use(middleware.ModeratorOrAdminMiddleware())
+		{
+			returns.GET("", returnHandler.GetReturnQueue)
+			returns.PUT("/:id/approve", returnHandler.ApproveReturn)
+			returns.PUT("/:id/reject", returnHandler.RejectReturn)
+			returns.PUT("/:id/receive", returnHandler.ReceiveReturn)
+			returns.POST("/:id/refund", middleware.AdminMiddleware(), returnHandler.RefundReturn)
+		}
+
+		adminJobs := admin.Group("/jobs")
+		adminJobs.Use(middleware.AdminMiddleware())
+		{
+			adminJobs.GET("", jobHandler.GetJobs)
+			adminJobs.GET("/runs", jobHandler.GetJobRuns)
+			adminJobs.POST("/:name/run", jobHandler.TriggerJob)
+		}
+
+		promotions := admin.Group("/promotions")
+		promotions.Use(middleware.AdminMiddleware())
+		{
+			promotions.POST("", promotionHandler.CreatePromotion)
+			promotions.GET("", promotionHandler.GetPromotions)
+			promotions.GET("/:id", promotionHandler.GetPromotionByID)
+			promotions.PUT("/:id", promotionHandler.UpdatePromotion)
+			promotions.DELETE("/:id", promotionHandler.DeletePromotion)
+		}
+
+		shippingMethods := admin.Group("/shipping-methods")
+		shippingMethods.Use(middleware.AdminMiddleware())
+		{
+			shippingMethods.POST("", shippingHandler.CreateShippingMethod)
+			shippingMethods.PUT("/:id", shippingHandler.UpdateShippingMethod)
+			shippingMethods.DELETE("/:id", shippingHandler.DeleteShippingMethod)
+		}
+
+		adminGiftCards := admin.Group("/gift-cards")
+		adminGiftCards.Use(middleware.AdminMiddleware())
+		{
+			adminGiftCards.GET("", giftCardHandler.GetGiftCards)
+			adminGiftCards.POST("", giftCardHandler.IssueGiftCard)
+			adminGiftCards.GET("/:id", giftCardHandler.GetGiftCardByID)
+			adminGiftCards.PUT("/:id/disable", giftCardHandler.DisableGiftCard)
+			adminGiftCards.PUT("/:id/enable", giftCardHandler.EnableGiftCard)
+		}
+
+		loyaltyTiers := admin.Group("/loyalty-tiers")
+		loyaltyTiers.Use(middleware.AdminMiddleware())
+		{
+			loyaltyTiers.GET("", loyaltyHandler.GetTiers)
+			loyaltyTiers.POST("", loyaltyHandler.CreateTier)
+			loyaltyTiers.PUT("/:id", loyaltyHandler.UpdateTier)
+			loyaltyTiers.DELETE("/:id", loyaltyHandler.DeleteTier)
+		}
+
+		taxRules := admin.Group("/tax-rules")
+		taxRules.Use(middleware.AdminMiddleware())
+		{
+			taxRules.GET("", taxHandler.GetTaxRules)
+			taxRules.POST("", taxHandler.CreateTaxRule)
+			taxRules.PUT("/:id", taxHandler.UpdateTaxRule)
+			taxRules.DELETE("/:id", taxHandler.DeleteTaxRule)
+		}
 
 		// moderator or admin endpoints - book management
 		books := admin.Group("/books")
 		books.Use(middleware.ModeratorOrAdminMiddleware())
 		{
 			books.POST("", bookHandler.CreateBook)
+			books.GET("/isbn-issues", bookHandler.GetISBNIssues)
+			books.POST("/lookup", metadataHandler.LookupBook)
+			books.POST("/:id/cover", imageHandler.UploadBookCover)
+			books.DELETE("/:id/cover", imageHandler.DeleteBookCover)
 			books.PUT("/:id", bookHandler.UpdateBook)
 			books.DELETE("/:id", bookHandler.DeleteBook)
+			books.GET("/deleted", bookHandler.GetDeletedBooks)
+			books.POST("/:id/restore", bookHandler.RestoreBook)
+			books.GET("/:id/history", revisionHandler.GetHistory)
+			books.GET("/:id/history/:version", revisionHandler.GetRevision)
+			books.POST("/:id/history/:version/rollback", revisionHandler.Rollback)
+			books.GET("/:id/price-history", revisionHandler.GetPriceHistory)
+		}
+
+		catalog := admin.Group("/catalog")
+		catalog.Use(middleware.ModeratorOrAdminMiddleware())
+		{
+			catalog.POST("/imports", catalogHandler.ImportCatalog)
+			catalog.GET("/imports", catalogHandler.GetImports)
+			catalog.GET("/imports/:id", catalogHandler.GetImport)
+			catalog.GET("/export", catalogHandler.ExportCatalog)
+		}
+
+		authors := admin.Group("/authors")
+		authors.Use(middleware.ModeratorOrAdminMiddleware())
+		{
+			authors.POST("", authorHandler.CreateAuthor)
+			authors.PUT("/:id", authorHandler.UpdateAuthor)
+			authors.DELETE("/:id", authorHandler.DeleteAuthor)
+			authors.POST("/:id/merge", authorHandler.MergeAuthor)
+		}
+
+		categories := admin.Group("/categories")
+		categories.Use(middleware.ModeratorOrAdminMiddleware())
+		{
+			categories.POST("", categoryHandler.CreateCategory)
+			categories.PUT("/:id", categoryHandler.UpdateCategory)
+			categories.DELETE("/:id", categoryHandler.DeleteCategory)
+		}
+
+		series := admin.Group("/series")
+		series.Use(middleware.ModeratorOrAdminMiddleware())
+		{
+			series.POST("", seriesHandler.CreateSeries)
+			series.PUT("/:id", seriesHandler.UpdateSeries)
+			series.DELETE("/:id", seriesHandler.DeleteSeries)
 		}
 	}
 }
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrAuthorNotFound = errors.New("author not found")
+	ErrAuthorExists   = errors.New("an author with this name already exists")
+	ErrAuthorHasBooks = errors.New("author is still credited on books")
+	ErrInvalidAuthor  = errors.New("invalid author")
+)
+
+// AuthorService keeps the authors collection and the author credits copied
+// onto books in step.
+type AuthorService struct {
+	authorsCollection *mongo.Collection
+	booksCollection   *mongo.Collection
+}
+
+func NewAuthorService(authorsCollection, booksCollection *mongo.Collection) *AuthorService {
+	return &AuthorService{
+		authorsCollection: authorsCollection,
+		booksCollection:   booksCollection,
+	}
+}
+
+// Resolve turns the credits of a book request into book authors, creating
+// authors for names that are not known yet. Without inputs the free-text
+// author line is split into names, all credited as authors.
+func (s *AuthorService) Resolve(ctx context.Context, inputs []models.BookAuthorInput, authorLine string) ([]models.BookAuthor, error) {
+	if len(inputs) == 0 {
+		for _, name := range models.SplitAuthorNames(authorLine) {
+			inputs = append(inputs, models.BookAuthorInput{Name: name})
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("%w: a book needs at least one author", ErrInvalidAuthor)
+	}
+
+	authors := []models.BookAuthor{}
+	seen := map[string]bool{}
+	for _, in := range inputs {
+		var author *models.Author
+		var err error
+		if in.AuthorID != "" {
+			id, idErr := primitive.ObjectIDFromHex(in.AuthorID)
+			if idErr != nil {
+				return nil, fmt.Errorf("%w: invalid author ID %q", ErrInvalidAuthor, in.AuthorID)
+			}
+			author, err = s.Get(ctx, id)
+			if errors.Is(err, ErrAuthorNotFound) {
+				return nil, fmt.Errorf("%w: author %s not found", ErrInvalidAuthor, in.AuthorID)
+			}
+		} else {
+			author, err = s.FindOrCreate(ctx, in.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		role := in.Role
+		if role == "" {
+			role = models.AuthorRoleAuthor
+		}
+		if seen[author.ID.Hex()+role] {
+			continue
+		}
+		seen[author.ID.Hex()+role] = true
+		authors = append(authors, models.BookAuthor{AuthorID: author.ID, Name: author.Name, Role: role})
+	}
+	return authors, nil
+}
+
+// FindOrCreate returns the author whose normalized name matches, creating
+// one when there is none.
+func (s *AuthorService) FindOrCreate(ctx context.Context, name string) (*models.Author, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	key := models.AuthorKey(name)
+	if key == "" {
+		return nil, fmt.Errorf("%w: %q is not a name", ErrInvalidAuthor, name)
+	}
+
+	now := time.Now()
+	var author models.Author
+	err := s.authorsCollection.FindOneAndUpdate(ctx,
+		bson.M{"key": key},
+		bson.M{"$setOnInsert": bson.M{"name": name, "key": key, "created_at": now, "updated_at": now}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&author)
+	if mongo.IsDuplicateKeyError(err) {
+		// created by a concurrent request
+		err = s.authorsCollection.FindOne(ctx, bson.M{"key": key}).Decode(&author)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &author, nil
+}
+
+func (s *AuthorService) Get(ctx context.Context, id primitive.ObjectID) (*models.Author, error) {
+	var author models.Author
+	err := s.authorsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&author)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrAuthorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &author, nil
+}
+
+func (s *AuthorService) List(ctx context.Context, search string, limit int64) ([]models.Author, error) {
+	filter := bson.M{}
+	if search = strings.TrimSpace(search); search != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(search), "$options": "i"}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}}).SetLimit(limit)
+	cursor, err := s.authorsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var authors []models.Author
+	if err := cursor.All(ctx, &authors); err != nil {
+		return nil, err
+	}
+	return authors, nil
+}
+
+// Books lists the books the author is credited on, newest first.
+func (s *AuthorService) Books(ctx context.Context, authorID primitive.ObjectID) ([]models.Book, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "published_year", Value: -1}, {Key: "title", Value: 1}})
+	cursor, err := s.booksCollection.Find(ctx, bson.M{"authors.author_id": authorID, "deleted_at": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var books []models.Book
+	if err := cursor.All(ctx, &books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (s *AuthorService) Create(ctx context.Context, req models.AuthorRequest) (*models.Author, error) {
+	name := strings.Join(strings.Fields(req.Name), " ")
+	author := models.Author{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Key:       models.AuthorKey(name),
+		Bio:       strings.TrimSpace(req.Bio),
+		PhotoURL:  req.PhotoURL,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if author.Key == "" {
+		return nil, fmt.Errorf("%w: %q is not a name", ErrInvalidAuthor, req.Name)
+	}
+	_, err := s.authorsCollection.InsertOne(ctx, author)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrAuthorExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &author, nil
+}
+
+// Update edits an author. A new name is copied onto every book crediting
+// the author.
+func (s *AuthorService) Update(ctx context.Context, id primitive.ObjectID, req models.AuthorRequest) (*models.Author, error) {
+	name := strings.Join(strings.Fields(req.Name), " ")
+	key := models.AuthorKey(name)
+	if key == "" {
+		return nil, fmt.Errorf("%w: %q is not a name", ErrInvalidAuthor, req.Name)
+	}
+
+	var author models.Author
+	err := s.authorsCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"name":       name,
+			"key":        key,
+			"bio":        strings.TrimSpace(req.Bio),
+			"photo_url":  req.PhotoURL,
+			"updated_at": time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&author)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrAuthorExists
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrAuthorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.rewriteCredits(ctx, id, func(credits []models.BookAuthor) []models.BookAuthor {
+		for i := range credits {
+			if credits[i].AuthorID == id {
+				credits[i].Name = author.Name
+			}
+		}
+		return credits
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &author, nil
+}
+
+// Delete removes an author who is no longer credited on any book.
+func (s *AuthorService) Delete(ctx context.Context, id primitive.ObjectID) error {
+	count, err := s.booksCollection.CountDocuments(ctx, bson.M{"authors.author_id": id})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAuthorHasBooks
+	}
+	result, err := s.authorsCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrAuthorNotFound
+	}
+	return nil
+}
+
+// Merge moves every credit of one author to another and deletes the first,
+// for duplicates that name normalization did not catch. It returns the
+// number of books changed.
+func (s *AuthorService) Merge(ctx context.Context, fromID, intoID primitive.ObjectID) (int, error) {
+	if fromID == intoID {
+		return 0, fmt.Errorf("%w: cannot merge an author into itself", ErrInvalidAuthor)
+	}
+	if _, err := s.Get(ctx, fromID); err != nil {
+		return 0, err
+	}
+	into, err := s.Get(ctx, intoID)
+	if err != nil {
+		return 0, err
+	}
+
+	changed, err := s.rewriteCredits(ctx, fromID, func(credits []models.BookAuthor) []models.BookAuthor {
+		merged := []models.BookAuthor{}
+		seen := map[string]bool{}
+		for _, c := range credits {
+			if c.AuthorID == fromID {
+				c.AuthorID = into.ID
+				c.Name = into.Name
+			}
+			if seen[c.AuthorID.Hex()+c.Role] {
+				continue
+			}
+			seen[c.AuthorID.Hex()+c.Role] = true
+			merged = append(merged, c)
+		}
+		return merged
+	})
+	if err != nil {
+		return changed, err
+	}
+
+	_, err = s.authorsCollection.DeleteOne(ctx, bson.M{"_id": fromID})
+	return changed, err
+}
+
+// rewriteCredits applies rewrite to the credits of every book crediting the
+// author and refreshes the book's author line.
+func (s *AuthorService) rewriteCredits(ctx context.Context, authorID primitive.ObjectID, rewrite func([]models.BookAuthor) []models.BookAuthor) (int, error) {
+	cursor, err := s.booksCollection.Find(ctx,
+		bson.M{"authors.author_id": authorID},
+		options.Find().SetProjection(bson.M{"_id": 1, "authors": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var books []models.Book
+	if err := cursor.All(ctx, &books); err != nil {
+		return 0, err
+	}
+
+	for i, book := range books {
+		credits := rewrite(book.Authors)
+		_, err := s.booksCollection.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{"$set": bson.M{
+			"authors":    credits,
+			"author":     models.AuthorLine(credits),
+			"updated_at": time.Now(),
+		}})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(books), nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrBookNotDeleted = errors.New("book is not deleted")
+	ErrBookReferenced = errors.New("book is still referenced by orders or libraries")
+)
+
+// BookArchiveService deletes books softly: a deleted book leaves the
+// catalog but its document stays, so order items, library entries and other
+// records that point at it keep resolving. Only a deleted book that nothing
+// points at can be removed for good.
+type BookArchiveService struct {
+	booksCollection           *mongo.Collection
+	promotionsCollection      *mongo.Collection
+	relatedCollection         *mongo.Collection
+	recommendationsCollection *mongo.Collection
+	imageService              *ImageService
+	// references are the collections whose book_id points at books
+	references []*mongo.Collection
+	// dependents are the collections whose records about a book go with it
+	dependents []*mongo.Collection
+}
+
+func NewBookArchiveService(booksCollection, orderItemsCollection, digitalAccessCollection, libraryEntriesCollection, rentalsCollection, giftsCollection, returnsCollection, wishlistCollection, promotionsCollection, revisionsCollection, priceHistoryCollection, relatedCollection, recommendationsCollection *mongo.Collection, imageService *ImageService) *BookArchiveService {
+	return &BookArchiveService{
+		booksCollection:           booksCollection,
+		promotionsCollection:      promotionsCollection,
+		relatedCollection:         relatedCollection,
+		recommendationsCollection: recommendationsCollection,
+		imageService:              imageService,
+		references: []*mongo.Collection{
+			orderItemsCollection,
+			digitalAccessCollection,
+			libraryEntriesCollection,
+			rentalsCollection,
+			giftsCollection,
+			returnsCollection,
+		},
+		dependents: []*mongo.Collection{
+			revisionsCollection,
+			priceHistoryCollection,
+			wishlistCollection,
+		},
+	}
+}
+
+// Delete takes a book out of the catalog. Deleting a deleted book does
+// nothing.
+func (s *BookArchiveService) Delete(ctx context.Context, bookID, deletedBy primitive.ObjectID) error {
+	result, err := s.booksCollection.UpdateOne(ctx,
+		bson.M{"_id": bookID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"deleted_at": time.Now(), "deleted_by": deletedBy}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return s.exists(ctx, bookID)
+	}
+	return nil
+}
+
+// Restore puts a deleted book back in the catalog.
+func (s *BookArchiveService) Restore(ctx context.Context, bookID primitive.ObjectID) error {
+	result, err := s.booksCollection.UpdateOne(ctx,
+		bson.M{"_id": bookID, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{
+			"$set":   bson.M{"updated_at": time.Now()},
+			"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if err := s.exists(ctx, bookID); err != nil {
+			return err
+		}
+		return ErrBookNotDeleted
+	}
+	return nil
+}
+
+// Deleted lists deleted books, most recently deleted first.
+func (s *BookArchiveService) Deleted(ctx context.Context, limit int64) ([]models.Book, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}}).SetLimit(limit)
+	cursor, err := s.booksCollection.Find(ctx, bson.M{"deleted_at": bson.M{"$ne": nil}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var books []models.Book
+	if err := cursor.All(ctx, &books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// References counts the records pointing at a book, by collection. Only
+// collections with references are listed.
+func (s *BookArchiveService) References(ctx context.Context, bookID primitive.ObjectID) (map[string]int64, error) {
+	refs := map[string]int64{}
+	for _, collection := range s.references {
+		n, err := collection.CountDocuments(ctx, bson.M{"book_id": bookID})
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			refs[collection.Name()] = n
+		}
+	}
+	return refs, nil
+}
+
+// Purge removes a deleted book for good, along with its uploaded cover, its
+// revisions, price history and wishlist entries, and its place in
+// promotions and the recommendations cache. It returns ErrBookReferenced,
+// with the references, while anything still points at the book.
+func (s *BookArchiveService) Purge(ctx context.Context, bookID primitive.ObjectID) (map[string]int64, error) {
+	var book models.Book
+	err := s.booksCollection.FindOne(ctx, bson.M{"_id": bookID}).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if book.DeletedAt == nil {
+		return nil, ErrBookNotDeleted
+	}
+	refs, err := s.References(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) > 0 {
+		return refs, ErrBookReferenced
+	}
+
+	if book.Cover != nil {
+		if err := s.imageService.RemoveBookCover(ctx, bookID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.promotionsCollection.UpdateMany(ctx, bson.M{"book_ids": bookID}, bson.M{"$pull": bson.M{"book_ids": bookID}}); err != nil {
+		return nil, err
+	}
+	for _, collection := range s.dependents {
+		if _, err := collection.DeleteMany(ctx, bson.M{"book_id": bookID}); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.uncache(ctx, bookID); err != nil {
+		return nil, err
+	}
+	_, err = s.booksCollection.DeleteOne(ctx, bson.M{"_id": bookID, "deleted_at": bson.M{"$ne": nil}})
+	return nil, err
+}
+
+// uncache takes a book out of the related books and recommendations cache,
+// both as a recommended book and as the reason for one.
+func (s *BookArchiveService) uncache(ctx context.Context, bookID primitive.ObjectID) error {
+	if _, err := s.relatedCollection.DeleteOne(ctx, bson.M{"_id": bookID}); err != nil {
+		return err
+	}
+	for _, collection := range []*mongo.Collection{s.relatedCollection, s.recommendationsCollection} {
+		_, err := collection.UpdateMany(ctx, bson.M{"books.book_id": bookID}, bson.M{"$pull": bson.M{"books": bson.M{"book_id": bookID}}})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := s.recommendationsCollection.UpdateMany(ctx, bson.M{"books.because_of": bookID}, bson.M{"$pull": bson.M{"books.$[].because_of": bookID}})
+	return err
+}
+
+func (s *BookArchiveService) exists(ctx context.Context, bookID primitive.ObjectID) error {
+	count, err := s.booksCollection.CountDocuments(ctx, bson.M{"_id": bookID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrBookNotFound
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrImportNotFound = errors.New("import not found")
+
+const (
+	// MaxImportErrors caps the row errors kept on an import.
+	MaxImportErrors = 1000
+	// importProgressEvery is how often, in rows, a running import saves its
+	// counters.
+	importProgressEvery = 100
+	// importHeartbeat is the longest a running import goes without saving
+	// its progress, however slow its rows are.
+	importHeartbeat = time.Minute
+	// importStaleAfter is how long an unfinished import may go without
+	// saving progress before it is taken to have been cut off.
+	importStaleAfter = 5 * time.Minute
+)
+
+// CatalogService imports books in bulk from catalog files and exports the
+// catalog to them.
+type CatalogService struct {
+	booksCollection   *mongo.Collection
+	importsCollection *mongo.Collection
+	authorService     *AuthorService
+	categoryService   *CategoryService
+	seriesService     *SeriesService
+	revisionService   *RevisionService
+}
+
+func NewCatalogService(booksCollection, importsCollection *mongo.Collection, authorService *AuthorService, categoryService *CategoryService, seriesService *SeriesService, revisionService *RevisionService) *CatalogService {
+	return &CatalogService{
+		booksCollection:   booksCollection,
+		importsCollection: importsCollection,
+		authorService:     authorService,
+		categoryService:   categoryService,
+		seriesService:     seriesService,
+		revisionService:   revisionService,
+	}
+}
+
+// NewImport records an uploaded file before its rows are processed.
+// rowErrors are the rows that were rejected while reading the file.
+func (s *CatalogService) NewImport(ctx context.Context, createdBy primitive.ObjectID, fileName, format string, dryRun bool, totalRows int, rowErrors []models.ImportRowError) (*models.CatalogImport, error) {
+	if len(rowErrors) > MaxImportErrors {
+		rowErrors = rowErrors[:MaxImportErrors]
+	}
+	if rowErrors == nil {
+		rowErrors = []models.ImportRowError{}
+	}
+	now := time.Now()
+	imp := &models.CatalogImport{
+		ID:        primitive.NewObjectID(),
+		FileName:  fileName,
+		Format:    format,
+		DryRun:    dryRun,
+		Status:    models.ImportStatusQueued,
+		TotalRows: totalRows,
+		Processed: len(rowErrors),
+		Failed:    len(rowErrors),
+		Errors:    rowErrors,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := s.importsCollection.InsertOne(ctx, imp); err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// Run applies the rows of an import, or only checks them on a dry run,
+// saving progress as it goes. Rows are matched to existing books by ISBN.
+func (s *CatalogService) Run(ctx context.Context, imp *models.CatalogImport, rows []models.CatalogRow) {
+	imp.Status = models.ImportStatusProcessing
+	s.saveProgress(imp)
+
+	for i, row := range rows {
+		if err := ctx.Err(); err != nil {
+			imp.Status = models.ImportStatusFailed
+			imp.Error = err.Error()
+			break
+		}
+
+		created, err := s.apply(ctx, row, imp.DryRun, imp.CreatedBy)
+		imp.Processed++
+		switch {
+		case err != nil:
+			imp.Failed++
+			if len(imp.Errors) < MaxImportErrors {
+				imp.Errors = append(imp.Errors, models.ImportRowError{Row: row.Row, ISBN: row.Book.ISBN, Error: err.Error()})
+			}
+		case created:
+			imp.Created++
+		default:
+			imp.Updated++
+		}
+		if (i+1)%importProgressEvery == 0 || time.Since(imp.UpdatedAt) >= importHeartbeat {
+			s.saveProgress(imp)
+		}
+	}
+
+	if imp.Status == models.ImportStatusProcessing {
+		imp.Status = models.ImportStatusCompleted
+	}
+	now := time.Now()
+	imp.FinishedAt = &now
+	s.saveProgress(imp)
+}
+
+// FailInterrupted marks unfinished imports that have stopped saving progress
+// as failed. Their run was cut off, usually by a restart, and will not
+// resume, so they would otherwise stay queued or processing forever.
+func (s *CatalogService) FailInterrupted(ctx context.Context, now time.Time) (int64, error) {
+	result, err := s.importsCollection.UpdateMany(ctx, bson.M{
+		"status": bson.M{"$in": []string{models.ImportStatusQueued, models.ImportStatusProcessing}},
+		"$or": []bson.M{
+			{"updated_at": bson.M{"$lt": now.Add(-importStaleAfter)}},
+			{"updated_at": bson.M{"$exists": false}},
+		},
+	}, bson.M{"$set": bson.M{
+		"status":      models.ImportStatusFailed,
+		"error":       "import was interrupted before it finished",
+		"finished_at": now,
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (s *CatalogService) Import(ctx context.Context, id primitive.ObjectID) (*models.CatalogImport, error) {
+	var imp models.CatalogImport
+	err := s.importsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&imp)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrImportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+// Imports lists recent imports without their row errors.
+func (s *CatalogService) Imports(ctx context.Context, limit int64) ([]models.CatalogImport, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"errors": 0})
+	cursor, err := s.importsCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var imports []models.CatalogImport
+	if err := cursor.All(ctx, &imports); err != nil {
+		return nil, err
+	}
+	return imports, nil
+}
+
+// Export writes every book to w in the given format.
+func (s *CatalogService) Export(ctx context.Context, format string, w io.Writer) error {
+	writer, err := newCatalogWriter(format, w)
+	if err != nil {
+		return err
+	}
+
+	allSeries, err := s.seriesService.List(ctx, "", 0)
+	if err != nil {
+		return err
+	}
+	seriesNames := map[primitive.ObjectID]string{}
+	for _, series := range allSeries {
+		seriesNames[series.ID] = series.Name
+	}
+
+	cursor, err := s.booksCollection.Find(ctx, bson.M{"deleted_at": nil}, options.Find().SetSort(bson.D{{Key: "title", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return err
+		}
+		series := ""
+		if book.SeriesID != nil {
+			series = seriesNames[*book.SeriesID]
+		}
+		if err := writer.Write(book, series); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// apply creates or updates the book of one row and reports whether it was
+// created. On a dry run it only resolves the row's references. Changes are
+// recorded as revisions by the user who started the import.
+func (s *CatalogService) apply(ctx context.Context, row models.CatalogRow, dryRun bool, editor primitive.ObjectID) (bool, error) {
+	req := row.Book
+	isbn, ok := models.ISBN13(req.ISBN)
+	if !ok {
+		return false, fmt.Errorf("invalid ISBN %q", req.ISBN)
+	}
+
+	var existing models.Book
+	err := s.booksCollection.FindOne(ctx, bson.M{"isbn": isbn}).Decode(&existing)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return false, err
+	}
+	found := err == nil
+	if found && existing.DeletedAt != nil {
+		return false, errors.New("the book with this ISBN is deleted; restore it before importing")
+	}
+
+	var category *models.Category
+	if req.Category != "" {
+		category, err = s.categoryService.Lookup(ctx, req.Category)
+		if errors.Is(err, ErrCategoryNotFound) {
+			return false, fmt.Errorf("unknown category %q", req.Category)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	var series *models.Series
+	if row.Series != "" {
+		series, err = s.seriesService.Named(ctx, row.Series, !dryRun)
+		if err != nil && !(dryRun && errors.Is(err, ErrSeriesNotFound)) {
+			return false, err
+		}
+	}
+
+	if dryRun {
+		if len(req.Authors) == 0 && len(models.SplitAuthorNames(req.Author)) == 0 {
+			return false, fmt.Errorf("%w: a book needs at least one author", ErrInvalidAuthor)
+		}
+		return !found, nil
+	}
+
+	authors, err := s.authorService.Resolve(ctx, req.Authors, req.Author)
+	if err != nil {
+		return false, err
+	}
+	formats := make([]models.BookFormat, len(req.Formats))
+	for i, f := range req.Formats {
+		formats[i] = f.BookFormat()
+	}
+
+	set := bson.M{
+		"isbn":       isbn,
+		"title":      req.Title,
+		"author":     models.AuthorLine(authors),
+		"authors":    authors,
+		"formats":    formats,
+		"updated_at": time.Now(),
+	}
+	if req.Description != "" {
+		set["description"] = req.Description
+	}
+	if req.ImageURL != "" {
+		set["image_url"] = req.ImageURL
+	}
+	if req.PublishedYear > 0 {
+		set["published_year"] = req.PublishedYear
+	}
+	if req.Tags != nil {
+		set["tags"] = models.NormalizeTags(req.Tags)
+	}
+	if req.Language != "" {
+		set["language"] = req.Language
+	}
+	if req.TranslatedFrom != "" {
+		set["translated_from"] = req.TranslatedFrom
+	}
+	if req.ReleaseDate != nil {
+		set["release_date"] = req.ReleaseDate
+	}
+	if category != nil {
+		set["category"] = category.Name
+		set["category_id"] = category.ID
+		set["category_path"] = category.Path()
+	}
+	if series != nil {
+		set["series_id"] = series.ID
+		if req.SeriesPosition > 0 {
+			set["series_position"] = req.SeriesPosition
+		}
+	}
+
+	if found {
+		_, err := s.booksCollection.UpdateOne(ctx, bson.M{"_id": existing.ID}, bson.M{"$set": set, "$unset": bson.M{"legacy_isbn": ""}})
+		if err != nil {
+			return false, err
+		}
+		s.revisionService.Record(ctx, existing.ID, &existing, models.RevisionImport, &editor)
+		return false, nil
+	}
+	result, err := s.booksCollection.UpdateOne(ctx,
+		bson.M{"isbn": isbn},
+		bson.M{
+			"$set":         set,
+			"$setOnInsert": bson.M{"rating": 0.0, "total_ratings": 0, "created_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	if id, ok := result.UpsertedID.(primitive.ObjectID); ok {
+		s.revisionService.Record(ctx, id, nil, models.RevisionImport, &editor)
+	}
+	return true, nil
+}
+
+// saveProgress stores the counters of a running import. It uses its own
+// context so the final state is saved even when the import was cut short.
+func (s *CatalogService) saveProgress(imp *models.CatalogImport) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	imp.UpdatedAt = time.Now()
+	_, err := s.importsCollection.UpdateOne(ctx, bson.M{"_id": imp.ID}, bson.M{"$set": bson.M{
+		"status":      imp.Status,
+		"processed":   imp.Processed,
+		"created":     imp.Created,
+		"updated":     imp.Updated,
+		"failed":      imp.Failed,
+		"errors":      imp.Errors,
+		"error":       imp.Error,
+		"finished_at": imp.FinishedAt,
+		"updated_at":  imp.UpdatedAt,
+	}})
+	if err != nil {
+		log.Printf("Failed to save progress of catalog import %s: %v", imp.ID.Hex(), err)
+	}
+}
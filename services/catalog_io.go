@@ -0,0 +1,824 @@
+package services
+
+import (
+	"bookstore/models"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownCatalogFormat = errors.New("unknown catalog format; use csv, jsonl or onix")
+
+// catalogCSVColumns are the columns of a catalog CSV file. Each format of
+// a book has its own price and stock columns; a format is included when
+// its price is filled in. Tags are separated by "|".
+var catalogCSVColumns = []string{
+	"isbn", "title", "author", "description", "image_url", "published_year",
+	"category", "tags", "language", "translated_from", "series", "series_position",
+	"physical_price", "physical_stock", "weight_grams",
+	"digital_price", "digital_stock",
+	"both_price", "both_stock",
+	"rental_7_price", "rental_14_price", "rental_30_price",
+}
+
+var rentalPeriods = []int{7, 14, 30}
+
+// ReadCatalog parses a catalog file into rows. Rows that cannot be parsed
+// are reported and skipped; an error is returned only when the file as a
+// whole cannot be read.
+func ReadCatalog(format string, r io.Reader) ([]models.CatalogRow, []models.ImportRowError, error) {
+	switch format {
+	case models.CatalogFormatCSV:
+		return readCatalogCSV(r)
+	case models.CatalogFormatJSONL:
+		return readCatalogJSONL(r)
+	case models.CatalogFormatONIX:
+		return readCatalogONIX(r)
+	}
+	return nil, nil, ErrUnknownCatalogFormat
+}
+
+// CatalogFormatFromFileName guesses the format of an uploaded file from its
+// extension.
+func CatalogFormatFromFileName(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".csv"):
+		return models.CatalogFormatCSV
+	case strings.HasSuffix(name, ".jsonl"), strings.HasSuffix(name, ".ndjson"):
+		return models.CatalogFormatJSONL
+	case strings.HasSuffix(name, ".xml"), strings.HasSuffix(name, ".onix"):
+		return models.CatalogFormatONIX
+	}
+	return ""
+}
+
+func readCatalogCSV(r io.Reader) ([]models.CatalogRow, []models.ImportRowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading the header row: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["isbn"]; !ok {
+		return nil, nil, errors.New("the header row has no isbn column")
+	}
+
+	var rows []models.CatalogRow
+	var rowErrors []models.ImportRowError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: line, Error: err.Error()})
+			continue
+		}
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row, err := csvRow(get)
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: line, ISBN: get("isbn"), Error: err.Error()})
+			continue
+		}
+		row.Row = line
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+func csvRow(get func(string) string) (models.CatalogRow, error) {
+	book := models.CreateBookRequest{
+		ISBN:           get("isbn"),
+		Title:          get("title"),
+		Author:         get("author"),
+		Description:    get("description"),
+		ImageURL:       get("image_url"),
+		Category:       get("category"),
+		Language:       get("language"),
+		TranslatedFrom: get("translated_from"),
+		Formats:        []models.BookFormatInput{},
+	}
+	if tags := get("tags"); tags != "" {
+		book.Tags = strings.Split(tags, "|")
+	}
+
+	var err error
+	number := func(column string) int {
+		value := get(column)
+		if value == "" || err != nil {
+			return 0
+		}
+		n, parseErr := strconv.Atoi(value)
+		if parseErr != nil {
+			err = fmt.Errorf("%s: %q is not a whole number", column, value)
+		}
+		return n
+	}
+	price := func(column string) float64 {
+		value := get(column)
+		if value == "" || err != nil {
+			return 0
+		}
+		f, parseErr := strconv.ParseFloat(value, 64)
+		if parseErr != nil {
+			err = fmt.Errorf("%s: %q is not a number", column, value)
+		}
+		return f
+	}
+	// prices are written as decimals in CSV files
+	money := func(column string) models.Money {
+		return models.MoneyFromFloat(price(column))
+	}
+
+	book.PublishedYear = number("published_year")
+	book.SeriesPosition = price("series_position")
+	for _, formatType := range []string{"physical", "digital", "both"} {
+		if get(formatType+"_price") == "" {
+			continue
+		}
+		format := models.BookFormatInput{
+			Type:          formatType,
+			Price:         money(formatType + "_price"),
+			StockQuantity: number(formatType + "_stock"),
+		}
+		if formatType != "digital" {
+			format.WeightGrams = number("weight_grams")
+		}
+		book.Formats = append(book.Formats, format)
+	}
+	var rentalPrices []models.RentalPrice
+	for _, days := range rentalPeriods {
+		column := fmt.Sprintf("rental_%d_price", days)
+		if get(column) != "" {
+			rentalPrices = append(rentalPrices, models.RentalPrice{Days: days, Price: money(column)})
+		}
+	}
+	if len(rentalPrices) > 0 {
+		book.Formats = append(book.Formats, models.BookFormatInput{Type: "rental", RentalPrices: rentalPrices})
+	}
+	if err != nil {
+		return models.CatalogRow{}, err
+	}
+	return models.CatalogRow{Book: book, Series: get("series")}, nil
+}
+
+// catalogRecord is a book in a JSON Lines catalog. Its fields are named as
+// in a book create request; authors are given by name so files can move
+// between stores.
+type catalogRecord struct {
+	ISBN           string                   `json:"isbn"`
+	Title          string                   `json:"title"`
+	Author         string                   `json:"author,omitempty"`
+	Authors        []models.BookAuthorInput `json:"authors,omitempty"`
+	Description    string                   `json:"description,omitempty"`
+	ImageURL       string                   `json:"image_url,omitempty"`
+	PublishedYear  int                      `json:"published_year,omitempty"`
+	Category       string                   `json:"category,omitempty"`
+	Tags           []string                 `json:"tags,omitempty"`
+	Language       string                   `json:"language,omitempty"`
+	TranslatedFrom string                   `json:"translated_from,omitempty"`
+	Series         string                   `json:"series,omitempty"`
+	SeriesPosition float64                  `json:"series_position,omitempty"`
+	Formats        []catalogFormat          `json:"formats"`
+}
+
+type catalogFormat struct {
+	Type          string               `json:"type"`
+	Price         models.Money         `json:"price,omitempty"`
+	StockQuantity int                  `json:"stock_quantity"`
+	WeightGrams   int                  `json:"weight_grams,omitempty"`
+	RentalPrices  []models.RentalPrice `json:"rental_prices,omitempty"`
+}
+
+func readCatalogJSONL(r io.Reader) ([]models.CatalogRow, []models.ImportRowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var rows []models.CatalogRow
+	var rowErrors []models.ImportRowError
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record catalogRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: line, Error: err.Error()})
+			continue
+		}
+
+		book := models.CreateBookRequest{
+			ISBN:           record.ISBN,
+			Title:          record.Title,
+			Author:         record.Author,
+			Authors:        record.Authors,
+			Description:    record.Description,
+			ImageURL:       record.ImageURL,
+			PublishedYear:  record.PublishedYear,
+			Category:       record.Category,
+			Tags:           record.Tags,
+			Language:       record.Language,
+			TranslatedFrom: record.TranslatedFrom,
+			SeriesPosition: record.SeriesPosition,
+			Formats:        make([]models.BookFormatInput, len(record.Formats)),
+		}
+		for i, f := range record.Formats {
+			book.Formats[i] = models.BookFormatInput{
+				Type:          f.Type,
+				Price:         f.Price,
+				StockQuantity: f.StockQuantity,
+				WeightGrams:   f.WeightGrams,
+				RentalPrices:  f.RentalPrices,
+			}
+		}
+		rows = append(rows, models.CatalogRow{Row: line, Book: book, Series: record.Series})
+	}
+	if err := scanner.Err(); err != nil {
+		return rows, rowErrors, fmt.Errorf("reading line %d: %w", line+1, err)
+	}
+	return rows, rowErrors, nil
+}
+
+// catalogWriter writes books to an export file in one of the catalog
+// formats.
+type catalogWriter interface {
+	Write(book models.Book, series string) error
+	Close() error
+}
+
+func newCatalogWriter(format string, w io.Writer) (catalogWriter, error) {
+	switch format {
+	case models.CatalogFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(catalogCSVColumns); err != nil {
+			return nil, err
+		}
+		return &csvCatalogWriter{writer: writer}, nil
+	case models.CatalogFormatJSONL:
+		return &jsonlCatalogWriter{encoder: json.NewEncoder(w)}, nil
+	case models.CatalogFormatONIX:
+		return newONIXCatalogWriter(w)
+	}
+	return nil, ErrUnknownCatalogFormat
+}
+
+type csvCatalogWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvCatalogWriter) Write(book models.Book, series string) error {
+	values := map[string]string{
+		"isbn":            book.ISBN,
+		"title":           book.Title,
+		"author":          strings.Join(book.AuthorNames(), " & "),
+		"description":     book.Description,
+		"image_url":       book.ImageURL,
+		"category":        book.Category,
+		"tags":            strings.Join(book.Tags, "|"),
+		"language":        book.Language,
+		"translated_from": book.TranslatedFrom,
+		"series":          series,
+	}
+	if book.PublishedYear > 0 {
+		values["published_year"] = strconv.Itoa(book.PublishedYear)
+	}
+	if book.SeriesPosition > 0 {
+		values["series_position"] = strconv.FormatFloat(book.SeriesPosition, 'f', -1, 64)
+	}
+	for _, f := range book.Formats {
+		switch f.Type {
+		case "physical", "digital", "both":
+			values[f.Type+"_price"] = f.Price.String()
+			values[f.Type+"_stock"] = strconv.Itoa(f.StockQuantity)
+			if f.WeightGrams > 0 {
+				values["weight_grams"] = strconv.Itoa(f.WeightGrams)
+			}
+		case "rental":
+			for _, p := range f.RentalPrices {
+				values[fmt.Sprintf("rental_%d_price", p.Days)] = p.Price.String()
+			}
+		}
+	}
+
+	record := make([]string, len(catalogCSVColumns))
+	for i, column := range catalogCSVColumns {
+		record[i] = values[column]
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvCatalogWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type jsonlCatalogWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonlCatalogWriter) Write(book models.Book, series string) error {
+	record := catalogRecord{
+		ISBN:           book.ISBN,
+		Title:          book.Title,
+		Description:    book.Description,
+		ImageURL:       book.ImageURL,
+		PublishedYear:  book.PublishedYear,
+		Category:       book.Category,
+		Tags:           book.Tags,
+		Language:       book.Language,
+		TranslatedFrom: book.TranslatedFrom,
+		Series:         series,
+		SeriesPosition: book.SeriesPosition,
+		Formats:        make([]catalogFormat, len(book.Formats)),
+	}
+	if len(book.Authors) > 0 {
+		for _, a := range book.Authors {
+			record.Authors = append(record.Authors, models.BookAuthorInput{Name: a.Name, Role: a.Role})
+		}
+	} else {
+		record.Author = book.Author
+	}
+	for i, f := range book.Formats {
+		record.Formats[i] = catalogFormat{
+			Type:          f.Type,
+			Price:         f.Price,
+			StockQuantity: f.StockQuantity,
+			WeightGrams:   f.WeightGrams,
+			RentalPrices:  f.RentalPrices,
+		}
+	}
+	return j.encoder.Encode(record)
+}
+
+func (j *jsonlCatalogWriter) Close() error {
+	return nil
+}
+
+// ONIX 3.0 reference-tag records. Only the parts of a product record the
+// store keeps are mapped: identifiers, form, title, contributors, series,
+// languages, subjects, description, cover, publication date, stock and
+// price. Each product is one format of a book; products sharing an ISBN
+// are read as one book.
+type onixProduct struct {
+	RecordReference  string                `xml:"RecordReference"`
+	NotificationType string                `xml:"NotificationType"`
+	Identifiers      []onixIdentifier      `xml:"ProductIdentifier"`
+	Descriptive      onixDescriptiveDetail `xml:"DescriptiveDetail"`
+	Collateral       *onixCollateralDetail `xml:"CollateralDetail,omitempty"`
+	Publishing       *onixPublishingDetail `xml:"PublishingDetail,omitempty"`
+	Supply           []onixSupplyDetail    `xml:"ProductSupply>SupplyDetail"`
+}
+
+type onixIdentifier struct {
+	Type  string `xml:"ProductIDType"`
+	Value string `xml:"IDValue"`
+}
+
+type onixDescriptiveDetail struct {
+	ProductComposition string            `xml:"ProductComposition"`
+	ProductForm        string            `xml:"ProductForm"`
+	Collections        []onixCollection  `xml:"Collection"`
+	Titles             []onixTitleDetail `xml:"TitleDetail"`
+	Contributors       []onixContributor `xml:"Contributor"`
+	Languages          []onixLanguage    `xml:"Language"`
+	Subjects           []onixSubject     `xml:"Subject"`
+}
+
+type onixCollection struct {
+	CollectionType string          `xml:"CollectionType"`
+	Title          onixTitleDetail `xml:"TitleDetail"`
+}
+
+type onixTitleDetail struct {
+	TitleType string             `xml:"TitleType"`
+	Elements  []onixTitleElement `xml:"TitleElement"`
+}
+
+type onixTitleElement struct {
+	Level      string `xml:"TitleElementLevel"`
+	PartNumber string `xml:"PartNumber,omitempty"`
+	TitleText  string `xml:"TitleText"`
+	Subtitle   string `xml:"Subtitle,omitempty"`
+}
+
+type onixContributor struct {
+	SequenceNumber int    `xml:"SequenceNumber,omitempty"`
+	Role           string `xml:"ContributorRole"`
+	PersonName     string `xml:"PersonName,omitempty"`
+	NamesBeforeKey string `xml:"NamesBeforeKey,omitempty"`
+	KeyNames       string `xml:"KeyNames,omitempty"`
+	CorporateName  string `xml:"CorporateName,omitempty"`
+}
+
+type onixLanguage struct {
+	Role string `xml:"LanguageRole"`
+	Code string `xml:"LanguageCode"`
+}
+
+type onixSubject struct {
+	SchemeIdentifier string `xml:"SubjectSchemeIdentifier"`
+	SchemeName       string `xml:"SubjectSchemeName,omitempty"`
+	HeadingText      string `xml:"SubjectHeadingText"`
+}
+
+type onixCollateralDetail struct {
+	TextContents []onixTextContent        `xml:"TextContent"`
+	Resources    []onixSupportingResource `xml:"SupportingResource"`
+}
+
+type onixTextContent struct {
+	TextType        string `xml:"TextType"`
+	ContentAudience string `xml:"ContentAudience"`
+	Text            string `xml:"Text"`
+}
+
+type onixSupportingResource struct {
+	ContentType     string                `xml:"ResourceContentType"`
+	ContentAudience string                `xml:"ContentAudience"`
+	Mode            string                `xml:"ResourceMode"`
+	Versions        []onixResourceVersion `xml:"ResourceVersion"`
+}
+
+type onixResourceVersion struct {
+	Form string `xml:"ResourceForm"`
+	Link string `xml:"ResourceLink"`
+}
+
+type onixPublishingDetail struct {
+	Dates []onixPublishingDate `xml:"PublishingDate"`
+}
+
+type onixPublishingDate struct {
+	Role string `xml:"PublishingDateRole"`
+	Date string `xml:"Date"`
+}
+
+type onixSupplyDetail struct {
+	Supplier     onixSupplier `xml:"Supplier"`
+	Availability string       `xml:"ProductAvailability"`
+	Stock        []onixStock  `xml:"Stock"`
+	Prices       []onixPrice  `xml:"Price"`
+}
+
+type onixSupplier struct {
+	Role string `xml:"SupplierRole"`
+	Name string `xml:"SupplierName"`
+}
+
+type onixStock struct {
+	OnHand int `xml:"OnHand"`
+}
+
+type onixPrice struct {
+	Type     string `xml:"PriceType"`
+	Amount   string `xml:"PriceAmount"`
+	Currency string `xml:"CurrencyCode,omitempty"`
+}
+
+// ONIX code list values used when reading and writing products.
+const (
+	onixISBN13            = "15"
+	onixISBN10            = "02"
+	onixGTIN13            = "03"
+	onixDistinctiveTitle  = "01"
+	onixProductLevel      = "01"
+	onixCollectionLevel   = "02"
+	onixPublisherSeries   = "10"
+	onixLanguageOfText    = "01"
+	onixOriginalLanguage  = "02"
+	onixKeywords          = "20"
+	onixProprietaryScheme = "24"
+	onixDescription       = "03"
+	onixFrontCover        = "01"
+	onixPublicationDate   = "01"
+	onixCategoryScheme    = "Bookstore category"
+)
+
+var onixContributorRoles = map[string]string{
+	"A01": models.AuthorRoleAuthor,
+	"B06": models.AuthorRoleTranslator,
+	"A12": models.AuthorRoleIllustrator,
+}
+
+func onixRoleCode(role string) string {
+	for code, r := range onixContributorRoles {
+		if r == role {
+			return code
+		}
+	}
+	return "A01"
+}
+
+func readCatalogONIX(r io.Reader) ([]models.CatalogRow, []models.ImportRowError, error) {
+	decoder := xml.NewDecoder(r)
+	var rows []models.CatalogRow
+	var rowErrors []models.ImportRowError
+	byISBN := map[string]int{}
+	product := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, rowErrors, fmt.Errorf("after product %d: %w", product, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Product" {
+			continue
+		}
+
+		product++
+		var p onixProduct
+		if err := decoder.DecodeElement(&p, &start); err != nil {
+			return rows, rowErrors, fmt.Errorf("product %d: %w", product, err)
+		}
+		if p.NotificationType == "05" {
+			// deletions are not applied by import
+			continue
+		}
+		row, err := onixRow(p)
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: product, ISBN: row.Book.ISBN, Error: err.Error()})
+			continue
+		}
+		row.Row = product
+
+		key := models.NormalizeISBN(row.Book.ISBN)
+		if i, ok := byISBN[key]; ok && key != "" {
+			rows[i].Book.Formats = append(rows[i].Book.Formats, row.Book.Formats...)
+			continue
+		}
+		byISBN[key] = len(rows)
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+func onixRow(p onixProduct) (models.CatalogRow, error) {
+	var row models.CatalogRow
+	book := &row.Book
+	for _, wanted := range []string{onixISBN13, onixISBN10, onixGTIN13} {
+		for _, id := range p.Identifiers {
+			if id.Type == wanted && book.ISBN == "" {
+				book.ISBN = strings.TrimSpace(id.Value)
+			}
+		}
+	}
+
+	d := p.Descriptive
+	for _, title := range d.Titles {
+		if title.TitleType != onixDistinctiveTitle {
+			continue
+		}
+		for _, e := range title.Elements {
+			if e.Level == onixProductLevel {
+				book.Title = strings.TrimSpace(e.TitleText)
+				if e.Subtitle != "" {
+					book.Title += ": " + strings.TrimSpace(e.Subtitle)
+				}
+			}
+		}
+	}
+	for _, c := range d.Contributors {
+		role, ok := onixContributorRoles[c.Role]
+		if !ok {
+			continue
+		}
+		name := c.PersonName
+		if name == "" {
+			name = strings.TrimSpace(c.NamesBeforeKey + " " + c.KeyNames)
+		}
+		if name == "" {
+			name = c.CorporateName
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			book.Authors = append(book.Authors, models.BookAuthorInput{Name: name, Role: role})
+		}
+	}
+	for _, c := range d.Collections {
+		for _, e := range c.Title.Elements {
+			if e.Level == onixCollectionLevel && row.Series == "" {
+				row.Series = strings.TrimSpace(e.TitleText)
+				book.SeriesPosition, _ = strconv.ParseFloat(strings.TrimSpace(e.PartNumber), 64)
+			}
+		}
+	}
+	for _, l := range d.Languages {
+		switch l.Role {
+		case onixLanguageOfText:
+			book.Language = strings.TrimSpace(l.Code)
+		case onixOriginalLanguage:
+			book.TranslatedFrom = strings.TrimSpace(l.Code)
+		}
+	}
+	for _, s := range d.Subjects {
+		switch {
+		case s.SchemeIdentifier == onixKeywords:
+			book.Tags = append(book.Tags, strings.Split(s.HeadingText, ";")...)
+		case s.SchemeIdentifier == onixProprietaryScheme && s.SchemeName == onixCategoryScheme && book.Category == "":
+			book.Category = strings.TrimSpace(s.HeadingText)
+		}
+	}
+
+	if p.Collateral != nil {
+		for _, t := range p.Collateral.TextContents {
+			if t.TextType == onixDescription && book.Description == "" {
+				book.Description = strings.TrimSpace(t.Text)
+			}
+		}
+		for _, r := range p.Collateral.Resources {
+			if r.ContentType == onixFrontCover && len(r.Versions) > 0 && book.ImageURL == "" {
+				book.ImageURL = strings.TrimSpace(r.Versions[0].Link)
+			}
+		}
+	}
+	if p.Publishing != nil {
+		for _, date := range p.Publishing.Dates {
+			if date.Role == onixPublicationDate && len(date.Date) >= 4 {
+				book.PublishedYear, _ = strconv.Atoi(date.Date[:4])
+			}
+		}
+	}
+
+	format := models.BookFormatInput{Type: "physical"}
+	if form := strings.ToUpper(d.ProductForm); strings.HasPrefix(form, "E") || strings.HasPrefix(form, "A") {
+		// e-books and audio are sold as the digital format
+		format.Type = "digital"
+	}
+	if len(p.Supply) == 0 || len(p.Supply[0].Prices) == 0 {
+		return row, errors.New("product has no price")
+	}
+	supply := p.Supply[0]
+	price, err := strconv.ParseFloat(strings.TrimSpace(supply.Prices[0].Amount), 64)
+	if err != nil {
+		return row, fmt.Errorf("price %q is not a number", supply.Prices[0].Amount)
+	}
+	format.Price = models.MoneyFromFloat(price)
+	for _, s := range supply.Stock {
+		format.StockQuantity += s.OnHand
+	}
+	book.Formats = []models.BookFormatInput{format}
+	return row, nil
+}
+
+type onixCatalogWriter struct {
+	encoder *xml.Encoder
+}
+
+func newONIXCatalogWriter(w io.Writer) (*onixCatalogWriter, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err := encoder.EncodeToken(xml.StartElement{
+		Name: xml.Name{Local: "ONIXMessage"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns"}, Value: "http://ns.editeur.org/onix/3.0/reference"},
+			{Name: xml.Name{Local: "release"}, Value: "3.0"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	header := struct {
+		XMLName      xml.Name `xml:"Header"`
+		SenderName   string   `xml:"Sender>SenderName"`
+		SentDateTime string   `xml:"SentDateTime"`
+	}{SenderName: "Bookstore", SentDateTime: time.Now().UTC().Format("20060102T150405Z")}
+	if err := encoder.Encode(header); err != nil {
+		return nil, err
+	}
+	return &onixCatalogWriter{encoder: encoder}, nil
+}
+
+// Write writes one product per physical or digital format of the book.
+// Rentals and bundles have no ONIX equivalent and are left out.
+func (o *onixCatalogWriter) Write(book models.Book, series string) error {
+	for _, f := range book.Formats {
+		form := ""
+		switch f.Type {
+		case "physical":
+			form = "BC"
+		case "digital":
+			form = "ED"
+		default:
+			continue
+		}
+
+		p := onixProduct{
+			RecordReference:  book.ID.Hex() + "-" + f.Type,
+			NotificationType: "03",
+			Identifiers:      []onixIdentifier{{Type: onixISBN13, Value: models.NormalizeISBN(book.ISBN)}},
+			Descriptive: onixDescriptiveDetail{
+				ProductComposition: "00",
+				ProductForm:        form,
+				Titles: []onixTitleDetail{{
+					TitleType: onixDistinctiveTitle,
+					Elements:  []onixTitleElement{{Level: onixProductLevel, TitleText: book.Title}},
+				}},
+			},
+			Supply: []onixSupplyDetail{{
+				Supplier:     onixSupplier{Role: "01", Name: "Bookstore"},
+				Availability: "20",
+				Stock:        []onixStock{{OnHand: f.StockQuantity}},
+				Prices:       []onixPrice{{Type: "01", Amount: f.Price.String()}},
+			}},
+		}
+		if f.StockQuantity <= 0 && f.Type == "physical" {
+			p.Supply[0].Availability = "31"
+		}
+
+		d := &p.Descriptive
+		if series != "" {
+			part := ""
+			if book.SeriesPosition > 0 {
+				part = strconv.FormatFloat(book.SeriesPosition, 'f', -1, 64)
+			}
+			d.Collections = []onixCollection{{
+				CollectionType: onixPublisherSeries,
+				Title: onixTitleDetail{
+					TitleType: onixDistinctiveTitle,
+					Elements:  []onixTitleElement{{Level: onixCollectionLevel, PartNumber: part, TitleText: series}},
+				},
+			}}
+		}
+		if len(book.Authors) > 0 {
+			for i, a := range book.Authors {
+				d.Contributors = append(d.Contributors, onixContributor{SequenceNumber: i + 1, Role: onixRoleCode(a.Role), PersonName: a.Name})
+			}
+		} else {
+			for i, name := range book.AuthorNames() {
+				d.Contributors = append(d.Contributors, onixContributor{SequenceNumber: i + 1, Role: "A01", PersonName: name})
+			}
+		}
+		if book.Language != "" {
+			d.Languages = append(d.Languages, onixLanguage{Role: onixLanguageOfText, Code: book.Language})
+		}
+		if book.TranslatedFrom != "" {
+			d.Languages = append(d.Languages, onixLanguage{Role: onixOriginalLanguage, Code: book.TranslatedFrom})
+		}
+		if book.Category != "" {
+			d.Subjects = append(d.Subjects, onixSubject{SchemeIdentifier: onixProprietaryScheme, SchemeName: onixCategoryScheme, HeadingText: book.Category})
+		}
+		if len(book.Tags) > 0 {
+			d.Subjects = append(d.Subjects, onixSubject{SchemeIdentifier: onixKeywords, HeadingText: strings.Join(book.Tags, ";")})
+		}
+
+		if book.Description != "" || book.ImageURL != "" {
+			p.Collateral = &onixCollateralDetail{}
+		}
+		if book.Description != "" {
+			p.Collateral.TextContents = []onixTextContent{{TextType: onixDescription, ContentAudience: "00", Text: book.Description}}
+		}
+		if book.ImageURL != "" {
+			p.Collateral.Resources = []onixSupportingResource{{
+				ContentType:     onixFrontCover,
+				ContentAudience: "00",
+				Mode:            "03",
+				Versions:        []onixResourceVersion{{Form: "02", Link: book.ImageURL}},
+			}}
+		}
+		if book.PublishedYear > 0 {
+			p.Publishing = &onixPublishingDetail{
+				Dates: []onixPublishingDate{{Role: onixPublicationDate, Date: strconv.Itoa(book.PublishedYear)}},
+			}
+		}
+
+		if err := o.encoder.EncodeElement(p, xml.StartElement{Name: xml.Name{Local: "Product"}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *onixCatalogWriter) Close() error {
+	if err := o.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: "ONIXMessage"}}); err != nil {
+		return err
+	}
+	return o.encoder.Flush()
+}
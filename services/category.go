@@ -0,0 +1,392 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("a category with this name already exists here")
+	ErrCategoryInUse    = errors.New("category still has books; give a category to move them to")
+	ErrInvalidCategory  = errors.New("invalid category")
+)
+
+// CategoryService manages the category tree. Books copy the name and path
+// of their category, and are kept in step when categories are renamed,
+// moved or deleted.
+type CategoryService struct {
+	categoriesCollection *mongo.Collection
+	booksCollection      *mongo.Collection
+}
+
+func NewCategoryService(categoriesCollection, booksCollection *mongo.Collection) *CategoryService {
+	return &CategoryService{
+		categoriesCollection: categoriesCollection,
+		booksCollection:      booksCollection,
+	}
+}
+
+// Tree returns the root categories with their subcategories nested, each
+// with the number of books in its subtree.
+func (s *CategoryService) Tree(ctx context.Context) ([]*models.CategoryNode, error) {
+	cursor, err := s.categoriesCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var categories []models.Category
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	countCursor, err := s.booksCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"deleted_at": nil}}},
+		bson.D{{Key: "$unwind", Value: "$category_path"}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$category_path"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	}
+	if err := countCursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	bookCounts := map[primitive.ObjectID]int64{}
+	for _, c := range counts {
+		bookCounts[c.ID] = c.Count
+	}
+
+	nodes := map[primitive.ObjectID]*models.CategoryNode{}
+	for _, category := range categories {
+		nodes[category.ID] = &models.CategoryNode{
+			Category:  category,
+			BookCount: bookCounts[category.ID],
+			Children:  []*models.CategoryNode{},
+		}
+	}
+	roots := []*models.CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots, nil
+}
+
+func (s *CategoryService) Get(ctx context.Context, id primitive.ObjectID) (*models.Category, error) {
+	var category models.Category
+	err := s.categoriesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&category)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Lookup finds a category by ID or by name. A name used in more than one
+// place in the tree has to be given by ID.
+func (s *CategoryService) Lookup(ctx context.Context, ref string) (*models.Category, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := primitive.ObjectIDFromHex(ref); err == nil {
+		return s.Get(ctx, id)
+	}
+
+	cursor, err := s.categoriesCollection.Find(ctx, bson.M{"key": models.NameKey(ref)}, options.Find().SetLimit(2))
+	if err != nil {
+		return nil, err
+	}
+	var categories []models.Category
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	switch len(categories) {
+	case 0:
+		return nil, ErrCategoryNotFound
+	case 1:
+		return &categories[0], nil
+	default:
+		return nil, fmt.Errorf("%w: more than one category is called %q, use its ID", ErrInvalidCategory, ref)
+	}
+}
+
+func (s *CategoryService) Create(ctx context.Context, req models.CategoryRequest) (*models.Category, error) {
+	parent, err := s.parent(ctx, req.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	category := models.Category{
+		ID:        primitive.NewObjectID(),
+		Name:      strings.Join(strings.Fields(req.Name), " "),
+		Key:       models.NameKey(req.Name),
+		Ancestors: []primitive.ObjectID{},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if category.Key == "" {
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalidCategory)
+	}
+	if parent != nil {
+		category.ParentID = &parent.ID
+		category.Ancestors = parent.Path()
+	}
+
+	_, err = s.categoriesCollection.InsertOne(ctx, category)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrCategoryExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// Update renames a category and moves it under another parent. Its
+// subcategories move with it, and the books in the subtree are updated.
+func (s *CategoryService) Update(ctx context.Context, id primitive.ObjectID, req models.CategoryRequest) (*models.Category, error) {
+	current, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := s.parent(ctx, req.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := models.NameKey(req.Name)
+	if key == "" {
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalidCategory)
+	}
+	set := bson.M{
+		"name":       strings.Join(strings.Fields(req.Name), " "),
+		"key":        key,
+		"parent_id":  nil,
+		"ancestors":  []primitive.ObjectID{},
+		"updated_at": time.Now(),
+	}
+	if parent != nil {
+		for _, ancestor := range parent.Path() {
+			if ancestor == id {
+				return nil, fmt.Errorf("%w: a category cannot be moved under itself", ErrInvalidCategory)
+			}
+		}
+		set["parent_id"] = parent.ID
+		set["ancestors"] = parent.Path()
+	}
+
+	var category models.Category
+	err = s.categoriesCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&category)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrCategoryExists
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if category.Name != current.Name {
+		_, err := s.booksCollection.UpdateMany(ctx, bson.M{"category_id": id}, bson.M{"$set": bson.M{"category": category.Name}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !samePath(category.Ancestors, current.Ancestors) {
+		if err := s.reroot(ctx, &category); err != nil {
+			return nil, err
+		}
+	}
+	return &category, nil
+}
+
+// Delete removes a category. Its subcategories move up to its parent and
+// its books move to reassignTo, or to the parent when that is nil. A root
+// category with books needs a reassignTo.
+func (s *CategoryService) Delete(ctx context.Context, id primitive.ObjectID, reassignTo *primitive.ObjectID) error {
+	category, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	target := category.ParentID
+	if reassignTo != nil {
+		if *reassignTo == id {
+			return fmt.Errorf("%w: books cannot be moved to the category being deleted", ErrInvalidCategory)
+		}
+		if _, err := s.Get(ctx, *reassignTo); err != nil {
+			if errors.Is(err, ErrCategoryNotFound) {
+				return fmt.Errorf("%w: category to move books to not found", ErrInvalidCategory)
+			}
+			return err
+		}
+		target = reassignTo
+	}
+	if target == nil {
+		count, err := s.booksCollection.CountDocuments(ctx, bson.M{"category_id": id})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCategoryInUse
+		}
+	}
+
+	// check before moving anything that the subcategories fit under the parent
+	cursor, err := s.categoriesCollection.Find(ctx, bson.M{"parent_id": id})
+	if err != nil {
+		return err
+	}
+	var children []models.Category
+	if err := cursor.All(ctx, &children); err != nil {
+		return err
+	}
+	for _, child := range children {
+		count, err := s.categoriesCollection.CountDocuments(ctx, bson.M{"parent_id": category.ParentID, "key": child.Key})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %q", ErrCategoryExists, child.Name)
+		}
+	}
+
+	if _, err := s.categoriesCollection.UpdateMany(ctx, bson.M{"parent_id": id}, bson.M{"$set": bson.M{"parent_id": category.ParentID}}); err != nil {
+		return err
+	}
+	if _, err := s.categoriesCollection.UpdateMany(ctx, bson.M{"ancestors": id}, bson.M{"$pull": bson.M{"ancestors": id}}); err != nil {
+		return err
+	}
+	if _, err := s.booksCollection.UpdateMany(ctx, bson.M{"category_path": id}, bson.M{"$pull": bson.M{"category_path": id}}); err != nil {
+		return err
+	}
+
+	if target != nil {
+		// read after the move, in case the target was a subcategory
+		moveTo, err := s.Get(ctx, *target)
+		if err != nil {
+			return err
+		}
+		_, err = s.booksCollection.UpdateMany(ctx, bson.M{"category_id": id}, bson.M{"$set": bson.M{
+			"category":      moveTo.Name,
+			"category_id":   moveTo.ID,
+			"category_path": moveTo.Path(),
+			"updated_at":    time.Now(),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.categoriesCollection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// TagCounts lists the tags in use, most used first.
+func (s *CategoryService) TagCounts(ctx context.Context, limit int64) ([]models.TagCount, error) {
+	cursor, err := s.booksCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"deleted_at": nil}}},
+		bson.D{{Key: "$unwind", Value: "$tags"}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$tags"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: limit}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var tags []models.TagCount
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (s *CategoryService) parent(ctx context.Context, parentID string) (*models.Category, error) {
+	if parentID == "" {
+		return nil, nil
+	}
+	id, err := primitive.ObjectIDFromHex(parentID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid parent ID", ErrInvalidCategory)
+	}
+	parent, err := s.Get(ctx, id)
+	if errors.Is(err, ErrCategoryNotFound) {
+		return nil, fmt.Errorf("%w: parent category not found", ErrInvalidCategory)
+	}
+	return parent, err
+}
+
+// reroot rewrites the ancestors of the subcategories of a moved category
+// and the category paths of the books in its subtree.
+func (s *CategoryService) reroot(ctx context.Context, category *models.Category) error {
+	cursor, err := s.categoriesCollection.Find(ctx, bson.M{"ancestors": category.ID})
+	if err != nil {
+		return err
+	}
+	var descendants []models.Category
+	if err := cursor.All(ctx, &descendants); err != nil {
+		return err
+	}
+
+	moved := []models.Category{*category}
+	for _, d := range descendants {
+		for i, ancestor := range d.Ancestors {
+			if ancestor == category.ID {
+				d.Ancestors = append(category.Path(), d.Ancestors[i+1:]...)
+				break
+			}
+		}
+		if _, err := s.categoriesCollection.UpdateOne(ctx, bson.M{"_id": d.ID}, bson.M{"$set": bson.M{"ancestors": d.Ancestors}}); err != nil {
+			return err
+		}
+		moved = append(moved, d)
+	}
+
+	for _, c := range moved {
+		if _, err := s.booksCollection.UpdateMany(ctx, bson.M{"category_id": c.ID}, bson.M{"$set": bson.M{"category_path": c.Path()}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func samePath(a, b []primitive.ObjectID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,509 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrGiftCardNotFound   = errors.New("gift card not found")
+	ErrGiftCardEmpty      = errors.New("gift card has no balance left")
+	ErrInsufficientCredit = errors.New("not enough balance left to pay for this order")
+	ErrGiftCardPayment    = errors.New("gift card payment failed")
+)
+
+// gift card codes leave out characters that are easy to misread
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// CreditService keeps gift card and store credit balances. Gift card
+// balances live on the card, wallet balances in the user's store_credit
+// field; every change to either is recorded in credit_transactions.
+type CreditService struct {
+	giftCardsCollection    *mongo.Collection
+	transactionsCollection *mongo.Collection
+	usersCollection        *mongo.Collection
+	biller                 Biller
+}
+
+func NewCreditService(giftCardsCollection, transactionsCollection, usersCollection *mongo.Collection, biller Biller) *CreditService {
+	return &CreditService{
+		giftCardsCollection:    giftCardsCollection,
+		transactionsCollection: transactionsCollection,
+		usersCollection:        usersCollection,
+		biller:                 biller,
+	}
+}
+
+// PurchaseGiftCard creates the card and then charges the buyer, so a card
+// that cannot be stored is never paid for. The card is removed again when
+// the charge is declined; its code has not been shown to anyone yet.
+func (s *CreditService) PurchaseGiftCard(ctx context.Context, userID primitive.ObjectID, req models.PurchaseGiftCardRequest) (*models.GiftCard, error) {
+	card, err := s.insertCard(ctx, models.GiftCard{
+		InitialAmount:  req.Amount,
+		PurchasedBy:    &userID,
+		RecipientEmail: strings.ToLower(strings.TrimSpace(req.RecipientEmail)),
+		Message:        strings.TrimSpace(req.Message),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.biller.Charge(ctx, userID, req.Amount, "Gift card "+req.Amount.String()); err != nil {
+		if _, derr := s.giftCardsCollection.DeleteOne(ctx, bson.M{"_id": card.ID}); derr != nil {
+			log.Printf("Failed to remove gift card %s after a declined charge: %v", card.ID.Hex(), derr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrGiftCardPayment, err)
+	}
+	s.recordIssued(ctx, card, "Purchased", &userID)
+	return card, nil
+}
+
+// IssueGiftCard creates a free card, for example as a goodwill gesture.
+func (s *CreditService) IssueGiftCard(ctx context.Context, amount models.Money, note string, adminID primitive.ObjectID) (*models.GiftCard, error) {
+	card := models.GiftCard{
+		InitialAmount: amount,
+		IssuedBy:      &adminID,
+		Message:       note,
+	}
+	return s.create(ctx, card, note, &adminID)
+}
+
+func (s *CreditService) GiftCardByCode(ctx context.Context, code string) (*models.GiftCard, error) {
+	var card models.GiftCard
+	err := s.giftCardsCollection.FindOne(ctx, bson.M{"code": NormalizeGiftCardCode(code)}).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (s *CreditService) GiftCard(ctx context.Context, cardID primitive.ObjectID) (*models.GiftCard, error) {
+	var card models.GiftCard
+	err := s.giftCardsCollection.FindOne(ctx, bson.M{"_id": cardID}).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+func (s *CreditService) GiftCards(ctx context.Context, filter bson.M, limit int64) ([]models.GiftCard, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := s.giftCardsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var cards []models.GiftCard
+	if err := cursor.All(ctx, &cards); err != nil {
+		return nil, err
+	}
+	if cards == nil {
+		cards = []models.GiftCard{}
+	}
+	return cards, nil
+}
+
+func (s *CreditService) SetGiftCardStatus(ctx context.Context, cardID primitive.ObjectID, status string) error {
+	result, err := s.giftCardsCollection.UpdateOne(ctx, bson.M{"_id": cardID}, bson.M{
+		"$set": bson.M{"status": status, "updated_at": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrGiftCardNotFound
+	}
+	return nil
+}
+
+// RedeemToWallet moves the whole remaining balance of a card into the
+// user's store credit and returns the amount moved.
+func (s *CreditService) RedeemToWallet(ctx context.Context, userID primitive.ObjectID, code string) (models.Money, error) {
+	var card models.GiftCard
+	err := s.giftCardsCollection.FindOneAndUpdate(ctx,
+		bson.M{"code": NormalizeGiftCardCode(code), "status": models.GiftCardActive, "balance": bson.M{"$gt": 0}},
+		bson.M{"$set": bson.M{"balance": models.Money(0), "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		if _, err := s.GiftCardByCode(ctx, code); err != nil {
+			return 0, err
+		}
+		return 0, ErrGiftCardEmpty
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	s.record(ctx, models.CreditTransaction{
+		Account:    models.CreditAccountGiftCard,
+		GiftCardID: &card.ID,
+		UserID:     &userID,
+		Type:       models.CreditRedeemed,
+		Amount:     -card.Balance,
+		Balance:    0,
+		Note:       "Redeemed to store credit",
+	})
+	if err := s.CreditWallet(ctx, userID, card.Balance, models.CreditRedeemed, nil, "Gift card "+MaskGiftCardCode(card.Code), nil); err != nil {
+		// put the balance back on the card rather than lose it
+		_, _ = s.creditCard(ctx, card.ID, card.Balance)
+		return 0, err
+	}
+	return card.Balance, nil
+}
+
+func (s *CreditService) WalletBalance(ctx context.Context, userID primitive.ObjectID) (models.Money, error) {
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"store_credit": 1})
+	if err := s.usersCollection.FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&user); err != nil {
+		return 0, err
+	}
+	return user.StoreCredit, nil
+}
+
+// CreditWallet adds amount to the user's store credit.
+func (s *CreditService) CreditWallet(ctx context.Context, userID primitive.ObjectID, amount models.Money, txType string, orderID *primitive.ObjectID, note string, by *primitive.ObjectID) error {
+	balance, err := s.creditWallet(ctx, userID, amount)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, models.CreditTransaction{
+		Account:   models.CreditAccountWallet,
+		UserID:    &userID,
+		Type:      txType,
+		Amount:    amount,
+		Balance:   balance,
+		OrderID:   orderID,
+		Note:      note,
+		CreatedBy: by,
+	})
+	return nil
+}
+
+// AdjustWallet is a manual correction by an admin. A deduction fails with
+// ErrInsufficientCredit rather than leave a negative balance.
+func (s *CreditService) AdjustWallet(ctx context.Context, userID primitive.ObjectID, amount models.Money, reason string, adminID primitive.ObjectID) error {
+	if amount > 0 {
+		return s.CreditWallet(ctx, userID, amount, models.CreditAdjusted, nil, reason, &adminID)
+	}
+	balance, err := s.debitWallet(ctx, userID, -amount)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, models.CreditTransaction{
+		Account:   models.CreditAccountWallet,
+		UserID:    &userID,
+		Type:      models.CreditAdjusted,
+		Amount:    amount,
+		Balance:   balance,
+		Note:      reason,
+		CreatedBy: &adminID,
+	})
+	return nil
+}
+
+// PlanPayments works out how much of total the given gift cards and, when
+// useStoreCredit is set, the user's wallet can pay, in that order. Nothing
+// is charged; see Capture.
+func (s *CreditService) PlanPayments(ctx context.Context, userID primitive.ObjectID, codes []string, useStoreCredit bool, total models.Money) ([]models.PaymentLine, error) {
+	var payments []models.PaymentLine
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = NormalizeGiftCardCode(code)
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		card, err := s.GiftCardByCode(ctx, code)
+		if errors.Is(err, ErrGiftCardNotFound) {
+			return nil, fmt.Errorf("%w: gift card %s not found", ErrInvalidBasket, MaskGiftCardCode(code))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if card.Status != models.GiftCardActive || card.Balance <= 0 {
+			return nil, fmt.Errorf("%w: gift card %s cannot be used", ErrInvalidBasket, MaskGiftCardCode(code))
+		}
+		if total <= 0 {
+			continue
+		}
+		amount := min(card.Balance, total)
+		id := card.ID
+		payments = append(payments, models.PaymentLine{
+			Method:     models.PaymentGiftCard,
+			Label:      "Gift card " + MaskGiftCardCode(card.Code),
+			GiftCardID: &id,
+			Amount:     amount,
+		})
+		total -= amount
+	}
+
+	if useStoreCredit && total > 0 {
+		balance, err := s.WalletBalance(ctx, userID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if amount := min(balance, total); amount > 0 {
+			payments = append(payments, models.PaymentLine{
+				Method: models.PaymentStoreCredit,
+				Label:  "Store credit",
+				Amount: amount,
+			})
+		}
+	}
+	return payments, nil
+}
+
+// Capture takes the planned payments for an order. If any balance has run
+// short in the meantime, the payments already taken are given back and
+// ErrInsufficientCredit is returned.
+func (s *CreditService) Capture(ctx context.Context, userID, orderID primitive.ObjectID, payments []models.PaymentLine) error {
+	for i, p := range payments {
+		var balance models.Money
+		var err error
+		if p.Method == models.PaymentGiftCard {
+			balance, err = s.debitCard(ctx, *p.GiftCardID, p.Amount)
+		} else {
+			balance, err = s.debitWallet(ctx, userID, p.Amount)
+		}
+		if err != nil {
+			s.Reverse(ctx, userID, orderID, payments[:i], "Order could not be placed")
+			return err
+		}
+		s.record(ctx, paymentTransaction(p, userID, orderID, models.CreditPayment, -p.Amount, balance, "Order "+orderID.Hex()))
+	}
+	return nil
+}
+
+// Reverse gives captured payments back to the cards and wallet they came
+// from.
+func (s *CreditService) Reverse(ctx context.Context, userID, orderID primitive.ObjectID, payments []models.PaymentLine, note string) {
+	for _, p := range payments {
+		var balance models.Money
+		var err error
+		if p.Method == models.PaymentGiftCard {
+			balance, err = s.creditCard(ctx, *p.GiftCardID, p.Amount)
+		} else {
+			balance, err = s.creditWallet(ctx, userID, p.Amount)
+		}
+		if err != nil {
+			log.Printf("Failed to give back %s of order %s: %v", p.Label, orderID.Hex(), err)
+			continue
+		}
+		s.record(ctx, paymentTransaction(p, userID, orderID, models.CreditPaymentReversed, p.Amount, balance, note))
+	}
+}
+
+// LessRefunded takes an amount that has already been refunded off the
+// payments of an order, starting from the last one, so cancelling the
+// order does not give that money back a second time.
+func LessRefunded(payments []models.PaymentLine, refunded models.Money) []models.PaymentLine {
+	out := make([]models.PaymentLine, len(payments))
+	copy(out, payments)
+	for i := len(out) - 1; i >= 0 && refunded > 0; i-- {
+		take := min(out[i].Amount, refunded)
+		out[i].Amount -= take
+		refunded -= take
+	}
+	kept := out[:0]
+	for _, p := range out {
+		if p.Amount > 0 {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func (s *CreditService) Transactions(ctx context.Context, filter bson.M, limit int64) ([]models.CreditTransaction, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+	cursor, err := s.transactionsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var transactions []models.CreditTransaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	if transactions == nil {
+		transactions = []models.CreditTransaction{}
+	}
+	return transactions, nil
+}
+
+func (s *CreditService) create(ctx context.Context, card models.GiftCard, note string, by *primitive.ObjectID) (*models.GiftCard, error) {
+	created, err := s.insertCard(ctx, card)
+	if err != nil {
+		return nil, err
+	}
+	s.recordIssued(ctx, created, note, by)
+	return created, nil
+}
+
+// insertCard stores a new active card under a fresh code.
+func (s *CreditService) insertCard(ctx context.Context, card models.GiftCard) (*models.GiftCard, error) {
+	card.Balance = card.InitialAmount
+	card.Status = models.GiftCardActive
+	card.CreatedAt = time.Now()
+	card.UpdatedAt = time.Now()
+
+	// codes are random; retry on the unlikely collision with the unique index
+	for attempt := 0; ; attempt++ {
+		code, err := generateGiftCardCode()
+		if err != nil {
+			return nil, err
+		}
+		card.Code = code
+		result, err := s.giftCardsCollection.InsertOne(ctx, card)
+		if err == nil {
+			card.ID = result.InsertedID.(primitive.ObjectID)
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt == 4 {
+			return nil, err
+		}
+	}
+	return &card, nil
+}
+
+func (s *CreditService) recordIssued(ctx context.Context, card *models.GiftCard, note string, by *primitive.ObjectID) {
+	s.record(ctx, models.CreditTransaction{
+		Account:    models.CreditAccountGiftCard,
+		GiftCardID: &card.ID,
+		Type:       models.CreditIssued,
+		Amount:     card.InitialAmount,
+		Balance:    card.InitialAmount,
+		Note:       note,
+		CreatedBy:  by,
+	})
+}
+
+func (s *CreditService) debitCard(ctx context.Context, cardID primitive.ObjectID, amount models.Money) (models.Money, error) {
+	var card models.GiftCard
+	err := s.giftCardsCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": cardID, "status": models.GiftCardActive, "balance": bson.M{"$gte": amount}},
+		bson.M{"$inc": bson.M{"balance": -amount}, "$set": bson.M{"updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return 0, ErrInsufficientCredit
+	}
+	return card.Balance, err
+}
+
+func (s *CreditService) creditCard(ctx context.Context, cardID primitive.ObjectID, amount models.Money) (models.Money, error) {
+	var card models.GiftCard
+	err := s.giftCardsCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": cardID},
+		bson.M{"$inc": bson.M{"balance": amount}, "$set": bson.M{"updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&card)
+	return card.Balance, err
+}
+
+func (s *CreditService) debitWallet(ctx context.Context, userID primitive.ObjectID, amount models.Money) (models.Money, error) {
+	var user models.User
+	err := s.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID, "store_credit": bson.M{"$gte": amount}},
+		bson.M{"$inc": bson.M{"store_credit": -amount}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return 0, ErrInsufficientCredit
+	}
+	return user.StoreCredit, err
+}
+
+func (s *CreditService) creditWallet(ctx context.Context, userID primitive.ObjectID, amount models.Money) (models.Money, error) {
+	var user models.User
+	err := s.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"store_credit": amount}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	return user.StoreCredit, err
+}
+
+// record inserts a transaction. The balance change has already happened by
+// then, so a failure is logged rather than returned.
+func (s *CreditService) record(ctx context.Context, tx models.CreditTransaction) {
+	tx.CreatedAt = time.Now()
+	if _, err := s.transactionsCollection.InsertOne(ctx, tx); err != nil {
+		log.Printf("Failed to record %s %s transaction: %v", tx.Account, tx.Type, err)
+	}
+}
+
+func paymentTransaction(p models.PaymentLine, userID, orderID primitive.ObjectID, txType string, amount, balance models.Money, note string) models.CreditTransaction {
+	tx := models.CreditTransaction{
+		Account: models.CreditAccountWallet,
+		UserID:  &userID,
+		Type:    txType,
+		Amount:  amount,
+		Balance: balance,
+		OrderID: &orderID,
+		Note:    note,
+	}
+	if p.Method == models.PaymentGiftCard {
+		tx.Account = models.CreditAccountGiftCard
+		tx.GiftCardID = p.GiftCardID
+	}
+	return tx
+}
+
+func generateGiftCardCode() (string, error) {
+	var b strings.Builder
+	for i := 0; i < 16; i++ {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(giftCardAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(giftCardAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// NormalizeGiftCardCode accepts codes typed in any case, with or without
+// dashes and spaces, and returns the stored XXXX-XXXX-XXXX-XXXX form.
+func NormalizeGiftCardCode(code string) string {
+	var raw strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		if r != '-' && r != ' ' {
+			raw.WriteRune(r)
+		}
+	}
+	var b strings.Builder
+	for i, r := range []rune(raw.String()) {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// MaskGiftCardCode shows only the last four characters of a code.
+func MaskGiftCardCode(code string) string {
+	if len(code) <= 4 {
+		return code
+	}
+	return "****" + code[len(code)-4:]
+}
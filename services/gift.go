@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrGiftNotFound   = errors.New("gift not found")
+	ErrGiftClaimed    = errors.New("gift has already been claimed")
+	ErrGiftExpired    = errors.New("gift is no longer available")
+	ErrOwnGift        = errors.New("you cannot claim a gift you sent")
+	ErrGiftNotPending = errors.New("gift is not waiting to be claimed")
+
+	// errGiftOrderCancelled means the gift's order was cancelled, which
+	// already gave its money back.
+	errGiftOrderCancelled = errors.New("order of the gift was cancelled")
+)
+
+// GiftService delivers gifted digital books. A gift is paid for with the
+// sender's order, mailed to the recipient and added to the library of
+// whoever claims it. Unclaimed gifts expire and are refunded to the sender
+// as store credit.
+type GiftService struct {
+	giftsCollection      *mongo.Collection
+	ordersCollection     *mongo.Collection
+	orderItemsCollection *mongo.Collection
+	refundsCollection    *mongo.Collection
+	usersCollection      *mongo.Collection
+	creditService        *CreditService
+	libraryService       *LibraryService
+	mailer               Mailer
+	claimPeriod          time.Duration
+	appURL               string
+}
+
+func NewGiftService(
+	giftsCollection,
+	ordersCollection,
+	orderItemsCollection,
+	refundsCollection,
+	usersCollection *mongo.Collection,
+	creditService *CreditService,
+	libraryService *LibraryService,
+	mailer Mailer,
+	claimDays int,
+	appURL string,
+) *GiftService {
+	return &GiftService{
+		giftsCollection:      giftsCollection,
+		ordersCollection:     ordersCollection,
+		orderItemsCollection: orderItemsCollection,
+		refundsCollection:    refundsCollection,
+		usersCollection:      usersCollection,
+		creditService:        creditService,
+		libraryService:       libraryService,
+		mailer:               mailer,
+		claimPeriod:          time.Duration(claimDays) * 24 * time.Hour,
+		appURL:               strings.TrimRight(appURL, "/"),
+	}
+}
+
+// Send stores a gift and mails the claim token to the recipient. gift.ID
+// may be set beforehand so the order item can point at it.
+func (s *GiftService) Send(ctx context.Context, gift models.Gift) (*models.Gift, error) {
+	token, err := giftToken()
+	if err != nil {
+		return nil, err
+	}
+	if gift.ID.IsZero() {
+		gift.ID = primitive.NewObjectID()
+	}
+	gift.RecipientEmail = strings.ToLower(strings.TrimSpace(gift.RecipientEmail))
+	gift.Message = strings.TrimSpace(gift.Message)
+	gift.Token = token
+	gift.Status = models.GiftPending
+	gift.ExpiresAt = time.Now().Add(s.claimPeriod)
+	gift.CreatedAt = time.Now()
+	gift.UpdatedAt = time.Now()
+
+	if _, err := s.giftsCollection.InsertOne(ctx, gift); err != nil {
+		return nil, err
+	}
+	s.mailClaim(ctx, gift)
+	return &gift, nil
+}
+
+// Resend mails the claim token again while the gift is pending.
+func (s *GiftService) Resend(ctx context.Context, senderID, giftID primitive.ObjectID) error {
+	var gift models.Gift
+	err := s.giftsCollection.FindOne(ctx, bson.M{"_id": giftID, "sender_id": senderID}).Decode(&gift)
+	if err == mongo.ErrNoDocuments {
+		return ErrGiftNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if gift.Status != models.GiftPending || !gift.ExpiresAt.After(time.Now()) {
+		return ErrGiftNotPending
+	}
+	s.mailClaim(ctx, gift)
+	return nil
+}
+
+// Claim adds the gifted book to the user's library.
+func (s *GiftService) Claim(ctx context.Context, userID primitive.ObjectID, token string) (*models.Gift, error) {
+	var gift models.Gift
+	err := s.giftsCollection.FindOne(ctx, bson.M{"token": strings.TrimSpace(token)}).Decode(&gift)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrGiftNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case gift.SenderID == userID:
+		return nil, ErrOwnGift
+	case gift.Status == models.GiftClaimed:
+		return nil, ErrGiftClaimed
+	case gift.Status != models.GiftPending || !gift.ExpiresAt.After(time.Now()):
+		return nil, ErrGiftExpired
+	}
+
+	now := time.Now()
+	err = s.giftsCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": gift.ID, "status": models.GiftPending, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"status": models.GiftClaimed, "claimed_by": userID, "claimed_at": now, "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&gift)
+	if err == mongo.ErrNoDocuments {
+		// claimed or expired since it was read
+		return nil, ErrGiftClaimed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.libraryService.Grant(ctx, userID, gift.BookID, gift.FormatType, gift.OrderID); err != nil {
+		_, _ = s.giftsCollection.UpdateOne(ctx, bson.M{"_id": gift.ID}, bson.M{
+			"$set":   bson.M{"status": models.GiftPending, "updated_at": time.Now()},
+			"$unset": bson.M{"claimed_by": "", "claimed_at": ""},
+		})
+		return nil, err
+	}
+	return &gift, nil
+}
+
+func (s *GiftService) Sent(ctx context.Context, senderID primitive.ObjectID) ([]models.Gift, error) {
+	return s.list(ctx, bson.M{"sender_id": senderID})
+}
+
+// Received lists the gifts the user claimed and the ones still waiting for
+// their email address.
+func (s *GiftService) Received(ctx context.Context, userID primitive.ObjectID, email string) ([]models.Gift, error) {
+	return s.list(ctx, bson.M{"$or": []bson.M{
+		{"claimed_by": userID},
+		{"recipient_email": strings.ToLower(email), "status": models.GiftPending},
+	}})
+}
+
+// CancelOrder withdraws the gifts of a cancelled order. Gifts that were
+// already claimed are taken out of the recipient's library, and expired
+// gifts still waiting for their refund will not get it.
+func (s *GiftService) CancelOrder(ctx context.Context, orderID primitive.ObjectID) error {
+	gifts, err := s.list(ctx, bson.M{"order_id": orderID, "status": bson.M{"$in": []string{models.GiftPending, models.GiftClaimed, models.GiftRefundPending}}})
+	if err != nil {
+		return err
+	}
+	for _, gift := range gifts {
+		result, err := s.giftsCollection.UpdateOne(ctx, bson.M{"_id": gift.ID, "status": gift.Status}, bson.M{
+			"$set": bson.M{"status": models.GiftCancelled, "updated_at": time.Now()},
+		})
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 && gift.ClaimedBy != nil {
+			_ = s.libraryService.Revoke(ctx, *gift.ClaimedBy, gift.BookID, gift.FormatType, gift.OrderID)
+		}
+	}
+	return nil
+}
+
+// Expire ends the pending gifts whose claim period is over and refunds
+// each to its sender. Gifts are marked refund_pending before the refund, so
+// one that fails is tried again on the next run. It returns the number of
+// gifts expired.
+func (s *GiftService) Expire(ctx context.Context, now time.Time) (int, error) {
+	_, err := s.giftsCollection.UpdateMany(ctx,
+		bson.M{"status": models.GiftPending, "expires_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"status": models.GiftRefundPending, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	gifts, err := s.list(ctx, bson.M{"status": models.GiftRefundPending})
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, gift := range gifts {
+		amount, err := s.refund(ctx, gift)
+		if errors.Is(err, errGiftOrderCancelled) {
+			_, _ = s.giftsCollection.UpdateOne(ctx, bson.M{"_id": gift.ID, "status": models.GiftRefundPending}, bson.M{
+				"$set": bson.M{"status": models.GiftCancelled, "updated_at": time.Now()},
+			})
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to refund expired gift %s: %v", gift.ID.Hex(), err)
+			continue
+		}
+		if _, err := s.giftsCollection.UpdateOne(ctx, bson.M{"_id": gift.ID}, bson.M{
+			"$set": bson.M{"status": models.GiftExpired, "refund_amount": amount, "updated_at": time.Now()},
+		}); err != nil {
+			return expired, err
+		}
+		expired++
+		s.mailExpiry(ctx, gift, amount)
+	}
+	return expired, nil
+}
+
+// refund pays the gift's share of its order back to the sender's store
+// credit, recording it like any other refund. A refund that fails part way
+// is undone so it can be tried again. Cancelled orders are not refunded.
+func (s *GiftService) refund(ctx context.Context, gift models.Gift) (models.Money, error) {
+	var order models.Order
+	if err := s.ordersCollection.FindOne(ctx, bson.M{"_id": gift.OrderID}).Decode(&order); err != nil {
+		return 0, err
+	}
+	var item models.OrderItem
+	if err := s.orderItemsCollection.FindOne(ctx, bson.M{"_id": gift.OrderItemID}).Decode(&item); err != nil {
+		return 0, err
+	}
+	amount := RefundShare(order, item.Price*models.Money(item.Quantity))
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	grandTotal := order.TotalAmount
+	if order.Pricing != nil {
+		grandTotal = order.Pricing.GrandTotal
+	}
+	if order.Status == "Cancelled" {
+		return 0, errGiftOrderCancelled
+	}
+	result, err := s.ordersCollection.UpdateOne(ctx, bson.M{
+		"_id":    order.ID,
+		"status": bson.M{"$ne": "Cancelled"},
+		"$expr": bson.M{"$lte": bson.A{
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$refunded_amount", 0}}, int64(amount)}},
+			int64(grandTotal),
+		}},
+	}, bson.M{
+		"$inc": bson.M{"refunded_amount": amount},
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if result.MatchedCount == 0 {
+		// cancelled since it was read, or refunded in full already
+		return 0, fmt.Errorf("order %s has nothing left to refund", order.ID.Hex())
+	}
+	undo := func() {
+		_, _ = s.ordersCollection.UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{"$inc": bson.M{"refunded_amount": -amount}})
+	}
+
+	inserted, err := s.refundsCollection.InsertOne(ctx, models.Refund{
+		OrderID:   order.ID,
+		UserID:    gift.SenderID,
+		Amount:    amount,
+		Method:    models.RefundToStoreCredit,
+		Note:      "Unclaimed gift of " + gift.BookTitle,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		undo()
+		return 0, err
+	}
+	if err := s.creditService.CreditWallet(ctx, gift.SenderID, amount, models.CreditRefund, &order.ID, "Unclaimed gift of "+gift.BookTitle, nil); err != nil {
+		_, _ = s.refundsCollection.DeleteOne(ctx, bson.M{"_id": inserted.InsertedID})
+		undo()
+		return 0, err
+	}
+	return amount, nil
+}
+
+func (s *GiftService) list(ctx context.Context, filter bson.M) ([]models.Gift, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := s.giftsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var gifts []models.Gift
+	if err := cursor.All(ctx, &gifts); err != nil {
+		return nil, err
+	}
+	if gifts == nil {
+		gifts = []models.Gift{}
+	}
+	return gifts, nil
+}
+
+func (s *GiftService) mailClaim(ctx context.Context, gift models.Gift) {
+	sender := s.username(ctx, gift.SenderID)
+	body := fmt.Sprintf("%s sent you the e-book %q.\n", sender, gift.BookTitle)
+	if gift.Message != "" {
+		body += "\n" + gift.Message + "\n"
+	}
+	body += fmt.Sprintf("\nClaim it by %s at %s/gifts/claim?token=%s\nor enter this code in the store: %s\n",
+		gift.ExpiresAt.Format("January 2, 2006"), s.appURL, gift.Token, gift.Token)
+	if err := s.mailer.Send(ctx, gift.RecipientEmail, sender+" sent you a book", body); err != nil {
+		log.Printf("Failed to mail gift %s: %v", gift.ID.Hex(), err)
+	}
+}
+
+func (s *GiftService) mailExpiry(ctx context.Context, gift models.Gift, amount models.Money) {
+	var sender models.User
+	if err := s.usersCollection.FindOne(ctx, bson.M{"_id": gift.SenderID}).Decode(&sender); err != nil {
+		return
+	}
+	body := fmt.Sprintf("Your gift of %q to %s was not claimed in time.\n", gift.BookTitle, gift.RecipientEmail)
+	if amount > 0 {
+		body += fmt.Sprintf("We added $%s to your store credit.\n", amount.String())
+	}
+	if err := s.mailer.Send(ctx, sender.Email, "Your gift was not claimed", body); err != nil {
+		log.Printf("Failed to mail gift expiry %s: %v", gift.ID.Hex(), err)
+	}
+}
+
+func (s *GiftService) username(ctx context.Context, userID primitive.ObjectID) string {
+	var user models.User
+	if err := s.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil || user.Username == "" {
+		return "Someone"
+	}
+	return user.Username
+}
+
+func giftToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bookstore/models"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("image must be a JPEG, PNG or GIF")
+	ErrImageTooLarge    = errors.New("image is larger than 5 MB")
+	ErrBookNotFound     = errors.New("book not found")
+	ErrUserNotFound     = errors.New("user not found")
+)
+
+const (
+	MaxImageBytes = 5 << 20
+	// ImageURLPrefix is where uploaded images are served; the rest of the
+	// URL is the blob key.
+	ImageURLPrefix = "/api/images/"
+	// maxImageSide rejects images whose pixels would take too much memory
+	// to decode, however small the file.
+	maxImageSide     = 8000
+	thumbnailQuality = 85
+)
+
+type thumbnailSize struct {
+	name string
+	size int
+}
+
+// Cover thumbnails keep the aspect ratio and are size pixels wide; avatars
+// are cropped to a centred square of size pixels. Images are never scaled
+// up.
+var (
+	coverSizes  = []thumbnailSize{{"small", 160}, {"medium", 320}, {"large", 640}}
+	avatarSizes = []thumbnailSize{{"small", 48}, {"medium", 128}, {"large", 256}}
+)
+
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// ImageService stores book covers and user avatars in a BlobStore together
+// with their thumbnails.
+type ImageService struct {
+	store           BlobStore
+	booksCollection *mongo.Collection
+	usersCollection *mongo.Collection
+}
+
+func NewImageService(store BlobStore, booksCollection, usersCollection *mongo.Collection) *ImageService {
+	return &ImageService{
+		store:           store,
+		booksCollection: booksCollection,
+		usersCollection: usersCollection,
+	}
+}
+
+// Open returns a stored image file by its key.
+func (s *ImageService) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	return s.store.Open(ctx, key)
+}
+
+// SetBookCover stores an uploaded cover and points the book's image_url at
+// it. The previous uploaded cover is deleted.
+func (s *ImageService) SetBookCover(ctx context.Context, bookID primitive.ObjectID, r io.Reader) (*models.StoredImage, error) {
+	var book models.Book
+	err := s.booksCollection.FindOne(ctx, bson.M{"_id": bookID}, options.FindOne().SetProjection(bson.M{"cover": 1})).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cover, err := s.save(ctx, "covers/"+bookID.Hex(), r, coverSizes, false)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.booksCollection.UpdateOne(ctx, bson.M{"_id": bookID}, bson.M{"$set": bson.M{
+		"cover":      cover,
+		"image_url":  cover.URL,
+		"updated_at": time.Now(),
+	}})
+	if err != nil {
+		s.remove(ctx, cover)
+		return nil, err
+	}
+	s.remove(ctx, book.Cover)
+	return cover, nil
+}
+
+// RemoveBookCover deletes a book's uploaded cover and clears its image_url.
+func (s *ImageService) RemoveBookCover(ctx context.Context, bookID primitive.ObjectID) error {
+	var book models.Book
+	err := s.booksCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": bookID},
+		bson.M{
+			"$set":   bson.M{"image_url": "", "updated_at": time.Now()},
+			"$unset": bson.M{"cover": ""},
+		},
+		options.FindOneAndUpdate().SetProjection(bson.M{"cover": 1}),
+	).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return ErrBookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.remove(ctx, book.Cover)
+	return nil
+}
+
+// SetAvatar stores an uploaded avatar and points the user's profile_image
+// at its large thumbnail. The previous avatar is deleted.
+func (s *ImageService) SetAvatar(ctx context.Context, userID primitive.ObjectID, r io.Reader) (*models.StoredImage, error) {
+	var user models.User
+	err := s.usersCollection.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(bson.M{"avatar": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	avatar, err := s.save(ctx, "avatars/"+userID.Hex(), r, avatarSizes, true)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{
+		"avatar":        avatar,
+		"profile_image": avatar.Thumbnails["large"],
+		"updated_at":    time.Now(),
+	}})
+	if err != nil {
+		s.remove(ctx, avatar)
+		return nil, err
+	}
+	s.remove(ctx, user.Avatar)
+	return avatar, nil
+}
+
+// RemoveAvatar deletes a user's avatar and clears their profile_image.
+func (s *ImageService) RemoveAvatar(ctx context.Context, userID primitive.ObjectID) error {
+	var user models.User
+	err := s.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set":   bson.M{"profile_image": "", "updated_at": time.Now()},
+			"$unset": bson.M{"avatar": ""},
+		},
+		options.FindOneAndUpdate().SetProjection(bson.M{"avatar": 1}),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.remove(ctx, user.Avatar)
+	return nil
+}
+
+// save checks an uploaded image by its content rather than the name or
+// type the client gave, then stores it with its thumbnails under a new
+// directory below prefix.
+func (s *ImageService) save(ctx context.Context, prefix string, r io.Reader, sizes []thumbnailSize, square bool) (*models.StoredImage, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageBytes {
+		return nil, ErrImageTooLarge
+	}
+	ext, ok := imageExtensions[http.DetectContentType(data)]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if config.Width > maxImageSide || config.Height > maxImageSide {
+		return nil, fmt.Errorf("%w: at most %d pixels on each side", ErrImageTooLarge, maxImageSide)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+
+	dir := prefix + "/" + primitive.NewObjectID().Hex() + "/"
+	stored := &models.StoredImage{
+		Thumbnails: map[string]string{},
+		Width:      config.Width,
+		Height:     config.Height,
+		UploadedAt: time.Now(),
+	}
+	put := func(name string, data []byte) (string, error) {
+		key := dir + name
+		if err := s.store.Put(ctx, key, bytes.NewReader(data)); err != nil {
+			return "", err
+		}
+		stored.Keys = append(stored.Keys, key)
+		return ImageURLPrefix + key, nil
+	}
+
+	if stored.URL, err = put("original."+ext, data); err != nil {
+		s.remove(ctx, stored)
+		return nil, err
+	}
+	for _, size := range sizes {
+		var thumb *image.RGBA
+		if square {
+			thumb = cropSquare(src, size.size)
+		} else {
+			thumb = fitWidth(src, size.size)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			s.remove(ctx, stored)
+			return nil, err
+		}
+		url, err := put(size.name+".jpg", buf.Bytes())
+		if err != nil {
+			s.remove(ctx, stored)
+			return nil, err
+		}
+		stored.Thumbnails[size.name] = url
+	}
+	return stored, nil
+}
+
+// remove deletes the files of a stored image. Failures are only logged: the
+// image is no longer referenced, so at worst its files are left behind.
+func (s *ImageService) remove(ctx context.Context, stored *models.StoredImage) {
+	if stored == nil {
+		return
+	}
+	for _, key := range stored.Keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete image %s: %v", key, err)
+		}
+	}
+}
+
+// fitWidth scales src down to width pixels wide, keeping its aspect ratio.
+func fitWidth(src image.Image, width int) *image.RGBA {
+	b := src.Bounds()
+	if b.Dx() <= width {
+		return scale(src, b, b.Dx(), b.Dy())
+	}
+	height := (b.Dy()*width + b.Dx()/2) / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	return scale(src, b, width, height)
+}
+
+// cropSquare cuts the largest centred square out of src and scales it down
+// to size pixels.
+func cropSquare(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	return scale(src, image.Rect(x0, y0, x0+side, y0+side), min(size, side), min(size, side))
+}
+
+// scale resizes the r part of src to w×h by averaging the source pixels
+// under each target pixel. Transparent areas are put on white, as the
+// thumbnails are JPEGs.
+func scale(src image.Image, r image.Rectangle, w, h int) *image.RGBA {
+	flat := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, r.Min, draw.Over)
+
+	sw, sh := r.Dx(), r.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var red, green, blue, n int
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					red += int(row[sx*4])
+					green += int(row[sx*4+1])
+					blue += int(row[sx*4+2])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(red / n)
+			dst.Pix[i+1] = uint8(green / n)
+			dst.Pix[i+2] = uint8(blue / n)
+			dst.Pix[i+3] = 255
+		}
+	}
+	return dst
+}
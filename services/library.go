@@ -0,0 +1,591 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotInLibrary     = errors.New("book is not in your library")
+	ErrNotEbook         = errors.New("you do not own an e-book format of this book")
+	ErrInvalidShelves   = errors.New("a book can only be on one of to-read, reading and finished")
+	ErrStaleProgress    = errors.New("a later reading position has already been saved")
+	ErrBookmarkNotFound = errors.New("bookmark not found")
+	ErrTooManyBookmarks = errors.New("bookmark limit reached for this book")
+	ErrAccessExpired    = errors.New("access to this book has expired")
+	ErrNotRentable      = errors.New("this book is not available for rental")
+	ErrAlreadyInLibrary = errors.New("you can already read this book")
+	ErrNotPremium       = errors.New("borrowing is a premium membership benefit")
+	ErrBorrowLimit      = errors.New("you have borrowed all the books included this month")
+)
+
+// MaxBookmarks is how many bookmarks a book may have.
+const MaxBookmarks = 200
+
+// LibraryService manages what users own (digital_access grants), what they
+// do with it (library_entries: shelves, reading progress, bookmarks) and
+// e-book rentals, including the monthly loans of premium members.
+type LibraryService struct {
+	digitalAccessCollection *mongo.Collection
+	entriesCollection       *mongo.Collection
+	booksCollection         *mongo.Collection
+	rentalsCollection       *mongo.Collection
+	usersCollection         *mongo.Collection
+	borrowsPerMonth         int
+	borrowDays              int
+}
+
+func NewLibraryService(
+	digitalAccessCollection,
+	entriesCollection,
+	booksCollection,
+	rentalsCollection,
+	usersCollection *mongo.Collection,
+	borrowsPerMonth,
+	borrowDays int,
+) *LibraryService {
+	return &LibraryService{
+		digitalAccessCollection: digitalAccessCollection,
+		entriesCollection:       entriesCollection,
+		booksCollection:         booksCollection,
+		rentalsCollection:       rentalsCollection,
+		usersCollection:         usersCollection,
+		borrowsPerMonth:         borrowsPerMonth,
+		borrowDays:              borrowDays,
+	}
+}
+
+// Grant gives the user a purchased format of a book from an order. Buying
+// a format that is already owned adds the order to the existing grant
+// instead of creating another one. Purchases do not expire.
+func (s *LibraryService) Grant(ctx context.Context, userID, bookID primitive.ObjectID, formatType string, orderID primitive.ObjectID) error {
+	now := time.Now()
+	accessURL := ""
+	if formatType != "physical" {
+		accessURL = "https://library.bookstore.com/access/" + orderID.Hex()
+	}
+	update := bson.M{
+		"$setOnInsert": bson.M{"access_granted_date": now, "access_url": accessURL, "created_at": now},
+		"$addToSet":    bson.M{"order_ids": orderID},
+		"$unset":       bson.M{"expiry_date": ""},
+	}
+	filter := bson.M{"user_id": userID, "book_id": bookID, "format_type": formatType}
+
+	_, err := s.digitalAccessCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// a concurrent upsert created the grant first; this one now updates it
+		_, err = s.digitalAccessCollection.UpdateOne(ctx, filter, update)
+	}
+	return err
+}
+
+// Revoke takes back the format granted by an order. The grant stays while
+// other orders still account for it. Grants from before order tracking
+// carry no order IDs and are removed outright.
+func (s *LibraryService) Revoke(ctx context.Context, userID, bookID primitive.ObjectID, formatType string, orderID primitive.ObjectID) error {
+	filter := bson.M{"user_id": userID, "book_id": bookID, "format_type": formatType}
+	if _, err := s.digitalAccessCollection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"order_ids": orderID}}); err != nil {
+		return err
+	}
+	filter["$or"] = []bson.M{
+		{"order_ids": bson.M{"$size": 0}},
+		{"order_ids": bson.M{"$exists": false}},
+	}
+	_, err := s.digitalAccessCollection.DeleteOne(ctx, filter)
+	return err
+}
+
+// RevokeOrder takes back everything granted by a cancelled order.
+func (s *LibraryService) RevokeOrder(ctx context.Context, userID, orderID primitive.ObjectID) error {
+	filter := bson.M{"user_id": userID, "order_ids": orderID}
+	cursor, err := s.digitalAccessCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var grants []models.DigitalAccess
+	if err := cursor.All(ctx, &grants); err != nil {
+		return err
+	}
+	if len(grants) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, len(grants))
+	for i, g := range grants {
+		ids[i] = g.ID
+	}
+
+	_, err = s.digitalAccessCollection.UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"order_ids": orderID}})
+	if err != nil {
+		return err
+	}
+	// only grants this order accounted for; premium loans carry no orders
+	_, err = s.digitalAccessCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "order_ids": bson.M{"$size": 0}})
+	return err
+}
+
+// Rent lends the user the rental format of a book for days days. Renting a
+// book that is still out extends the current period instead of starting a
+// new one. orderID is nil for premium loans.
+func (s *LibraryService) Rent(ctx context.Context, userID, bookID primitive.ObjectID, days int, orderID *primitive.ObjectID, price models.Money) (*models.Rental, error) {
+	now := time.Now()
+	rental := models.Rental{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		BookID:    bookID,
+		OrderID:   orderID,
+		Days:      days,
+		Price:     price,
+		Borrowed:  orderID == nil,
+		CreatedAt: now,
+	}
+	orderIDs := bson.A{}
+	if orderID != nil {
+		orderIDs = append(orderIDs, *orderID)
+	}
+	period := time.Duration(days) * 24 * time.Hour
+
+	// a lapsed rental the cleanup job has not removed yet starts over
+	active := bson.M{"$gt": bson.A{"$expiry_date", now}}
+	keep := func(field string, value interface{}) bson.M {
+		return bson.M{"$cond": bson.A{active, "$" + field, value}}
+	}
+	var before models.DigitalAccess
+	err := s.digitalAccessCollection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "book_id": bookID, "format_type": "rental"},
+		mongo.Pipeline{bson.D{{Key: "$set", Value: bson.M{
+			"access_granted_date": keep("access_granted_date", now),
+			"access_url":          keep("access_url", "https://library.bookstore.com/access/"+rental.ID.Hex()),
+			"created_at":          bson.M{"$ifNull": bson.A{"$created_at", now}},
+			"order_ids": bson.M{"$cond": bson.A{active,
+				bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$order_ids", bson.A{}}}, orderIDs}},
+				orderIDs,
+			}},
+			"expiry_date": bson.M{"$add": bson.A{keep("expiry_date", now), period.Milliseconds()}},
+		}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	start := now
+	if err == nil && before.ExpiryDate != nil && before.ExpiryDate.After(now) {
+		start = *before.ExpiryDate
+		rental.Extension = true
+	}
+	rental.ExpiresAt = start.Add(period)
+
+	if _, err := s.rentalsCollection.InsertOne(ctx, rental); err != nil {
+		return nil, err
+	}
+	return &rental, nil
+}
+
+// Borrow lends a premium member a rentable book for free. Members get
+// borrowsPerMonth loans per calendar month.
+func (s *LibraryService) Borrow(ctx context.Context, userID, bookID primitive.ObjectID) (*models.Rental, error) {
+	var book models.Book
+	err := s.booksCollection.FindOne(ctx, bson.M{"_id": bookID, "deleted_at": nil}).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotRentable
+	}
+	if err != nil {
+		return nil, err
+	}
+	if format, ok := findFormat(book, "rental"); !ok || !book.Released(format, time.Now()) {
+		return nil, ErrNotRentable
+	}
+	owned, err := s.Book(ctx, userID, bookID)
+	if err != nil && err != ErrNotInLibrary {
+		return nil, err
+	}
+	if owned != nil && owned.IsEbook() {
+		return nil, ErrAlreadyInLibrary
+	}
+
+	var user models.User
+	if err := s.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !user.HasPremium(now) {
+		return nil, ErrNotPremium
+	}
+	if s.borrowsPerMonth <= 0 {
+		return nil, ErrBorrowLimit
+	}
+
+	// the count resets with the month; the filter keeps concurrent
+	// borrows from going over the allowance
+	month := now.UTC().Format("2006-01")
+	result, err := s.usersCollection.UpdateOne(ctx,
+		bson.M{"_id": userID, "$or": []bson.M{
+			{"borrow_month": bson.M{"$ne": month}},
+			{"borrow_count": bson.M{"$lt": s.borrowsPerMonth}},
+		}},
+		mongo.Pipeline{bson.D{{Key: "$set", Value: bson.M{
+			"borrow_count": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$borrow_month", month}},
+				bson.M{"$add": bson.A{"$borrow_count", 1}},
+				1,
+			}},
+			"borrow_month": month,
+		}}}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrBorrowLimit
+	}
+
+	rental, err := s.Rent(ctx, userID, bookID, s.borrowDays, nil, 0)
+	if err != nil {
+		_, _ = s.usersCollection.UpdateOne(ctx,
+			bson.M{"_id": userID, "borrow_month": month, "borrow_count": bson.M{"$gt": 0}},
+			bson.M{"$inc": bson.M{"borrow_count": -1}},
+		)
+		return nil, err
+	}
+	return rental, nil
+}
+
+// BorrowsLeft is how many more books the user can borrow this month.
+func (s *LibraryService) BorrowsLeft(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	var user models.User
+	if err := s.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if !user.HasPremium(now) {
+		return 0, nil
+	}
+	left := s.borrowsPerMonth
+	if user.BorrowMonth == now.UTC().Format("2006-01") {
+		left -= user.BorrowCount
+	}
+	if left < 0 {
+		left = 0
+	}
+	return left, nil
+}
+
+func (s *LibraryService) Rentals(ctx context.Context, userID primitive.ObjectID, limit int64) ([]models.Rental, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := s.rentalsCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rentals []models.Rental
+	if err := cursor.All(ctx, &rentals); err != nil {
+		return nil, err
+	}
+	return rentals, nil
+}
+
+// Download returns the grant to read a book with, checking its expiry at
+// the moment of download. An empty formatType picks any readable format,
+// owned copies before rentals.
+func (s *LibraryService) Download(ctx context.Context, userID, bookID primitive.ObjectID, formatType string) (*models.DigitalAccess, error) {
+	if formatType == "physical" {
+		return nil, ErrNotEbook
+	}
+	filter := bson.M{"user_id": userID, "book_id": bookID, "format_type": bson.M{"$ne": "physical"}}
+	if formatType != "" {
+		filter["format_type"] = formatType
+	}
+	cursor, err := s.digitalAccessCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var grants []models.DigitalAccess
+	if err := cursor.All(ctx, &grants); err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return nil, ErrNotInLibrary
+	}
+
+	now := time.Now()
+	var pick *models.DigitalAccess
+	for i, g := range grants {
+		switch {
+		case g.ExpiryDate == nil:
+			return &grants[i], nil
+		case g.ExpiryDate.After(now) && (pick == nil || g.ExpiryDate.After(*pick.ExpiryDate)):
+			pick = &grants[i]
+		}
+	}
+	if pick == nil {
+		return nil, ErrAccessExpired
+	}
+	return pick, nil
+}
+
+// Library returns every book the user owns, newest first.
+func (s *LibraryService) Library(ctx context.Context, userID primitive.ObjectID) ([]models.LibraryBook, error) {
+	return s.books(ctx, userID, bson.M{})
+}
+
+// Book returns a single book of the user's library.
+func (s *LibraryService) Book(ctx context.Context, userID, bookID primitive.ObjectID) (*models.LibraryBook, error) {
+	books, err := s.books(ctx, userID, bson.M{"book_id": bookID})
+	if err != nil {
+		return nil, err
+	}
+	if len(books) == 0 {
+		return nil, ErrNotInLibrary
+	}
+	return &books[0], nil
+}
+
+// books merges the user's unexpired grants into one document per book and
+// joins the book and the user's library entry onto it.
+func (s *LibraryService) books(ctx context.Context, userID primitive.ObjectID, match bson.M) ([]models.LibraryBook, error) {
+	match["user_id"] = userID
+	match["expiry_date"] = bson.M{"$not": bson.M{"$lte": time.Now()}}
+
+	cursor, err := s.digitalAccessCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: match}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "access_granted_date", Value: 1}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$book_id"},
+			{Key: "formats", Value: bson.D{{Key: "$push", Value: bson.D{
+				{Key: "type", Value: "$format_type"},
+				{Key: "access_url", Value: "$access_url"},
+				{Key: "acquired_at", Value: "$access_granted_date"},
+				{Key: "expires_at", Value: "$expiry_date"},
+			}}}},
+			{Key: "acquired_at", Value: bson.D{{Key: "$min", Value: "$access_granted_date"}}},
+		}}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: s.booksCollection.Name()},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "book"},
+		}}},
+		bson.D{{Key: "$unwind", Value: "$book"}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: s.entriesCollection.Name()},
+			{Key: "let", Value: bson.D{{Key: "book_id", Value: "$_id"}}},
+			{Key: "pipeline", Value: mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "user_id", Value: userID},
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$book_id", "$$book_id"}}}},
+				}}},
+			}},
+			{Key: "as", Value: "entry"},
+		}}},
+		bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$entry"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "book_id", Value: "$_id"},
+			{Key: "title", Value: "$book.title"},
+			{Key: "author", Value: "$book.author"},
+			{Key: "image_url", Value: "$book.image_url"},
+			{Key: "formats", Value: 1},
+			{Key: "acquired_at", Value: 1},
+			{Key: "shelves", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$entry.shelves", bson.A{}}}}},
+			{Key: "progress", Value: "$entry.progress"},
+			{Key: "bookmarks", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$entry.bookmarks", bson.A{}}}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "acquired_at", Value: -1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var books []models.LibraryBook
+	if err := cursor.All(ctx, &books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// SetShelves replaces the shelves a book is on.
+func (s *LibraryService) SetShelves(ctx context.Context, userID, bookID primitive.ObjectID, shelves []string) (*models.LibraryEntry, error) {
+	if _, err := s.Book(ctx, userID, bookID); err != nil {
+		return nil, err
+	}
+
+	cleaned := []string{}
+	seen := map[string]bool{}
+	reading := 0
+	for _, shelf := range shelves {
+		shelf = strings.TrimSpace(shelf)
+		if shelf == "" || seen[strings.ToLower(shelf)] {
+			continue
+		}
+		if isReadingShelf(strings.ToLower(shelf)) {
+			shelf = strings.ToLower(shelf)
+			reading++
+		}
+		seen[strings.ToLower(shelf)] = true
+		cleaned = append(cleaned, shelf)
+	}
+	if reading > 1 {
+		return nil, ErrInvalidShelves
+	}
+
+	now := time.Now()
+	var entry models.LibraryEntry
+	err := s.entriesCollection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "book_id": bookID},
+		bson.M{
+			"$set":         bson.M{"shelves": cleaned, "updated_at": now},
+			"$setOnInsert": bson.M{"bookmarks": []models.Bookmark{}, "created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// UpdateProgress stores the reading position of an e-book. Starting a book
+// moves it to the reading shelf and reaching the end moves it to finished.
+// When a later position is already stored the entry is returned along with
+// ErrStaleProgress so the caller can jump to it.
+func (s *LibraryService) UpdateProgress(ctx context.Context, userID, bookID primitive.ObjectID, req models.ReadingProgressRequest) (*models.LibraryEntry, error) {
+	if err := s.ownsEbook(ctx, userID, bookID); err != nil {
+		return nil, err
+	}
+	if err := s.ensureEntry(ctx, userID, bookID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	at := now
+	if req.UpdatedAt != nil && req.UpdatedAt.Before(now) {
+		at = *req.UpdatedAt
+	}
+	progress := models.ReadingProgress{
+		Percent:   req.Percent,
+		Location:  strings.TrimSpace(req.Location),
+		Device:    strings.TrimSpace(req.Device),
+		UpdatedAt: at,
+	}
+
+	// $literal keeps a location starting with "$" from being read as a field path
+	set := bson.M{"progress": bson.M{"$literal": progress}, "updated_at": now}
+	switch {
+	case req.Percent >= 100:
+		set["shelves"] = withReadingShelf(models.ShelfFinished)
+	case req.Percent > 0:
+		set["shelves"] = withReadingShelf(models.ShelfReading)
+	}
+
+	var entry models.LibraryEntry
+	err := s.entriesCollection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "book_id": bookID, "$or": []bson.M{
+			{"progress": bson.M{"$exists": false}},
+			{"progress.updated_at": bson.M{"$lt": at}},
+		}},
+		mongo.Pipeline{bson.D{{Key: "$set", Value: set}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		if err := s.entriesCollection.FindOne(ctx, bson.M{"user_id": userID, "book_id": bookID}).Decode(&entry); err != nil {
+			return nil, err
+		}
+		return &entry, ErrStaleProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// AddBookmark bookmarks a location in an e-book.
+func (s *LibraryService) AddBookmark(ctx context.Context, userID, bookID primitive.ObjectID, req models.BookmarkRequest) (*models.Bookmark, error) {
+	if err := s.ownsEbook(ctx, userID, bookID); err != nil {
+		return nil, err
+	}
+	if err := s.ensureEntry(ctx, userID, bookID); err != nil {
+		return nil, err
+	}
+
+	bookmark := models.Bookmark{
+		ID:        primitive.NewObjectID(),
+		Location:  strings.TrimSpace(req.Location),
+		Note:      strings.TrimSpace(req.Note),
+		CreatedAt: time.Now(),
+	}
+	result, err := s.entriesCollection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "book_id": bookID, "bookmarks." + strconv.Itoa(MaxBookmarks-1): bson.M{"$exists": false}},
+		bson.M{"$push": bson.M{"bookmarks": bookmark}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrTooManyBookmarks
+	}
+	return &bookmark, nil
+}
+
+func (s *LibraryService) DeleteBookmark(ctx context.Context, userID, bookID, bookmarkID primitive.ObjectID) error {
+	result, err := s.entriesCollection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "book_id": bookID},
+		bson.M{"$pull": bson.M{"bookmarks": bson.M{"_id": bookmarkID}}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrBookmarkNotFound
+	}
+	return nil
+}
+
+// ownsEbook checks the user has an unexpired grant for a readable format.
+func (s *LibraryService) ownsEbook(ctx context.Context, userID, bookID primitive.ObjectID) error {
+	book, err := s.Book(ctx, userID, bookID)
+	if err != nil {
+		return err
+	}
+	if !book.IsEbook() {
+		return ErrNotEbook
+	}
+	return nil
+}
+
+func (s *LibraryService) ensureEntry(ctx context.Context, userID, bookID primitive.ObjectID) error {
+	now := time.Now()
+	_, err := s.entriesCollection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "book_id": bookID},
+		bson.M{"$setOnInsert": bson.M{"shelves": []string{}, "bookmarks": []models.Bookmark{}, "created_at": now, "updated_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// withReadingShelf is an update expression putting the book on the given
+// reading shelf, off the other two, and leaving custom shelves alone.
+func withReadingShelf(shelf string) bson.M {
+	return bson.M{"$concatArrays": bson.A{
+		bson.M{"$setDifference": bson.A{bson.M{"$ifNull": bson.A{"$shelves", bson.A{}}}, models.ReadingShelves}},
+		bson.A{shelf},
+	}}
+}
+
+func isReadingShelf(shelf string) bool {
+	for _, s := range models.ReadingShelves {
+		if s == shelf {
+			return true
+		}
+	}
+	return false
+}
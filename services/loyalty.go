@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoyaltyWindow is how far back spend counts towards a tier.
+const LoyaltyWindow = 12 // months
+
+// defaultLoyaltyTiers are used while the loyalty_tiers collection is empty.
+var defaultLoyaltyTiers = []models.LoyaltyTier{
+	{Name: "Bronze", MinSpend: 0, Discount: 0, Color: "#A0826D"},
+	{Name: "Silver", MinSpend: 50000, Discount: 0.02, Color: "#C0C0C0"},
+	{Name: "Gold", MinSpend: 150000, Discount: 0.05, Color: "#FFD700"},
+	{Name: "Platinum", MinSpend: 500000, Discount: 0.10, Color: "#E5E4E2", FreeShipping: true},
+}
+
+// LoyaltyService places users in loyalty tiers by what they spent over the
+// last LoyaltyWindow months. The spend and tier name are stored on the user
+// and refreshed by Recalculate.
+type LoyaltyService struct {
+	tiersCollection     *mongo.Collection
+	ordersCollection    *mongo.Collection
+	usersCollection     *mongo.Collection
+	notificationService *NotificationService
+}
+
+func NewLoyaltyService(tiersCollection, ordersCollection, usersCollection *mongo.Collection, notificationService *NotificationService) *LoyaltyService {
+	return &LoyaltyService{
+		tiersCollection:     tiersCollection,
+		ordersCollection:    ordersCollection,
+		usersCollection:     usersCollection,
+		notificationService: notificationService,
+	}
+}
+
+// Tiers returns the tiers ordered by spend threshold, lowest first.
+func (s *LoyaltyService) Tiers(ctx context.Context) ([]models.LoyaltyTier, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "min_spend", Value: 1}})
+	cursor, err := s.tiersCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var tiers []models.LoyaltyTier
+	if err := cursor.All(ctx, &tiers); err != nil {
+		return nil, err
+	}
+	if len(tiers) == 0 {
+		return defaultLoyaltyTiers, nil
+	}
+	return tiers, nil
+}
+
+// TierFor returns the tier matching the user's stored spend, or nil when
+// the spend is below every tier.
+func (s *LoyaltyService) TierFor(ctx context.Context, user models.User) (*models.LoyaltyTier, error) {
+	tiers, err := s.Tiers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tierForSpend(tiers, user.LoyaltySpend), nil
+}
+
+// Recalculate refreshes the user's spend and tier and notifies the user
+// when the tier changed.
+func (s *LoyaltyService) Recalculate(ctx context.Context, userID primitive.ObjectID) (*models.LoyaltyTier, error) {
+	tiers, err := s.Tiers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.recalculate(ctx, userID, tiers, time.Now())
+}
+
+// RecalculateAll refreshes every active user, so spend that falls out of
+// the window lowers the tier. It returns the number of tier changes.
+func (s *LoyaltyService) RecalculateAll(ctx context.Context, now time.Time) (int, error) {
+	tiers, err := s.Tiers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := s.usersCollection.Find(ctx, bson.M{"is_active": true}, options.Find().SetProjection(bson.M{"_id": 1, "loyalty_tier": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	changed := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return changed, err
+		}
+		tier, err := s.recalculate(ctx, user.ID, tiers, now)
+		if err != nil {
+			return changed, err
+		}
+		if tierName(tier) != user.LoyaltyTier {
+			changed++
+		}
+	}
+	return changed, cursor.Err()
+}
+
+func (s *LoyaltyService) recalculate(ctx context.Context, userID primitive.ObjectID, tiers []models.LoyaltyTier, now time.Time) (*models.LoyaltyTier, error) {
+	spend, err := s.spend(ctx, userID, now.AddDate(0, -LoyaltyWindow, 0))
+	if err != nil {
+		return nil, err
+	}
+	tier := tierForSpend(tiers, spend)
+
+	var before models.User
+	err = s.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"loyalty_spend": spend, "loyalty_tier": tierName(tier)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err != nil {
+		return nil, err
+	}
+
+	// a user getting their first tier on their first order is not news
+	if before.LoyaltyTier != tierName(tier) && tier != nil && (before.LoyaltyTier != "" || tier.MinSpend > tiers[0].MinSpend) {
+		s.notifyTierChange(ctx, userID, tiers, before.LoyaltyTier, *tier)
+	}
+	return tier, nil
+}
+
+// spend is the total of the user's orders since from, less cancellations
+// and refunds.
+func (s *LoyaltyService) spend(ctx context.Context, userID primitive.ObjectID, from time.Time) (models.Money, error) {
+	cursor, err := s.ordersCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{
+			"user_id":    userID,
+			"status":     bson.M{"$ne": "Cancelled"},
+			"created_at": bson.M{"$gte": from},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$total_amount"}}},
+			{Key: "refunded", Value: bson.D{{Key: "$sum", Value: "$refunded_amount"}}},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var totals struct {
+		Total    models.Money `bson:"total"`
+		Refunded models.Money `bson:"refunded"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&totals); err != nil {
+			return 0, err
+		}
+	}
+	spend := totals.Total - totals.Refunded
+	if spend < 0 {
+		spend = 0
+	}
+	return spend, cursor.Err()
+}
+
+func (s *LoyaltyService) notifyTierChange(ctx context.Context, userID primitive.ObjectID, tiers []models.LoyaltyTier, previous string, tier models.LoyaltyTier) {
+	title := "Welcome to " + tier.Name
+	message := fmt.Sprintf("You are now a %s member", tier.Name)
+	for _, t := range tiers {
+		if t.Name == previous && t.MinSpend > tier.MinSpend {
+			title = "Your loyalty tier changed"
+			message = fmt.Sprintf("Your tier is now %s, based on your spending over the last %d months", tier.Name, LoyaltyWindow)
+			break
+		}
+	}
+	if tier.Discount > 0 {
+		message += fmt.Sprintf(", with %.0f%% off every order", tier.Discount*100)
+	}
+	if tier.FreeShipping {
+		message += " and free shipping"
+	}
+	_ = s.notificationService.Notify(ctx, userID, models.NotificationLoyaltyTier, title, message+".")
+}
+
+func tierForSpend(tiers []models.LoyaltyTier, spend models.Money) *models.LoyaltyTier {
+	var match *models.LoyaltyTier
+	for i := range tiers {
+		if spend >= tiers[i].MinSpend {
+			match = &tiers[i]
+		}
+	}
+	return match
+}
+
+func tierName(tier *models.LoyaltyTier) string {
+	if tier == nil {
+		return ""
+	}
+	return tier.Name
+}
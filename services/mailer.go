@@ -0,0 +1,19 @@
+package services
+
+import (
+	"context"
+	"log"
+)
+
+// Mailer delivers email. The store has no mail provider yet, so LogMailer
+// only writes the message to the server log.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("Mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
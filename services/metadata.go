@@ -0,0 +1,297 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrMetadataNotFound    = errors.New("no metadata found for this ISBN")
+	ErrMetadataUnavailable = errors.New("metadata source is unavailable")
+	ErrInvalidISBN         = errors.New("invalid ISBN")
+)
+
+const (
+	// enrichBatch is how many books one enrichment run looks up.
+	enrichBatch = 200
+	// enrichPause spaces the lookups of an enrichment run so the source is
+	// not flooded.
+	enrichPause = 500 * time.Millisecond
+	// enrichRecheckDays is how long a book the source knew nothing useful
+	// about is left alone before it is looked up again.
+	enrichRecheckDays = 30
+)
+
+// MetadataProvider looks up an edition in a bibliographic source by its
+// ISBN-13. It returns ErrMetadataNotFound when the source does not know the
+// ISBN and ErrMetadataUnavailable when the source cannot be reached.
+type MetadataProvider interface {
+	Name() string
+	LookupISBN(ctx context.Context, isbn string) (*models.BookMetadata, error)
+}
+
+// OpenLibraryProvider reads the Open Library books API.
+type OpenLibraryProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewOpenLibraryProvider(baseURL string) *OpenLibraryProvider {
+	return &OpenLibraryProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OpenLibraryProvider) Name() string {
+	return "openlibrary"
+}
+
+type openLibraryEdition struct {
+	Details struct {
+		Title       string          `json:"title"`
+		Description json.RawMessage `json:"description"`
+		PublishDate string          `json:"publish_date"`
+		Covers      []int           `json:"covers"`
+		Authors     []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+		Languages []struct {
+			Key string `json:"key"`
+		} `json:"languages"`
+	} `json:"details"`
+}
+
+var yearPattern = regexp.MustCompile(`\b(1[5-9]|20)\d{2}\b`)
+
+// marcLanguages maps the MARC codes Open Library uses to BCP 47 tags for the
+// common languages; other languages are left blank.
+var marcLanguages = map[string]string{
+	"eng": "en", "fre": "fr", "ger": "de", "spa": "es", "ita": "it",
+	"por": "pt", "dut": "nl", "swe": "sv", "dan": "da", "nor": "no",
+	"fin": "fi", "pol": "pl", "rus": "ru", "jpn": "ja", "chi": "zh",
+	"kor": "ko", "ara": "ar", "heb": "he", "tur": "tr", "gre": "el",
+}
+
+func (p *OpenLibraryProvider) LookupISBN(ctx context.Context, isbn string) (*models.BookMetadata, error) {
+	query := url.Values{
+		"bibkeys": {"ISBN:" + isbn},
+		"format":  {"json"},
+		"jscmd":   {"details"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMetadataUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrMetadataUnavailable, resp.StatusCode)
+	}
+
+	var editions map[string]openLibraryEdition
+	if err := json.NewDecoder(resp.Body).Decode(&editions); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMetadataUnavailable, err)
+	}
+	edition, ok := editions["ISBN:"+isbn]
+	if !ok || edition.Details.Title == "" {
+		return nil, ErrMetadataNotFound
+	}
+
+	details := edition.Details
+	meta := &models.BookMetadata{
+		ISBN:        isbn,
+		Title:       details.Title,
+		Authors:     []string{},
+		Description: openLibraryText(details.Description),
+	}
+	for _, a := range details.Authors {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			meta.Authors = append(meta.Authors, name)
+		}
+	}
+	if len(details.Covers) > 0 && details.Covers[0] > 0 {
+		meta.CoverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-L.jpg", details.Covers[0])
+	}
+	if year := yearPattern.FindString(details.PublishDate); year != "" {
+		meta.PublishedYear, _ = strconv.Atoi(year)
+	}
+	if len(details.Languages) > 0 {
+		meta.Language = marcLanguages[strings.TrimPrefix(details.Languages[0].Key, "/languages/")]
+	}
+	return meta, nil
+}
+
+// openLibraryText reads a text field, which Open Library sends either as a
+// string or as {"type": "/type/text", "value": "..."}.
+func openLibraryText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return strings.TrimSpace(text)
+	}
+	var typed struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &typed); err == nil {
+		return strings.TrimSpace(typed.Value)
+	}
+	return ""
+}
+
+// FixtureMetadataProvider answers lookups from a fixed set of records keyed
+// by ISBN-13, for tests and for running without network access.
+type FixtureMetadataProvider map[string]models.BookMetadata
+
+// LoadMetadataFixtures reads a JSON array of book metadata. ISBNs may be
+// written as ISBN-10 or with hyphens.
+func LoadMetadataFixtures(path string) (FixtureMetadataProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []models.BookMetadata
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	fixtures := FixtureMetadataProvider{}
+	for _, record := range records {
+		isbn, ok := models.ISBN13(record.ISBN)
+		if !ok {
+			return nil, fmt.Errorf("invalid ISBN %q in metadata fixtures", record.ISBN)
+		}
+		record.ISBN = isbn
+		fixtures[isbn] = record
+	}
+	return fixtures, nil
+}
+
+func (FixtureMetadataProvider) Name() string {
+	return "fixture"
+}
+
+func (p FixtureMetadataProvider) LookupISBN(ctx context.Context, isbn string) (*models.BookMetadata, error) {
+	meta, ok := p[isbn]
+	if !ok {
+		return nil, ErrMetadataNotFound
+	}
+	return &meta, nil
+}
+
+// MetadataService fills in book details from a MetadataProvider.
+type MetadataService struct {
+	booksCollection *mongo.Collection
+	provider        MetadataProvider
+}
+
+func NewMetadataService(booksCollection *mongo.Collection, provider MetadataProvider) *MetadataService {
+	return &MetadataService{
+		booksCollection: booksCollection,
+		provider:        provider,
+	}
+}
+
+func (s *MetadataService) Source() string {
+	return s.provider.Name()
+}
+
+// Lookup returns a create request pre-filled from the provider's record of
+// an ISBN.
+func (s *MetadataService) Lookup(ctx context.Context, isbn string) (*models.CreateBookRequest, error) {
+	isbn13, ok := models.ISBN13(isbn)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidISBN, isbn)
+	}
+	meta, err := s.provider.LookupISBN(ctx, isbn13)
+	if err != nil {
+		return nil, err
+	}
+	req := meta.CreateRequest()
+	req.ISBN = isbn13
+	return &req, nil
+}
+
+// Enrich looks up books with an ISBN that lack a description or a cover
+// and fills in whatever the provider has; fields that are already set are
+// never overwritten. Books are marked as checked, so one the provider has
+// nothing for is only tried again after enrichRecheckDays. It returns the
+// number of books that were updated.
+func (s *MetadataService) Enrich(ctx context.Context, now time.Time) (int, error) {
+	missing := bson.A{"", nil}
+	cursor, err := s.booksCollection.Find(ctx,
+		bson.M{
+			"isbn":       bson.M{"$exists": true},
+			"deleted_at": nil,
+			"$or": bson.A{
+				bson.M{"description": bson.M{"$in": missing}},
+				bson.M{"image_url": bson.M{"$in": missing}},
+			},
+			"metadata_checked_at": bson.M{"$not": bson.M{"$gt": now.AddDate(0, 0, -enrichRecheckDays)}},
+		},
+		options.Find().
+			SetSort(bson.D{{Key: "metadata_checked_at", Value: 1}, {Key: "created_at", Value: -1}}).
+			SetLimit(enrichBatch).
+			SetProjection(bson.M{"isbn": 1, "description": 1, "image_url": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var books []models.Book
+	if err := cursor.All(ctx, &books); err != nil {
+		return 0, err
+	}
+
+	enriched := 0
+	for i, book := range books {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return enriched, ctx.Err()
+			case <-time.After(enrichPause):
+			}
+		}
+
+		meta, err := s.provider.LookupISBN(ctx, book.ISBN)
+		if err != nil && !errors.Is(err, ErrMetadataNotFound) {
+			// the source is down; leave the rest for the next run
+			return enriched, err
+		}
+
+		set := bson.M{"metadata_checked_at": now}
+		if meta != nil {
+			if book.Description == "" && meta.Description != "" {
+				set["description"] = meta.Description
+			}
+			if book.ImageURL == "" && meta.CoverURL != "" {
+				set["image_url"] = meta.CoverURL
+			}
+		}
+		if len(set) > 1 {
+			set["updated_at"] = now
+			enriched++
+		}
+		if _, err := s.booksCollection.UpdateOne(ctx, bson.M{"_id": book.ID}, bson.M{"$set": set}); err != nil {
+			return enriched, err
+		}
+	}
+	return enriched, nil
+}
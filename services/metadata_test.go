@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMetadataFixtures(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "isbn-10 and hyphenated isbn-13",
+			data: `[{"isbn": "0-306-40615-2", "title": "A"}, {"isbn": "978-0-8044-2957-3", "title": "B"}]`,
+			want: []string{"9780306406157", "9780804429573"},
+		},
+		{name: "empty", data: `[]`},
+		{name: "invalid isbn", data: `[{"isbn": "0306406153"}]`, wantErr: true},
+		{name: "malformed json", data: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metadata.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			fixtures, err := LoadMetadataFixtures(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadMetadataFixtures() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadMetadataFixtures() error = %v", err)
+			}
+			if len(fixtures) != len(tt.want) {
+				t.Fatalf("LoadMetadataFixtures() loaded %d records, want %d", len(fixtures), len(tt.want))
+			}
+			for _, isbn := range tt.want {
+				if record, ok := fixtures[isbn]; !ok || record.ISBN != isbn {
+					t.Errorf("fixture %s missing or stored as %q", isbn, record.ISBN)
+				}
+			}
+		})
+	}
+}
+
+func TestMetadataServiceLookup(t *testing.T) {
+	service := NewMetadataService(nil, FixtureMetadataProvider{
+		"9780306406157": {
+			ISBN:          "9780306406157",
+			Title:         "The Book",
+			Authors:       []string{"Ann Author", "Bob Writer"},
+			Description:   "About things.",
+			CoverURL:      "https://covers.example.com/9780306406157.jpg",
+			PublishedYear: 1999,
+			Language:      "en",
+		},
+	})
+
+	tests := []struct {
+		name    string
+		isbn    string
+		wantErr error
+	}{
+		{name: "isbn-13", isbn: "9780306406157"},
+		{name: "isbn-10 with hyphens", isbn: "0-306-40615-2"},
+		{name: "unknown isbn", isbn: "9780804429573", wantErr: ErrMetadataNotFound},
+		{name: "invalid isbn", isbn: "9780306406158", wantErr: ErrInvalidISBN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := service.Lookup(context.Background(), tt.isbn)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Lookup(%q) error = %v, want %v", tt.isbn, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup(%q) error = %v", tt.isbn, err)
+			}
+			if req.ISBN != "9780306406157" || req.Title != "The Book" || req.PublishedYear != 1999 || req.Language != "en" {
+				t.Errorf("Lookup(%q) = %+v", tt.isbn, req)
+			}
+			if req.ImageURL != "https://covers.example.com/9780306406157.jpg" || req.Description != "About things." {
+				t.Errorf("Lookup(%q) cover and description = %q, %q", tt.isbn, req.ImageURL, req.Description)
+			}
+			want := []models.BookAuthorInput{{Name: "Ann Author"}, {Name: "Bob Writer"}}
+			if len(req.Authors) != len(want) {
+				t.Fatalf("Lookup(%q) authors = %+v, want %+v", tt.isbn, req.Authors, want)
+			}
+			for i := range want {
+				if req.Authors[i].Name != want[i].Name {
+					t.Errorf("Lookup(%q) author %d = %q, want %q", tt.isbn, i, req.Authors[i].Name, want[i].Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+type NotificationService struct {
+	notificationsCollection *mongo.Collection
+}
+
+func NewNotificationService(notificationsCollection *mongo.Collection) *NotificationService {
+	return &NotificationService{notificationsCollection: notificationsCollection}
+}
+
+func (s *NotificationService) Notify(ctx context.Context, userID primitive.ObjectID, notificationType, title, message string) error {
+	_, err := s.notificationsCollection.InsertOne(ctx, models.Notification{
+		UserID:    userID,
+		Type:      notificationType,
+		Title:     title,
+		Message:   message,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+// List returns the user's notifications, newest first, and how many of them
+// are unread.
+func (s *NotificationService) List(ctx context.Context, userID primitive.ObjectID, unreadOnly bool, limit int64) ([]models.Notification, int64, error) {
+	filter := bson.M{"user_id": userID}
+	if unreadOnly {
+		filter["read_at"] = bson.M{"$exists": false}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := s.notificationsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	var notifications []models.Notification
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, 0, err
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+
+	unread, err := s.notificationsCollection.CountDocuments(ctx, bson.M{"user_id": userID, "read_at": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, 0, err
+	}
+	return notifications, unread, nil
+}
+
+func (s *NotificationService) MarkRead(ctx context.Context, userID, notificationID primitive.ObjectID) error {
+	result, err := s.notificationsCollection.UpdateOne(ctx,
+		bson.M{"_id": notificationID, "user_id": userID, "read_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"read_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		count, err := s.notificationsCollection.CountDocuments(ctx, bson.M{"_id": notificationID, "user_id": userID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotificationNotFound
+		}
+	}
+	return nil
+}
+
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := s.notificationsCollection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "read_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"read_at": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
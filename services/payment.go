@@ -0,0 +1,41 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrPaymentDeclined = errors.New("payment was declined")
+
+// PaymentGateway holds a card payment now and takes it later, for orders
+// that are paid when they are fulfilled, such as pre-orders. Authorize
+// returns the ID that Capture, Void and Refund refer to; Refund pays back
+// a captured amount. The store has no payment provider yet, so
+// NoopPaymentGateway approves everything.
+type PaymentGateway interface {
+	Authorize(ctx context.Context, userID primitive.ObjectID, amount models.Money, description string) (string, error)
+	Capture(ctx context.Context, authorizationID string, amount models.Money) error
+	Void(ctx context.Context, authorizationID string) error
+	Refund(ctx context.Context, authorizationID string, amount models.Money) error
+}
+
+type NoopPaymentGateway struct{}
+
+func (NoopPaymentGateway) Authorize(ctx context.Context, userID primitive.ObjectID, amount models.Money, description string) (string, error) {
+	return "noop_" + primitive.NewObjectID().Hex(), nil
+}
+
+func (NoopPaymentGateway) Capture(ctx context.Context, authorizationID string, amount models.Money) error {
+	return nil
+}
+
+func (NoopPaymentGateway) Void(ctx context.Context, authorizationID string) error {
+	return nil
+}
+
+func (NoopPaymentGateway) Refund(ctx context.Context, authorizationID string, amount models.Money) error {
+	return nil
+}
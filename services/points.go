@@ -0,0 +1,398 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrInsufficientPoints = errors.New("not enough loyalty points")
+
+// PointsService keeps the loyalty points ledger. The user's loyalty_points
+// field stays the balance; every change to it goes through here and is
+// recorded in the points_ledger collection.
+type PointsService struct {
+	ledgerCollection *mongo.Collection
+	usersCollection  *mongo.Collection
+	expiry           time.Duration
+	pointValue       models.Money
+}
+
+// NewPointsService creates the service. Points expire expiryDays after they
+// were earned (0 keeps them forever) and are worth pointValue each at
+// checkout.
+func NewPointsService(ledgerCollection, usersCollection *mongo.Collection, expiryDays int, pointValue models.Money) *PointsService {
+	return &PointsService{
+		ledgerCollection: ledgerCollection,
+		usersCollection:  usersCollection,
+		expiry:           time.Duration(expiryDays) * 24 * time.Hour,
+		pointValue:       pointValue,
+	}
+}
+
+func (s *PointsService) PointValue() models.Money {
+	return s.pointValue
+}
+
+func (s *PointsService) Earn(ctx context.Context, userID primitive.ObjectID, points int, orderID *primitive.ObjectID, reason string) error {
+	if points <= 0 {
+		return nil
+	}
+	return s.add(ctx, userID, models.PointsEarned, points, orderID, reason, nil)
+}
+
+// Redeem spends points on an order. It fails with ErrInsufficientPoints
+// instead of going below zero.
+func (s *PointsService) Redeem(ctx context.Context, userID primitive.ObjectID, points int, orderID primitive.ObjectID) error {
+	if points <= 0 {
+		return nil
+	}
+	var user models.User
+	err := s.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID, "loyalty_points": bson.M{"$gte": points}},
+		bson.M{"$inc": bson.M{"loyalty_points": -points}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return ErrInsufficientPoints
+	}
+	if err != nil {
+		return err
+	}
+
+	lots, err := s.consume(ctx, userID, points)
+	if err != nil {
+		return err
+	}
+	return s.insert(ctx, models.PointsEntry{
+		UserID:  userID,
+		Type:    models.PointsRedeemed,
+		Points:  -points,
+		Balance: user.LoyaltyPoints,
+		Lots:    lots,
+		OrderID: &orderID,
+		Reason:  "Redeemed at checkout",
+	})
+}
+
+// Deduct takes up to points away, never leaving a negative balance. It is
+// used when the purchase that earned them is returned.
+func (s *PointsService) Deduct(ctx context.Context, userID primitive.ObjectID, points int, orderID *primitive.ObjectID, reason string) error {
+	return s.deduct(ctx, userID, models.PointsAdjusted, points, orderID, reason, nil)
+}
+
+// Adjust is a manual correction by an admin; delta may be negative.
+func (s *PointsService) Adjust(ctx context.Context, userID primitive.ObjectID, delta int, reason string, adminID primitive.ObjectID) error {
+	if delta > 0 {
+		return s.add(ctx, userID, models.PointsAdjusted, delta, nil, reason, &adminID)
+	}
+	return s.deduct(ctx, userID, models.PointsAdjusted, -delta, nil, reason, &adminID)
+}
+
+// ReverseOrder undoes the points an order earned and gives back the points
+// it redeemed, for example when the order is cancelled. Redeemed points go
+// back to the lots they were spent from and keep their expiry date. Each
+// ledger entry is reversed at most once, so calling it again does nothing.
+func (s *PointsService) ReverseOrder(ctx context.Context, userID, orderID primitive.ObjectID, reason string) error {
+	cursor, err := s.ledgerCollection.Find(ctx, bson.M{
+		"user_id":  userID,
+		"order_id": orderID,
+		"type":     bson.M{"$in": []string{models.PointsEarned, models.PointsRedeemed}},
+		"reversed": bson.M{"$ne": true},
+	})
+	if err != nil {
+		return err
+	}
+	var entries []models.PointsEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return err
+	}
+
+	earned := 0
+	var earnedIDs []primitive.ObjectID
+	for _, e := range entries {
+		// claim the entry so a repeated or concurrent reversal skips it
+		result, err := s.ledgerCollection.UpdateOne(ctx,
+			bson.M{"_id": e.ID, "reversed": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{"reversed": true}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		if e.Type == models.PointsEarned {
+			earned += e.Points
+			earnedIDs = append(earnedIDs, e.ID)
+			continue
+		}
+		if err := s.restore(ctx, e, reason); err != nil {
+			s.unreverse(e.ID)
+			return err
+		}
+	}
+	if err := s.deduct(ctx, userID, models.PointsAdjusted, earned, &orderID, reason, nil); err != nil {
+		s.unreverse(earnedIDs...)
+		return err
+	}
+	return nil
+}
+
+// restore gives back the points of a redemption to the lots it spent them
+// from. A lot that has expired in the meantime is picked up by the next
+// expiry run. Redemptions from before lots were recorded come back as a new
+// lot.
+func (s *PointsService) restore(ctx context.Context, redemption models.PointsEntry, reason string) error {
+	points := -redemption.Points
+	if points <= 0 {
+		return nil
+	}
+	// Lots is null on redemptions from before lots were recorded and an
+	// empty list when the points had no lot.
+	if redemption.Lots == nil {
+		return s.add(ctx, redemption.UserID, models.PointsAdjusted, points, redemption.OrderID, reason, nil)
+	}
+
+	var user models.User
+	err := s.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": redemption.UserID},
+		bson.M{"$inc": bson.M{"loyalty_points": points}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return err
+	}
+	for _, use := range redemption.Lots {
+		if _, err := s.ledgerCollection.UpdateOne(ctx, bson.M{"_id": use.LotID}, bson.M{"$inc": bson.M{"remaining": use.Points}}); err != nil {
+			log.Printf("Failed to give back %d points to lot %s: %v", use.Points, use.LotID.Hex(), err)
+		}
+	}
+	return s.insert(ctx, models.PointsEntry{
+		UserID:  redemption.UserID,
+		Type:    models.PointsAdjusted,
+		Points:  points,
+		Balance: user.LoyaltyPoints,
+		OrderID: redemption.OrderID,
+		Reason:  reason,
+	})
+}
+
+// unreverse releases the claim on ledger entries whose reversal failed, so
+// it can be tried again.
+func (s *PointsService) unreverse(ids ...primitive.ObjectID) {
+	if len(ids) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.ledgerCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$unset": bson.M{"reversed": ""}}); err != nil {
+		log.Printf("Failed to release reversal of points entries: %v", err)
+	}
+}
+
+// Expire removes the unspent part of every lot that is past its expiry
+// date and returns the number of points expired.
+func (s *PointsService) Expire(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := s.ledgerCollection.Find(ctx, bson.M{
+		"expires_at": bson.M{"$lte": now},
+		"remaining":  bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var lots []models.PointsEntry
+	if err := cursor.All(ctx, &lots); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, lot := range lots {
+		// claim the lot so a concurrent spend or expiry run cannot use it too
+		result, err := s.ledgerCollection.UpdateOne(ctx,
+			bson.M{"_id": lot.ID, "remaining": lot.Remaining},
+			bson.M{"$set": bson.M{"remaining": 0}},
+		)
+		if err != nil {
+			return total, err
+		}
+		if result.MatchedCount == 0 {
+			continue
+		}
+		taken, balance, err := s.decrement(ctx, lot.UserID, lot.Remaining)
+		if err != nil {
+			return total, err
+		}
+		if taken == 0 {
+			continue
+		}
+		total += taken
+		if err := s.insert(ctx, models.PointsEntry{
+			UserID:  lot.UserID,
+			Type:    models.PointsExpired,
+			Points:  -taken,
+			Balance: balance,
+			Reason:  "Points earned on " + lot.CreatedAt.Format("2006-01-02") + " expired",
+		}); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (s *PointsService) Balance(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"loyalty_points": 1})
+	if err := s.usersCollection.FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&user); err != nil {
+		return 0, err
+	}
+	return user.LoyaltyPoints, nil
+}
+
+func (s *PointsService) History(ctx context.Context, userID primitive.ObjectID, limit int64) ([]models.PointsEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+	cursor, err := s.ledgerCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.PointsEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []models.PointsEntry{}
+	}
+	return entries, nil
+}
+
+func (s *PointsService) add(ctx context.Context, userID primitive.ObjectID, entryType string, points int, orderID *primitive.ObjectID, reason string, by *primitive.ObjectID) error {
+	var user models.User
+	err := s.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"loyalty_points": points}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return err
+	}
+
+	entry := models.PointsEntry{
+		UserID:    userID,
+		Type:      entryType,
+		Points:    points,
+		Balance:   user.LoyaltyPoints,
+		Remaining: points,
+		OrderID:   orderID,
+		Reason:    reason,
+		CreatedBy: by,
+	}
+	if s.expiry > 0 {
+		expiresAt := time.Now().Add(s.expiry)
+		entry.ExpiresAt = &expiresAt
+	}
+	return s.insert(ctx, entry)
+}
+
+func (s *PointsService) deduct(ctx context.Context, userID primitive.ObjectID, entryType string, points int, orderID *primitive.ObjectID, reason string, by *primitive.ObjectID) error {
+	if points <= 0 {
+		return nil
+	}
+	taken, balance, err := s.decrement(ctx, userID, points)
+	if err != nil || taken == 0 {
+		return err
+	}
+	if _, err := s.consume(ctx, userID, taken); err != nil {
+		return err
+	}
+	return s.insert(ctx, models.PointsEntry{
+		UserID:    userID,
+		Type:      entryType,
+		Points:    -taken,
+		Balance:   balance,
+		OrderID:   orderID,
+		Reason:    reason,
+		CreatedBy: by,
+	})
+}
+
+// decrement lowers the balance by up to points, stopping at zero, and
+// returns how many points were actually taken and the new balance.
+func (s *PointsService) decrement(ctx context.Context, userID primitive.ObjectID, points int) (int, int, error) {
+	var before models.User
+	err := s.usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"loyalty_points": bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{"$loyalty_points", points}}}}}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	taken := points
+	if before.LoyaltyPoints < taken {
+		taken = before.LoyaltyPoints
+	}
+	if taken < 0 {
+		taken = 0
+	}
+	return taken, before.LoyaltyPoints - taken, nil
+}
+
+// consume marks points as spent on the user's lots, oldest first, and
+// returns what it took from each lot. Points from before the ledger existed
+// have no lot, so running out of lots is not an error.
+func (s *PointsService) consume(ctx context.Context, userID primitive.ObjectID, points int) ([]models.PointsLotUse, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := s.ledgerCollection.Find(ctx, bson.M{"user_id": userID, "remaining": bson.M{"$gt": 0}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var lots []models.PointsEntry
+	if err := cursor.All(ctx, &lots); err != nil {
+		return nil, err
+	}
+
+	used := []models.PointsLotUse{}
+
+	for _, lot := range lots {
+		if points == 0 {
+			break
+		}
+		take := lot.Remaining
+		if take > points {
+			take = points
+		}
+		result, err := s.ledgerCollection.UpdateOne(ctx,
+			bson.M{"_id": lot.ID, "remaining": bson.M{"$gte": take}},
+			bson.M{"$inc": bson.M{"remaining": -take}},
+		)
+		if err != nil {
+			return used, err
+		}
+		if result.MatchedCount > 0 {
+			points -= take
+			used = append(used, models.PointsLotUse{LotID: lot.ID, Points: take})
+		}
+	}
+	return used, nil
+}
+
+func (s *PointsService) insert(ctx context.Context, entry models.PointsEntry) error {
+	entry.CreatedAt = time.Now()
+	if _, err := s.ledgerCollection.InsertOne(ctx, entry); err != nil {
+		log.Printf("Failed to write points ledger entry for %s: %v", entry.UserID.Hex(), err)
+		return err
+	}
+	return nil
+}
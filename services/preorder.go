@@ -0,0 +1,282 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errCaptureFailed = errors.New("payment capture failed")
+
+// PreorderService holds the payment of orders for books that are not
+// released yet and fulfils them once the books are out.
+type PreorderService struct {
+	ordersCollection     *mongo.Collection
+	orderItemsCollection *mongo.Collection
+	booksCollection      *mongo.Collection
+	gateway              PaymentGateway
+	libraryService       *LibraryService
+	notificationService  *NotificationService
+}
+
+func NewPreorderService(ordersCollection, orderItemsCollection, booksCollection *mongo.Collection, gateway PaymentGateway, libraryService *LibraryService, notificationService *NotificationService) *PreorderService {
+	return &PreorderService{
+		ordersCollection:     ordersCollection,
+		orderItemsCollection: orderItemsCollection,
+		booksCollection:      booksCollection,
+		gateway:              gateway,
+		libraryService:       libraryService,
+		notificationService:  notificationService,
+	}
+}
+
+// Authorize holds the amount due of a pre-order quote with the payment
+// gateway and returns the pre-order state to store on the order. What gift
+// cards and store credit pay is taken at checkout as for any order.
+func (s *PreorderService) Authorize(ctx context.Context, userID, orderID primitive.ObjectID, quote *models.PriceQuote) (*models.Preorder, error) {
+	preorder := &models.Preorder{
+		Status: models.PreorderAwaitingRelease,
+		Amount: quote.AmountDue,
+	}
+	for _, line := range quote.Lines {
+		if line.ReleaseDate != nil && line.ReleaseDate.After(preorder.ReleaseDate) {
+			preorder.ReleaseDate = *line.ReleaseDate
+		}
+	}
+	if quote.AmountDue > 0 {
+		id, err := s.gateway.Authorize(ctx, userID, quote.AmountDue, "Pre-order "+orderID.Hex())
+		if err != nil {
+			return nil, err
+		}
+		preorder.AuthorizationID = id
+	}
+	return preorder, nil
+}
+
+// Void gives up the payment held for a pre-order that will not be
+// released, because it was cancelled or could not be placed.
+func (s *PreorderService) Void(ctx context.Context, preorder *models.Preorder) error {
+	if preorder == nil || preorder.AuthorizationID == "" {
+		return nil
+	}
+	return s.gateway.Void(ctx, preorder.AuthorizationID)
+}
+
+// Refund pays back the payment captured for a released pre-order that was
+// cancelled.
+func (s *PreorderService) Refund(ctx context.Context, preorder *models.Preorder) error {
+	if preorder == nil || preorder.Status != models.PreorderReleased || preorder.AuthorizationID == "" {
+		return nil
+	}
+	return s.gateway.Refund(ctx, preorder.AuthorizationID, preorder.Amount)
+}
+
+// Release fulfils the pre-orders whose books are all out at now, oldest
+// first: stock is taken, the held payment is captured, e-books are granted
+// and the customer is notified. Release dates are read from the books on
+// every run, so a release that is brought forward or delayed is followed. A
+// pre-order that there is not enough stock for, or whose payment cannot be
+// captured, is left waiting and tried again on the next run. It returns the
+// number of orders released.
+func (s *PreorderService) Release(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := s.ordersCollection.Find(ctx,
+		bson.M{"preorder.status": models.PreorderAwaitingRelease, "status": bson.M{"$ne": "Cancelled"}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return 0, err
+	}
+
+	books := map[primitive.ObjectID]*models.Book{}
+	released, failed := 0, 0
+	for _, order := range orders {
+		if err := ctx.Err(); err != nil {
+			return released, err
+		}
+		items, ready, err := s.readyItems(ctx, order.ID, books, now)
+		if err != nil {
+			return released, err
+		}
+		if !ready {
+			continue
+		}
+		ok, err := s.release(ctx, order, items, books, now)
+		if errors.Is(err, errCaptureFailed) {
+			log.Printf("Pre-order %s: %v", order.ID.Hex(), err)
+			failed++
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		if ok {
+			released++
+		}
+	}
+	if failed > 0 {
+		return released, fmt.Errorf("%w for %d pre-orders", errCaptureFailed, failed)
+	}
+	return released, nil
+}
+
+// readyItems returns the items of an order and whether every one of them
+// is released. Books are cached in books for the rest of the run; a book
+// that was deleted holds the order back.
+func (s *PreorderService) readyItems(ctx context.Context, orderID primitive.ObjectID, books map[primitive.ObjectID]*models.Book, now time.Time) ([]models.OrderItem, bool, error) {
+	cursor, err := s.orderItemsCollection.Find(ctx, bson.M{"order_id": orderID})
+	if err != nil {
+		return nil, false, err
+	}
+	var items []models.OrderItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, false, err
+	}
+
+	for _, item := range items {
+		book, ok := books[item.BookID]
+		if !ok {
+			var found models.Book
+			err := s.booksCollection.FindOne(ctx, bson.M{"_id": item.BookID, "deleted_at": nil}).Decode(&found)
+			if err != nil && err != mongo.ErrNoDocuments {
+				return nil, false, err
+			}
+			if err == nil {
+				book = &found
+			}
+			books[item.BookID] = book
+		}
+		if book == nil {
+			return items, false, nil
+		}
+		format, ok := findFormat(*book, item.FormatType)
+		if !ok || !book.Released(format, now) {
+			return items, false, nil
+		}
+	}
+	return items, len(items) > 0, nil
+}
+
+// release claims a pre-order, so a concurrent cancellation or run cannot
+// act on it too, takes its stock, captures its payment and fulfils it. It
+// reports false when the order was cancelled or released in the meantime,
+// or is short of stock.
+func (s *PreorderService) release(ctx context.Context, order models.Order, items []models.OrderItem, books map[primitive.ObjectID]*models.Book, now time.Time) (bool, error) {
+	result, err := s.ordersCollection.UpdateOne(ctx,
+		bson.M{"_id": order.ID, "preorder.status": models.PreorderAwaitingRelease, "status": bson.M{"$ne": "Cancelled"}},
+		bson.M{
+			"$set":   bson.M{"preorder.status": models.PreorderReleased, "preorder.released_at": now, "updated_at": now},
+			"$unset": bson.M{"preorder.capture_error": "", "preorder.waiting_for_stock": ""},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, nil
+	}
+
+	// stock is taken before the payment, so an order that cannot be filled
+	// yet keeps its payment held until the book is restocked
+	taken, err := s.takeStock(ctx, items)
+	if err != nil {
+		if uerr := s.unclaim(ctx, order.ID, bson.M{}); uerr != nil {
+			return false, uerr
+		}
+		return false, err
+	}
+	if !taken {
+		return false, s.unclaim(ctx, order.ID, bson.M{"preorder.waiting_for_stock": true})
+	}
+
+	if id := order.Preorder.AuthorizationID; id != "" {
+		if err := s.gateway.Capture(ctx, id, order.Preorder.Amount); err != nil {
+			s.putBackStock(ctx, items)
+			if uerr := s.unclaim(ctx, order.ID, bson.M{"preorder.capture_error": err.Error()}); uerr != nil {
+				return false, uerr
+			}
+			return false, fmt.Errorf("%w: %v", errCaptureFailed, err)
+		}
+	}
+
+	var titles []string
+	digital, physical := false, false
+	for _, item := range items {
+		if err := s.libraryService.Grant(ctx, order.UserID, item.BookID, item.FormatType, order.ID); err != nil {
+			log.Printf("Failed to grant book %s of pre-order %s: %v", item.BookID.Hex(), order.ID.Hex(), err)
+		}
+
+		digital = digital || item.FormatType != "physical"
+		physical = physical || GoodsCategory(item.FormatType) == GoodsPhysical
+		if book := books[item.BookID]; book != nil {
+			titles = append(titles, fmt.Sprintf("%q", book.Title))
+		}
+	}
+
+	message := strings.Join(titles, ", ") + " is out now"
+	switch {
+	case digital && physical:
+		message += ": e-books are in your library and printed copies will ship shortly."
+	case digital:
+		message += " and waiting in your library."
+	default:
+		message += " and your copy will ship shortly."
+	}
+	if err := s.notificationService.Notify(ctx, order.UserID, models.NotificationPreorderReleased, "Your pre-order is here", message); err != nil {
+		log.Printf("Failed to notify user %s of pre-order %s: %v", order.UserID.Hex(), order.ID.Hex(), err)
+	}
+	return true, nil
+}
+
+// unclaim puts a claimed pre-order back to waiting for release, with set
+// recording why.
+func (s *PreorderService) unclaim(ctx context.Context, orderID primitive.ObjectID, set bson.M) error {
+	set["preorder.status"] = models.PreorderAwaitingRelease
+	_, err := s.ordersCollection.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{
+		"$set":   set,
+		"$unset": bson.M{"preorder.released_at": ""},
+	})
+	return err
+}
+
+// takeStock takes the units of every item from stock, or none of them. It
+// reports false when a format does not have enough units left.
+func (s *PreorderService) takeStock(ctx context.Context, items []models.OrderItem) (bool, error) {
+	for i, item := range items {
+		result, err := s.booksCollection.UpdateOne(ctx,
+			bson.M{"_id": item.BookID, "formats": bson.M{"$elemMatch": bson.M{
+				"type":           item.FormatType,
+				"stock_quantity": bson.M{"$gte": item.Quantity},
+			}}},
+			bson.M{"$inc": bson.M{"formats.$.stock_quantity": -item.Quantity}},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			s.putBackStock(ctx, items[:i])
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *PreorderService) putBackStock(ctx context.Context, items []models.OrderItem) {
+	for _, item := range items {
+		_, err := s.booksCollection.UpdateOne(ctx, bson.M{"_id": item.BookID, "formats.type": item.FormatType}, bson.M{
+			"$inc": bson.M{"formats.$.stock_quantity": item.Quantity},
+		})
+		if err != nil {
+			log.Printf("Failed to put back stock of book %s: %v", item.BookID.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	Currency            = "USD"
+	PremiumDiscountRate = 0.10
+)
+
+// ErrInvalidBasket wraps every pricing error caused by the request itself
+// (unknown book, missing format, not enough stock) as opposed to database
+// failures.
+var ErrInvalidBasket = errors.New("invalid basket")
+
+type QuoteInput struct {
+	UserID         primitive.ObjectID
+	Items          []models.CreateOrderItem
+	CouponCodes    []string
+	RedeemPoints   int
+	GiftCardCodes  []string
+	UseStoreCredit bool
+	Address        *models.Address
+	ShippingMethod string
+}
+
+type PricingService struct {
+	booksCollection  *mongo.Collection
+	usersCollection  *mongo.Collection
+	promotionService *PromotionService
+	taxService       *TaxService
+	shippingService  *ShippingService
+	pointsService    *PointsService
+	loyaltyService   *LoyaltyService
+	creditService    *CreditService
+}
+
+func NewPricingService(
+	booksCollection,
+	usersCollection *mongo.Collection,
+	promotionService *PromotionService,
+	taxService *TaxService,
+	shippingService *ShippingService,
+	pointsService *PointsService,
+	loyaltyService *LoyaltyService,
+	creditService *CreditService,
+) *PricingService {
+	return &PricingService{
+		booksCollection:  booksCollection,
+		usersCollection:  usersCollection,
+		promotionService: promotionService,
+		taxService:       taxService,
+		shippingService:  shippingService,
+		pointsService:    pointsService,
+		loyaltyService:   loyaltyService,
+		creditService:    creditService,
+	}
+}
+
+// Quote prices a basket line by line. Discounts are applied in a fixed
+// order: promotions on the subtotal, then the premium discount, then the
+// loyalty tier discount on whatever is left, and finally redeemed points.
+// Tax is charged on the discounted amount; shipping is only charged when the
+// basket contains physical copies, is waived by tiers with free shipping and
+// is not taxed. Gift cards and store credit then pay what they can of the
+// grand total. Books that are not released yet are pre-ordered, which is
+// done in an order of their own. The applied promotions are returned
+// separately so checkout can redeem them.
+func (s *PricingService) Quote(ctx context.Context, in QuoteInput) (*models.PriceQuote, []models.AppliedPromotion, error) {
+	if len(in.Items) == 0 {
+		return nil, nil, fmt.Errorf("%w: no items", ErrInvalidBasket)
+	}
+
+	quote := &models.PriceQuote{
+		Currency:  Currency,
+		Lines:     []models.PriceLine{},
+		Discounts: []models.PriceAdjustment{},
+		TaxLines:  []models.TaxLine{},
+	}
+	var promotionLines []PromotionLine
+
+	for _, item := range in.Items {
+		bookID, err := primitive.ObjectIDFromHex(item.BookID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: invalid book ID %q", ErrInvalidBasket, item.BookID)
+		}
+		if item.GiftRecipientEmail != "" && (item.FormatType != "digital" || item.Quantity != 1) {
+			return nil, nil, fmt.Errorf("%w: only single digital copies can be sent as gifts", ErrInvalidBasket)
+		}
+		if item.FormatType == "rental" && item.Quantity != 1 {
+			return nil, nil, fmt.Errorf("%w: a book can only be rented once per order", ErrInvalidBasket)
+		}
+
+		var book models.Book
+		err = s.booksCollection.FindOne(ctx, bson.M{"_id": bookID, "deleted_at": nil}).Decode(&book)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, nil, fmt.Errorf("%w: book %s not found", ErrInvalidBasket, item.BookID)
+			}
+			return nil, nil, err
+		}
+
+		format, found := findFormat(book, item.FormatType)
+		if !found {
+			return nil, nil, fmt.Errorf("%w: format %s not available for %q", ErrInvalidBasket, item.FormatType, book.Title)
+		}
+		// stock of an upcoming book is only taken on its release
+		preorder := !book.Released(format, time.Now())
+		if preorder {
+			if item.FormatType == "rental" || item.GiftRecipientEmail != "" {
+				return nil, nil, fmt.Errorf("%w: %q is not released yet and can only be pre-ordered for yourself", ErrInvalidBasket, book.Title)
+			}
+		} else if format.StockQuantity < item.Quantity {
+			return nil, nil, fmt.Errorf("%w: insufficient stock for format %s of %q", ErrInvalidBasket, format.Type, book.Title)
+		}
+
+		unitPrice := format.Price
+		if item.FormatType == "rental" {
+			price, ok := format.RentalPriceFor(item.RentalDays)
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: %q cannot be rented for %d days", ErrInvalidBasket, book.Title, item.RentalDays)
+			}
+			unitPrice = price
+		}
+		line := models.PriceLine{
+			BookID:     bookID,
+			Title:      book.Title,
+			FormatType: item.FormatType,
+			Quantity:   item.Quantity,
+			UnitPrice:  unitPrice,
+			Total:      unitPrice * models.Money(item.Quantity),
+		}
+		if GoodsCategory(item.FormatType) == GoodsPhysical {
+			line.WeightGrams = format.WeightGrams
+		}
+		if item.FormatType == "rental" {
+			line.RentalDays = item.RentalDays
+		}
+		if preorder {
+			line.ReleaseDate = book.ReleaseDateOf(format)
+		}
+		if len(quote.Lines) > 0 && (line.ReleaseDate != nil) != quote.IsPreorder() {
+			return nil, nil, fmt.Errorf("%w: pre-orders must be placed separately from books that are already out", ErrInvalidBasket)
+		}
+		quote.Lines = append(quote.Lines, line)
+		quote.Subtotal += line.Total
+
+		promotionLines = append(promotionLines, PromotionLine{
+			BookID:       bookID,
+			Category:     book.Category,
+			CategoryPath: book.CategoryPath,
+			Authors:      book.AuthorNames(),
+			Quantity:     item.Quantity,
+			UnitPrice:    unitPrice,
+		})
+	}
+
+	promotions, err := s.promotionService.Evaluate(ctx, in.UserID, promotionLines, in.CouponCodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	remaining := quote.Subtotal
+	for _, p := range promotions {
+		id := p.PromotionID
+		label := p.Name
+		if p.Code != "" {
+			label = p.Name + " (" + p.Code + ")"
+		}
+		addDiscount(quote, models.PriceAdjustment{
+			Source:      models.DiscountSourcePromotion,
+			Label:       label,
+			PromotionID: &id,
+			Amount:      p.Amount,
+		})
+		remaining -= p.Amount
+	}
+
+	// premium is read from the user rather than the token, which may
+	// predate an expiry or a new subscription
+	var user models.User
+	err = s.usersCollection.FindOne(ctx, bson.M{"_id": in.UserID}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, nil, err
+	}
+
+	if user.HasPremium(time.Now()) {
+		amount := remaining.Percent(PremiumDiscountRate)
+		addDiscount(quote, models.PriceAdjustment{
+			Source: models.DiscountSourcePremium,
+			Label:  "Premium member discount",
+			Amount: amount,
+		})
+		remaining -= amount
+	}
+	tier, err := s.loyaltyService.TierFor(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tier != nil && tier.Discount > 0 {
+		amount := remaining.Percent(tier.Discount)
+		addDiscount(quote, models.PriceAdjustment{
+			Source: models.DiscountSourceLoyalty,
+			Label:  tier.Name + " loyalty discount",
+			Amount: amount,
+		})
+		remaining -= amount
+	}
+
+	// redeemed points pay for what is left, never more than that
+	if in.RedeemPoints > 0 {
+		if in.RedeemPoints > user.LoyaltyPoints {
+			return nil, nil, fmt.Errorf("%w: only %d loyalty points available", ErrInvalidBasket, user.LoyaltyPoints)
+		}
+		value := s.pointsService.PointValue()
+		if value <= 0 {
+			return nil, nil, fmt.Errorf("%w: loyalty points cannot be redeemed", ErrInvalidBasket)
+		}
+		points := in.RedeemPoints
+		if models.Money(points)*value > remaining {
+			points = int(remaining / value)
+		}
+		if points > 0 {
+			quote.PointsRedeemed = points
+			addDiscount(quote, models.PriceAdjustment{
+				Source: models.DiscountSourcePoints,
+				Label:  fmt.Sprintf("%d loyalty points", points),
+				Amount: models.Money(points) * value,
+			})
+		}
+	}
+
+	if in.Address != nil {
+		if err := in.Address.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidBasket, err)
+		}
+	}
+
+	if RequiresShipping(quote.Lines) {
+		code := in.ShippingMethod
+		if code == "" {
+			code = DefaultShippingMethod
+		}
+		method, err := s.shippingService.Method(ctx, code)
+		if err != nil {
+			return nil, nil, err
+		}
+		if method.RequiresAddress && in.Address == nil {
+			return nil, nil, fmt.Errorf("%w: %s needs a shipping address", ErrInvalidBasket, method.Name)
+		}
+		quote.ShippingMethod = method.Code
+		quote.Shipping, err = s.shippingService.Rate(method, in.Address, quote.Lines, quote.Subtotal-quote.DiscountTotal)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tier != nil && tier.FreeShipping {
+			quote.Shipping = 0
+		}
+	}
+
+	quote.TaxLines, quote.Tax, err = s.taxService.Calculate(ctx, in.Address, quote.Lines, quote.Subtotal, quote.DiscountTotal)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quote.GrandTotal = quote.Subtotal - quote.DiscountTotal + quote.Tax + quote.Shipping
+
+	quote.Payments, err = s.creditService.PlanPayments(ctx, in.UserID, in.GiftCardCodes, in.UseStoreCredit, quote.GrandTotal)
+	if err != nil {
+		return nil, nil, err
+	}
+	quote.AmountDue = quote.GrandTotal
+	for _, p := range quote.Payments {
+		quote.AmountDue -= p.Amount
+	}
+	return quote, promotions, nil
+}
+
+// RefundShare is the part of what the customer paid that belongs to gross
+// worth of merchandise: discounts and tax are spread proportionally and
+// shipping is kept.
+func RefundShare(order models.Order, gross models.Money) models.Money {
+	if order.Pricing == nil || order.Pricing.Subtotal <= 0 {
+		return gross
+	}
+	paid := order.Pricing.GrandTotal - order.Pricing.Shipping
+	return models.Money(int64(paid) * int64(gross) / int64(order.Pricing.Subtotal))
+}
+
+func addDiscount(q *models.PriceQuote, adj models.PriceAdjustment) {
+	if adj.Amount <= 0 {
+		return
+	}
+	q.Discounts = append(q.Discounts, adj)
+	q.DiscountTotal += adj.Amount
+}
+
+func findFormat(book models.Book, formatType string) (models.BookFormat, bool) {
+	for _, f := range book.Formats {
+		if f.Type == formatType {
+			return f, true
+		}
+	}
+	return models.BookFormat{}, false
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidCoupon        = errors.New("invalid coupon")
+	ErrPromotionUnavailable = errors.New("promotion is no longer available")
+)
+
+// PromotionLine is a basket line as seen by the promotion engine.
+type PromotionLine struct {
+	BookID   primitive.ObjectID
+	Category string
+	// CategoryPath is the book's category and its ancestors.
+	CategoryPath []primitive.ObjectID
+	Authors      []string
+	Quantity     int
+	UnitPrice    models.Money
+}
+
+type PromotionService struct {
+	promotionsCollection  *mongo.Collection
+	redemptionsCollection *mongo.Collection
+}
+
+func NewPromotionService(promotionsCollection, redemptionsCollection *mongo.Collection) *PromotionService {
+	return &PromotionService{
+		promotionsCollection:  promotionsCollection,
+		redemptionsCollection: redemptionsCollection,
+	}
+}
+
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Evaluate returns the promotions that apply to the basket. Every coupon in
+// codes must be valid, otherwise an error describing the first bad coupon is
+// returned. Stackable promotions are summed; an exclusive promotion is only
+// chosen when it beats the stackable total on its own.
+func (s *PromotionService) Evaluate(ctx context.Context, userID primitive.ObjectID, lines []PromotionLine, codes []string) ([]models.AppliedPromotion, error) {
+	now := time.Now()
+
+	requested := make(map[string]bool)
+	var codeList []string
+	for _, code := range codes {
+		code = NormalizeCouponCode(code)
+		if code == "" || requested[code] {
+			continue
+		}
+		requested[code] = true
+		codeList = append(codeList, code)
+	}
+
+	codeFilter := []bson.M{{"code": bson.M{"$exists": false}}}
+	if len(codeList) > 0 {
+		codeFilter = append(codeFilter, bson.M{"code": bson.M{"$in": codeList}})
+	}
+
+	cursor, err := s.promotionsCollection.Find(ctx, bson.M{
+		"is_active": true,
+		"starts_at": bson.M{"$lte": now},
+		"$and": []bson.M{
+			{"$or": []bson.M{{"ends_at": nil}, {"ends_at": bson.M{"$gt": now}}}},
+			{"$or": codeFilter},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var promotions []models.Promotion
+	if err := cursor.All(ctx, &promotions); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for _, p := range promotions {
+		if p.Code != "" {
+			found[p.Code] = true
+		}
+	}
+	for _, code := range codeList {
+		if !found[code] {
+			return nil, fmt.Errorf("%w: %s is unknown or expired", ErrInvalidCoupon, code)
+		}
+	}
+
+	var basketTotal models.Money
+	var basketItems int
+	for _, line := range lines {
+		basketTotal += line.UnitPrice * models.Money(line.Quantity)
+		basketItems += line.Quantity
+	}
+
+	var stackable []models.AppliedPromotion
+	var bestExclusive *models.AppliedPromotion
+
+	sort.SliceStable(promotions, func(i, j int) bool {
+		return promotions[i].Priority > promotions[j].Priority
+	})
+
+	for _, p := range promotions {
+		reason := ""
+		switch {
+		case p.MinBasketAmount > 0 && basketTotal < p.MinBasketAmount:
+			reason = fmt.Sprintf("requires a minimum basket of %s", p.MinBasketAmount)
+		case p.MinBasketItems > 0 && basketItems < p.MinBasketItems:
+			reason = fmt.Sprintf("requires at least %d items", p.MinBasketItems)
+		case p.UsageLimit > 0 && p.UsageCount >= p.UsageLimit:
+			reason = "has reached its usage limit"
+		}
+		if reason == "" && p.PerUserLimit > 0 {
+			used, err := s.redemptionsCollection.CountDocuments(ctx, bson.M{"promotion_id": p.ID, "user_id": userID})
+			if err != nil {
+				return nil, err
+			}
+			if int(used) >= p.PerUserLimit {
+				reason = "has already been used the maximum number of times"
+			}
+		}
+		if reason != "" {
+			if p.Code != "" {
+				return nil, fmt.Errorf("%w: %s %s", ErrInvalidCoupon, p.Code, reason)
+			}
+			continue
+		}
+
+		amount := promotionAmount(p, lines)
+		if amount <= 0 {
+			if p.Code != "" {
+				return nil, fmt.Errorf("%w: %s does not apply to any item in the basket", ErrInvalidCoupon, p.Code)
+			}
+			continue
+		}
+
+		applied := models.AppliedPromotion{
+			PromotionID: p.ID,
+			Code:        p.Code,
+			Name:        p.Name,
+			Type:        p.Type,
+			Amount:      amount,
+		}
+		if p.Stackable {
+			stackable = append(stackable, applied)
+		} else if bestExclusive == nil || applied.Amount > bestExclusive.Amount {
+			bestExclusive = &applied
+		}
+	}
+
+	var stackableTotal models.Money
+	for _, a := range stackable {
+		stackableTotal += a.Amount
+	}
+
+	result := stackable
+	if bestExclusive != nil && bestExclusive.Amount > stackableTotal {
+		result = []models.AppliedPromotion{*bestExclusive}
+	}
+
+	// never discount more than the basket is worth
+	remaining := basketTotal
+	for i := range result {
+		if result[i].Amount > remaining {
+			result[i].Amount = remaining
+		}
+		remaining -= result[i].Amount
+	}
+
+	return result, nil
+}
+
+// Redeem records usage of the applied promotions for an order. The usage
+// counter is only incremented while it is below the limit, and each of a
+// user's redemptions takes one of a limited number of slots, so concurrent
+// checkouts cannot overshoot a promotion's total or per-user limit.
+func (s *PromotionService) Redeem(ctx context.Context, userID, orderID primitive.ObjectID, applied []models.AppliedPromotion) error {
+	for i, a := range applied {
+		var p models.Promotion
+		err := s.promotionsCollection.FindOneAndUpdate(ctx, bson.M{
+			"_id": a.PromotionID,
+			"$or": []bson.M{
+				{"usage_limit": 0},
+				{"$expr": bson.M{"$lt": []string{"$usage_count", "$usage_limit"}}},
+			},
+		}, bson.M{"$inc": bson.M{"usage_count": 1}}).Decode(&p)
+		if err == mongo.ErrNoDocuments {
+			err = ErrPromotionUnavailable
+		}
+		if err == nil {
+			err = s.insertRedemption(ctx, p, models.PromotionRedemption{
+				PromotionID: a.PromotionID,
+				UserID:      userID,
+				OrderID:     orderID,
+				Amount:      a.Amount,
+				CreatedAt:   time.Now(),
+			})
+			if err != nil {
+				_, _ = s.promotionsCollection.UpdateOne(ctx, bson.M{"_id": a.PromotionID}, bson.M{"$inc": bson.M{"usage_count": -1}})
+			}
+		}
+		if err != nil {
+			s.Release(ctx, orderID, applied[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// insertRedemption stores a redemption of p. With a per-user limit it takes
+// the user's first free slot; a unique index on the slots keeps two
+// checkouts from taking the same one.
+func (s *PromotionService) insertRedemption(ctx context.Context, p models.Promotion, redemption models.PromotionRedemption) error {
+	if p.PerUserLimit <= 0 {
+		_, err := s.redemptionsCollection.InsertOne(ctx, redemption)
+		return err
+	}
+	for slot := 1; slot <= p.PerUserLimit; slot++ {
+		redemption.Slot = slot
+		_, err := s.redemptionsCollection.InsertOne(ctx, redemption)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return ErrPromotionUnavailable
+}
+
+// Release undoes Redeem, e.g. when the order could not be stored or was cancelled.
+func (s *PromotionService) Release(ctx context.Context, orderID primitive.ObjectID, applied []models.AppliedPromotion) {
+	for _, a := range applied {
+		_, _ = s.promotionsCollection.UpdateOne(ctx, bson.M{"_id": a.PromotionID}, bson.M{"$inc": bson.M{"usage_count": -1}})
+		_, _ = s.redemptionsCollection.DeleteOne(ctx, bson.M{"promotion_id": a.PromotionID, "order_id": orderID})
+	}
+}
+
+func promotionAmount(p models.Promotion, lines []PromotionLine) models.Money {
+	var eligible []PromotionLine
+	var eligibleTotal models.Money
+	for _, line := range lines {
+		if inScope(p.Scope, line) {
+			eligible = append(eligible, line)
+			eligibleTotal += line.UnitPrice * models.Money(line.Quantity)
+		}
+	}
+	if len(eligible) == 0 {
+		return 0
+	}
+
+	var amount models.Money
+	switch p.Type {
+	case models.PromotionTypePercentage:
+		amount = eligibleTotal.Percent(p.Percent / 100)
+	case models.PromotionTypeFixed:
+		amount = min(p.Amount, eligibleTotal)
+	case models.PromotionTypeBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return 0
+		}
+		// the cheapest eligible units are the free ones
+		var units []models.Money
+		for _, line := range eligible {
+			for i := 0; i < line.Quantity; i++ {
+				units = append(units, line.UnitPrice)
+			}
+		}
+		sort.Slice(units, func(i, j int) bool { return units[i] < units[j] })
+		free := len(units) / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+		for i := 0; i < free; i++ {
+			amount += units[i]
+		}
+	}
+	return amount
+}
+
+func inScope(scope models.PromotionScope, line PromotionLine) bool {
+	if len(scope.Categories) == 0 && len(scope.Authors) == 0 && len(scope.BookIDs) == 0 {
+		return true
+	}
+	for _, id := range scope.CategoryIDs {
+		for _, pathID := range line.CategoryPath {
+			if id == pathID {
+				return true
+			}
+		}
+	}
+	for _, id := range scope.BookIDs {
+		if id == line.BookID {
+			return true
+		}
+	}
+	for _, category := range scope.Categories {
+		if strings.EqualFold(category, line.Category) {
+			return true
+		}
+	}
+	for _, author := range scope.Authors {
+		for _, name := range line.Authors {
+			if models.AuthorKey(author) == models.AuthorKey(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
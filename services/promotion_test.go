@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bookstore/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPromotionAmount(t *testing.T) {
+	bookID := primitive.NewObjectID()
+	fiction, fantasy := primitive.NewObjectID(), primitive.NewObjectID()
+	lines := []PromotionLine{
+		{BookID: bookID, Category: "Fantasy", CategoryPath: []primitive.ObjectID{fiction, fantasy}, Authors: []string{"Ann Author"}, Quantity: 2, UnitPrice: 1000},
+		{BookID: primitive.NewObjectID(), Category: "History", Authors: []string{"Bob Writer"}, Quantity: 1, UnitPrice: 2500},
+		{BookID: primitive.NewObjectID(), Category: "Fiction", Authors: []string{"Cy Novelist"}, Quantity: 1, UnitPrice: 799},
+	}
+
+	tests := []struct {
+		name  string
+		promo models.Promotion
+		lines []PromotionLine
+		want  models.Money
+	}{
+		{
+			name:  "percentage of the whole basket",
+			promo: models.Promotion{Type: models.PromotionTypePercentage, Percent: 10},
+			lines: lines,
+			want:  530, // 10% of 52.99, rounded
+		},
+		{
+			name:  "percentage of a category matched by name only",
+			promo: models.Promotion{Type: models.PromotionTypePercentage, Percent: 25, Scope: models.PromotionScope{Categories: []string{"fiction"}}},
+			lines: lines,
+			want:  200, // 25% of 7.99, rounded
+		},
+		{
+			name:  "percentage of a category subtree",
+			promo: models.Promotion{Type: models.PromotionTypePercentage, Percent: 50, Scope: models.PromotionScope{Categories: []string{"Fiction"}, CategoryIDs: []primitive.ObjectID{fiction}}},
+			lines: lines,
+			want:  1400, // 50% of 20.00 in Fiction > Fantasy and 7.99 in Fiction, rounded
+		},
+		{
+			name:  "fixed amount",
+			promo: models.Promotion{Type: models.PromotionTypeFixed, Amount: 500},
+			lines: lines,
+			want:  500,
+		},
+		{
+			name:  "fixed amount capped at the eligible total",
+			promo: models.Promotion{Type: models.PromotionTypeFixed, Amount: 5000, Scope: models.PromotionScope{BookIDs: []primitive.ObjectID{bookID}}},
+			lines: lines,
+			want:  2000,
+		},
+		{
+			name:  "fixed amount scoped to an author",
+			promo: models.Promotion{Type: models.PromotionTypeFixed, Amount: 1000, Scope: models.PromotionScope{Authors: []string{"bob writer"}}},
+			lines: lines,
+			want:  1000,
+		},
+		{
+			name:  "buy 2 get 1 makes the cheapest unit free",
+			promo: models.Promotion{Type: models.PromotionTypeBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			lines: lines,
+			want:  799,
+		},
+		{
+			name:  "buy 1 get 1 makes the cheaper half free",
+			promo: models.Promotion{Type: models.PromotionTypeBuyXGetY, BuyQuantity: 1, GetQuantity: 1},
+			lines: lines,
+			want:  1799,
+		},
+		{
+			name:  "buy x get y without enough units",
+			promo: models.Promotion{Type: models.PromotionTypeBuyXGetY, BuyQuantity: 4, GetQuantity: 1},
+			lines: lines,
+			want:  0,
+		},
+		{
+			name:  "buy x get y without quantities",
+			promo: models.Promotion{Type: models.PromotionTypeBuyXGetY},
+			lines: lines,
+			want:  0,
+		},
+		{
+			name:  "nothing in scope",
+			promo: models.Promotion{Type: models.PromotionTypePercentage, Percent: 50, Scope: models.PromotionScope{Categories: []string{"Poetry"}}},
+			lines: lines,
+			want:  0,
+		},
+		{
+			name:  "empty basket",
+			promo: models.Promotion{Type: models.PromotionTypeFixed, Amount: 500},
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := promotionAmount(tt.promo, tt.lines); got != tt.want {
+				t.Errorf("promotionAmount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,556 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxRecommendations is how many books are kept per book and per user.
+	MaxRecommendations = 20
+	// copurchaseBooksPerCustomer caps the books of one customer paired up
+	// when counting co-purchases, so a few very large libraries neither
+	// dominate the counts nor blow up the run.
+	copurchaseBooksPerCustomer = 200
+	// similarCandidates is how many of the best rated books by the same
+	// author, or in the same category, are considered for a book.
+	similarCandidates = 20
+	// recommendationBatch is how many cached lists are written at a time.
+	recommendationBatch = 500
+)
+
+// How much each signal adds to the score of a related book. Co-purchases
+// count relative to the book's most frequent co-purchase, so scores stay
+// between 0 and 1.
+const (
+	copurchaseWeight   = 0.6
+	sameAuthorWeight   = 0.25
+	sameCategoryWeight = 0.15
+)
+
+// popularID keys the list of best sellers in the recommendations cache;
+// it is shown to users who have no recommendations of their own.
+var popularID = primitive.NilObjectID
+
+// RecommendationService precomputes related books and personal
+// recommendations and serves them from a cache, so requests only read one
+// document. Related books come from co-purchases (books bought by the same
+// customers) and from sharing an author or category; personal
+// recommendations add up the related books of everything in a user's
+// library and wishlist.
+type RecommendationService struct {
+	orderItemsCollection      *mongo.Collection
+	booksCollection           *mongo.Collection
+	digitalAccessCollection   *mongo.Collection
+	wishlistCollection        *mongo.Collection
+	relatedCollection         *mongo.Collection
+	recommendationsCollection *mongo.Collection
+}
+
+func NewRecommendationService(orderItemsCollection, booksCollection, digitalAccessCollection, wishlistCollection, relatedCollection, recommendationsCollection *mongo.Collection) *RecommendationService {
+	return &RecommendationService{
+		orderItemsCollection:      orderItemsCollection,
+		booksCollection:           booksCollection,
+		digitalAccessCollection:   digitalAccessCollection,
+		wishlistCollection:        wishlistCollection,
+		relatedCollection:         relatedCollection,
+		recommendationsCollection: recommendationsCollection,
+	}
+}
+
+// Related returns the cached books related to a book, best first. A book
+// added since the last run has none yet.
+func (s *RecommendationService) Related(ctx context.Context, bookID primitive.ObjectID, limit int) ([]models.Recommendation, error) {
+	var related models.RelatedBooks
+	err := s.relatedCollection.FindOne(ctx, bson.M{"_id": bookID}).Decode(&related)
+	if err == mongo.ErrNoDocuments {
+		count, err := s.booksCollection.CountDocuments(ctx, bson.M{"_id": bookID, "deleted_at": nil})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrBookNotFound
+		}
+		return []models.Recommendation{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.resolve(ctx, related.Books, nil, limit)
+}
+
+// ForUser returns a user's cached recommendations, best first, or the best
+// sellers when there are none. Books the user has bought or wished for
+// since the last run are left out.
+func (s *RecommendationService) ForUser(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.Recommendation, error) {
+	var cached models.UserRecommendations
+	err := s.recommendationsCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&cached)
+	if err == mongo.ErrNoDocuments {
+		err = s.recommendationsCollection.FindOne(ctx, bson.M{"_id": popularID}).Decode(&cached)
+	}
+	if err == mongo.ErrNoDocuments {
+		return []models.Recommendation{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	owned, err := distinctIDs(ctx, s.digitalAccessCollection, "book_id", bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	wished, err := distinctIDs(ctx, s.wishlistCollection, "book_id", bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	exclude := map[primitive.ObjectID]bool{}
+	for _, id := range append(owned, wished...) {
+		exclude[id] = true
+	}
+	return s.resolve(ctx, cached.Books, exclude, limit)
+}
+
+// resolve turns cached scores into recommendations, dropping books that
+// were deleted since the last run and those in exclude.
+func (s *RecommendationService) resolve(ctx context.Context, scored []models.ScoredBook, exclude map[primitive.ObjectID]bool, limit int) ([]models.Recommendation, error) {
+	ids := make([]primitive.ObjectID, 0, len(scored))
+	for _, b := range scored {
+		if !exclude[b.BookID] {
+			ids = append(ids, b.BookID)
+		}
+	}
+	links, err := bookLinks(ctx, s.booksCollection, ids)
+	if err != nil {
+		return nil, err
+	}
+	recommendations := []models.Recommendation{}
+	for _, b := range scored {
+		link, ok := links[b.BookID]
+		if !ok || exclude[b.BookID] {
+			continue
+		}
+		recommendations = append(recommendations, models.Recommendation{
+			BookLink:  link,
+			Score:     b.Score,
+			Reasons:   b.Reasons,
+			BecauseOf: b.BecauseOf,
+		})
+		if len(recommendations) == limit {
+			break
+		}
+	}
+	return recommendations, nil
+}
+
+// bookFeatures is what the similarity signals need of a book.
+type bookFeatures struct {
+	ID           primitive.ObjectID  `bson:"_id"`
+	Authors      []models.BookAuthor `bson:"authors"`
+	CategoryID   *primitive.ObjectID `bson:"category_id"`
+	WorkID       *primitive.ObjectID `bson:"work_id"`
+	Rating       float64             `bson:"rating"`
+	TotalRatings int                 `bson:"total_ratings"`
+}
+
+// Compute rebuilds the related books of every book in the catalog, the
+// personal recommendations of every user with a library or wishlist and
+// the best sellers. Lists left from books and users that no longer qualify
+// are removed. It returns the number of books and users computed.
+func (s *RecommendationService) Compute(ctx context.Context, now time.Time) (int, int, error) {
+	books, err := s.catalogFeatures(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	copurchases, err := s.copurchases(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	byAuthor := map[primitive.ObjectID][]*bookFeatures{}
+	byCategory := map[primitive.ObjectID][]*bookFeatures{}
+	for _, b := range books {
+		for _, a := range b.Authors {
+			if !a.AuthorID.IsZero() {
+				byAuthor[a.AuthorID] = append(byAuthor[a.AuthorID], b)
+			}
+		}
+		if b.CategoryID != nil {
+			byCategory[*b.CategoryID] = append(byCategory[*b.CategoryID], b)
+		}
+	}
+	for _, group := range []map[primitive.ObjectID][]*bookFeatures{byAuthor, byCategory} {
+		for key, list := range group {
+			sort.SliceStable(list, func(i, j int) bool { return betterRated(list[i], list[j]) })
+			if len(list) > similarCandidates+1 {
+				group[key] = list[:similarCandidates+1]
+			}
+		}
+	}
+
+	related := map[primitive.ObjectID][]models.ScoredBook{}
+	var writes []mongo.WriteModel
+	for id, book := range books {
+		scores := newScoreBoard()
+		if counts := copurchases[id]; len(counts) > 0 {
+			most := 0
+			for _, n := range counts {
+				most = max(most, n)
+			}
+			for other, n := range counts {
+				scores.add(other, copurchaseWeight*float64(n)/float64(most), models.ReasonBoughtTogether, nil)
+			}
+		}
+		seen := map[primitive.ObjectID]bool{}
+		for _, a := range book.Authors {
+			for _, other := range byAuthor[a.AuthorID] {
+				if !seen[other.ID] {
+					seen[other.ID] = true
+					scores.add(other.ID, sameAuthorWeight, models.ReasonSameAuthor, nil)
+				}
+			}
+		}
+		if book.CategoryID != nil {
+			for _, other := range byCategory[*book.CategoryID] {
+				scores.add(other.ID, sameCategoryWeight, models.ReasonSameCategory, nil)
+			}
+		}
+
+		list := scores.top(func(other primitive.ObjectID) bool {
+			o, ok := books[other]
+			// other editions are already linked from the book's page
+			return ok && other != id && !(book.WorkID != nil && o.WorkID != nil && *book.WorkID == *o.WorkID)
+		}, books)
+		related[id] = list
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetReplacement(models.RelatedBooks{BookID: id, Books: list, ComputedAt: now}).
+			SetUpsert(true))
+		if len(writes) == recommendationBatch {
+			if err := s.write(ctx, s.relatedCollection, writes); err != nil {
+				return 0, 0, err
+			}
+			writes = writes[:0]
+		}
+	}
+	if err := s.write(ctx, s.relatedCollection, writes); err != nil {
+		return 0, 0, err
+	}
+	if _, err := s.relatedCollection.DeleteMany(ctx, bson.M{"computed_at": bson.M{"$lt": now}}); err != nil {
+		return 0, 0, err
+	}
+
+	users, err := s.computeUsers(ctx, books, related, now)
+	if err != nil {
+		return len(books), 0, err
+	}
+	if err := s.computePopular(ctx, books, now); err != nil {
+		return len(books), users, err
+	}
+	if _, err := s.recommendationsCollection.DeleteMany(ctx, bson.M{"computed_at": bson.M{"$lt": now}}); err != nil {
+		return len(books), users, err
+	}
+	return len(books), users, nil
+}
+
+// computeUsers adds up, for every user with a library or wishlist, the
+// related books of each book they have or wish for.
+func (s *RecommendationService) computeUsers(ctx context.Context, books map[primitive.ObjectID]*bookFeatures, related map[primitive.ObjectID][]models.ScoredBook, now time.Time) (int, error) {
+	owned, err := s.booksByUser(ctx, s.digitalAccessCollection)
+	if err != nil {
+		return 0, err
+	}
+	wished, err := s.booksByUser(ctx, s.wishlistCollection)
+	if err != nil {
+		return 0, err
+	}
+	users := map[primitive.ObjectID]bool{}
+	for id := range owned {
+		users[id] = true
+	}
+	for id := range wished {
+		users[id] = true
+	}
+
+	computed := 0
+	var writes []mongo.WriteModel
+	for userID := range users {
+		has := map[primitive.ObjectID]bool{}
+		for _, id := range owned[userID] {
+			has[id] = true
+		}
+		for _, id := range wished[userID] {
+			has[id] = true
+		}
+
+		scores := newScoreBoard()
+		for _, seeds := range []struct {
+			ids    []primitive.ObjectID
+			reason string
+		}{{owned[userID], models.ReasonLibrary}, {wished[userID], models.ReasonWishlist}} {
+			for _, seed := range seeds.ids {
+				for _, r := range related[seed] {
+					scores.add(r.BookID, r.Score, seeds.reason, &seed)
+				}
+			}
+		}
+		list := scores.top(func(id primitive.ObjectID) bool {
+			_, ok := books[id]
+			return ok && !has[id]
+		}, books)
+		if len(list) == 0 {
+			continue
+		}
+		computed++
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": userID}).
+			SetReplacement(models.UserRecommendations{UserID: userID, Books: list, ComputedAt: now}).
+			SetUpsert(true))
+		if len(writes) == recommendationBatch {
+			if err := s.write(ctx, s.recommendationsCollection, writes); err != nil {
+				return computed, err
+			}
+			writes = writes[:0]
+		}
+	}
+	return computed, s.write(ctx, s.recommendationsCollection, writes)
+}
+
+// computePopular caches the books bought by the most customers.
+func (s *RecommendationService) computePopular(ctx context.Context, books map[primitive.ObjectID]*bookFeatures, now time.Time) error {
+	pipeline := append(customerBooksPipeline(),
+		bson.D{{Key: "$unwind", Value: "$books"}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$books", "customers": bson.M{"$sum": 1}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "customers", Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: MaxRecommendations * 2}},
+	)
+	cursor, err := s.orderItemsCollection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	var rows []struct {
+		BookID    primitive.ObjectID `bson:"_id"`
+		Customers int                `bson:"customers"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return err
+	}
+
+	list := []models.ScoredBook{}
+	for _, row := range rows {
+		if _, ok := books[row.BookID]; !ok || len(list) == MaxRecommendations {
+			continue
+		}
+		list = append(list, models.ScoredBook{
+			BookID:  row.BookID,
+			Score:   float64(row.Customers) / float64(rows[0].Customers),
+			Reasons: []string{models.ReasonPopular},
+		})
+	}
+	_, err = s.recommendationsCollection.ReplaceOne(ctx,
+		bson.M{"_id": popularID},
+		models.UserRecommendations{UserID: popularID, Books: list, ComputedAt: now},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// customerBooksPipeline groups the books of orders that were not cancelled
+// by customer.
+func customerBooksPipeline() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "orders",
+			"localField":   "order_id",
+			"foreignField": "_id",
+			"as":           "order",
+		}}},
+		{{Key: "$unwind", Value: "$order"}},
+		{{Key: "$match", Value: bson.M{"order.status": bson.M{"$ne": "Cancelled"}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$order.user_id", "books": bson.M{"$addToSet": "$book_id"}}}},
+	}
+}
+
+// copurchases counts, for every pair of books, how many customers bought
+// both.
+func (s *RecommendationService) copurchases(ctx context.Context) (map[primitive.ObjectID]map[primitive.ObjectID]int, error) {
+	pipeline := append(customerBooksPipeline(),
+		bson.D{{Key: "$match", Value: bson.M{"books.1": bson.M{"$exists": true}}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"a": bson.M{"$slice": bson.A{"$books", copurchaseBooksPerCustomer}},
+			"b": bson.M{"$slice": bson.A{"$books", copurchaseBooksPerCustomer}},
+		}}},
+		bson.D{{Key: "$unwind", Value: "$a"}},
+		bson.D{{Key: "$unwind", Value: "$b"}},
+		bson.D{{Key: "$match", Value: bson.M{"$expr": bson.M{"$ne": bson.A{"$a", "$b"}}}}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": bson.M{"book": "$a", "other": "$b"}, "customers": bson.M{"$sum": 1}}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":   "$_id.book",
+			"books": bson.M{"$push": bson.M{"book_id": "$_id.other", "customers": "$customers"}},
+		}}},
+	)
+	cursor, err := s.orderItemsCollection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := map[primitive.ObjectID]map[primitive.ObjectID]int{}
+	for cursor.Next(ctx) {
+		var row struct {
+			BookID primitive.ObjectID `bson:"_id"`
+			Books  []struct {
+				BookID    primitive.ObjectID `bson:"book_id"`
+				Customers int                `bson:"customers"`
+			} `bson:"books"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		others := make(map[primitive.ObjectID]int, len(row.Books))
+		for _, b := range row.Books {
+			others[b.BookID] = b.Customers
+		}
+		counts[row.BookID] = others
+	}
+	return counts, cursor.Err()
+}
+
+func (s *RecommendationService) catalogFeatures(ctx context.Context) (map[primitive.ObjectID]*bookFeatures, error) {
+	cursor, err := s.booksCollection.Find(ctx,
+		bson.M{"deleted_at": nil},
+		options.Find().SetProjection(bson.M{"authors": 1, "category_id": 1, "work_id": 1, "rating": 1, "total_ratings": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var list []*bookFeatures
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	books := make(map[primitive.ObjectID]*bookFeatures, len(list))
+	for _, b := range list {
+		books[b.ID] = b
+	}
+	return books, nil
+}
+
+// booksByUser groups the book_id of every document in a collection by its
+// user_id.
+func (s *RecommendationService) booksByUser(ctx context.Context, collection *mongo.Collection) (map[primitive.ObjectID][]primitive.ObjectID, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "books": bson.M{"$addToSet": "$book_id"}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := map[primitive.ObjectID][]primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var row struct {
+			UserID primitive.ObjectID   `bson:"_id"`
+			Books  []primitive.ObjectID `bson:"books"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		users[row.UserID] = row.Books
+	}
+	return users, cursor.Err()
+}
+
+func (s *RecommendationService) write(ctx context.Context, collection *mongo.Collection, writes []mongo.WriteModel) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	_, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// scoreBoard adds up the score of candidate books with the reasons and the
+// seed books that contributed to it.
+type scoreBoard map[primitive.ObjectID]*scoredCandidate
+
+type scoredCandidate struct {
+	score   float64
+	reasons []string
+	seeds   map[primitive.ObjectID]float64
+}
+
+func newScoreBoard() scoreBoard {
+	return scoreBoard{}
+}
+
+func (b scoreBoard) add(id primitive.ObjectID, score float64, reason string, seed *primitive.ObjectID) {
+	c, ok := b[id]
+	if !ok {
+		c = &scoredCandidate{seeds: map[primitive.ObjectID]float64{}}
+		b[id] = c
+	}
+	c.score += score
+	found := false
+	for _, r := range c.reasons {
+		found = found || r == reason
+	}
+	if !found {
+		c.reasons = append(c.reasons, reason)
+	}
+	if seed != nil {
+		c.seeds[*seed] += score
+	}
+}
+
+// top returns the MaxRecommendations best candidates that keep accepts.
+// Ties go to the better rated book. BecauseOf lists up to three seeds that
+// contributed most.
+func (b scoreBoard) top(keep func(primitive.ObjectID) bool, books map[primitive.ObjectID]*bookFeatures) []models.ScoredBook {
+	list := []models.ScoredBook{}
+	for id, c := range b {
+		if !keep(id) {
+			continue
+		}
+		scored := models.ScoredBook{BookID: id, Score: c.score, Reasons: c.reasons}
+		if len(c.seeds) > 0 {
+			seeds := make([]primitive.ObjectID, 0, len(c.seeds))
+			for seed := range c.seeds {
+				seeds = append(seeds, seed)
+			}
+			sort.Slice(seeds, func(i, j int) bool {
+				if c.seeds[seeds[i]] != c.seeds[seeds[j]] {
+					return c.seeds[seeds[i]] > c.seeds[seeds[j]]
+				}
+				return seeds[i].Hex() < seeds[j].Hex()
+			})
+			scored.BecauseOf = seeds[:min(3, len(seeds))]
+		}
+		list = append(list, scored)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		bi, bj := books[list[i].BookID], books[list[j].BookID]
+		if bi != nil && bj != nil && (bi.Rating != bj.Rating || bi.TotalRatings != bj.TotalRatings) {
+			return betterRated(bi, bj)
+		}
+		return list[i].BookID.Hex() < list[j].BookID.Hex()
+	})
+	if len(list) > MaxRecommendations {
+		list = list[:MaxRecommendations]
+	}
+	return list
+}
+
+func betterRated(a, b *bookFeatures) bool {
+	if a.Rating != b.Rating {
+		return a.Rating > b.Rating
+	}
+	return a.TotalRatings > b.TotalRatings
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"bookstore/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrRollbackConflict = errors.New("revision cannot be restored")
+)
+
+const (
+	// LowestPriceDays is the window of the lowest price shown on a book.
+	LowestPriceDays = 30
+	// versionAttempts bounds the retries when two changes to a book take the
+	// same version number.
+	versionAttempts = 3
+)
+
+// untrackedFields are the book fields left out of revision diffs: they are
+// bookkeeping or change without an editor.
+var untrackedFields = map[string]bool{
+	"id":            true,
+	"created_at":    true,
+	"updated_at":    true,
+	"rating":        true,
+	"total_ratings": true,
+}
+
+// RevisionService keeps the edit history of books: a numbered snapshot per
+// change with the fields that changed, and the prices each format was set
+// to.
+type RevisionService struct {
+	revisionsCollection    *mongo.Collection
+	priceHistoryCollection *mongo.Collection
+	booksCollection        *mongo.Collection
+	categoryService        *CategoryService
+}
+
+func NewRevisionService(revisionsCollection, priceHistoryCollection, booksCollection *mongo.Collection, categoryService *CategoryService) *RevisionService {
+	return &RevisionService{
+		revisionsCollection:    revisionsCollection,
+		priceHistoryCollection: priceHistoryCollection,
+		booksCollection:        booksCollection,
+		categoryService:        categoryService,
+	}
+}
+
+// Record saves the current state of a book as a new revision. before is the
+// book as it was ahead of the change, or nil for a new book; a book edited
+// for the first time since revisions were kept gets a baseline revision of
+// that state first. The book itself is already saved, so failures are only
+// logged.
+func (s *RevisionService) Record(ctx context.Context, bookID primitive.ObjectID, before *models.Book, action string, editor *primitive.ObjectID) {
+	if _, err := s.record(ctx, bookID, before, action, 0, editor); err != nil {
+		log.Printf("Failed to record revision of book %s: %v", bookID.Hex(), err)
+	}
+}
+
+func (s *RevisionService) record(ctx context.Context, bookID primitive.ObjectID, before *models.Book, action string, rolledBackTo int, editor *primitive.ObjectID) (*models.BookRevision, error) {
+	var after models.Book
+	if err := s.booksCollection.FindOne(ctx, bson.M{"_id": bookID}).Decode(&after); err != nil {
+		return nil, err
+	}
+	changes, err := diffBooks(before, &after)
+	if err != nil {
+		return nil, err
+	}
+	if before != nil && len(changes) == 0 && action != models.RevisionRollback {
+		return nil, nil
+	}
+
+	if before != nil {
+		count, err := s.revisionsCollection.CountDocuments(ctx, bson.M{"book_id": bookID}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			baseline := &models.BookRevision{
+				BookID:    bookID,
+				Action:    models.RevisionBaseline,
+				Changes:   []models.FieldChange{},
+				Snapshot:  before,
+				CreatedAt: before.UpdatedAt,
+			}
+			if err := s.insert(ctx, baseline); err != nil {
+				return nil, err
+			}
+			if err := s.recordPrices(ctx, nil, before, before.UpdatedAt); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	now := time.Now()
+	revision := &models.BookRevision{
+		BookID:       bookID,
+		Action:       action,
+		RolledBackTo: rolledBackTo,
+		Changes:      changes,
+		Snapshot:     &after,
+		EditedBy:     editor,
+		CreatedAt:    now,
+	}
+	if err := s.insert(ctx, revision); err != nil {
+		return nil, err
+	}
+	if err := s.recordPrices(ctx, before, &after, now); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// insert gives a revision the next version of its book and saves it.
+func (s *RevisionService) insert(ctx context.Context, revision *models.BookRevision) error {
+	for attempt := 1; ; attempt++ {
+		var latest models.BookRevision
+		err := s.revisionsCollection.FindOne(ctx,
+			bson.M{"book_id": revision.BookID},
+			options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}).SetProjection(bson.M{"version": 1}),
+		).Decode(&latest)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		revision.ID = primitive.NewObjectID()
+		revision.Version = latest.Version + 1
+		_, err = s.revisionsCollection.InsertOne(ctx, revision)
+		if mongo.IsDuplicateKeyError(err) && attempt < versionAttempts {
+			continue
+		}
+		return err
+	}
+}
+
+// recordPrices adds a price point for each format whose price differs from
+// before, or that is new. Rentals are priced per period and not tracked.
+func (s *RevisionService) recordPrices(ctx context.Context, before, after *models.Book, at time.Time) error {
+	previous := map[string]models.Money{}
+	if before != nil {
+		for _, f := range before.Formats {
+			previous[f.Type] = f.Price
+		}
+	}
+	var points []interface{}
+	for _, f := range after.Formats {
+		if f.Type == "rental" {
+			continue
+		}
+		if price, ok := previous[f.Type]; ok && price == f.Price {
+			continue
+		}
+		points = append(points, models.PricePoint{
+			BookID:     after.ID,
+			FormatType: f.Type,
+			Price:      f.Price,
+			ChangedAt:  at,
+		})
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	_, err := s.priceHistoryCollection.InsertMany(ctx, points)
+	return err
+}
+
+// diffBooks compares two states of a book field by field, by their JSON
+// form, so fields are named and shown as in the API. A nil before lists
+// every field set on after.
+func diffBooks(before, after *models.Book) ([]models.FieldChange, error) {
+	from := map[string]json.RawMessage{}
+	if before != nil {
+		if err := roundTrip(before, &from); err != nil {
+			return nil, err
+		}
+	}
+	to := map[string]json.RawMessage{}
+	if err := roundTrip(after, &to); err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(to))
+	for field := range to {
+		fields = append(fields, field)
+	}
+	for field := range from {
+		if _, ok := to[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []models.FieldChange{}
+	for _, field := range fields {
+		if untrackedFields[field] {
+			continue
+		}
+		old, value := from[field], to[field]
+		if bytes.Equal(old, value) {
+			continue
+		}
+		if before == nil && isEmptyJSON(value) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: field, From: old, To: value})
+	}
+	return changes, nil
+}
+
+func roundTrip(book *models.Book, fields *map[string]json.RawMessage) error {
+	data, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, fields)
+}
+
+func isEmptyJSON(value json.RawMessage) bool {
+	switch string(value) {
+	case "", "null", `""`, "0", "[]", "{}", "false":
+		return true
+	}
+	return false
+}
+
+// History lists the revisions of a book, newest first, without their
+// snapshots.
+func (s *RevisionService) History(ctx context.Context, bookID primitive.ObjectID, limit int64) ([]models.BookRevision, error) {
+	if err := s.bookExists(ctx, bookID); err != nil {
+		return nil, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"snapshot": 0})
+	cursor, err := s.revisionsCollection.Find(ctx, bson.M{"book_id": bookID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []models.BookRevision
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (s *RevisionService) Revision(ctx context.Context, bookID primitive.ObjectID, version int) (*models.BookRevision, error) {
+	var revision models.BookRevision
+	err := s.revisionsCollection.FindOne(ctx, bson.M{"book_id": bookID, "version": version}).Decode(&revision)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// Rollback puts the catalog fields of a book back as they were in a
+// revision and records that as a new revision. Stock is not part of an
+// edit and stays as it is now for the formats the revision had. An uploaded
+// cover whose files have since been replaced is not brought back. The
+// revision's ISBN and category must still be usable.
+func (s *RevisionService) Rollback(ctx context.Context, bookID primitive.ObjectID, version int, editor primitive.ObjectID) (*models.BookRevision, error) {
+	revision, err := s.Revision(ctx, bookID, version)
+	if err != nil {
+		return nil, err
+	}
+	var current models.Book
+	err = s.booksCollection.FindOne(ctx, bson.M{"_id": bookID}).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	old := revision.Snapshot
+
+	stock := map[string]int{}
+	for _, f := range current.Formats {
+		stock[f.Type] = f.StockQuantity
+	}
+	formats := make([]models.BookFormat, len(old.Formats))
+	for i, f := range old.Formats {
+		f.StockQuantity = stock[f.Type]
+		formats[i] = f
+	}
+
+	set := bson.M{
+		"title":          old.Title,
+		"author":         old.Author,
+		"description":    old.Description,
+		"published_year": old.PublishedYear,
+		"category":       old.Category,
+		"formats":        formats,
+		"updated_at":     time.Now(),
+	}
+	unset := bson.M{}
+	optional := func(field string, value interface{}, empty bool) {
+		if empty {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+	optional("authors", old.Authors, len(old.Authors) == 0)
+	optional("tags", old.Tags, len(old.Tags) == 0)
+	optional("series_id", old.SeriesID, old.SeriesID == nil)
+	optional("series_position", old.SeriesPosition, old.SeriesPosition == 0)
+	optional("work_id", old.WorkID, old.WorkID == nil)
+	optional("language", old.Language, old.Language == "")
+	optional("translated_from", old.TranslatedFrom, old.TranslatedFrom == "")
+	optional("release_date", old.ReleaseDate, old.ReleaseDate == nil)
+
+	if old.ISBN != current.ISBN {
+		optional("isbn", old.ISBN, old.ISBN == "")
+		if old.ISBN != "" {
+			unset["legacy_isbn"] = ""
+		}
+	}
+
+	unset["category_path"] = ""
+	unset["category_id"] = ""
+	if old.CategoryID != nil {
+		category, err := s.categoryService.Get(ctx, *old.CategoryID)
+		if errors.Is(err, ErrCategoryNotFound) {
+			return nil, fmt.Errorf("%w: its category no longer exists", ErrRollbackConflict)
+		}
+		if err != nil {
+			return nil, err
+		}
+		delete(unset, "category_path")
+		delete(unset, "category_id")
+		set["category"] = category.Name
+		set["category_id"] = category.ID
+		set["category_path"] = category.Path()
+	}
+
+	switch {
+	case current.Cover != nil && old.ImageURL == current.Cover.URL:
+		set["image_url"] = old.ImageURL
+	case strings.HasPrefix(old.ImageURL, ImageURLPrefix):
+		// the uploaded cover it pointed at is gone; keep the current one
+	default:
+		set["image_url"] = old.ImageURL
+		if current.Cover != nil {
+			unset["cover"] = ""
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	_, err = s.booksCollection.UpdateOne(ctx, bson.M{"_id": bookID}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("%w: another book now has its ISBN", ErrRollbackConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.record(ctx, bookID, &current, models.RevisionRollback, version, &editor)
+}
+
+// PriceHistory lists the prices a book's formats were set to, newest first.
+// An empty formatType lists every format.
+func (s *RevisionService) PriceHistory(ctx context.Context, bookID primitive.ObjectID, formatType string, limit int64) ([]models.PricePoint, error) {
+	if err := s.bookExists(ctx, bookID); err != nil {
+		return nil, err
+	}
+	filter := bson.M{"book_id": bookID}
+	if formatType != "" {
+		filter["format_type"] = formatType
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "changed_at", Value: -1}}).SetLimit(limit)
+	cursor, err := s.priceHistoryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var points []models.PricePoint
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// LowestPrices returns, per format of a book, the lowest price it had over
+// the last LowestPriceDays: the price in effect when the window opened,
+// every price set since and the current one.
+func (s *RevisionService) LowestPrices(ctx context.Context, book models.Book, now time.Time) (map[string]models.Money, error) {
+	since := now.AddDate(0, 0, -LowestPriceDays)
+	lowest := map[string]models.Money{}
+	for _, f := range book.Formats {
+		if f.Type == "rental" {
+			continue
+		}
+		lowest[f.Type] = f.Price
+
+		var opening models.PricePoint
+		err := s.priceHistoryCollection.FindOne(ctx,
+			bson.M{"book_id": book.ID, "format_type": f.Type, "changed_at": bson.M{"$lte": since}},
+			options.FindOne().SetSort(bson.D{{Key: "changed_at", Value: -1}}),
+		).Decode(&opening)
+		if err == nil {
+			lowest[f.Type] = min(lowest[f.Type], opening.Price)
+		} else if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+
+		cursor, err := s.priceHistoryCollection.Find(ctx,
+			bson.M{"book_id": book.ID, "format_type": f.Type, "changed_at": bson.M{"$gt": since}},
+			options.Find().SetProjection(bson.M{"price": 1}),
+		)
+		if err != nil {
+			return nil, err
+		}
+		var points []models.PricePoint
+		if err := cursor.All(ctx, &points); err != nil {
+			return nil, err
+		}
+		for _, p := range points {
+			lowest[f.Type] = min(lowest[f.Type], p.Price)
+		}
+	}
+	return lowest, nil
+}
+
+func (s *RevisionService) bookExists(ctx context.Context, bookID primitive.ObjectID) error {
+	count, err := s.booksCollection.CountDocuments(ctx, bson.M{"_id": bookID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrBookNotFound
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrSeriesNotFound = errors.New("series not found")
+	ErrSeriesExists   = errors.New("a series with this name already exists")
+	ErrSeriesHasBooks = errors.New("series still has books")
+	ErrInvalidSeries  = errors.New("invalid series")
+	ErrInvalidEdition = errors.New("invalid edition")
+)
+
+// MaxEditionsListed caps the other editions shown on a book's page.
+const MaxEditionsListed = 50
+
+var bookLinkProjection = bson.M{"_id": 1, "title": 1, "author": 1, "image_url": 1, "published_year": 1, "language": 1, "series_position": 1}
+
+// SeriesService manages series and the works that group editions of a
+// book, and builds the links between books shown on a book's page.
+type SeriesService struct {
+	seriesCollection *mongo.Collection
+	worksCollection  *mongo.Collection
+	booksCollection  *mongo.Collection
+}
+
+func NewSeriesService(seriesCollection, worksCollection, booksCollection *mongo.Collection) *SeriesService {
+	return &SeriesService{
+		seriesCollection: seriesCollection,
+		worksCollection:  worksCollection,
+		booksCollection:  booksCollection,
+	}
+}
+
+func (s *SeriesService) List(ctx context.Context, search string, limit int64) ([]models.Series, error) {
+	filter := bson.M{}
+	if search = strings.TrimSpace(search); search != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(search), "$options": "i"}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}}).SetLimit(limit)
+	cursor, err := s.seriesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var series []models.Series
+	if err := cursor.All(ctx, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+func (s *SeriesService) Get(ctx context.Context, id primitive.ObjectID) (*models.Series, error) {
+	var series models.Series
+	err := s.seriesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&series)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSeriesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+// Volumes lists the books of a series in reading order.
+func (s *SeriesService) Volumes(ctx context.Context, seriesID primitive.ObjectID) ([]models.Book, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "series_position", Value: 1}, {Key: "published_year", Value: 1}})
+	cursor, err := s.booksCollection.Find(ctx, bson.M{"series_id": seriesID, "deleted_at": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var books []models.Book
+	if err := cursor.All(ctx, &books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+func (s *SeriesService) Create(ctx context.Context, req models.SeriesRequest) (*models.Series, error) {
+	series := models.Series{
+		ID:          primitive.NewObjectID(),
+		Name:        strings.Join(strings.Fields(req.Name), " "),
+		Key:         models.NameKey(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if series.Key == "" {
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalidSeries)
+	}
+	_, err := s.seriesCollection.InsertOne(ctx, series)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrSeriesExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+func (s *SeriesService) Update(ctx context.Context, id primitive.ObjectID, req models.SeriesRequest) (*models.Series, error) {
+	key := models.NameKey(req.Name)
+	if key == "" {
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalidSeries)
+	}
+	var series models.Series
+	err := s.seriesCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"name":        strings.Join(strings.Fields(req.Name), " "),
+			"key":         key,
+			"description": strings.TrimSpace(req.Description),
+			"updated_at":  time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&series)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrSeriesExists
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSeriesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+// Delete removes a series that no book belongs to any more.
+func (s *SeriesService) Delete(ctx context.Context, id primitive.ObjectID) error {
+	count, err := s.booksCollection.CountDocuments(ctx, bson.M{"series_id": id})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSeriesHasBooks
+	}
+	result, err := s.seriesCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrSeriesNotFound
+	}
+	return nil
+}
+
+// Resolve checks the series a book request names.
+func (s *SeriesService) Resolve(ctx context.Context, seriesID string) (*models.Series, error) {
+	id, err := primitive.ObjectIDFromHex(seriesID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid series ID", ErrInvalidSeries)
+	}
+	series, err := s.Get(ctx, id)
+	if errors.Is(err, ErrSeriesNotFound) {
+		return nil, fmt.Errorf("%w: series not found", ErrInvalidSeries)
+	}
+	return series, err
+}
+
+// Named finds a series by name. With create set, a series that does not
+// exist yet is created.
+func (s *SeriesService) Named(ctx context.Context, name string, create bool) (*models.Series, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	key := models.NameKey(name)
+	if key == "" {
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalidSeries)
+	}
+
+	var series models.Series
+	if !create {
+		err := s.seriesCollection.FindOne(ctx, bson.M{"key": key}).Decode(&series)
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSeriesNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &series, nil
+	}
+
+	now := time.Now()
+	err := s.seriesCollection.FindOneAndUpdate(ctx,
+		bson.M{"key": key},
+		bson.M{"$setOnInsert": bson.M{"name": name, "key": key, "created_at": now, "updated_at": now}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&series)
+	if mongo.IsDuplicateKeyError(err) {
+		err = s.seriesCollection.FindOne(ctx, bson.M{"key": key}).Decode(&series)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &series, nil
+}
+
+// WorkOf returns the work of the given book so another edition can join
+// it. A book that has no work yet gets one, titled after it.
+func (s *SeriesService) WorkOf(ctx context.Context, bookID string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(bookID)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("%w: invalid book ID", ErrInvalidEdition)
+	}
+	var book models.Book
+	err = s.booksCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, fmt.Errorf("%w: book not found", ErrInvalidEdition)
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if book.WorkID != nil {
+		return *book.WorkID, nil
+	}
+
+	language := book.TranslatedFrom
+	if language == "" {
+		language = book.Language
+	}
+	work := models.Work{
+		ID:               primitive.NewObjectID(),
+		Title:            book.Title,
+		OriginalLanguage: language,
+		CreatedAt:        time.Now(),
+	}
+	if _, err := s.worksCollection.InsertOne(ctx, work); err != nil {
+		return primitive.NilObjectID, err
+	}
+	result, err := s.booksCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "work_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"work_id": work.ID}},
+	)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if result.ModifiedCount == 0 {
+		// another edition was linked to the book at the same time
+		s.worksCollection.DeleteOne(ctx, bson.M{"_id": work.ID})
+		if err := s.booksCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&book); err != nil {
+			return primitive.NilObjectID, err
+		}
+		return *book.WorkID, nil
+	}
+	return work.ID, nil
+}
+
+// Detail adds to a book its series, the books before and after it in the
+// series and its other editions.
+func (s *SeriesService) Detail(ctx context.Context, book models.Book) (*models.BookDetail, error) {
+	detail := &models.BookDetail{Book: book, OtherEditions: []models.BookLink{}}
+
+	if book.SeriesID != nil {
+		series, err := s.Get(ctx, *book.SeriesID)
+		if err != nil && !errors.Is(err, ErrSeriesNotFound) {
+			return nil, err
+		}
+		detail.Series = series
+		if series != nil && book.SeriesPosition > 0 {
+			if detail.PreviousInSeries, err = s.neighbour(ctx, book, "$lt", -1); err != nil {
+				return nil, err
+			}
+			if detail.NextInSeries, err = s.neighbour(ctx, book, "$gt", 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if book.WorkID != nil {
+		opts := options.Find().
+			SetProjection(bookLinkProjection).
+			SetSort(bson.D{{Key: "published_year", Value: -1}}).
+			SetLimit(MaxEditionsListed)
+		cursor, err := s.booksCollection.Find(ctx, bson.M{"work_id": book.WorkID, "_id": bson.M{"$ne": book.ID}, "deleted_at": nil}, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.All(ctx, &detail.OtherEditions); err != nil {
+			return nil, err
+		}
+	}
+	return detail, nil
+}
+
+func (s *SeriesService) neighbour(ctx context.Context, book models.Book, op string, order int) (*models.BookLink, error) {
+	opts := options.FindOne().
+		SetProjection(bookLinkProjection).
+		SetSort(bson.D{{Key: "series_position", Value: order}, {Key: "published_year", Value: 1}})
+	position := bson.M{op: book.SeriesPosition}
+	if op == "$lt" {
+		// books without a position are not part of the reading order
+		position["$gt"] = 0
+	}
+	var link models.BookLink
+	err := s.booksCollection.FindOne(ctx, bson.M{"series_id": book.SeriesID, "series_position": position, "deleted_at": nil}, opts).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// bookLinks loads the books with the given IDs that are in the catalog,
+// keyed by ID.
+func bookLinks(ctx context.Context, booksCollection *mongo.Collection, ids []primitive.ObjectID) (map[primitive.ObjectID]models.BookLink, error) {
+	links := map[primitive.ObjectID]models.BookLink{}
+	if len(ids) == 0 {
+		return links, nil
+	}
+	cursor, err := booksCollection.Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "deleted_at": nil},
+		options.Find().SetProjection(bookLinkProjection),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var found []models.BookLink
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for _, link := range found {
+		links[link.ID] = link
+	}
+	return links, nil
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const DefaultShippingMethod = "standard"
+
+// defaultShippingMethods are offered while the shipping_methods collection is empty.
+var defaultShippingMethods = []models.ShippingMethod{
+	{Code: "standard", Name: "Standard delivery", RateType: models.ShippingRatePerItem, BaseFee: 499, PerItemFee: 100, FreeOver: 5000, RequiresAddress: true, EstimatedDaysMin: 3, EstimatedDaysMax: 7, IsActive: true},
+	{Code: "express", Name: "Express delivery", RateType: models.ShippingRateWeight, BaseFee: 999, PerKgFee: 300, RequiresAddress: true, EstimatedDaysMin: 1, EstimatedDaysMax: 2, IsActive: true},
+	{Code: "pickup", Name: "Store pickup", RateType: models.ShippingRatePerItem, RequiresAddress: false, EstimatedDaysMin: 1, EstimatedDaysMax: 3, IsActive: true},
+}
+
+type ShippingService struct {
+	methodsCollection *mongo.Collection
+}
+
+func NewShippingService(methodsCollection *mongo.Collection) *ShippingService {
+	return &ShippingService{methodsCollection: methodsCollection}
+}
+
+// Methods returns the active shipping methods.
+func (s *ShippingService) Methods(ctx context.Context) ([]models.ShippingMethod, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "base_fee", Value: 1}})
+	cursor, err := s.methodsCollection.Find(ctx, bson.M{"is_active": true}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var methods []models.ShippingMethod
+	if err := cursor.All(ctx, &methods); err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		count, err := s.methodsCollection.CountDocuments(ctx, bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return defaultShippingMethods, nil
+		}
+	}
+	if methods == nil {
+		methods = []models.ShippingMethod{}
+	}
+	return methods, nil
+}
+
+func (s *ShippingService) Method(ctx context.Context, code string) (models.ShippingMethod, error) {
+	methods, err := s.Methods(ctx)
+	if err != nil {
+		return models.ShippingMethod{}, err
+	}
+	for _, m := range methods {
+		if m.Code == code {
+			return m, nil
+		}
+	}
+	return models.ShippingMethod{}, fmt.Errorf("%w: unknown shipping method %q", ErrInvalidBasket, code)
+}
+
+// RequiresShipping reports whether any line contains a physical copy.
+func RequiresShipping(lines []models.PriceLine) bool {
+	for _, line := range lines {
+		if GoodsCategory(line.FormatType) == GoodsPhysical {
+			return true
+		}
+	}
+	return false
+}
+
+// Rate prices shipping for the physical lines of a quote. merchandise is
+// the discounted basket value used for the free shipping threshold.
+func (s *ShippingService) Rate(method models.ShippingMethod, address *models.Address, lines []models.PriceLine, merchandise models.Money) (models.Money, error) {
+	if address != nil && len(method.Countries) > 0 && !containsFold(method.Countries, address.Country) {
+		return 0, fmt.Errorf("%w: %s is not available in %s", ErrInvalidBasket, method.Name, address.Country)
+	}
+
+	var items, grams int
+	for _, line := range lines {
+		if GoodsCategory(line.FormatType) != GoodsPhysical {
+			continue
+		}
+		items += line.Quantity
+		grams += line.WeightGrams * line.Quantity
+	}
+	if items == 0 {
+		return 0, nil
+	}
+	if method.FreeOver > 0 && merchandise >= method.FreeOver {
+		return 0, nil
+	}
+
+	fee := method.BaseFee
+	switch method.RateType {
+	case models.ShippingRateWeight:
+		// charge per started kilogram
+		kg := (grams + 999) / 1000
+		fee += method.PerKgFee * models.Money(kg)
+	default:
+		fee += method.PerItemFee * models.Money(items)
+	}
+	return fee, nil
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"bookstore/models"
+	"errors"
+	"testing"
+)
+
+func TestShippingServiceRate(t *testing.T) {
+	perItem := models.ShippingMethod{Name: "Standard", RateType: models.ShippingRatePerItem, BaseFee: 300, PerItemFee: 100, FreeOver: 5000}
+	weight := models.ShippingMethod{Name: "Courier", RateType: models.ShippingRateWeight, BaseFee: 500, PerKgFee: 250, Countries: []string{"DE", "AT"}}
+
+	paperback := models.PriceLine{FormatType: "physical", Quantity: 2, WeightGrams: 400}
+	bundle := models.PriceLine{FormatType: "both", Quantity: 1, WeightGrams: 1300}
+	ebook := models.PriceLine{FormatType: "digital", Quantity: 3}
+
+	tests := []struct {
+		name        string
+		method      models.ShippingMethod
+		address     *models.Address
+		lines       []models.PriceLine
+		merchandise models.Money
+		want        models.Money
+		wantErr     error
+	}{
+		{name: "per item", method: perItem, lines: []models.PriceLine{paperback, bundle}, merchandise: 3000, want: 600},
+		{name: "digital lines are not shipped", method: perItem, lines: []models.PriceLine{paperback, ebook}, merchandise: 3000, want: 500},
+		{name: "only digital lines", method: perItem, lines: []models.PriceLine{ebook}, merchandise: 3000, want: 0},
+		{name: "free over the threshold", method: perItem, lines: []models.PriceLine{paperback}, merchandise: 5000, want: 0},
+		{name: "just under the threshold", method: perItem, lines: []models.PriceLine{paperback}, merchandise: 4999, want: 500},
+		{name: "per started kilogram", method: weight, address: &models.Address{Country: "de"}, lines: []models.PriceLine{paperback, bundle}, want: 1250},
+		{name: "exactly one kilogram", method: weight, lines: []models.PriceLine{{FormatType: "physical", Quantity: 2, WeightGrams: 500}}, want: 750},
+		{name: "country not served", method: weight, address: &models.Address{Country: "FR"}, lines: []models.PriceLine{paperback}, wantErr: ErrInvalidBasket},
+	}
+	s := NewShippingService(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Rate(tt.method, tt.address, tt.lines, tt.merchandise)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Rate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Rate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
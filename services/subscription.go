@@ -0,0 +1,464 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrUnknownPlan         = errors.New("unknown subscription plan")
+	ErrAlreadySubscribed   = errors.New("user already has an active subscription")
+	ErrNoSubscription      = errors.New("user has no active subscription")
+	ErrSubscriptionPayment = errors.New("subscription payment failed")
+)
+
+// GrantPlan is the plan code of memberships handed out by admins.
+const GrantPlan = "grant"
+
+var subscriptionPlans = []models.SubscriptionPlan{
+	{Code: "monthly", Name: "Premium monthly", Months: 1, Price: 2200, GraceDays: 3},
+	{Code: "annual", Name: "Premium annual", Months: 12, Price: 22000, GraceDays: 7},
+}
+
+// Biller charges a customer for a subscription period or a gift card. The
+// store has no payment provider yet, so NoopBiller accepts every charge; a
+// failed charge puts the subscription into its grace period instead of
+// ending it.
+type Biller interface {
+	Charge(ctx context.Context, userID primitive.ObjectID, amount models.Money, description string) error
+}
+
+type NoopBiller struct{}
+
+func (NoopBiller) Charge(ctx context.Context, userID primitive.ObjectID, amount models.Money, description string) error {
+	return nil
+}
+
+// SubscriptionService owns premium memberships. The is_premium and
+// premium_until fields on the user are kept in step with the subscription so
+// the rest of the code can keep reading them.
+type SubscriptionService struct {
+	subscriptionsCollection *mongo.Collection
+	eventsCollection        *mongo.Collection
+	usersCollection         *mongo.Collection
+	biller                  Biller
+}
+
+func NewSubscriptionService(subscriptionsCollection, eventsCollection, usersCollection *mongo.Collection, biller Biller) *SubscriptionService {
+	return &SubscriptionService{
+		subscriptionsCollection: subscriptionsCollection,
+		eventsCollection:        eventsCollection,
+		usersCollection:         usersCollection,
+		biller:                  biller,
+	}
+}
+
+func (s *SubscriptionService) Plans() []models.SubscriptionPlan {
+	return subscriptionPlans
+}
+
+func (s *SubscriptionService) Plan(code string) (models.SubscriptionPlan, error) {
+	for _, p := range subscriptionPlans {
+		if p.Code == code {
+			return p, nil
+		}
+	}
+	return models.SubscriptionPlan{}, fmt.Errorf("%w: %q", ErrUnknownPlan, code)
+}
+
+// Current returns the user's active or past_due subscription, or nil.
+func (s *SubscriptionService) Current(ctx context.Context, userID primitive.ObjectID) (*models.Subscription, error) {
+	var sub models.Subscription
+	err := s.subscriptionsCollection.FindOne(ctx, bson.M{
+		"user_id": userID,
+		"status":  bson.M{"$in": []string{models.SubscriptionStatusActive, models.SubscriptionStatusPastDue}},
+	}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *SubscriptionService) History(ctx context.Context, userID primitive.ObjectID) ([]models.SubscriptionEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}})
+	cursor, err := s.eventsCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.SubscriptionEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []models.SubscriptionEvent{}
+	}
+	return events, nil
+}
+
+// Subscribe starts a subscription on planCode. A past_due subscription is
+// renewed instead, continuing from where its last period ended.
+func (s *SubscriptionService) Subscribe(ctx context.Context, userID primitive.ObjectID, planCode string, autoRenew bool) (*models.Subscription, error) {
+	plan, err := s.Plan(planCode)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.Current(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Status == models.SubscriptionStatusActive {
+		return nil, ErrAlreadySubscribed
+	}
+
+	// the subscription is claimed before the card is charged, so concurrent
+	// requests cannot both charge; the claim is undone if the charge fails
+	now := time.Now()
+	if current != nil {
+		start := current.CurrentPeriodEnd
+		end := start.AddDate(0, plan.Months, 0)
+		result, err := s.subscriptionsCollection.UpdateOne(ctx, bson.M{
+			"_id":                current.ID,
+			"status":             models.SubscriptionStatusPastDue,
+			"current_period_end": start,
+		}, bson.M{
+			"$set": bson.M{
+				"plan":                 plan.Code,
+				"price":                plan.Price,
+				"status":               models.SubscriptionStatusActive,
+				"auto_renew":           autoRenew,
+				"cancel_at_period_end": false,
+				"current_period_start": start,
+				"current_period_end":   end,
+				"updated_at":           now,
+			},
+			"$unset": bson.M{"grace_until": ""},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			// renewed or expired by a concurrent request or job run
+			return nil, ErrAlreadySubscribed
+		}
+
+		if err := s.biller.Charge(ctx, userID, plan.Price, plan.Name); err != nil {
+			_, uerr := s.subscriptionsCollection.UpdateOne(ctx, bson.M{"_id": current.ID, "current_period_end": end}, bson.M{
+				"$set": bson.M{
+					"plan":                 current.Plan,
+					"price":                current.Price,
+					"status":               current.Status,
+					"auto_renew":           current.AutoRenew,
+					"cancel_at_period_end": current.CancelAtPeriodEnd,
+					"current_period_start": current.CurrentPeriodStart,
+					"current_period_end":   current.CurrentPeriodEnd,
+					"grace_until":          current.GraceUntil,
+					"updated_at":           time.Now(),
+				},
+			})
+			if uerr != nil {
+				log.Printf("Failed to restore subscription %s after a declined charge: %v", current.ID.Hex(), uerr)
+			}
+			return nil, fmt.Errorf("%w: %v", ErrSubscriptionPayment, err)
+		}
+
+		current.Plan, current.Price, current.Status = plan.Code, plan.Price, models.SubscriptionStatusActive
+		current.AutoRenew, current.CancelAtPeriodEnd, current.GraceUntil = autoRenew, false, nil
+		current.CurrentPeriodStart, current.CurrentPeriodEnd = start, end
+		s.record(ctx, current, models.SubscriptionEventRenewed, plan.Price, "")
+		return current, s.syncUser(ctx, userID, &end)
+	}
+
+	sub := &models.Subscription{
+		UserID:             userID,
+		Plan:               plan.Code,
+		Price:              plan.Price,
+		Status:             models.SubscriptionStatusActive,
+		AutoRenew:          autoRenew,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   now.AddDate(0, plan.Months, 0),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	result, err := s.subscriptionsCollection.InsertOne(ctx, sub)
+	if mongo.IsDuplicateKeyError(err) {
+		// a user has at most one active or past_due subscription
+		return nil, ErrAlreadySubscribed
+	}
+	if err != nil {
+		return nil, err
+	}
+	sub.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := s.biller.Charge(ctx, userID, plan.Price, plan.Name); err != nil {
+		if _, derr := s.subscriptionsCollection.DeleteOne(ctx, bson.M{"_id": sub.ID}); derr != nil {
+			log.Printf("Failed to remove subscription %s after a declined charge: %v", sub.ID.Hex(), derr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrSubscriptionPayment, err)
+	}
+	s.record(ctx, sub, models.SubscriptionEventStarted, plan.Price, "")
+	return sub, s.syncUser(ctx, userID, &sub.CurrentPeriodEnd)
+}
+
+// Cancel stops auto-renewal; the member keeps premium until the period ends.
+func (s *SubscriptionService) Cancel(ctx context.Context, userID primitive.ObjectID) (*models.Subscription, error) {
+	return s.setCancelAtPeriodEnd(ctx, userID, true)
+}
+
+// Resume undoes Cancel while the current period is still running.
+func (s *SubscriptionService) Resume(ctx context.Context, userID primitive.ObjectID) (*models.Subscription, error) {
+	return s.setCancelAtPeriodEnd(ctx, userID, false)
+}
+
+func (s *SubscriptionService) setCancelAtPeriodEnd(ctx context.Context, userID primitive.ObjectID, cancel bool) (*models.Subscription, error) {
+	current, err := s.Current(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || current.Status != models.SubscriptionStatusActive {
+		return nil, ErrNoSubscription
+	}
+
+	now := time.Now()
+	set := bson.M{"cancel_at_period_end": cancel, "updated_at": now}
+	eventType := models.SubscriptionEventResumed
+	if cancel {
+		set["cancelled_at"] = now
+		current.CancelledAt = &now
+		eventType = models.SubscriptionEventCancelScheduled
+	}
+	if _, err := s.subscriptionsCollection.UpdateOne(ctx, bson.M{"_id": current.ID}, bson.M{"$set": set}); err != nil {
+		return nil, err
+	}
+	current.CancelAtPeriodEnd = cancel
+	s.record(ctx, current, eventType, 0, "")
+	return current, nil
+}
+
+// Grant gives a user days of premium for free. An existing subscription is
+// extended; otherwise a non-renewing one is created.
+func (s *SubscriptionService) Grant(ctx context.Context, userID primitive.ObjectID, days int, note string) (*models.Subscription, error) {
+	current, err := s.Current(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if current != nil {
+		from := current.CurrentPeriodEnd
+		if current.Status == models.SubscriptionStatusPastDue {
+			from = now
+		}
+		end := from.AddDate(0, 0, days)
+		_, err := s.subscriptionsCollection.UpdateOne(ctx, bson.M{"_id": current.ID}, bson.M{
+			"$set":   bson.M{"status": models.SubscriptionStatusActive, "current_period_end": end, "updated_at": now},
+			"$unset": bson.M{"grace_until": ""},
+		})
+		if err != nil {
+			return nil, err
+		}
+		current.Status, current.CurrentPeriodEnd, current.GraceUntil = models.SubscriptionStatusActive, end, nil
+		s.record(ctx, current, models.SubscriptionEventExtended, 0, note)
+		return current, s.syncUser(ctx, userID, &end)
+	}
+
+	sub := &models.Subscription{
+		UserID:             userID,
+		Plan:               GrantPlan,
+		Status:             models.SubscriptionStatusActive,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   now.AddDate(0, 0, days),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	result, err := s.subscriptionsCollection.InsertOne(ctx, sub)
+	if mongo.IsDuplicateKeyError(err) {
+		// a subscription was started concurrently; extend it instead
+		return s.Grant(ctx, userID, days, note)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sub.ID = result.InsertedID.(primitive.ObjectID)
+	s.record(ctx, sub, models.SubscriptionEventStarted, 0, note)
+	return sub, s.syncUser(ctx, userID, &sub.CurrentPeriodEnd)
+}
+
+// ProcessDue moves every subscription whose period or grace period has run
+// out to its next state and returns how many were changed. It is safe to run
+// repeatedly: each step only matches subscriptions that still need it.
+func (s *SubscriptionService) ProcessDue(ctx context.Context, now time.Time) (int, error) {
+	processed := 0
+
+	cursor, err := s.subscriptionsCollection.Find(ctx, bson.M{
+		"status":             models.SubscriptionStatusActive,
+		"current_period_end": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return processed, err
+	}
+	var due []models.Subscription
+	if err := cursor.All(ctx, &due); err != nil {
+		return processed, err
+	}
+	for i := range due {
+		if err := s.periodEnded(ctx, &due[i], now); err != nil {
+			log.Printf("subscription %s: %v", due[i].ID.Hex(), err)
+			continue
+		}
+		processed++
+	}
+
+	cursor, err = s.subscriptionsCollection.Find(ctx, bson.M{
+		"status":      models.SubscriptionStatusPastDue,
+		"grace_until": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return processed, err
+	}
+	var lapsed []models.Subscription
+	if err := cursor.All(ctx, &lapsed); err != nil {
+		return processed, err
+	}
+	for i := range lapsed {
+		if err := s.end(ctx, &lapsed[i], models.SubscriptionStatusExpired, models.SubscriptionEventExpired, now); err != nil {
+			log.Printf("subscription %s: %v", lapsed[i].ID.Hex(), err)
+			continue
+		}
+		processed++
+	}
+
+	// memberships granted before subscriptions existed have no subscription
+	// document and only a premium_until date
+	result, err := s.usersCollection.UpdateMany(ctx, bson.M{
+		"is_premium":    true,
+		"premium_until": bson.M{"$lte": now},
+	}, bson.M{"$set": bson.M{"is_premium": false, "updated_at": now}})
+	if err != nil {
+		return processed, err
+	}
+	return processed + int(result.ModifiedCount), nil
+}
+
+func (s *SubscriptionService) periodEnded(ctx context.Context, sub *models.Subscription, now time.Time) error {
+	if sub.CancelAtPeriodEnd {
+		return s.end(ctx, sub, models.SubscriptionStatusCancelled, models.SubscriptionEventEnded, now)
+	}
+
+	plan, planErr := s.Plan(sub.Plan)
+	if sub.AutoRenew && planErr == nil {
+		renewed, err := s.renew(ctx, sub, plan, now)
+		if renewed || err != nil {
+			return err
+		}
+	}
+
+	// not renewed: keep premium through the grace period so the member can
+	// still renew without losing their benefits
+	graceDays := 0
+	if planErr == nil {
+		graceDays = plan.GraceDays
+	}
+	if graceDays == 0 {
+		return s.end(ctx, sub, models.SubscriptionStatusExpired, models.SubscriptionEventExpired, now)
+	}
+	graceUntil := sub.CurrentPeriodEnd.AddDate(0, 0, graceDays)
+	result, err := s.subscriptionsCollection.UpdateOne(ctx, bson.M{"_id": sub.ID, "status": models.SubscriptionStatusActive}, bson.M{
+		"$set": bson.M{"status": models.SubscriptionStatusPastDue, "grace_until": graceUntil, "updated_at": now},
+	})
+	if err != nil || result.MatchedCount == 0 {
+		return err
+	}
+	sub.Status, sub.GraceUntil = models.SubscriptionStatusPastDue, &graceUntil
+	s.record(ctx, sub, models.SubscriptionEventGraceStarted, 0, "")
+	return s.syncUser(ctx, sub.UserID, &graceUntil)
+}
+
+// renew charges the next period. The period is moved on before the charge,
+// so another replica processing the same subscription matches nothing and
+// cannot charge it twice; a declined charge moves it back. It reports false
+// when the charge was declined, in which case the subscription should enter
+// its grace period.
+func (s *SubscriptionService) renew(ctx context.Context, sub *models.Subscription, plan models.SubscriptionPlan, now time.Time) (bool, error) {
+	start := sub.CurrentPeriodEnd
+	end := start.AddDate(0, plan.Months, 0)
+	result, err := s.subscriptionsCollection.UpdateOne(ctx, bson.M{"_id": sub.ID, "status": models.SubscriptionStatusActive, "current_period_end": start}, bson.M{
+		"$set": bson.M{"price": plan.Price, "current_period_start": start, "current_period_end": end, "updated_at": now},
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		// another replica already handled this period
+		return true, nil
+	}
+
+	if err := s.biller.Charge(ctx, sub.UserID, plan.Price, plan.Name+" renewal"); err != nil {
+		_, uerr := s.subscriptionsCollection.UpdateOne(ctx, bson.M{"_id": sub.ID, "current_period_end": end}, bson.M{
+			"$set": bson.M{"price": sub.Price, "current_period_start": sub.CurrentPeriodStart, "current_period_end": start, "updated_at": now},
+		})
+		if uerr != nil {
+			return false, uerr
+		}
+		s.record(ctx, sub, models.SubscriptionEventRenewalFailed, plan.Price, err.Error())
+		return false, nil
+	}
+
+	sub.Price, sub.CurrentPeriodStart, sub.CurrentPeriodEnd = plan.Price, start, end
+	s.record(ctx, sub, models.SubscriptionEventRenewed, plan.Price, "")
+	return true, s.syncUser(ctx, sub.UserID, &end)
+}
+
+func (s *SubscriptionService) end(ctx context.Context, sub *models.Subscription, status, eventType string, now time.Time) error {
+	result, err := s.subscriptionsCollection.UpdateOne(ctx, bson.M{"_id": sub.ID, "status": sub.Status}, bson.M{
+		"$set": bson.M{"status": status, "ended_at": now, "updated_at": now},
+	})
+	if err != nil || result.MatchedCount == 0 {
+		return err
+	}
+	sub.Status, sub.EndedAt = status, &now
+	s.record(ctx, sub, eventType, 0, "")
+	return s.syncUser(ctx, sub.UserID, nil)
+}
+
+// syncUser mirrors the membership onto the user document. until is nil
+// when the user is no longer premium.
+func (s *SubscriptionService) syncUser(ctx context.Context, userID primitive.ObjectID, until *time.Time) error {
+	update := bson.M{"$set": bson.M{"is_premium": true, "premium_until": until, "updated_at": time.Now()}}
+	if until == nil {
+		update = bson.M{
+			"$set":   bson.M{"is_premium": false, "updated_at": time.Now()},
+			"$unset": bson.M{"premium_until": ""},
+		}
+	}
+	_, err := s.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	return err
+}
+
+func (s *SubscriptionService) record(ctx context.Context, sub *models.Subscription, eventType string, amount models.Money, note string) {
+	event := models.SubscriptionEvent{
+		SubscriptionID: sub.ID,
+		UserID:         sub.UserID,
+		Type:           eventType,
+		Plan:           sub.Plan,
+		Amount:         amount,
+		PeriodEnd:      sub.CurrentPeriodEnd,
+		Note:           note,
+		At:             time.Now(),
+	}
+	if _, err := s.eventsCollection.InsertOne(ctx, event); err != nil {
+		log.Printf("Failed to record subscription event for %s: %v", sub.ID.Hex(), err)
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const taxRulesCacheTTL = 5 * time.Minute
+
+const (
+	GoodsPhysical = "physical"
+	GoodsDigital  = "digital"
+)
+
+// TaxService calculates tax from the rules in the tax_rules collection. When
+// the collection holds no active rules the rules loaded from config are used
+// instead. Rules are cached for a few minutes, so edits made through the
+// admin API take effect without a redeploy.
+type TaxService struct {
+	rulesCollection *mongo.Collection
+	fallbackRules   []models.TaxRule
+	defaultCountry  string
+
+	mu       sync.Mutex
+	cached   []models.TaxRule
+	cachedAt time.Time
+}
+
+func NewTaxService(rulesCollection *mongo.Collection, fallbackRules []models.TaxRule, defaultCountry string) *TaxService {
+	return &TaxService{
+		rulesCollection: rulesCollection,
+		fallbackRules:   fallbackRules,
+		defaultCountry:  strings.ToUpper(defaultCountry),
+	}
+}
+
+// LoadTaxRulesFile reads a JSON array of tax rules. An empty path yields no rules.
+func LoadTaxRulesFile(path string) ([]models.TaxRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []models.TaxRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		rules[i].Country = strings.ToUpper(rules[i].Country)
+		rules[i].Region = strings.ToUpper(rules[i].Region)
+		rules[i].IsActive = true
+	}
+	return rules, nil
+}
+
+// Invalidate drops the cached rules after an admin change.
+func (s *TaxService) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cached = nil
+}
+
+func (s *TaxService) rules(ctx context.Context) ([]models.TaxRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Since(s.cachedAt) < taxRulesCacheTTL {
+		return s.cached, nil
+	}
+
+	cursor, err := s.rulesCollection.Find(ctx, bson.M{"is_active": true})
+	if err != nil {
+		return nil, err
+	}
+	var rules []models.TaxRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		rules = s.fallbackRules
+	}
+	if rules == nil {
+		rules = []models.TaxRule{}
+	}
+
+	s.cached = rules
+	s.cachedAt = time.Now()
+	return rules, nil
+}
+
+// Calculate returns the tax for the quote lines delivered to address. The
+// order-level discount is spread over the lines proportionally before tax is
+// applied. Without an address the configured default country is used.
+func (s *TaxService) Calculate(ctx context.Context, address *models.Address, lines []models.PriceLine, subtotal, discount models.Money) ([]models.TaxLine, models.Money, error) {
+	country, region := s.defaultCountry, ""
+	if address != nil {
+		country, region = address.Country, address.Region
+	}
+	if country == "" || subtotal <= 0 {
+		return []models.TaxLine{}, 0, nil
+	}
+
+	rules, err := s.rules(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	rule, ok := matchTaxRule(rules, country, region)
+	if !ok {
+		return []models.TaxLine{}, 0, nil
+	}
+
+	taxable := map[string]models.Money{}
+	for _, line := range lines {
+		taxable[GoodsCategory(line.FormatType)] += line.Total
+	}
+
+	var taxLines []models.TaxLine
+	var total models.Money
+	for _, category := range []string{GoodsPhysical, GoodsDigital} {
+		gross, ok := taxable[category]
+		if !ok {
+			continue
+		}
+		net := gross - models.Money(int64(discount)*int64(gross)/int64(subtotal))
+		rate := rule.PhysicalRate
+		if category == GoodsDigital {
+			rate = rule.DigitalRate
+		}
+		amount := net.Percent(rate)
+		if amount <= 0 {
+			continue
+		}
+		taxLines = append(taxLines, models.TaxLine{
+			Name:          rule.Name,
+			GoodsCategory: category,
+			Rate:          rate,
+			Taxable:       net,
+			Amount:        amount,
+		})
+		total += amount
+	}
+	if taxLines == nil {
+		taxLines = []models.TaxLine{}
+	}
+	return taxLines, total, nil
+}
+
+// GoodsCategory maps a book format to the tax class it falls under. Bundles
+// that include a physical copy are taxed as physical goods; rentals are
+// digital.
+func GoodsCategory(formatType string) string {
+	if formatType == "digital" || formatType == "rental" {
+		return GoodsDigital
+	}
+	return GoodsPhysical
+}
+
+func matchTaxRule(rules []models.TaxRule, country, region string) (models.TaxRule, bool) {
+	var countryRule *models.TaxRule
+	for i, r := range rules {
+		if !strings.EqualFold(r.Country, country) {
+			continue
+		}
+		if r.Region != "" && strings.EqualFold(r.Region, region) {
+			return r, true
+		}
+		if r.Region == "" && countryRule == nil {
+			countryRule = &rules[i]
+		}
+	}
+	if countryRule != nil {
+		return *countryRule, true
+	}
+	return models.TaxRule{}, false
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestTaxService returns a TaxService whose rules are already cached, so
+// Calculate never reaches the database.
+func newTestTaxService(rules []models.TaxRule, defaultCountry string) *TaxService {
+	s := NewTaxService(nil, nil, defaultCountry)
+	s.cached = rules
+	s.cachedAt = time.Now()
+	return s
+}
+
+func TestTaxServiceCalculate(t *testing.T) {
+	s := newTestTaxService([]models.TaxRule{
+		{Country: "DE", Name: "MwSt", PhysicalRate: 0.07, DigitalRate: 0.19},
+		{Country: "US", Name: "No sales tax"},
+		{Country: "US", Region: "NY", Name: "NY sales tax", PhysicalRate: 0.08, DigitalRate: 0.08},
+	}, "DE")
+
+	physical := models.PriceLine{FormatType: "physical", Quantity: 2, Total: 3000}
+	digital := models.PriceLine{FormatType: "digital", Quantity: 1, Total: 1000}
+	rental := models.PriceLine{FormatType: "rental", Quantity: 1, Total: 500}
+
+	tests := []struct {
+		name      string
+		address   *models.Address
+		lines     []models.PriceLine
+		discount  models.Money
+		wantLines []models.TaxLine
+		wantTotal models.Money
+	}{
+		{
+			name:    "physical and digital at their own rates",
+			address: &models.Address{Country: "DE"},
+			lines:   []models.PriceLine{physical, digital},
+			wantLines: []models.TaxLine{
+				{Name: "MwSt", GoodsCategory: GoodsPhysical, Rate: 0.07, Taxable: 3000, Amount: 210},
+				{Name: "MwSt", GoodsCategory: GoodsDigital, Rate: 0.19, Taxable: 1000, Amount: 190},
+			},
+			wantTotal: 400,
+		},
+		{
+			name:     "discount spread over the categories proportionally",
+			address:  &models.Address{Country: "DE"},
+			lines:    []models.PriceLine{physical, digital},
+			discount: 1000,
+			wantLines: []models.TaxLine{
+				{Name: "MwSt", GoodsCategory: GoodsPhysical, Rate: 0.07, Taxable: 2250, Amount: 158},
+				{Name: "MwSt", GoodsCategory: GoodsDigital, Rate: 0.19, Taxable: 750, Amount: 143},
+			},
+			wantTotal: 301,
+		},
+		{
+			name:    "rentals are digital goods",
+			address: &models.Address{Country: "DE"},
+			lines:   []models.PriceLine{digital, rental},
+			wantLines: []models.TaxLine{
+				{Name: "MwSt", GoodsCategory: GoodsDigital, Rate: 0.19, Taxable: 1500, Amount: 285},
+			},
+			wantTotal: 285,
+		},
+		{
+			name:  "default country without an address",
+			lines: []models.PriceLine{physical},
+			wantLines: []models.TaxLine{
+				{Name: "MwSt", GoodsCategory: GoodsPhysical, Rate: 0.07, Taxable: 3000, Amount: 210},
+			},
+			wantTotal: 210,
+		},
+		{
+			name:    "region rule before the country rule",
+			address: &models.Address{Country: "us", Region: "ny"},
+			lines:   []models.PriceLine{physical},
+			wantLines: []models.TaxLine{
+				{Name: "NY sales tax", GoodsCategory: GoodsPhysical, Rate: 0.08, Taxable: 3000, Amount: 240},
+			},
+			wantTotal: 240,
+		},
+		{
+			name:      "zero rate country rule",
+			address:   &models.Address{Country: "US", Region: "OR"},
+			lines:     []models.PriceLine{physical},
+			wantLines: []models.TaxLine{},
+		},
+		{
+			name:      "country without a rule",
+			address:   &models.Address{Country: "FR"},
+			lines:     []models.PriceLine{physical},
+			wantLines: []models.TaxLine{},
+		},
+		{
+			name:      "empty basket",
+			address:   &models.Address{Country: "DE"},
+			wantLines: []models.TaxLine{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var subtotal models.Money
+			for _, line := range tt.lines {
+				subtotal += line.Total
+			}
+			lines, total, err := s.Calculate(context.Background(), tt.address, tt.lines, subtotal, tt.discount)
+			if err != nil {
+				t.Fatalf("Calculate() error = %v", err)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("Calculate() total = %d, want %d", total, tt.wantTotal)
+			}
+			if len(lines) != len(tt.wantLines) {
+				t.Fatalf("Calculate() lines = %+v, want %+v", lines, tt.wantLines)
+			}
+			for i := range lines {
+				if lines[i] != tt.wantLines[i] {
+					t.Errorf("Calculate() line %d = %+v, want %+v", i, lines[i], tt.wantLines[i])
+				}
+			}
+		})
+	}
+}
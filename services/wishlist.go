@@ -0,0 +1,120 @@
+package services
+
+import (
+	"bookstore/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotInWishlist = errors.New("book is not in the wishlist")
+	ErrWishlistFull  = errors.New("wishlist is full")
+)
+
+// MaxWishlistItems caps the size of a wishlist.
+const MaxWishlistItems = 500
+
+// WishlistService keeps the books users would like to have. Wishlists feed
+// the personal recommendations.
+type WishlistService struct {
+	wishlistCollection *mongo.Collection
+	booksCollection    *mongo.Collection
+}
+
+func NewWishlistService(wishlistCollection, booksCollection *mongo.Collection) *WishlistService {
+	return &WishlistService{
+		wishlistCollection: wishlistCollection,
+		booksCollection:    booksCollection,
+	}
+}
+
+// Add puts a book on a user's wishlist. Adding a book that is already
+// there does nothing.
+func (s *WishlistService) Add(ctx context.Context, userID, bookID primitive.ObjectID) error {
+	count, err := s.booksCollection.CountDocuments(ctx, bson.M{"_id": bookID, "deleted_at": nil})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrBookNotFound
+	}
+	count, err = s.wishlistCollection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return err
+	}
+	if count >= MaxWishlistItems {
+		return ErrWishlistFull
+	}
+
+	_, err = s.wishlistCollection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "book_id": bookID},
+		bson.M{"$setOnInsert": bson.M{"added_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// added by a concurrent request
+		return nil
+	}
+	return err
+}
+
+func (s *WishlistService) Remove(ctx context.Context, userID, bookID primitive.ObjectID) error {
+	result, err := s.wishlistCollection.DeleteOne(ctx, bson.M{"user_id": userID, "book_id": bookID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotInWishlist
+	}
+	return nil
+}
+
+// List returns a user's wishlist, most recently added first. Books that
+// have been deleted are left out.
+func (s *WishlistService) List(ctx context.Context, userID primitive.ObjectID) ([]models.WishlistBook, error) {
+	cursor, err := s.wishlistCollection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "added_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var items []models.WishlistItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(items))
+	for i, item := range items {
+		ids[i] = item.BookID
+	}
+	links, err := bookLinks(ctx, s.booksCollection, ids)
+	if err != nil {
+		return nil, err
+	}
+	books := []models.WishlistBook{}
+	for _, item := range items {
+		if link, ok := links[item.BookID]; ok {
+			books = append(books, models.WishlistBook{BookLink: link, AddedAt: item.AddedAt})
+		}
+	}
+	return books, nil
+}
+
+// distinctIDs returns the distinct ObjectID values of a field.
+func distinctIDs(ctx context.Context, collection *mongo.Collection, field string, filter bson.M) ([]primitive.ObjectID, error) {
+	values, err := collection.Distinct(ctx, field, filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}